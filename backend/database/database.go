@@ -7,6 +7,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -411,11 +412,20 @@ func GetDatabaseStats(ctx context.Context) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to get database stats: %v", err)
 	}
 
+	// Cluster gossip fields are not statistics
+	for key := range result {
+		if strings.HasPrefix(key, "$") || key == "operationTime" || key == "ok" {
+			delete(result, key)
+		}
+	}
+
 	log.Println("✅ [DEBUG] Database stats retrieved")
 	return result, nil
 }
 
-// GetCollectionStats returns statistics for a specific collection
+// GetCollectionStats returns statistics for a specific collection. The document count only needs
+// read access; sizes come from collStats, and when that is refused the count is still returned
+// with the reason under stats_error.
 func GetCollectionStats(ctx context.Context, collectionName string) (map[string]interface{}, error) {
 	log.Printf("🔍 [DEBUG] GetCollectionStats(%s) called", collectionName)
 	collection := GetCollection(collectionName)
@@ -435,6 +445,23 @@ func GetCollectionStats(ctx context.Context, collectionName string) (map[string]
 		"database":       DB.Name(),
 	}
 
+	var sizes struct {
+		Size           int64 `bson:"size"`
+		StorageSize    int64 `bson:"storageSize"`
+		TotalIndexSize int64 `bson:"totalIndexSize"`
+		IndexCount     int64 `bson:"nindexes"`
+	}
+	err = DB.RunCommand(ctx, bson.D{{Key: "collStats", Value: collectionName}}).Decode(&sizes)
+	if err != nil {
+		log.Printf("⚠️ [DEBUG] collStats(%s) unavailable: %v", collectionName, err)
+		stats["stats_error"] = err.Error()
+	} else {
+		stats["size_bytes"] = sizes.Size
+		stats["storage_size_bytes"] = sizes.StorageSize
+		stats["index_size_bytes"] = sizes.TotalIndexSize
+		stats["index_count"] = sizes.IndexCount
+	}
+
 	log.Printf("✅ [DEBUG] Collection stats retrieved: %d documents", count)
 	return stats, nil
 }
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// criticalIndexes are the unique indexes the services depend on to reject duplicates. They match
+// the definitions in scripts/init.go, which creates the full set including lookup indexes.
+var criticalIndexes = map[string][]mongo.IndexModel{
+	"customers": {
+		{
+			Keys:    bson.D{{Key: "meter_number", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("meter_number_unique"),
+		},
+	},
+	"meter_readings": {
+		{
+			Keys: bson.D{
+				{Key: "meter_number", Value: 1},
+				{Key: "month", Value: 1},
+				{Key: "year", Value: 1},
+			},
+			Options: options.Index().SetUnique(true).SetName("meter_month_year_unique"),
+		},
+	},
+	"bills": {
+		{
+			Keys:    bson.D{{Key: "bill_number", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("bill_number_unique"),
+		},
+	},
+	"payments": {
+		{
+			Keys:    bson.D{{Key: "transaction_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true).SetName("transaction_id_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "receipt_number", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true).SetName("receipt_number_unique"),
+		},
+	},
+	"users": {
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("username_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("email_unique"),
+		},
+	},
+}
+
+// EnsureIndexes creates any critical index that is missing, so a deploy that never ran the init
+// script still enforces uniqueness. Indexes already present are left alone. Every collection is
+// attempted; the returned error lists the ones that failed, for example because existing data
+// already has duplicates.
+func EnsureIndexes() error {
+	if DB == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var failed []string
+	for name, indexes := range criticalIndexes {
+		if err := ensureCollectionIndexes(ctx, DB.Collection(name), indexes); err != nil {
+			log.Printf("❌ Indexes on %s: %v", name, err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to ensure indexes on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func ensureCollectionIndexes(ctx context.Context, collection *mongo.Collection, indexes []mongo.IndexModel) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %v", err)
+	}
+	var existing []bson.M
+	if err = cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("failed to decode indexes: %v", err)
+	}
+
+	present := make(map[string]bool, len(existing))
+	for _, index := range existing {
+		if name, ok := index["name"].(string); ok {
+			present[name] = true
+		}
+	}
+
+	missing, found := missingIndexes(indexes, present)
+	for _, name := range found {
+		log.Printf("✓ Index %s.%s present", collection.Name(), name)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	created, err := collection.Indexes().CreateMany(ctx, missing)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes: %v", err)
+	}
+	for _, name := range created {
+		log.Printf("🆕 Index %s.%s created", collection.Name(), name)
+	}
+	return nil
+}
+
+// missingIndexes splits indexes into those not in present and the names of those that are
+func missingIndexes(indexes []mongo.IndexModel, present map[string]bool) ([]mongo.IndexModel, []string) {
+	var missing []mongo.IndexModel
+	var found []string
+	for _, index := range indexes {
+		name := *index.Options.Name
+		if present[name] {
+			found = append(found, name)
+			continue
+		}
+		missing = append(missing, index)
+	}
+	return missing, found
+}
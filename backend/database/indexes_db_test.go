@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestPaymentsWithoutTransactionIDAreNotDuplicates needs MONGODB_TEST_URI, as in the services tests
+func TestPaymentsWithoutTransactionIDAreNotDuplicates(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set; skipping test that needs MongoDB")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	db := client.Database("waterbilling_test_" + primitive.NewObjectID().Hex())
+	defer func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	}()
+
+	payments := db.Collection("payments")
+	if err := ensureCollectionIndexes(ctx, payments, criticalIndexes["payments"]); err != nil {
+		t.Fatalf("ensureCollectionIndexes: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		payment := models.Payment{Amount: 100, PaymentMethod: "cash", ReceiptNumber: primitive.NewObjectID().Hex()}
+		if _, err := payments.InsertOne(ctx, payment); err != nil {
+			t.Fatalf("cash payment %d: %v", i+1, err)
+		}
+	}
+}
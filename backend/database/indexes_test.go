@@ -0,0 +1,47 @@
+package database
+
+import "testing"
+
+func TestMissingIndexes(t *testing.T) {
+	indexes := criticalIndexes["users"]
+
+	missing, found := missingIndexes(indexes, map[string]bool{"_id_": true, "username_unique": true})
+	if len(found) != 1 || found[0] != "username_unique" {
+		t.Errorf("found = %v, want [username_unique]", found)
+	}
+	if len(missing) != 1 || *missing[0].Options.Name != "email_unique" {
+		t.Fatalf("missing = %d indexes, want only email_unique", len(missing))
+	}
+
+	if missing, _ := missingIndexes(indexes, map[string]bool{}); len(missing) != len(indexes) {
+		t.Errorf("fresh collection: %d missing, want all %d", len(missing), len(indexes))
+	}
+}
+
+func TestCriticalIndexesAreNamedAndUnique(t *testing.T) {
+	for collection, indexes := range criticalIndexes {
+		for _, index := range indexes {
+			if index.Options == nil || index.Options.Name == nil {
+				t.Errorf("%s: index without a name", collection)
+				continue
+			}
+			if index.Options.Unique == nil || !*index.Options.Unique {
+				t.Errorf("%s.%s is not unique", collection, *index.Options.Name)
+			}
+		}
+	}
+}
+
+func TestPhoneIndexFollowsSharedPhoneSetting(t *testing.T) {
+	t.Setenv("ALLOW_SHARED_PHONE", "")
+	index := PhoneIndex()
+	if *index.Options.Name != "phone_number_unique" || index.Options.Unique == nil || !*index.Options.Unique {
+		t.Errorf("default phone index = %s, want unique phone_number_unique", *index.Options.Name)
+	}
+
+	t.Setenv("ALLOW_SHARED_PHONE", "true")
+	index = PhoneIndex()
+	if *index.Options.Name != "phone_number_index" || index.Options.Unique != nil {
+		t.Errorf("shared phone index = %s, want non-unique phone_number_index", *index.Options.Name)
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Customer phone numbers are unique by default. ALLOW_SHARED_PHONE=true lets one number be on
+// several customers, for a landlord with a meter per unit, and swaps the unique index for a
+// plain one so lookups by phone stay indexed.
+const (
+	phoneIndexUnique = "phone_number_unique"
+	phoneIndexShared = "phone_number_index"
+)
+
+// AllowSharedPhone reports whether ALLOW_SHARED_PHONE permits customers to share a phone number
+func AllowSharedPhone() bool {
+	allowed, _ := strconv.ParseBool(os.Getenv("ALLOW_SHARED_PHONE"))
+	return allowed
+}
+
+// PhoneIndexName is the name of the customers phone index for the current setting
+func PhoneIndexName() string {
+	if AllowSharedPhone() {
+		return phoneIndexShared
+	}
+	return phoneIndexUnique
+}
+
+// PhoneIndex is the customers phone index for the current setting
+func PhoneIndex() mongo.IndexModel {
+	opts := options.Index().SetName(PhoneIndexName())
+	if !AllowSharedPhone() {
+		opts.SetUnique(true)
+	}
+	return mongo.IndexModel{Keys: bson.D{{Key: "phone_number", Value: 1}}, Options: opts}
+}
+
+// MigratePhoneIndex brings the customers phone index in line with ALLOW_SHARED_PHONE. The new
+// index is built before the old one is dropped, so phone lookups are never unindexed. Going back
+// to unique phones is refused while any number is still shared, since the build would fail.
+func MigratePhoneIndex() error {
+	if DB == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	customers := DB.Collection("customers")
+	target := PhoneIndexName()
+	old := phoneIndexShared
+	if target == phoneIndexShared {
+		old = phoneIndexUnique
+	}
+
+	cursor, err := customers.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list customer indexes: %v", err)
+	}
+	var existing []bson.M
+	if err = cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("failed to decode customer indexes: %v", err)
+	}
+	present := make(map[string]bool, len(existing))
+	for _, index := range existing {
+		if name, ok := index["name"].(string); ok {
+			present[name] = true
+		}
+	}
+
+	if !present[target] {
+		if target == phoneIndexUnique {
+			shared, err := sharedPhones(ctx, customers)
+			if err != nil {
+				return err
+			}
+			if len(shared) > 0 {
+				return fmt.Errorf("cannot make customer phone numbers unique while some are shared (e.g. %s); "+
+					"fix them or set ALLOW_SHARED_PHONE=true", strings.Join(shared, ", "))
+			}
+		}
+
+		if _, err := customers.Indexes().CreateOne(ctx, PhoneIndex()); err != nil {
+			return fmt.Errorf("failed to create %s: %v", target, err)
+		}
+		log.Printf("🆕 Index customers.%s created", target)
+	}
+
+	if present[old] {
+		if _, err := customers.Indexes().DropOne(ctx, old); err != nil {
+			return fmt.Errorf("failed to drop %s: %v", old, err)
+		}
+		log.Printf("🗑️ Index customers.%s dropped", old)
+	}
+
+	return nil
+}
+
+// sharedPhones returns up to five phone numbers that are on more than one customer
+func sharedPhones(ctx context.Context, customers *mongo.Collection) ([]string, error) {
+	cursor, err := customers.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$phone_number", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 5}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for shared phone numbers: %v", err)
+	}
+
+	var groups []struct {
+		Phone string `bson:"_id"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode shared phone numbers: %v", err)
+	}
+
+	phones := make([]string, len(groups))
+	for i, group := range groups {
+		phones[i] = group.Phone
+	}
+	return phones, nil
+}
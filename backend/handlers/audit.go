@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"strconv"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// recordAudit stores entry with the authenticated caller as the actor, unless the entry names
+// one already, and the caller's IP
+func recordAudit(c *gin.Context, auditService *services.AuditService, entry models.AuditLog) {
+	if entry.ActorID == "" {
+		entry.ActorID = c.GetString("userID")
+		entry.ActorName = c.GetString("username")
+		entry.ActorRole = c.GetString("userRole")
+	}
+	entry.IPAddress = c.ClientIP()
+
+	auditService.Record(c.Request.Context(), entry)
+}
+
+// GetAuditLogs lists audit entries, newest first.
+// Filters: action, actor (user ID), target (entity ID) and from/to (YYYY-MM-DD, inclusive).
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	filter := bson.M{}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if actor := c.Query("actor"); actor != "" {
+		filter["actor_id"] = actor
+	}
+	if target := c.Query("target"); target != "" {
+		filter["target_id"] = target
+	}
+
+	dateRange := bson.M{}
+	if v := c.Query("from"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid from date, use YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$gte"] = date
+	}
+	if v := c.Query("to"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid to date, use YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$lt"] = date.AddDate(0, 0, 1) // Include the whole end day
+	}
+	if len(dateRange) > 0 {
+		filter["created_at"] = dateRange
+	}
+
+	entries, total, err := h.auditService.ListAuditLogs(c.Request.Context(), filter, page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch audit logs", err)
+		return
+	}
+
+	SuccessResponse(c, "Audit logs retrieved", gin.H{
+		"entries":     entries,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
+// paymentAuditEntry describes a newly recorded payment
+func paymentAuditEntry(payment *models.Payment) models.AuditLog {
+	return models.AuditLog{
+		Action:     "payment.record",
+		TargetType: "payment",
+		TargetID:   payment.ID.Hex(),
+		After: map[string]interface{}{
+			"bill_id":        payment.BillID.Hex(),
+			"meter_number":   payment.MeterNumber,
+			"amount":         payment.Amount,
+			"payment_method": payment.PaymentMethod,
+			"receipt_number": payment.ReceiptNumber,
+			"transaction_id": payment.TransactionID,
+		},
+	}
+}
@@ -1,14 +1,16 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"waterbilling/backend/models"
 	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,28 +18,37 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// dummyPasswordHash is checked for unknown usernames so they take as long to reject as a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("no-such-user"), bcrypt.DefaultCost)
+
 type AuthHandler struct {
-	userService *services.UserService
-	jwtService  *services.JWTService
+	userService  *services.UserService
+	jwtService   *services.JWTService
+	resetService *services.PasswordResetService
+	auditService *services.AuditService
 }
 
-func NewAuthHandler(userService *services.UserService, jwtService *services.JWTService) *AuthHandler {
+func NewAuthHandler(userService *services.UserService, jwtService *services.JWTService,
+	resetService *services.PasswordResetService, auditService *services.AuditService) *AuthHandler {
 	return &AuthHandler{
-		userService: userService,
-		jwtService:  jwtService,
+		userService:  userService,
+		jwtService:   jwtService,
+		resetService: resetService,
+		auditService: auditService,
 	}
 }
 
 // Login handles user authentication
 // @Summary User login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user and return an access token and a refresh token
 // @Tags Authentication
 // @Accept json
 // @Produce json
 // @Param credentials body LoginRequest true "Login credentials"
 // @Success 200 {object} Response "Login successful"
 // @Failure 400 {object} Response "Invalid credentials"
-// @Failure 401 {object} Response "Unauthorized"
+// @Failure 401 {object} Response "Invalid credentials, including while the account is locked"
+// @Failure 403 {object} Response "Account is deactivated"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /auth/login [post]
 // Login handles user authentication
@@ -55,11 +66,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Get user by username
-	user, err := h.userService.GetUserByUsername(req.Username)
+	user, err := h.userService.GetUserByUsername(c.Request.Context(), req.Username)
 	if err != nil {
 		// Check if it's a "not found" error
 		if err.Error() == "mongo: no documents in result" ||
 			err.Error() == "user not found" {
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
 			Unauthorized(c, "Invalid credentials")
 			return
 		}
@@ -69,30 +81,44 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// IMPORTANT: Check if user is nil
 	if user == nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
 		Unauthorized(c, "Invalid credentials")
 		return
 	}
 
-	// Check if user is active
-	if !user.IsActive {
-		Forbidden(c, "Account is deactivated")
+	// A locked account answers like an unknown one, so a lockout does not reveal that the
+	// username exists. The password is not checked, but the hash still is to keep the timing.
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		Unauthorized(c, "Invalid credentials")
 		return
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		if _, lockErr := h.userService.RecordFailedLogin(c.Request.Context(), user.ID); lockErr != nil {
+			log.Printf("⚠️ Failed to record failed login: %v", lockErr)
+		}
 		Unauthorized(c, "Invalid credentials")
 		return
 	}
 
-	// Update last login
+	// Only someone who knows the password learns the account is deactivated
+	if !user.IsActive {
+		Forbidden(c, "Account is deactivated")
+		return
+	}
+
+	// Update last login and clear any failed attempts
 	now := time.Now()
 	user.LastLogin = &now
-	if err := h.userService.UpdateUser(user.ID.Hex(), map[string]interface{}{
-		"last_login": now,
+	if err := h.userService.UpdateUser(c.Request.Context(), user.ID.Hex(), map[string]interface{}{
+		"last_login":            now,
+		"failed_login_attempts": 0,
+		"locked_until":          nil,
 	}); err != nil {
 		// Log error but continue with login
-		fmt.Printf("Failed to update last login: %v\n", err)
+		log.Printf("⚠️ Failed to update last login: %v", err)
 	}
 
 	// Generate JWT token
@@ -102,27 +128,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Return user info (excluding password) and token
-	userResponse := UserResponse{
-		ID:          user.ID.Hex(),
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Email:       user.Email,
-		Username:    user.Username,
-		PhoneNumber: user.PhoneNumber,
-		Role:        user.Role,
-		EmployeeID:  user.EmployeeID,
-		Department:  user.Department,
-		Zone:        user.AssignedZone,
-		IsActive:    user.IsActive,
-		LastLogin:   user.LastLogin,
-		CreatedAt:   user.CreatedAt,
-		MeterNumber: user.MeterNumber,
+	refreshToken, err := h.jwtService.GenerateRefreshToken(user)
+	if err != nil {
+		InternalServerError(c, "Failed to generate refresh token", err)
+		return
 	}
 
+	// Return user info (excluding password) and token. After an admin reset the token only
+	// allows changing the password; must_change_password tells the app to ask for one.
 	response := gin.H{
-		"user":  userResponse,
-		"token": token,
+		"user":          newUserResponse(user),
+		"token":         token,
+		"refresh_token": refreshToken,
 	}
 
 	SuccessResponse(c, "Login successful", response)
@@ -140,9 +157,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 // @Failure 403 {object} Response "Forbidden"
 // @Failure 409 {object} Response "User already exists"
 // @Failure 500 {object} Response "Internal server error"
-// @Router /auth/register [post]
-// Register handles new user registration
-// Register handles new user registration (admin only)
+// @Router /users [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -171,6 +186,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if err := utils.ValidatePassword(req.Password, req.Username, req.Email); err != nil {
+		BadRequest(c, "Password does not meet requirements", err)
+		return
+	}
+
 	// Validate role
 	validRoles := map[string]bool{
 		"admin":            true,
@@ -185,6 +205,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// Admins get every permission unless they are given an explicit list
+	if req.Role == "admin" && len(req.Permissions) == 0 {
+		req.Permissions = []string{"*"}
+	}
+
 	// Create user model
 	user := &models.User{
 		FirstName:    req.FirstName,
@@ -197,17 +222,16 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Department:   req.Department,
 		AssignedZone: req.Zone,
 		MeterNumber:  req.MeterNumber, // ✅ Make sure this is included
+		Permissions:  req.Permissions,
 		IsActive:     true,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
 	// Create user
-	if err := h.userService.CreateUser(user, req.Password); err != nil {
-		if err.Error() == "user with username "+req.Username+" already exists" {
-			ErrorResponse(c, http.StatusConflict, "User already exists", err)
-		} else if err.Error() == "user with email "+req.Email+" already exists" {
-			ErrorResponse(c, http.StatusConflict, "Email already registered", err)
+	if err := h.userService.CreateUser(c.Request.Context(), user, req.Password); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			Conflict(c, err)
 		} else {
 			InternalServerError(c, "Failed to register user", err)
 		}
@@ -228,6 +252,17 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		CreatedAt:   user.CreatedAt,
 	}
 
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.create",
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		After: map[string]interface{}{
+			"username":    user.Username,
+			"role":        user.Role,
+			"permissions": user.Permissions,
+		},
+	})
+
 	CreatedResponse(c, "User registered successfully", userResponse)
 }
 
@@ -249,13 +284,49 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetUserByID(userID.(string))
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID.(string))
 	if err != nil {
 		Unauthorized(c, "User not found")
 		return
 	}
 
-	userResponse := UserResponse{
+	SuccessResponse(c, "Profile retrieved", newUserResponse(user))
+}
+
+// GetUser gets a single user
+// @Summary Get user
+// @Description Get a user by ID (admin only)
+// @Tags Users
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} Response "User retrieved"
+// @Failure 400 {object} Response "Invalid user ID"
+// @Failure 404 {object} Response "User not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /users/{id} [get]
+func (h *AuthHandler) GetUser(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		BadRequest(c, "Invalid user ID format", err)
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			NotFound(c, "User not found")
+		} else {
+			InternalServerError(c, "Failed to fetch user", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "User retrieved", newUserResponse(user))
+}
+
+// newUserResponse is the API view of a user
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
 		ID:          user.ID.Hex(),
 		FirstName:   user.FirstName,
 		LastName:    user.LastName,
@@ -270,9 +341,154 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		LastLogin:   user.LastLogin,
 		CreatedAt:   user.CreatedAt,
 		MeterNumber: user.MeterNumber,
+
+		PasswordExpired:    user.PasswordExpired(services.PasswordMaxAge()),
+		MustChangePassword: user.MustChangePassword,
 	}
+}
 
-	SuccessResponse(c, "Profile retrieved", userResponse)
+// ResetUserPassword sets a new password for a user who cannot log in
+// @Summary Reset a user's password
+// @Description Set a user's password (admin only). Without new_password a temporary one is generated and returned once. The user must change it at their next login and their open sessions are revoked
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body ResetUserPasswordRequest false "New password"
+// @Success 200 {object} Response "Password reset"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "User not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /users/{id}/reset-password [post]
+func (h *AuthHandler) ResetUserPassword(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		BadRequest(c, "Invalid user ID format", err)
+		return
+	}
+
+	var req ResetUserPasswordRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, "Invalid request body", err)
+			return
+		}
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		if err.Error() == "user not found" {
+			NotFound(c, "User not found")
+		} else {
+			InternalServerError(c, "Failed to fetch user", err)
+		}
+		return
+	}
+
+	password := req.NewPassword
+	generated := password == ""
+	if generated {
+		if password, err = services.GenerateTemporaryPassword(); err != nil {
+			InternalServerError(c, "Failed to generate password", err)
+			return
+		}
+	} else if err := utils.ValidatePassword(password, user.Username, user.Email); err != nil {
+		BadRequest(c, "Password does not meet requirements", err)
+		return
+	}
+
+	if err := h.userService.ResetPassword(c.Request.Context(), id, password); err != nil {
+		InternalServerError(c, "Failed to reset password", err)
+		return
+	}
+	if err := h.jwtService.RevokeUserTokens(c.Request.Context(), id); err != nil {
+		InternalServerError(c, "Password reset but the user's sessions could not be revoked", err)
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.password_reset",
+		TargetType: "user",
+		TargetID:   id,
+		Details:    "reset by admin; change required at next login",
+	})
+
+	data := gin.H{"must_change_password": true}
+	if generated {
+		// Shown once; only the hash is stored
+		data["temporary_password"] = password
+	}
+	SuccessResponse(c, "Password reset successfully", data)
+}
+
+// ForgotPassword texts a password reset code to the phone on the account
+// @Summary Forgot password
+// @Description Send a password reset code by SMS. The response is the same whether or not the account exists
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Username"
+// @Success 200 {object} Response "Code sent if the account exists"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Username is required", err)
+		return
+	}
+
+	if err := h.resetService.RequestReset(c.Request.Context(), req.Username); err != nil {
+		InternalServerError(c, "Failed to send reset code", err)
+		return
+	}
+
+	SuccessResponse(c, "If the account exists, a reset code has been sent to its phone number", nil)
+}
+
+// ResetForgottenPassword sets a new password using a code from ForgotPassword
+// @Summary Reset forgotten password
+// @Description Set a new password with the code sent by SMS. Existing sessions are revoked
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body ResetForgottenPasswordRequest true "Username, code and new password"
+// @Success 200 {object} Response "Password reset"
+// @Failure 400 {object} Response "Invalid input or code"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetForgottenPassword(c *gin.Context) {
+	var req ResetForgottenPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Username, code and new password are required", err)
+		return
+	}
+
+	user, err := h.resetService.ResetWithCode(c.Request.Context(), req.Username, req.Code, req.NewPassword)
+	if err != nil {
+		switch {
+		case err.Error() == "invalid or expired code":
+			BadRequest(c, "Invalid or expired code", nil)
+		case strings.HasPrefix(err.Error(), "password must"):
+			BadRequest(c, "New password does not meet requirements", err)
+		default:
+			InternalServerError(c, "Failed to reset password", err)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		ActorID:    user.ID.Hex(),
+		ActorName:  user.Username,
+		ActorRole:  user.Role,
+		Action:     "user.password_reset",
+		TargetType: "user",
+		TargetID:   user.ID.Hex(),
+		Details:    "reset with SMS code",
+	})
+
+	SuccessResponse(c, "Password reset successfully. Please log in with your new password", nil)
 }
 
 // Add to handlers/auth.go - inside the AuthHandler struct
@@ -302,7 +518,7 @@ func (h *AuthHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.userService.DeleteUser(id); err != nil {
+	if err := h.userService.DeleteUser(c.Request.Context(), id); err != nil {
 		if err.Error() == "user not found" {
 			NotFound(c, "User not found")
 		} else {
@@ -311,12 +527,18 @@ func (h *AuthHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   id,
+	})
+
 	SuccessResponse(c, "User deleted successfully", nil)
 }
 
 // ToggleUserStatus handles user activation/deactivation
 // @Summary Toggle user status
-// @Description Activate or deactivate a user (admin only)
+// @Description Activate or deactivate a user (admin only). Deactivating revokes the user's tokens
 // @Tags Users
 // @Accept json
 // @Produce json
@@ -326,12 +548,12 @@ func (h *AuthHandler) DeleteUser(c *gin.Context) {
 // @Failure 400 {object} Response "Invalid input"
 // @Failure 404 {object} Response "User not found"
 // @Failure 500 {object} Response "Internal server error"
-// @Router /users/{id}/status [patch]
+// @Router /users/{id}/status [put]
 func (h *AuthHandler) ToggleUserStatus(c *gin.Context) {
 	// Get ID from URL parameter
 	id := c.Param("id")
-	if id == "" {
-		BadRequest(c, "User ID is required", nil)
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		BadRequest(c, "Invalid user ID format", err)
 		return
 	}
 
@@ -341,16 +563,13 @@ func (h *AuthHandler) ToggleUserStatus(c *gin.Context) {
 		BadRequest(c, "Invalid request body", err)
 		return
 	}
-
-	// CONVERT string ID to ObjectID (THIS WAS MISSING)
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		BadRequest(c, "Invalid user ID format", err)
+	active, ok := req.active()
+	if !ok {
+		BadRequest(c, "is_active is required", nil)
 		return
 	}
 
-	// Pass ObjectID to service
-	if err := h.userService.ToggleUserStatus(objectID, req.IsActive); err != nil {
+	if err := h.userService.SetActive(c.Request.Context(), id, active); err != nil {
 		if err.Error() == "user not found" {
 			NotFound(c, "User not found")
 		} else {
@@ -359,16 +578,101 @@ func (h *AuthHandler) ToggleUserStatus(c *gin.Context) {
 		return
 	}
 
+	// A departed employee's open sessions end now, not when their tokens expire
+	if !active {
+		if err := h.jwtService.RevokeUserTokens(c.Request.Context(), id); err != nil {
+			InternalServerError(c, "User deactivated but their sessions could not be revoked", err)
+			return
+		}
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.status",
+		TargetType: "user",
+		TargetID:   id,
+		After:      map[string]interface{}{"is_active": active},
+	})
+
 	status := "activated"
-	if !req.IsActive {
+	if !active {
 		status = "deactivated"
 	}
 	SuccessResponse(c, "User "+status+" successfully", nil)
 }
 
-// Add this type at the bottom of the file
+// SetUserPermissions replaces a user's fine-grained permissions
+// @Summary Set user permissions
+// @Description Replace a user's permissions, e.g. ["payments:reverse"] or ["*"] (admin only). Takes effect at the user's next login
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body SetPermissionsRequest true "Permissions"
+// @Success 200 {object} Response "User permissions updated"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "User not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /users/{id}/permissions [put]
+func (h *AuthHandler) SetUserPermissions(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		BadRequest(c, "Invalid user ID format", err)
+		return
+	}
+
+	var req SetPermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid request body", err)
+		return
+	}
+
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+
+	before, err := h.userService.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		NotFound(c, "User not found")
+		return
+	}
+
+	if err := h.userService.UpdateUser(c.Request.Context(), id, map[string]interface{}{
+		"permissions": req.Permissions,
+		"updated_at":  time.Now(),
+	}); err != nil {
+		if err.Error() == "user not found" {
+			NotFound(c, "User not found")
+		} else {
+			InternalServerError(c, "Failed to update user permissions", err)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.permissions",
+		TargetType: "user",
+		TargetID:   id,
+		Before:     map[string]interface{}{"permissions": before.Permissions},
+		After:      map[string]interface{}{"permissions": req.Permissions},
+	})
+
+	SuccessResponse(c, "User permissions updated", gin.H{"permissions": req.Permissions})
+}
+
+// ToggleStatusRequest activates or deactivates a user or template. The mobile app sends IsActive.
 type ToggleStatusRequest struct {
-	IsActive bool `json:"IsActive" `
+	Active   *bool `json:"is_active"`
+	IsActive *bool `json:"IsActive"`
+}
+
+func (r ToggleStatusRequest) active() (bool, bool) {
+	if r.Active != nil {
+		return *r.Active, true
+	}
+	if r.IsActive != nil {
+		return *r.IsActive, true
+	}
+	return false, false
 }
 
 // UpdateProfile updates current user profile
@@ -418,7 +722,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	// Add updated_at
 	updates["updated_at"] = time.Now()
 
-	if err := h.userService.UpdateUser(userID.(string), updates); err != nil {
+	if err := h.userService.UpdateUser(c.Request.Context(), userID.(string), updates); err != nil {
 		if err.Error() == "user not found" {
 			Unauthorized(c, "User not found")
 		} else if strings.Contains(err.Error(), "already exists") {
@@ -468,35 +772,47 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	if len(req.NewPassword) < 8 {
-		BadRequest(c, "New password must be at least 8 characters", nil)
-		return
-	}
-
 	// Verify current password
-	user, err := h.userService.GetUserByID(userID.(string))
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID.(string))
 	if err != nil {
 		Unauthorized(c, "User not found")
 		return
 	}
 
+	if err := utils.ValidatePassword(req.NewPassword, user.Username, user.Email); err != nil {
+		BadRequest(c, "New password does not meet requirements", err)
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
 		BadRequest(c, "Current password is incorrect", nil)
 		return
 	}
 
 	// Update password
-	if err := h.userService.ChangePassword(userID.(string), req.NewPassword); err != nil {
+	if err := h.userService.ChangePassword(c.Request.Context(), userID.(string), req.NewPassword); err != nil {
 		InternalServerError(c, "Failed to change password", err)
 		return
 	}
 
+	// The audit entry never includes the password itself
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "user.password_change",
+		TargetType: "user",
+		TargetID:   userID.(string),
+	})
+
+	// The token from a forced-change login stays restricted; the user logs in again
+	if user.MustChangePassword {
+		SuccessResponse(c, "Password changed successfully. Please log in again", gin.H{"relogin_required": true})
+		return
+	}
 	SuccessResponse(c, "Password changed successfully", nil)
 }
 
 // RefreshToken refreshes JWT token
 // @Summary Refresh JWT token
-// @Description Refresh expired JWT token
+// @Description Exchange a refresh token issued at login for a new access token carrying the user's current role, permissions and zone
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -504,6 +820,7 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 // @Success 200 {object} Response "Token refreshed successfully"
 // @Failure 400 {object} Response "Invalid token"
 // @Failure 401 {object} Response "Unauthorized"
+// @Failure 403 {object} Response "Account is deactivated"
 // @Router /auth/refresh-token [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req RefreshTokenRequest
@@ -517,13 +834,29 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate and refresh token
-	token, err := h.jwtService.RefreshToken(req.RefreshToken)
+	claims, err := h.jwtService.ValidateRefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
 		Unauthorized(c, "Invalid or expired refresh token")
 		return
 	}
 
+	// Issue from the stored user, not the old claims, so role and zone changes take effect
+	user, err := h.userService.GetUserByID(c.Request.Context(), claims.UserID)
+	if err != nil {
+		Unauthorized(c, "Invalid or expired refresh token")
+		return
+	}
+	if !user.IsActive {
+		Forbidden(c, "Account is deactivated")
+		return
+	}
+
+	token, err := h.jwtService.GenerateToken(user)
+	if err != nil {
+		InternalServerError(c, "Failed to generate token", err)
+		return
+	}
+
 	response := gin.H{
 		"token": token,
 	}
@@ -533,41 +866,95 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 // Logout handles user logout
 // @Summary User logout
-// @Description Logout user (client should discard token)
+// @Description Logout user by revoking the presented token and, when given, the refresh token issued with it
 // @Tags Authentication
 // @Accept json
 // @Produce json
+// @Param request body LogoutRequest false "Refresh token to revoke"
 // @Success 200 {object} Response "Logout successful"
-// @Router /auth/logout [post]
+// @Failure 400 {object} Response "Invalid refresh token"
+// @Failure 401 {object} Response "Not authenticated"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /profile/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In JWT, logout is handled client-side by discarding the token
-	// We could implement token blacklisting if needed
+	token, exists := c.Get("token")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	// The body is optional; clients without a stored refresh token send none
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, "Invalid request", err)
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		// Only the caller's own refresh token may be revoked this way
+		claims, err := h.jwtService.ValidateToken(req.RefreshToken)
+		if err != nil || claims.TokenType != services.TokenTypeRefresh || claims.UserID != c.GetString("userID") {
+			BadRequest(c, "Invalid refresh token", err)
+			return
+		}
+		if err := h.jwtService.RevokeToken(c.Request.Context(), req.RefreshToken); err != nil {
+			InternalServerError(c, "Failed to log out", err)
+			return
+		}
+	}
+
+	if err := h.jwtService.RevokeToken(c.Request.Context(), token.(string)); err != nil {
+		InternalServerError(c, "Failed to log out", err)
+		return
+	}
+
 	SuccessResponse(c, "Logout successful", nil)
 }
 
-// GetUsers returns all users (admin only)
-// GetUsers returns all users (admin only)
+// GetUsers returns users matching the query filters (admin only). search matches name, email
+// or username; active, role and zone filter exactly; sort is a field, "-" prefixed for descending.
 func (h *AuthHandler) GetUsers(c *gin.Context) {
 	// Parse query parameters
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
-	role := c.Query("role")
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
 
-	// Build filter
-	filter := bson.M{}
-	if role != "" {
-		filter["role"] = role
+	var active *bool
+	if value := c.Query("active"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			BadRequest(c, "active must be true or false", err)
+			return
+		}
+		active = &parsed
+	}
+
+	sort, ok := parseUserSort(c.Query("sort"))
+	if !ok {
+		BadRequest(c, "Invalid sort field", nil)
+		return
 	}
 
-	// Get users from service (returns 3 values)
-	users, total, err := h.userService.ListUsers(filter, int64(page), int64(limit))
+	filter := userListFilter(strings.TrimSpace(c.Query("search")), c.Query("role"), c.Query("zone"), active)
+
+	users, total, err := h.userService.ListUsers(c.Request.Context(), filter, sort, page, limit)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch users", err)
 		return
 	}
 
 	// Calculate total pages
-	totalPages := (total + int64(limit) - 1) / int64(limit)
+	totalPages := (total + limit - 1) / limit
 
 	SuccessResponse(c, "Users retrieved successfully", gin.H{
 		"users":       users,
@@ -578,6 +965,59 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 	})
 }
 
+// userListFilter builds the users query for GetUsers. search is matched literally.
+func userListFilter(search, role, zone string, active *bool) bson.M {
+	filter := bson.M{}
+	if search != "" {
+		pattern := regexp.QuoteMeta(search)
+		filter["$or"] = []bson.M{
+			{"first_name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"last_name": bson.M{"$regex": pattern, "$options": "i"}},
+			{"email": bson.M{"$regex": pattern, "$options": "i"}},
+			{"username": bson.M{"$regex": pattern, "$options": "i"}},
+		}
+	}
+	if role != "" {
+		filter["role"] = role
+	}
+	if zone != "" {
+		filter["assigned_zone"] = zone
+	}
+	if active != nil {
+		filter["is_active"] = *active
+	}
+	return filter
+}
+
+// userSortFields lists the fields users may be sorted by
+var userSortFields = map[string]bool{
+	"created_at": true,
+	"last_login": true,
+	"first_name": true,
+	"last_name":  true,
+	"username":   true,
+	"role":       true,
+}
+
+// parseUserSort turns "field" or "-field" into a sort document
+func parseUserSort(sort string) (bson.D, bool) {
+	if sort == "" {
+		return nil, true
+	}
+
+	direction := 1
+	if strings.HasPrefix(sort, "-") {
+		direction = -1
+		sort = sort[1:]
+	}
+
+	if !userSortFields[sort] {
+		return nil, false
+	}
+
+	return bson.D{{Key: sort, Value: direction}}, true
+}
+
 // Request/Response DTOs
 
 type LoginRequest struct {
@@ -586,17 +1026,38 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	FirstName   string `json:"first_name" binding:"required"`
-	LastName    string `json:"last_name" binding:"required"`
-	Email       string `json:"email" binding:"required"`
+	FirstName   string   `json:"first_name" binding:"required"`
+	LastName    string   `json:"last_name" binding:"required"`
+	Email       string   `json:"email" binding:"required"`
+	Username    string   `json:"username" binding:"required"`
+	Password    string   `json:"password" binding:"required"`
+	PhoneNumber string   `json:"phone_number,omitempty"`
+	Role        string   `json:"role"`
+	EmployeeID  string   `json:"employee_id,omitempty"`
+	Department  string   `json:"department,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	MeterNumber string   `json:"meter_number,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// ResetUserPasswordRequest optionally gives the password an admin sets for a user
+type ResetUserPasswordRequest struct {
+	NewPassword string `json:"new_password,omitempty"`
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+type ResetForgottenPasswordRequest struct {
 	Username    string `json:"username" binding:"required"`
-	Password    string `json:"password" binding:"required"`
-	PhoneNumber string `json:"phone_number,omitempty"`
-	Role        string `json:"role"`
-	EmployeeID  string `json:"employee_id,omitempty"`
-	Department  string `json:"department,omitempty"`
-	Zone        string `json:"zone,omitempty"`
-	MeterNumber string `json:"meter_number,omitempty"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// SetPermissionsRequest replaces a user's fine-grained permissions
+type SetPermissionsRequest struct {
+	Permissions []string `json:"permissions"`
 }
 
 type UpdateProfileRequest struct {
@@ -616,6 +1077,10 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type UserResponse struct {
 	ID          string     `json:"id"`
 	FirstName   string     `json:"first_name"`
@@ -631,4 +1096,7 @@ type UserResponse struct {
 	LastLogin   *time.Time `json:"last_login,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	MeterNumber string     `json:"meter_number,omitempty"`
+
+	PasswordExpired    bool `json:"password_expired"`               // Prompt the user to choose a new password
+	MustChangePassword bool `json:"must_change_password,omitempty"` // Set after an admin reset; other requests are refused until it is changed
 }
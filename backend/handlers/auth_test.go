@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestToggleStatusRequestActive(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantActive bool
+		wantOK     bool
+	}{
+		{`{"is_active": false}`, false, true},
+		{`{"is_active": true}`, true, true},
+		{`{"IsActive": false}`, false, true}, // As sent by the mobile app
+		{`{}`, false, false},                 // Missing, not a deactivation
+	}
+
+	for _, tt := range tests {
+		var req ToggleStatusRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatalf("%s: %v", tt.body, err)
+		}
+		if active, ok := req.active(); active != tt.wantActive || ok != tt.wantOK {
+			t.Errorf("%s: active() = %v, %v; want %v, %v", tt.body, active, ok, tt.wantActive, tt.wantOK)
+		}
+	}
+}
+
+func TestLogoutRejectsAnotherUsersRefreshToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtService := services.NewJWTService("test-secret", time.Hour, nil)
+	h := &AuthHandler{jwtService: jwtService}
+
+	self := &models.User{ID: primitive.NewObjectID(), Username: "self", Role: "cashier"}
+	other := &models.User{ID: primitive.NewObjectID(), Username: "other", Role: "cashier"}
+	access, err := jwtService.GenerateToken(self)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	otherRefresh, err := jwtService.GenerateRefreshToken(other)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	ownAccess, err := jwtService.GenerateToken(self)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	for name, refresh := range map[string]string{"another user's refresh token": otherRefresh, "an access token": ownAccess} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/profile/logout", strings.NewReader(`{"refresh_token":"`+refresh+`"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("token", access)
+		c.Set("userID", self.ID.Hex())
+
+		h.Logout(c)
+		if w.Code != 400 {
+			t.Errorf("%s: status %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestUserListFilter(t *testing.T) {
+	inactive := false
+	filter := userListFilter("j.doe", "meter_reader", "Zone A", &inactive)
+
+	if filter["is_active"] != false || filter["assigned_zone"] != "Zone A" || filter["role"] != "meter_reader" {
+		t.Errorf("filter = %v", filter)
+	}
+	or, _ := filter["$or"].([]bson.M)
+	if len(or) != 4 {
+		t.Fatalf("$or has %d clauses, want 4", len(or))
+	}
+	if pattern := or[0]["first_name"].(bson.M)["$regex"]; pattern != `j\.doe` {
+		t.Errorf("search pattern = %v, want it escaped", pattern)
+	}
+
+	if filter := userListFilter("", "", "", nil); len(filter) != 0 {
+		t.Errorf("empty query gave filter %v", filter)
+	}
+}
+
+func TestParseUserSort(t *testing.T) {
+	if sort, ok := parseUserSort("-last_login"); !ok || sort[0].Key != "last_login" || sort[0].Value != -1 {
+		t.Errorf("parseUserSort(-last_login) = %v, %v", sort, ok)
+	}
+	if _, ok := parseUserSort("password"); ok {
+		t.Error("sorting by password was allowed")
+	}
+}
@@ -2,6 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,6 +16,8 @@ type Response struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// RequestID is set on errors so users can quote it when reporting a problem
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // SuccessResponse returns a successful API response
@@ -39,13 +45,57 @@ func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
 		errorMsg = err.Error()
 	}
 
+	if statusCode >= http.StatusInternalServerError {
+		utils.Logf(c.Request.Context(), "❌ %s %s: %s: %s", c.Request.Method, c.Request.URL.Path, message, errorMsg)
+	}
+
 	c.JSON(statusCode, Response{
-		Success: false,
-		Message: message,
-		Error:   errorMsg,
+		Success:   false,
+		Message:   message,
+		Error:     errorMsg,
+		RequestID: c.GetString("requestID"),
 	})
 }
 
+// needsMeterScope reports whether the caller's role is limited to particular customers.
+// Customers see only their own meter and readers only their assigned zone; staff roles see everyone.
+func needsMeterScope(c *gin.Context) bool {
+	role, _ := c.Get("userRole")
+	return role == "customer" || role == "reader"
+}
+
+// canAccessCustomer checks a scoped caller against the customer whose records are requested.
+// Readers without an assigned zone are not limited.
+func canAccessCustomer(c *gin.Context, customer *models.Customer) bool {
+	role, _ := c.Get("userRole")
+	switch role {
+	case "customer":
+		meterNumber, _ := c.Get("meterNumber")
+		return meterNumber != "" && meterNumber == customer.MeterNumber
+	case "reader":
+		zone, _ := c.Get("userZone")
+		return zone == "" || zone == customer.Zone
+	default:
+		return true
+	}
+}
+
+// scopedZone returns the zone a list of customers must be limited to. Readers with an assigned
+// zone get it when no zone was asked for and are refused any other; other callers get zone as is.
+func scopedZone(c *gin.Context, zone string) (string, bool) {
+	if role, _ := c.Get("userRole"); role != "reader" {
+		return zone, true
+	}
+	assigned := c.GetString("userZone")
+	if assigned == "" {
+		return zone, true
+	}
+	if zone != "" && zone != assigned {
+		return "", false
+	}
+	return assigned, true
+}
+
 // BadRequest returns a 400 Bad Request response
 func BadRequest(c *gin.Context, message string, err error) {
 	ErrorResponse(c, http.StatusBadRequest, message, err)
@@ -61,6 +111,16 @@ func InternalServerError(c *gin.Context, message string, err error) {
 	ErrorResponse(c, http.StatusInternalServerError, message, err)
 }
 
+// Conflict returns a 409 Conflict response whose message is the service error, such as
+// "Customer with this phone number already exists"
+func Conflict(c *gin.Context, err error) {
+	message := err.Error()
+	if message != "" {
+		message = strings.ToUpper(message[:1]) + message[1:]
+	}
+	ErrorResponse(c, http.StatusConflict, message, err)
+}
+
 // Unauthorized returns a 401 Unauthorized response
 func Unauthorized(c *gin.Context, message string) {
 	ErrorResponse(c, http.StatusUnauthorized, message, nil)
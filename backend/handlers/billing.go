@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,24 +13,36 @@ import (
 	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type BillingHandler struct {
 	billingService *services.BillingService
 	userService    *services.UserService
+	photoStore     services.PhotoStore
+	auditService   *services.AuditService
 }
 
 // Update this function signature to accept userService
-func NewBillingHandler(billingService *services.BillingService, userService *services.UserService) *BillingHandler {
+func NewBillingHandler(billingService *services.BillingService, userService *services.UserService, photoStore services.PhotoStore, auditService *services.AuditService) *BillingHandler {
 	return &BillingHandler{
 		billingService: billingService,
 		userService:    userService, // Now userService is defined
+		photoStore:     photoStore,
+		auditService:   auditService,
 	}
 }
 
-// SubmitMeterReading submits a new meter reading
+// SubmitMeterReading submits a new meter reading.
+// Admins may pass ?overwrite=true to replace the meter's reading for that month and its bill.
 func (h *BillingHandler) SubmitMeterReading(c *gin.Context) {
+	overwrite := c.Query("overwrite") == "true"
+	if overwrite && c.GetString("userRole") != "admin" {
+		Forbidden(c, "Only admins can replace an existing reading")
+		return
+	}
+
 	var req MeterReadingRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -47,17 +61,23 @@ func (h *BillingHandler) SubmitMeterReading(c *gin.Context) {
 		return
 	}
 
-	// Get the authenticated user's ID from context (set by auth middleware)
-	userID, exists := c.Get("userID")
-	if !exists {
-		Unauthorized(c, "User not authenticated")
-		return
+	if req.Location != nil {
+		if req.Location.Type == "" {
+			req.Location.Type = "Point"
+		}
+		if req.Location.Type != "Point" || len(req.Location.Coordinates) != 2 {
+			BadRequest(c, "Location must be a GeoJSON Point with [longitude, latitude]", nil)
+			return
+		}
+		if err := utils.ValidateCoordinates(req.Location.Coordinates[0], req.Location.Coordinates[1]); err != nil {
+			BadRequest(c, "Invalid location", err)
+			return
+		}
 	}
 
-	// Get user details to get the reader's name
-	user, err := h.userService.GetUserByID(userID.(string))
-	if err != nil {
-		InternalServerError(c, "Failed to get user details", err)
+	// Credit the reading to the authenticated user, never to a client-supplied reader
+	readerID, readerName, ok := h.resolveReader(c, req.ReaderID)
+	if !ok {
 		return
 	}
 
@@ -74,13 +94,6 @@ func (h *BillingHandler) SubmitMeterReading(c *gin.Context) {
 		req.ReadingMethod = "mobile_app"
 	}
 
-	// Convert userID string to ObjectID
-	readerObjectID, err := primitive.ObjectIDFromHex(userID.(string))
-	if err != nil {
-		InternalServerError(c, "Invalid user ID format", err)
-		return
-	}
-
 	// Create meter reading model with the authenticated user's ID
 	reading := &models.MeterReading{
 		MeterNumber:    req.MeterNumber,
@@ -88,8 +101,8 @@ func (h *BillingHandler) SubmitMeterReading(c *gin.Context) {
 		ReadingDate:    req.ReadingDate,
 		ReadingType:    req.ReadingType,
 		ReadingMethod:  req.ReadingMethod,
-		ReaderID:       readerObjectID,                       // Set from authenticated user
-		ReaderName:     user.FirstName + " " + user.LastName, // Set from user object
+		ReaderID:       readerID,   // Set from authenticated user
+		ReaderName:     readerName, // Set from user object
 		Location:       req.Location,
 		MeterPhotoURL:  req.MeterPhotoURL,
 		MeterCondition: req.MeterCondition,
@@ -97,22 +110,121 @@ func (h *BillingHandler) SubmitMeterReading(c *gin.Context) {
 	}
 
 	// Submit reading and generate bill
-	bill, err := h.billingService.SubmitMeterReading(reading)
+	submit := h.billingService.SubmitMeterReading
+	if overwrite {
+		submit = h.billingService.ReplaceMeterReading
+	}
+	bill, err := submit(c.Request.Context(), reading)
 	if err != nil {
 		if strings.Contains(err.Error(), "customer with meter number") {
 			NotFound(c, "Customer not found")
-		} else if strings.Contains(err.Error(), "current reading cannot be less than previous reading") {
+		} else if strings.Contains(err.Error(), "cannot be less than previous reading") {
 			BadRequest(c, "Current reading cannot be less than previous reading", err)
+		} else if strings.Contains(err.Error(), "already exists for") {
+			ErrorResponse(c, http.StatusConflict, err.Error(), err)
+		} else if strings.Contains(err.Error(), "has payments against it") {
+			ErrorResponse(c, http.StatusConflict, "The existing bill has payments; reverse them before replacing the reading", err)
 		} else {
 			InternalServerError(c, "Failed to submit meter reading", err)
 		}
 		return
 	}
 
+	if overwrite {
+		recordAudit(c, h.auditService, models.AuditLog{
+			Action:     "reading.replace",
+			TargetType: "reading",
+			TargetID:   bill.ReadingID.Hex(),
+			After: map[string]interface{}{
+				"meter_number":    reading.MeterNumber,
+				"current_reading": reading.CurrentReading,
+				"bill_number":     bill.BillNumber,
+				"total_amount":    bill.TotalAmount,
+			},
+		})
+	}
+
 	CreatedResponse(c, "Meter reading submitted and bill generated successfully", bill)
 }
 
-// GetCustomerBills gets all bills for a customer
+// attributedReaderID decides who a submitted reading is credited to. It is always the
+// authenticated user, except that an admin may name another reader, e.g. when keying in
+// readings collected on paper.
+func attributedReaderID(role string, self, requested primitive.ObjectID) primitive.ObjectID {
+	if role == "admin" && !requested.IsZero() {
+		return requested
+	}
+	return self
+}
+
+// resolveReader returns the ID and name of the reader a submitted reading is credited to.
+// On failure it writes the error response and returns ok false.
+func (h *BillingHandler) resolveReader(c *gin.Context, requested primitive.ObjectID) (primitive.ObjectID, string, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return primitive.NilObjectID, "", false
+	}
+
+	self, err := primitive.ObjectIDFromHex(userID.(string))
+	if err != nil {
+		InternalServerError(c, "Invalid user ID format", err)
+		return primitive.NilObjectID, "", false
+	}
+
+	readerID := attributedReaderID(c.GetString("userRole"), self, requested)
+
+	// Get user details to get the reader's name
+	user, err := h.userService.GetUserByID(c.Request.Context(), readerID.Hex())
+	if err != nil {
+		if readerID != self && err.Error() == "user not found" {
+			BadRequest(c, "Reader not found", err)
+		} else {
+			InternalServerError(c, "Failed to get user details", err)
+		}
+		return primitive.NilObjectID, "", false
+	}
+
+	return readerID, user.FirstName + " " + user.LastName, true
+}
+
+// EstimateReadingRequest asks for an estimated reading for a meter that could not be read
+type EstimateReadingRequest struct {
+	MeterNumber string    `json:"meter_number" binding:"required"`
+	ReadingDate time.Time `json:"reading_date"`
+}
+
+// GenerateEstimatedReading bills a skipped meter from its consumption history
+func (h *BillingHandler) GenerateEstimatedReading(c *gin.Context) {
+	var req EstimateReadingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid request data", err)
+		return
+	}
+
+	if req.ReadingDate.IsZero() {
+		req.ReadingDate = time.Now()
+	}
+
+	bill, err := h.billingService.GenerateEstimatedReading(c.Request.Context(), req.MeterNumber, req.ReadingDate)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "customer with meter number"):
+			NotFound(c, "Customer not found")
+		case strings.Contains(err.Error(), "already exists"),
+			strings.Contains(err.Error(), "no consumption history"):
+			BadRequest(c, err.Error(), nil)
+		default:
+			InternalServerError(c, "Failed to generate estimated reading", err)
+		}
+		return
+	}
+
+	CreatedResponse(c, "Estimated reading recorded and bill generated successfully", bill)
+}
+
+// GetCustomerBills gets all bills for a customer. With ?includePayments=true each bill carries
+// its payments, fetched in a single query.
 func (h *BillingHandler) GetCustomerBills(c *gin.Context) {
 	meterNumber := c.Param("meterNumber")
 	if meterNumber == "" {
@@ -120,6 +232,10 @@ func (h *BillingHandler) GetCustomerBills(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeMeter(c, meterNumber) {
+		return
+	}
+
 	status := c.Query("status")
 	limit := c.DefaultQuery("limit", "50")
 
@@ -130,13 +246,38 @@ func (h *BillingHandler) GetCustomerBills(c *gin.Context) {
 		}
 	}
 
-	bills, err := h.billingService.GetCustomerBills(meterNumber, status, limitInt)
+	includePayments := false
+	if value := c.Query("includePayments"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			BadRequest(c, "includePayments must be true or false", err)
+			return
+		}
+		includePayments = parsed
+	}
+
+	bills, err := h.billingService.GetCustomerBills(c.Request.Context(), meterNumber, status, limitInt)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch customer bills", err)
 		return
 	}
 
-	SuccessResponse(c, "Customer bills retrieved", bills)
+	if !includePayments {
+		SuccessResponse(c, "Customer bills retrieved", bills)
+		return
+	}
+
+	billIDs := make([]primitive.ObjectID, len(bills))
+	for i, bill := range bills {
+		billIDs[i] = bill.ID
+	}
+	payments, err := h.billingService.GetPaymentsForBills(c.Request.Context(), billIDs)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch bill payments", err)
+		return
+	}
+
+	SuccessResponse(c, "Customer bills retrieved", billsWithPayments(bills, payments))
 }
 
 // GetCustomerReadingHistory gets reading history for a customer
@@ -147,13 +288,17 @@ func (h *BillingHandler) GetCustomerReadingHistory(c *gin.Context) {
 		return
 	}
 
+	if !h.authorizeMeter(c, meterNumber) {
+		return
+	}
+
 	limit := c.DefaultQuery("limit", "12")
 	limitInt, err := strconv.ParseInt(limit, 10, 64)
 	if err != nil {
 		limitInt = 12
 	}
 
-	readings, err := h.billingService.GetCustomerReadingHistory(meterNumber, limitInt)
+	readings, err := h.billingService.GetCustomerReadingHistory(c.Request.Context(), meterNumber, limitInt)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch reading history", err)
 		return
@@ -162,7 +307,80 @@ func (h *BillingHandler) GetCustomerReadingHistory(c *gin.Context) {
 	SuccessResponse(c, "Reading history retrieved", readings)
 }
 
-// ProcessPayment processes a payment for a bill
+// maxTrendMonths is the longest trend a chart can ask for
+const maxTrendMonths = 60
+
+// GetConsumptionTrend returns a customer's monthly consumption for charting
+// @Summary Customer consumption trend
+// @Description Consumption and charges per month for the last N months, oldest first. Months without a reading are included with no_reading set
+// @Tags Billing
+// @Produce json
+// @Param meterNumber path string true "Meter number"
+// @Param months query int false "Number of months including the current one (default 12, max 60)"
+// @Success 200 {object} Response "Consumption trend retrieved"
+// @Failure 400 {object} Response "Invalid months"
+// @Failure 403 {object} Response "Meter outside the caller's scope"
+// @Failure 404 {object} Response "Customer not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/customers/{meterNumber}/trend [get]
+func (h *BillingHandler) GetConsumptionTrend(c *gin.Context) {
+	meterNumber := c.Param("meterNumber")
+	if meterNumber == "" {
+		BadRequest(c, "Meter number is required", nil)
+		return
+	}
+
+	months, err := strconv.Atoi(c.DefaultQuery("months", "12"))
+	if err != nil || months < 1 || months > maxTrendMonths {
+		BadRequest(c, fmt.Sprintf("months must be between 1 and %d", maxTrendMonths), err)
+		return
+	}
+
+	if !h.authorizeMeter(c, meterNumber) {
+		return
+	}
+
+	trend, err := h.billingService.GetConsumptionTrend(c.Request.Context(), meterNumber, months)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch consumption trend", err)
+		return
+	}
+
+	SuccessResponse(c, "Consumption trend retrieved", gin.H{
+		"meter_number": meterNumber,
+		"months":       months,
+		"trend":        trend,
+	})
+}
+
+// authorizeMeter rejects customers and readers asking for a meter outside their scope.
+// It writes the error response and returns false when the request must stop.
+func (h *BillingHandler) authorizeMeter(c *gin.Context, meterNumber string) bool {
+	if !needsMeterScope(c) {
+		return true
+	}
+
+	customer, err := h.billingService.GetCustomerByMeterNumber(c.Request.Context(), meterNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Customer not found")
+		} else {
+			InternalServerError(c, "Failed to fetch customer", err)
+		}
+		return false
+	}
+
+	if !canAccessCustomer(c, customer) {
+		Forbidden(c, "You do not have access to this customer's records")
+		return false
+	}
+
+	return true
+}
+
+// ProcessPayment records a payment for the bill in the URL. POST /payments is the canonical
+// endpoint for recording payments; this one is kept for clients that pay from a bill and goes
+// through the same BillingService.RecordPayment path.
 func (h *BillingHandler) ProcessPayment(c *gin.Context) {
 	billID := c.Param("billID")
 	if billID == "" {
@@ -194,9 +412,7 @@ func (h *BillingHandler) ProcessPayment(c *gin.Context) {
 		return
 	}
 
-	// Get bill details first to include in payment record
-	// We'll need to fetch the bill to get customer details
-	// For now, we'll create payment with minimal info
+	// Meter and customer details are filled in from the bill
 	payment := &models.Payment{
 		BillID:        objectID,
 		Amount:        req.Amount,
@@ -205,41 +421,294 @@ func (h *BillingHandler) ProcessPayment(c *gin.Context) {
 		ReceiptNumber: req.ReceiptNumber,
 		PayerName:     req.PayerName,
 		PayerPhone:    req.PayerPhone,
-		CollectedBy:   req.CollectedBy,
+		CollectedBy:   c.GetString("username"),
 		Notes:         req.Notes,
 	}
 
 	// Process payment
-	if err := h.billingService.ProcessPayment(payment); err != nil {
+	duplicate, err := h.billingService.RecordPayment(c.Request.Context(), payment)
+	if err != nil {
 		if strings.Contains(err.Error(), "bill not found") {
 			NotFound(c, "Bill not found")
 		} else if strings.Contains(err.Error(), "payment amount must be greater than 0") {
 			BadRequest(c, "Payment amount must be greater than 0", err)
+		} else if strings.Contains(err.Error(), "already recorded") {
+			ErrorResponse(c, http.StatusConflict, "Payment already recorded", err)
+		} else if strings.Contains(err.Error(), "cannot take payments") {
+			Conflict(c, err)
 		} else {
 			InternalServerError(c, "Failed to process payment", err)
 		}
 		return
 	}
 
+	if !duplicate {
+		recordAudit(c, h.auditService, paymentAuditEntry(payment))
+	}
+
+	paymentProcessedResponse(c, payment, duplicate)
+}
+
+// paymentProcessedResponse returns the payment as saved. RecordPayment stamps the caller's payment
+// with its ID, date, status and receipt number, or replaces it with the original on a retry.
+func paymentProcessedResponse(c *gin.Context, payment *models.Payment, duplicate bool) {
+	if duplicate {
+		SuccessResponse(c, "Payment already recorded", gin.H{
+			"payment":    payment,
+			"idempotent": true,
+		})
+		return
+	}
+
 	SuccessResponse(c, "Payment processed successfully", payment)
 }
 
-// In handlers/billing.go
+// CancelBillRequest gives the reason a bill is being cancelled
+type CancelBillRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// CancelBill voids an unpaid bill and takes it off the customer balance
+// @Summary Cancel bill
+// @Description Cancel a bill with no payments against it, reversing its amount from the customer balance
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param billID path string true "Bill ID"
+// @Param cancellation body CancelBillRequest true "Cancellation reason"
+// @Success 200 {object} Response "Bill cancelled successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Bill not found"
+// @Failure 409 {object} Response "Bill is paid or already cancelled"
+// @Router /billing/bills/{billID}/cancel [post]
+func (h *BillingHandler) CancelBill(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("billID"))
+	if err != nil {
+		BadRequest(c, "Invalid bill ID format", err)
+		return
+	}
+
+	var req CancelBillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Cancellation reason is required", err)
+		return
+	}
+
+	bill, err := h.billingService.CancelBill(c.Request.Context(), objectID, req.Reason, c.GetString("userID"))
+	if err != nil {
+		switch {
+		case err.Error() == "bill not found":
+			NotFound(c, "Bill not found")
+		case strings.Contains(err.Error(), "already cancelled"),
+			strings.Contains(err.Error(), "has payments against it"):
+			Conflict(c, err)
+		case strings.HasPrefix(err.Error(), "error") || strings.HasPrefix(err.Error(), "failed"):
+			InternalServerError(c, "Failed to cancel bill", err)
+		default:
+			BadRequest(c, err.Error(), nil)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "bill.cancel",
+		TargetType: "bill",
+		TargetID:   objectID.Hex(),
+		Before:     map[string]interface{}{"balance": bill.TotalAmount - bill.AmountPaid},
+		After:      map[string]interface{}{"balance": 0, "status": bill.Status},
+		Details:    req.Reason,
+	})
+
+	SuccessResponse(c, "Bill cancelled successfully", bill)
+}
+
+// AdjustBillRequest describes a manual bill adjustment
+type AdjustBillRequest struct {
+	Amount float64 `json:"amount" binding:"required"` // Positive for a credit, negative for an extra charge
+	Reason string  `json:"reason" binding:"required"`
+}
 
-// GetBillByID retrieves a bill by its ID
-// @Summary Get bill by ID
-// @Description Get detailed bill information by bill ID
+// AdjustBill applies a credit or extra charge to a bill
+// @Summary Adjust bill
+// @Description Apply a credit (positive amount) or extra charge (negative amount) to a bill
 // @Tags Billing
 // @Accept json
 // @Produce json
-// @Param id path string true "Bill ID"
+// @Param billID path string true "Bill ID"
+// @Param adjustment body AdjustBillRequest true "Adjustment"
+// @Success 200 {object} Response "Bill adjusted successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Bill not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/bills/{billID}/adjust [post]
+func (h *BillingHandler) AdjustBill(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("billID"))
+	if err != nil {
+		BadRequest(c, "Invalid bill ID format", err)
+		return
+	}
+
+	var req AdjustBillRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid adjustment data", err)
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	before, err := h.billingService.GetBillByID(c.Request.Context(), objectID)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch bill", err)
+		return
+	}
+	if before == nil {
+		NotFound(c, "Bill not found")
+		return
+	}
+
+	bill, err := h.billingService.AdjustBill(c.Request.Context(), objectID, req.Amount, req.Reason, userID.(string))
+	if err != nil {
+		switch {
+		case err.Error() == "bill not found":
+			NotFound(c, "Bill not found")
+		case strings.HasPrefix(err.Error(), "error") || strings.HasPrefix(err.Error(), "failed"):
+			InternalServerError(c, "Failed to adjust bill", err)
+		default:
+			BadRequest(c, err.Error(), nil)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "bill.adjust",
+		TargetType: "bill",
+		TargetID:   objectID.Hex(),
+		Before:     map[string]interface{}{"total_amount": before.TotalAmount, "balance": before.Balance, "status": before.Status},
+		After:      map[string]interface{}{"total_amount": bill.TotalAmount, "balance": bill.Balance, "status": bill.Status, "adjustment": req.Amount},
+		Details:    req.Reason,
+	})
+
+	SuccessResponse(c, "Bill adjusted successfully", bill)
+}
+
+// DownloadBillPDF returns a printable PDF of a bill
+// @Summary Download bill PDF
+// @Description Render a bill as a PDF and mark it as printed
+// @Tags Billing
+// @Produce application/pdf
+// @Param billID path string true "Bill ID"
+// @Success 200 {file} file "Bill PDF"
+// @Failure 400 {object} Response "Invalid bill ID"
+// @Failure 404 {object} Response "Bill not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/bills/{billID}/pdf [get]
+func (h *BillingHandler) DownloadBillPDF(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("billID"))
+	if err != nil {
+		BadRequest(c, "Invalid bill ID format", err)
+		return
+	}
+
+	bill, err := h.billingService.GetBillByID(c.Request.Context(), objectID)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch bill", err)
+		return
+	}
+
+	if bill == nil {
+		NotFound(c, "Bill not found")
+		return
+	}
+
+	pdf, err := h.billingService.GenerateBillPDF(c.Request.Context(), objectID)
+	if err != nil {
+		InternalServerError(c, "Failed to generate bill PDF", err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", bill.BillNumber+".pdf"))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// BulkPaymentRequest is a lump-sum payment against a meter
+type BulkPaymentRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	PaymentMethod string  `json:"payment_method" binding:"required"`
+	TransactionID string  `json:"transaction_id"`
+}
+
+// ProcessCustomerPayment spreads a payment across a customer's unpaid bills
+// @Summary Pay customer bills
+// @Description Allocate a lump-sum payment across unpaid bills, oldest first; any excess becomes credit
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param meterNumber path string true "Meter number"
+// @Param payment body BulkPaymentRequest true "Payment"
+// @Success 200 {object} Response "Payment processed successfully, or already recorded under this transaction ID"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Customer not found"
+// @Failure 409 {object} Response "Receipt number already used"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/customers/{meterNumber}/pay [post]
+func (h *BillingHandler) ProcessCustomerPayment(c *gin.Context) {
+	meterNumber := c.Param("meterNumber")
+
+	var req BulkPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid payment data", err)
+		return
+	}
+
+	result, err := h.billingService.ProcessBulkPayment(c.Request.Context(), meterNumber, &models.Payment{
+		Amount:        req.Amount,
+		PaymentMethod: req.PaymentMethod,
+		TransactionID: req.TransactionID,
+		CollectedBy:   c.GetString("username"),
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "customer with meter number"):
+			NotFound(c, "Customer not found")
+		case strings.Contains(err.Error(), "already recorded"):
+			ErrorResponse(c, http.StatusConflict, "Payment already recorded", err)
+		default:
+			InternalServerError(c, "Failed to process payment", err)
+		}
+		return
+	}
+
+	// A retried submission with a known transaction ID returns the original payment
+	if result.Duplicate {
+		SuccessResponse(c, "Payment already recorded", result)
+		return
+	}
+
+	if result.Payment != nil {
+		recordAudit(c, h.auditService, paymentAuditEntry(result.Payment))
+	}
+
+	SuccessResponse(c, "Payment processed successfully", result)
+}
+
+// GetBillDetails gets a bill together with the payments made against it
+// @Summary Get bill details
+// @Description Get detailed bill information and its payments by bill ID
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param billID path string true "Bill ID"
 // @Success 200 {object} Response "Bill found"
 // @Failure 400 {object} Response "Invalid bill ID"
 // @Failure 404 {object} Response "Bill not found"
 // @Failure 500 {object} Response "Internal server error"
-// @Router /billing/bills/{id} [get]
-func (h *BillingHandler) GetBillByID(c *gin.Context) {
-	billID := c.Param("id")
+// @Router /billing/bills/{billID} [get]
+func (h *BillingHandler) GetBillDetails(c *gin.Context) {
+	billID := c.Param("billID")
 	if billID == "" {
 		BadRequest(c, "Bill ID is required", nil)
 		return
@@ -253,7 +722,7 @@ func (h *BillingHandler) GetBillByID(c *gin.Context) {
 	}
 
 	// Get bill from service
-	bill, err := h.billingService.GetBillByID(objectID)
+	bill, err := h.billingService.GetBillByID(c.Request.Context(), objectID)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch bill", err)
 		return
@@ -264,37 +733,191 @@ func (h *BillingHandler) GetBillByID(c *gin.Context) {
 		return
 	}
 
-	SuccessResponse(c, "Bill found", bill)
-}
+	payments, err := h.billingService.GetBillPayments(c.Request.Context(), objectID)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch bill payments", err)
+		return
+	}
 
-// GetBillDetails gets details of a specific bill
-func (h *BillingHandler) GetBillDetails(c *gin.Context) {
-	// This would query the bills collection directly
-	// For now, we'll implement a simple version
-	// We'll need to inject the bills collection or expand the service
+	if payments == nil {
+		payments = []models.Payment{}
+	}
 
+	SuccessResponse(c, "Bill found", BillDetailsResponse{
+		Bill:     *bill,
+		Payments: payments,
+	})
 }
 
-// GetOverdueBills gets all overdue bills
+// GetOverdueBills lists overdue bills a page at a time, oldest due date first
+// @Summary Get overdue bills
+// @Tags Billing
+// @Produce json
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Bills per page (default 50, max 200)"
+// @Param zone query string false "Only bills for customers in this zone"
+// @Param minAmount query number false "Only bills with at least this balance outstanding"
+// @Success 200 {object} Response "Overdue bills retrieved"
+// @Failure 400 {object} Response "Invalid filter"
+// @Router /billing/bills/overdue [get]
 func (h *BillingHandler) GetOverdueBills(c *gin.Context) {
-	bills, err := h.billingService.GetOverdueBills()
+	h.listOutstandingBills(c, "overdue", "Overdue bills retrieved")
+}
+
+// GetUnpaidBills lists bills with money still owing (pending, partially paid and overdue) a page
+// at a time, oldest due date first
+// @Summary Get unpaid bills
+// @Tags Billing
+// @Produce json
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Bills per page (default 50, max 200)"
+// @Param zone query string false "Only bills for customers in this zone"
+// @Param minAmount query number false "Only bills with at least this balance outstanding"
+// @Success 200 {object} Response "Unpaid bills retrieved"
+// @Failure 400 {object} Response "Invalid filter"
+// @Router /billing/bills/unpaid [get]
+func (h *BillingHandler) GetUnpaidBills(c *gin.Context) {
+	h.listOutstandingBills(c, bson.M{"$in": []string{"pending", "partially_paid", "overdue"}}, "Unpaid bills retrieved")
+}
+
+// listOutstandingBills serves a page of the bills with status, filtered by ?zone= and ?minAmount=
+func (h *BillingHandler) listOutstandingBills(c *gin.Context, status interface{}, message string) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	balance := bson.M{"$gt": 0}
+	filter := bson.M{"status": status, "balance": balance}
+	if value := c.Query("minAmount"); value != "" {
+		minAmount, err := strconv.ParseFloat(value, 64)
+		if err != nil || minAmount < 0 {
+			BadRequest(c, "minAmount must be a non-negative number", err)
+			return
+		}
+		balance["$gte"] = minAmount
+	}
+
+	// Bills do not store the zone, so resolve it to the zone's customers
+	if zone := c.Query("zone"); zone != "" {
+		customerIDs, err := h.billingService.GetCustomerIDsInZone(c.Request.Context(), zone)
+		if err != nil {
+			InternalServerError(c, "Failed to resolve zone", err)
+			return
+		}
+		filter["customer_id"] = bson.M{"$in": customerIDs}
+	}
+
+	bills, total, err := h.billingService.ListBillsByDueDate(c.Request.Context(), filter, page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch bills", err)
+		return
+	}
+	if bills == nil {
+		bills = []models.Bill{}
+	}
+
+	SuccessResponse(c, message, gin.H{
+		"bills":       bills,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
+}
+
+// ApplyLatePenalties charges late-payment penalties on overdue bills
+func (h *BillingHandler) ApplyLatePenalties(c *gin.Context) {
+	var req ApplyPenaltiesRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			BadRequest(c, "Invalid penalty data", err)
+			return
+		}
+	}
+
+	if req.PenaltyRate == 0 {
+		req.PenaltyRate = defaultPenaltyRate
+	}
+
+	if req.PenaltyRate < 0 || req.PenaltyRate > 1 {
+		BadRequest(c, "Penalty rate must be between 0 and 1", nil)
+		return
+	}
+
+	result, err := h.billingService.ApplyLatePenalties(c.Request.Context(), req.PenaltyRate)
 	if err != nil {
-		InternalServerError(c, "Failed to fetch overdue bills", err)
+		InternalServerError(c, "Failed to apply late penalties", err)
 		return
 	}
 
-	SuccessResponse(c, "Overdue bills retrieved", bills)
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "bill.penalties",
+		TargetType: "bill",
+		After: map[string]interface{}{
+			"penalty_rate":    result.PenaltyRate,
+			"bills_penalized": result.BillsPenalized,
+			"total_penalty":   result.TotalPenalty,
+		},
+	})
+
+	SuccessResponse(c, "Late penalties applied", result)
 }
 
-// GetUnpaidBills gets all unpaid bills (pending and overdue)
-func (h *BillingHandler) GetUnpaidBills(c *gin.Context) {
-	bills, err := h.billingService.GetUnpaidBills()
+// MarkOverdueBills moves pending bills past their due date to overdue
+func (h *BillingHandler) MarkOverdueBills(c *gin.Context) {
+	marked, err := h.billingService.MarkOverdueBills(c.Request.Context())
 	if err != nil {
-		InternalServerError(c, "Failed to fetch unpaid bills", err)
+		InternalServerError(c, "Failed to mark overdue bills", err)
 		return
 	}
 
-	SuccessResponse(c, "Unpaid bills retrieved", bills)
+	SuccessResponse(c, "Overdue bills marked", gin.H{"marked": marked})
+}
+
+// RunMonthlyBilling bills every active metered customer for ?period=YYYY-MM, defaulting to the
+// current month. Customers already billed for the period are skipped.
+func (h *BillingHandler) RunMonthlyBilling(c *gin.Context) {
+	period := time.Now()
+	if p := c.Query("period"); p != "" {
+		parsed, err := time.ParseInLocation("2006-01", p, time.Local)
+		if err != nil {
+			BadRequest(c, "Invalid period, expected YYYY-MM", err)
+			return
+		}
+		period = parsed
+	}
+
+	result, err := h.billingService.RunMonthlyBilling(c.Request.Context(), period)
+	if err != nil {
+		if strings.Contains(err.Error(), "future period") {
+			BadRequest(c, err.Error(), nil)
+			return
+		}
+		InternalServerError(c, "Failed to run monthly billing", err)
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "billing.run_monthly",
+		TargetType: "bill",
+		TargetID:   result.Period,
+		After: map[string]interface{}{
+			"billed":    result.Billed,
+			"estimated": result.Estimated,
+			"skipped":   result.Skipped,
+			"errored":   result.Errored,
+		},
+	})
+
+	SuccessResponse(c, "Monthly billing run completed", result)
 }
 
 // GetBillingSummary gets billing summary for a period
@@ -334,7 +957,7 @@ func (h *BillingHandler) GetBillingSummary(c *gin.Context) {
 		return
 	}
 
-	summary, err := h.billingService.GetBillingSummary(startDate, endDate)
+	summary, err := h.billingService.GetBillingSummary(c.Request.Context(), startDate, endDate)
 	if err != nil {
 		InternalServerError(c, "Failed to get billing summary", err)
 		return
@@ -344,6 +967,18 @@ func (h *BillingHandler) GetBillingSummary(c *gin.Context) {
 }
 
 // GetMyReadings returns readings submitted by the authenticated reader
+// @Summary Get my readings
+// @Description Readings submitted by the authenticated reader, newest first, optionally limited to an inclusive from/to date range
+// @Tags Billing
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Items per page (default 50, max 100)"
+// @Success 200 {object} Response "Readings retrieved"
+// @Failure 400 {object} Response "Invalid date"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/readings/my-readings [get]
 func (h *BillingHandler) GetMyReadings(c *gin.Context) {
 	// Get reader ID from context (set by auth middleware)
 	readerID, exists := c.Get("userID")
@@ -355,14 +990,113 @@ func (h *BillingHandler) GetMyReadings(c *gin.Context) {
 	// Parse optional query params for pagination
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	var from, to time.Time
+	if v := c.Query("from"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid from date, use YYYY-MM-DD", err)
+			return
+		}
+		from = date
+	}
+	if v := c.Query("to"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid to date, use YYYY-MM-DD", err)
+			return
+		}
+		to = date.AddDate(0, 0, 1) // Include the whole end day
+	}
 
-	readings, total, err := h.billingService.GetReadingsByReader(readerID.(string), page, limit)
+	readings, total, err := h.billingService.GetReadingsByReader(c.Request.Context(), readerID.(string), from, to, page, limit)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch readings", err) // ✅ Just call InternalServerError directly
 		return
 	}
 
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
 	SuccessResponse(c, "Readings retrieved", gin.H{ // ✅ Just call SuccessResponse directly
+		"readings":    readings,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": totalPages,
+	})
+}
+
+// GetReaderWorklist lists the meters the reader still has to read this billing period
+// @Summary Get reader worklist
+// @Description Active customers in the reader's assigned zone with no actual reading yet this billing period, sorted by meter number, with their last reading as the baseline
+// @Tags Billing
+// @Produce json
+// @Success 200 {object} Response "Worklist retrieved"
+// @Failure 400 {object} Response "No zone assigned"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/readings/worklist [get]
+func (h *BillingHandler) GetReaderWorklist(c *gin.Context) {
+	zone := c.GetString("userZone")
+	if zone == "" {
+		// Tokens issued before the zone was assigned do not carry it
+		userID, exists := c.Get("userID")
+		if !exists {
+			Unauthorized(c, "User not authenticated")
+			return
+		}
+
+		user, err := h.userService.GetUserByID(c.Request.Context(), userID.(string))
+		if err != nil {
+			InternalServerError(c, "Failed to get user details", err)
+			return
+		}
+		zone = user.AssignedZone
+	}
+
+	if zone == "" {
+		BadRequest(c, "No zone is assigned to this reader", nil)
+		return
+	}
+
+	now := time.Now()
+	worklist, err := h.billingService.GetReaderWorklist(c.Request.Context(), zone, now)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch worklist", err)
+		return
+	}
+
+	SuccessResponse(c, "Worklist retrieved", gin.H{
+		"zone":           zone,
+		"billing_period": utils.GetBillingPeriod(now),
+		"remaining":      len(worklist),
+		"worklist":       worklist,
+	})
+}
+
+// GetFlaggedReadings lists readings held for review because their consumption looked wrong
+func (h *BillingHandler) GetFlaggedReadings(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if limit <= 0 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	readings, total, err := h.billingService.GetFlaggedReadings(c.Request.Context(), page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch flagged readings", err)
+		return
+	}
+
+	SuccessResponse(c, "Flagged readings retrieved", gin.H{
 		"readings": readings,
 		"total":    total,
 		"page":     page,
@@ -370,6 +1104,268 @@ func (h *BillingHandler) GetMyReadings(c *gin.Context) {
 	})
 }
 
+// maxNearRadius is the widest proximity search allowed, in meters
+const maxNearRadius = 50000
+
+// GetReadingsNear lists readings captured near a point
+// @Summary Find readings near a point
+// @Description Readings whose GPS location is within radius meters of the point, nearest first. Lets supervisors check a reader was at the meter
+// @Tags Billing
+// @Produce json
+// @Param lng query number true "Longitude"
+// @Param lat query number true "Latitude"
+// @Param radius query number false "Radius in meters (default 100, max 50000)"
+// @Success 200 {object} Response "Nearby readings retrieved"
+// @Failure 400 {object} Response "Invalid coordinates or radius"
+// @Failure 503 {object} Response "Geospatial index missing"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/readings/near [get]
+func (h *BillingHandler) GetReadingsNear(c *gin.Context) {
+	lng, err := strconv.ParseFloat(c.Query("lng"), 64)
+	if err != nil {
+		BadRequest(c, "lng is required and must be a number", err)
+		return
+	}
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil {
+		BadRequest(c, "lat is required and must be a number", err)
+		return
+	}
+	if err := utils.ValidateCoordinates(lng, lat); err != nil {
+		BadRequest(c, "Invalid coordinates", err)
+		return
+	}
+
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "100"), 64)
+	if err != nil || radius <= 0 || radius > maxNearRadius {
+		BadRequest(c, fmt.Sprintf("radius must be between 0 and %d meters", maxNearRadius), err)
+		return
+	}
+
+	readings, err := h.billingService.GetReadingsNear(c.Request.Context(), lng, lat, radius)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "geospatial index missing") {
+			ErrorResponse(c, http.StatusServiceUnavailable, "Location search is unavailable until the geospatial index is created (run the init script)", err)
+		} else {
+			InternalServerError(c, "Failed to fetch nearby readings", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Nearby readings retrieved", gin.H{
+		"readings": readings,
+		"count":    len(readings),
+		"radius":   radius,
+	})
+}
+
+// DisputeReadingRequest records why a reading is disputed
+type DisputeReadingRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ResolveDisputeRequest closes a dispute, optionally cancelling the bill
+type ResolveDisputeRequest struct {
+	Resolution string `json:"resolution" binding:"required"`
+	CancelBill bool   `json:"cancel_bill"`
+}
+
+// DisputeReading marks a reading and its bill as disputed
+func (h *BillingHandler) DisputeReading(c *gin.Context) {
+	readingID, err := primitive.ObjectIDFromHex(c.Param("readingID"))
+	if err != nil {
+		BadRequest(c, "Invalid reading ID format", err)
+		return
+	}
+
+	var req DisputeReadingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "A dispute reason is required", err)
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.billingService.DisputeReading(c.Request.Context(), readingID, req.Reason, userID.(string)); err != nil {
+		switch {
+		case err.Error() == "reading not found":
+			NotFound(c, "Reading not found")
+		case strings.HasPrefix(err.Error(), "reading is already"):
+			ErrorResponse(c, http.StatusConflict, "Reading cannot be disputed", err)
+		default:
+			InternalServerError(c, "Failed to dispute reading", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Reading disputed successfully", nil)
+}
+
+// ResolveDispute resolves a disputed reading
+func (h *BillingHandler) ResolveDispute(c *gin.Context) {
+	readingID, err := primitive.ObjectIDFromHex(c.Param("readingID"))
+	if err != nil {
+		BadRequest(c, "Invalid reading ID format", err)
+		return
+	}
+
+	var req ResolveDisputeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "A resolution is required", err)
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.billingService.ResolveDispute(c.Request.Context(), readingID, req.Resolution, req.CancelBill, userID.(string)); err != nil {
+		switch {
+		case err.Error() == "reading not found":
+			NotFound(c, "Reading not found")
+		case err.Error() == "reading is not disputed":
+			ErrorResponse(c, http.StatusConflict, "Reading is not disputed", err)
+		case strings.Contains(err.Error(), "has payments against it"):
+			Conflict(c, err)
+		default:
+			InternalServerError(c, "Failed to resolve dispute", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Dispute resolved successfully", nil)
+}
+
+// CorrectReadingRequest replaces a misread meter value
+type CorrectReadingRequest struct {
+	CurrentReading *float64 `json:"current_reading" binding:"required"`
+	Reason         string   `json:"reason" binding:"required"`
+}
+
+// CorrectReading fixes a reading's value and reissues its bill
+// @Summary Correct meter reading
+// @Description Void the reading's bill, recalculate the reading with the corrected value and raise a new bill. Only a meter's latest reading can be corrected, and not once its bill has payments.
+// @Tags Billing
+// @Accept json
+// @Produce json
+// @Param readingID path string true "Reading ID"
+// @Param correction body CorrectReadingRequest true "Corrected value and reason"
+// @Success 200 {object} Response "Reading corrected successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Reading not found"
+// @Failure 409 {object} Response "Reading cannot be corrected"
+// @Router /billing/readings/{readingID} [put]
+func (h *BillingHandler) CorrectReading(c *gin.Context) {
+	readingID, err := primitive.ObjectIDFromHex(c.Param("readingID"))
+	if err != nil {
+		BadRequest(c, "Invalid reading ID format", err)
+		return
+	}
+
+	var req CorrectReadingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "A corrected reading and reason are required", err)
+		return
+	}
+
+	original, err := h.billingService.GetReadingByID(c.Request.Context(), readingID)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch reading", err)
+		return
+	}
+	if original == nil {
+		NotFound(c, "Reading not found")
+		return
+	}
+
+	bill, err := h.billingService.CorrectReading(c.Request.Context(), readingID, *req.CurrentReading, req.Reason, c.GetString("userID"))
+	if err != nil {
+		switch {
+		case err.Error() == "reading not found":
+			NotFound(c, "Reading not found")
+		case strings.Contains(err.Error(), "only the latest reading"),
+			strings.Contains(err.Error(), "has payments against it"),
+			err.Error() == "reading is cancelled":
+			Conflict(c, err)
+		case strings.HasPrefix(err.Error(), "error") || strings.HasPrefix(err.Error(), "failed"):
+			InternalServerError(c, "Failed to correct reading", err)
+		default:
+			BadRequest(c, err.Error(), nil)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "reading.correct",
+		TargetType: "reading",
+		TargetID:   readingID.Hex(),
+		Before: map[string]interface{}{
+			"current_reading": original.CurrentReading,
+			"consumption":     original.Consumption,
+			"bill_amount":     original.TotalAmount,
+		},
+		After: map[string]interface{}{
+			"current_reading": *req.CurrentReading,
+			"consumption":     bill.Consumption,
+			"bill_number":     bill.BillNumber,
+			"bill_amount":     bill.TotalAmount,
+		},
+		Details: req.Reason,
+	})
+
+	SuccessResponse(c, "Reading corrected successfully", bill)
+}
+
+// GetDisconnectionCandidates lists customers due for disconnection
+// @Summary Get disconnection candidates
+// @Description Active customers whose oldest unpaid bill is past the grace period and who owe more than the minimum balance
+// @Tags Billing
+// @Produce json
+// @Param grace_days query int false "Days past due before disconnection (default 14)"
+// @Param min_balance query number false "Minimum outstanding balance (default 0)"
+// @Success 200 {object} Response "Disconnection candidates retrieved"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/disconnection-candidates [get]
+func (h *BillingHandler) GetDisconnectionCandidates(c *gin.Context) {
+	graceDays, err := strconv.Atoi(c.DefaultQuery("grace_days", "14"))
+	if err != nil || graceDays < 0 {
+		BadRequest(c, "grace_days must be a non-negative integer", err)
+		return
+	}
+
+	minBalance, err := strconv.ParseFloat(c.DefaultQuery("min_balance", "0"), 64)
+	if err != nil || minBalance < 0 {
+		BadRequest(c, "min_balance must be a non-negative number", err)
+		return
+	}
+
+	candidates, err := h.billingService.GetDisconnectionCandidates(c.Request.Context(), graceDays, minBalance)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch disconnection candidates", err)
+		return
+	}
+
+	var totalOutstanding float64
+	for _, candidate := range candidates {
+		totalOutstanding += candidate.TotalOutstanding
+	}
+
+	SuccessResponse(c, "Disconnection candidates retrieved", gin.H{
+		"candidates":        candidates,
+		"count":             len(candidates),
+		"total_outstanding": utils.RoundToTwoDecimal(totalOutstanding),
+		"grace_days":        graceDays,
+		"min_balance":       minBalance,
+	})
+}
+
 // BulkSubmitReadings submits multiple meter readings
 func (h *BillingHandler) BulkSubmitReadings(c *gin.Context) {
 	var readings []MeterReadingRequest
@@ -389,13 +1385,21 @@ func (h *BillingHandler) BulkSubmitReadings(c *gin.Context) {
 		return
 	}
 
-	var results []BulkReadingResult
-	var errors []BulkReadingError
+	// Readings are credited to the authenticated user unless an admin names another reader
+	selfID, selfName, ok := h.resolveReader(c, primitive.NilObjectID)
+	if !ok {
+		return
+	}
+	readerNames := map[primitive.ObjectID]string{selfID: selfName}
+
+	var errors []services.BulkReadingError
+	var batch []*models.MeterReading
+	var batchIndex []int
 
 	for i, req := range readings {
 		// Validate required fields
 		if req.MeterNumber == "" {
-			errors = append(errors, BulkReadingError{
+			errors = append(errors, services.BulkReadingError{
 				Index: i,
 				Meter: req.MeterNumber,
 				Error: "Meter number is required",
@@ -404,7 +1408,7 @@ func (h *BillingHandler) BulkSubmitReadings(c *gin.Context) {
 		}
 
 		if req.CurrentReading <= 0 {
-			errors = append(errors, BulkReadingError{
+			errors = append(errors, services.BulkReadingError{
 				Index: i,
 				Meter: req.MeterNumber,
 				Error: "Current reading must be greater than 0",
@@ -412,35 +1416,55 @@ func (h *BillingHandler) BulkSubmitReadings(c *gin.Context) {
 			continue
 		}
 
+		readerID := attributedReaderID(c.GetString("userRole"), selfID, req.ReaderID)
+		readerName, known := readerNames[readerID]
+		if !known {
+			reader, err := h.userService.GetUserByID(c.Request.Context(), readerID.Hex())
+			if err != nil {
+				message := err.Error()
+				if message == "user not found" {
+					message = "Reader not found"
+				}
+				errors = append(errors, services.BulkReadingError{
+					Index: i,
+					Meter: req.MeterNumber,
+					Error: message,
+				})
+				continue
+			}
+			readerName = reader.FirstName + " " + reader.LastName
+			readerNames[readerID] = readerName
+		}
+
 		// Set default values
 		if req.ReadingDate.IsZero() {
 			req.ReadingDate = time.Now()
 		}
 
-		reading := &models.MeterReading{
+		batch = append(batch, &models.MeterReading{
 			MeterNumber:    req.MeterNumber,
 			CurrentReading: req.CurrentReading,
 			ReadingDate:    req.ReadingDate,
 			ReadingType:    req.ReadingType,
 			ReadingMethod:  req.ReadingMethod,
-			ReaderName:     req.ReaderName,
+			ReaderID:       readerID,
+			ReaderName:     readerName,
 			Notes:          req.Notes,
-		}
+		})
+		batchIndex = append(batchIndex, i)
+	}
 
-		bill, err := h.billingService.SubmitMeterReading(reading)
-		if err != nil {
-			errors = append(errors, BulkReadingError{
-				Index: i,
-				Meter: req.MeterNumber,
-				Error: err.Error(),
-			})
-		} else {
-			results = append(results, BulkReadingResult{
-				Meter:      req.MeterNumber,
-				BillNumber: bill.BillNumber,
-				Amount:     bill.TotalAmount,
-			})
+	var results []services.BulkReadingResult
+	if len(batch) > 0 {
+		var batchErrors []services.BulkReadingError
+		results, batchErrors = h.billingService.BulkSubmitReadings(c.Request.Context(), batch)
+
+		// Report errors against the position in the request, not in the batch
+		for _, batchErr := range batchErrors {
+			batchErr.Index = batchIndex[batchErr.Index]
+			errors = append(errors, batchErr)
 		}
+		sort.Slice(errors, func(i, j int) bool { return errors[i].Index < errors[j].Index })
 	}
 
 	response := gin.H{
@@ -507,17 +1531,16 @@ func (h *BillingHandler) GetAllBills(c *gin.Context) {
 // Request/Response DTOs
 
 type MeterReadingRequest struct {
-	MeterNumber    string             `json:"meter_number" binding:"required"`
-	CurrentReading float64            `json:"current_reading" binding:"required"`
-	ReadingDate    time.Time          `json:"reading_date"`
-	ReadingType    string             `json:"reading_type"`   // "manual", "estimated", "actual"
-	ReadingMethod  string             `json:"reading_method"` // "mobile_app", "field_agent", "customer"
-	ReaderID       primitive.ObjectID `json:"reader_id,omitempty"`
-	ReaderName     string             `json:"reader_name,omitempty"`
-	Location       models.GeoLocation `json:"location,omitempty"`
-	MeterPhotoURL  string             `json:"meter_photo_url,omitempty"`
-	MeterCondition string             `json:"meter_condition,omitempty"`
-	Notes          string             `json:"notes,omitempty"`
+	MeterNumber    string              `json:"meter_number" binding:"required"`
+	CurrentReading float64             `json:"current_reading" binding:"required"`
+	ReadingDate    time.Time           `json:"reading_date"`
+	ReadingType    string              `json:"reading_type"`        // "manual", "estimated", "actual"
+	ReadingMethod  string              `json:"reading_method"`      // "mobile_app", "field_agent", "customer"
+	ReaderID       primitive.ObjectID  `json:"reader_id,omitempty"` // Admins only: credit the reading to another reader
+	Location       *models.GeoLocation `json:"location,omitempty"`
+	MeterPhotoURL  string              `json:"meter_photo_url,omitempty"`
+	MeterCondition string              `json:"meter_condition,omitempty"`
+	Notes          string              `json:"notes,omitempty"`
 }
 
 type PaymentRequest struct {
@@ -527,18 +1550,31 @@ type PaymentRequest struct {
 	ReceiptNumber string  `json:"receipt_number"`
 	PayerName     string  `json:"payer_name,omitempty"`
 	PayerPhone    string  `json:"payer_phone,omitempty"`
-	CollectedBy   string  `json:"collected_by" binding:"required"`
 	Notes         string  `json:"notes,omitempty"`
 }
 
-type BulkReadingResult struct {
-	Meter      string  `json:"meter"`
-	BillNumber string  `json:"bill_number"`
-	Amount     float64 `json:"amount"`
+// defaultPenaltyRate is the share of the outstanding balance charged as a late penalty
+const defaultPenaltyRate = 0.05
+
+type ApplyPenaltiesRequest struct {
+	PenaltyRate float64 `json:"penalty_rate"` // e.g. 0.05 for 5%
 }
 
-type BulkReadingError struct {
-	Index int    `json:"index"`
-	Meter string `json:"meter"`
-	Error string `json:"error"`
+// BillDetailsResponse is a bill with its payments inlined alongside the bill fields
+type BillDetailsResponse struct {
+	models.Bill
+	Payments []models.Payment `json:"payments"`
+}
+
+// billsWithPayments pairs each bill with its payments, using an empty list for unpaid bills
+func billsWithPayments(bills []models.Bill, payments map[primitive.ObjectID][]models.Payment) []BillDetailsResponse {
+	details := make([]BillDetailsResponse, len(bills))
+	for i, bill := range bills {
+		billPayments := payments[bill.ID]
+		if billPayments == nil {
+			billPayments = []models.Payment{}
+		}
+		details[i] = BillDetailsResponse{Bill: bill, Payments: billPayments}
+	}
+	return details
 }
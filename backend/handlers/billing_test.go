@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAttributedReaderIDIgnoresSpoofedReader(t *testing.T) {
+	self := primitive.NewObjectID()
+	spoofed := primitive.NewObjectID()
+
+	for _, role := range []string{"reader", "manager", "cashier"} {
+		if got := attributedReaderID(role, self, spoofed); got != self {
+			t.Errorf("%s submission credited to %s, want own account %s", role, got.Hex(), self.Hex())
+		}
+	}
+
+	if got := attributedReaderID("reader", self, primitive.NilObjectID); got != self {
+		t.Errorf("reader submission without reader_id credited to %s, want %s", got.Hex(), self.Hex())
+	}
+}
+
+func TestAttributedReaderIDAdminOverride(t *testing.T) {
+	self := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	if got := attributedReaderID("admin", self, other); got != other {
+		t.Errorf("admin override credited to %s, want %s", got.Hex(), other.Hex())
+	}
+	if got := attributedReaderID("admin", self, primitive.NilObjectID); got != self {
+		t.Errorf("admin submission without reader_id credited to %s, want %s", got.Hex(), self.Hex())
+	}
+}
+
+func TestPaymentProcessedResponseIncludesReceipt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	payment := &models.Payment{
+		ID:            primitive.NewObjectID(),
+		Amount:        500,
+		ReceiptNumber: "RCP-20260314-1234",
+		Status:        "completed",
+		PaymentDate:   time.Now(),
+	}
+
+	for _, duplicate := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		paymentProcessedResponse(c, payment, duplicate)
+
+		var body struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+
+		var got models.Payment
+		if duplicate {
+			var wrapped struct {
+				Payment models.Payment `json:"payment"`
+			}
+			json.Unmarshal(body.Data, &wrapped)
+			got = wrapped.Payment
+		} else {
+			json.Unmarshal(body.Data, &got)
+		}
+
+		if got.ReceiptNumber != payment.ReceiptNumber || got.ID != payment.ID || got.Status != "completed" {
+			t.Errorf("duplicate=%v: response payment = %+v, want receipt %s", duplicate, got, payment.ReceiptNumber)
+		}
+	}
+}
+
+func TestBillsWithPayments(t *testing.T) {
+	paid := models.Bill{ID: primitive.NewObjectID()}
+	unpaid := models.Bill{ID: primitive.NewObjectID()}
+	payments := map[primitive.ObjectID][]models.Payment{
+		paid.ID: {{BillID: paid.ID, Amount: 300}, {BillID: paid.ID, Amount: 200}},
+	}
+
+	details := billsWithPayments([]models.Bill{paid, unpaid}, payments)
+	if len(details) != 2 || details[0].ID != paid.ID || details[1].ID != unpaid.ID {
+		t.Fatalf("details = %+v, want both bills in order", details)
+	}
+	if len(details[0].Payments) != 2 {
+		t.Errorf("paid bill has %d payments, want 2", len(details[0].Payments))
+	}
+	// Serialised as [] rather than null
+	if details[1].Payments == nil || len(details[1].Payments) != 0 {
+		t.Errorf("unpaid bill payments = %v, want an empty list", details[1].Payments)
+	}
+}
+
+func TestListOutstandingBillsRejectsInvalidMinAmount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &BillingHandler{}
+
+	for _, value := range []string{"abc", "-100"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/billing/bills/overdue?minAmount="+value, nil)
+
+		h.GetOverdueBills(c)
+		if w.Code != 400 {
+			t.Errorf("minAmount=%s: status %d, want 400", value, w.Code)
+		}
+	}
+}
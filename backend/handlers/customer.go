@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv" // ✅ ADD THIS - missing import
+	"strings"
 
 	"waterbilling/backend/models"
 	"waterbilling/backend/services"
@@ -15,11 +17,13 @@ import (
 
 type CustomerHandler struct {
 	customerService *services.CustomerService
+	auditService    *services.AuditService
 }
 
-func NewCustomerHandler(customerService *services.CustomerService) *CustomerHandler {
+func NewCustomerHandler(customerService *services.CustomerService, auditService *services.AuditService) *CustomerHandler {
 	return &CustomerHandler{
 		customerService: customerService,
+		auditService:    auditService,
 	}
 }
 
@@ -70,9 +74,11 @@ func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 	}
 
 	// Create customer
-	if err := h.customerService.CreateCustomer(&customer); err != nil {
-		if err.Error() == "customer with meter number "+customer.MeterNumber+" already exists" {
-			ErrorResponse(c, http.StatusConflict, "Customer already exists", err)
+	if err := h.customerService.CreateCustomer(c.Request.Context(), &customer); err != nil {
+		if strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "already registered") {
+			Conflict(c, err)
+		} else if strings.HasPrefix(err.Error(), "invalid phone number") {
+			BadRequest(c, "Invalid phone number", err)
 		} else {
 			InternalServerError(c, "Failed to create customer", err)
 		}
@@ -100,7 +106,7 @@ func (h *CustomerHandler) GetCustomerByMeterNumber(c *gin.Context) {
 		return
 	}
 
-	customer, err := h.customerService.GetCustomerByMeterNumber(meterNumber)
+	customer, err := h.customerService.GetCustomerByMeterNumber(c.Request.Context(), meterNumber)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch customer", err)
 		return
@@ -111,6 +117,11 @@ func (h *CustomerHandler) GetCustomerByMeterNumber(c *gin.Context) {
 		return
 	}
 
+	if !canAccessCustomer(c, customer) {
+		Forbidden(c, "You do not have access to this customer's records")
+		return
+	}
+
 	SuccessResponse(c, "Customer found", customer)
 }
 
@@ -167,9 +178,13 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 		return
 	}
 
-	if err := h.customerService.UpdateCustomer(meterNumber, updates); err != nil {
+	if err := h.customerService.UpdateCustomer(c.Request.Context(), meterNumber, updates); err != nil {
 		if err.Error() == "customer with meter number "+meterNumber+" not found" {
 			NotFound(c, "Customer not found")
+		} else if strings.HasPrefix(err.Error(), "invalid phone number") {
+			BadRequest(c, "Invalid phone number", err)
+		} else if strings.Contains(err.Error(), "already exists") {
+			Conflict(c, err)
 		} else {
 			InternalServerError(c, "Failed to update customer", err)
 		}
@@ -189,8 +204,10 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 // @Param zone query string false "Zone"
 // @Param status query string false "Status"
 // @Param customerType query string false "Customer Type"
-// @Param limit query int false "Limit results" default(50)
+// @Param includeArchived query bool false "Include archived customers"
+// @Param limit query int false "Limit results (max 200)" default(50)
 // @Success 200 {object} Response "Customers found"
+// @Failure 403 {object} Response "Zone outside the reader's assignment"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers/search [get]
 func (h *CustomerHandler) SearchCustomers(c *gin.Context) {
@@ -198,6 +215,7 @@ func (h *CustomerHandler) SearchCustomers(c *gin.Context) {
 	zone := c.Query("zone")
 	status := c.Query("status")
 	customerType := c.Query("customerType")
+	includeArchived := c.Query("includeArchived") == "true"
 	limit := c.DefaultQuery("limit", "50")
 
 	var limitInt int64 = 50
@@ -206,8 +224,18 @@ func (h *CustomerHandler) SearchCustomers(c *gin.Context) {
 			limitInt = l
 		}
 	}
+	if limitInt > 200 {
+		limitInt = 200
+	}
 
-	customers, err := h.customerService.SearchCustomers(searchTerm, zone, status, customerType, limitInt)
+	// Readers only search their own zone
+	zone, ok := scopedZone(c, zone)
+	if !ok {
+		Forbidden(c, "You do not have access to customers in this zone")
+		return
+	}
+
+	customers, err := h.customerService.SearchCustomers(c.Request.Context(), searchTerm, zone, status, customerType, includeArchived, limitInt)
 	if err != nil {
 		InternalServerError(c, "Failed to search customers", err)
 		return
@@ -223,7 +251,9 @@ func (h *CustomerHandler) SearchCustomers(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param zone path string true "Zone"
+// @Param includeArchived query bool false "Include archived customers"
 // @Success 200 {object} Response "Customers found"
+// @Failure 403 {object} Response "Zone outside the reader's assignment"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers/zone/{zone} [get]
 func (h *CustomerHandler) GetCustomersByZone(c *gin.Context) {
@@ -233,7 +263,14 @@ func (h *CustomerHandler) GetCustomersByZone(c *gin.Context) {
 		return
 	}
 
-	customers, err := h.customerService.GetCustomersByZone(zone)
+	if _, ok := scopedZone(c, zone); !ok {
+		Forbidden(c, "You do not have access to customers in this zone")
+		return
+	}
+
+	includeArchived := c.Query("includeArchived") == "true"
+
+	customers, err := h.customerService.GetCustomersByZone(c.Request.Context(), zone, includeArchived)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch customers by zone", err)
 		return
@@ -253,6 +290,7 @@ func (h *CustomerHandler) GetCustomersByZone(c *gin.Context) {
 // @Success 200 {object} Response "Status updated successfully"
 // @Failure 400 {object} Response "Invalid input"
 // @Failure 404 {object} Response "Customer not found"
+// @Failure 409 {object} Response "Disconnected customers are reactivated through the reconnect endpoint"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers/meter/{meterNumber}/status [put]
 func (h *CustomerHandler) UpdateCustomerStatus(c *gin.Context) {
@@ -287,18 +325,148 @@ func (h *CustomerHandler) UpdateCustomerStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.customerService.UpdateCustomerStatus(meterNumber, req.Status, req.Reason); err != nil {
+	before, err := h.customerService.GetCustomerByMeterNumber(c.Request.Context(), meterNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Customer not found")
+		} else {
+			InternalServerError(c, "Failed to fetch customer", err)
+		}
+		return
+	}
+
+	if err := h.customerService.UpdateCustomerStatus(c.Request.Context(), meterNumber, req.Status, req.Reason); err != nil {
 		if err.Error() == "customer with meter number "+meterNumber+" not found" {
 			NotFound(c, "Customer not found")
+		} else if strings.Contains(err.Error(), "must be reconnected") {
+			ErrorResponse(c, http.StatusConflict, "Customer is disconnected; use POST /customers/meter/"+meterNumber+"/reconnect", err)
 		} else {
 			InternalServerError(c, "Failed to update customer status", err)
 		}
 		return
 	}
 
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "customer.status",
+		TargetType: "customer",
+		TargetID:   before.ID.Hex(),
+		Before:     map[string]interface{}{"status": before.Status, "meter_number": meterNumber},
+		After:      map[string]interface{}{"status": req.Status},
+		Details:    req.Reason,
+	})
+
 	SuccessResponse(c, "Customer status updated successfully", nil)
 }
 
+// UpdateSMSPreferences opts a customer out of SMS notifications or back in
+// @Summary Update customer SMS preferences
+// @Description Opted-out customers get no bill, payment or reminder SMS. Login codes are still sent
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param meterNumber path string true "Meter Number"
+// @Param request body SMSPreferencesRequest true "SMS preferences"
+// @Success 200 {object} Response "SMS preferences updated"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Customer not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /customers/meter/{meterNumber}/sms-preferences [put]
+func (h *CustomerHandler) UpdateSMSPreferences(c *gin.Context) {
+	meterNumber := c.Param("meterNumber")
+
+	var req SMSPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid request data", err)
+		return
+	}
+	if req.SMSOptOut == nil {
+		BadRequest(c, "sms_opt_out is required", nil)
+		return
+	}
+
+	before, err := h.customerService.GetCustomerByMeterNumber(c.Request.Context(), meterNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Customer not found")
+		} else {
+			InternalServerError(c, "Failed to fetch customer", err)
+		}
+		return
+	}
+
+	if err := h.customerService.SetSMSOptOut(c.Request.Context(), meterNumber, *req.SMSOptOut); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Customer not found")
+		} else {
+			InternalServerError(c, "Failed to update SMS preferences", err)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "customer.sms_preferences",
+		TargetType: "customer",
+		TargetID:   before.ID.Hex(),
+		Before:     map[string]interface{}{"sms_opt_out": before.SMSOptOut, "meter_number": meterNumber},
+		After:      map[string]interface{}{"sms_opt_out": *req.SMSOptOut},
+	})
+
+	SuccessResponse(c, "SMS preferences updated", gin.H{
+		"meter_number": meterNumber,
+		"sms_opt_out":  *req.SMSOptOut,
+	})
+}
+
+// ReconnectCustomer restores supply to a disconnected customer
+// @Summary Reconnect customer
+// @Description Reactivate a disconnected customer once their balance is cleared and send the reconnection SMS
+// @Tags Customers
+// @Accept json
+// @Produce json
+// @Param meterNumber path string true "Meter number"
+// @Success 200 {object} Response "Customer reconnected successfully"
+// @Failure 404 {object} Response "Customer not found"
+// @Failure 409 {object} Response "Customer not disconnected or balance outstanding"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /customers/meter/{meterNumber}/reconnect [post]
+func (h *CustomerHandler) ReconnectCustomer(c *gin.Context) {
+	meterNumber := c.Param("meterNumber")
+
+	customer, err := h.customerService.ReconnectCustomer(c.Request.Context(), meterNumber)
+	if err != nil {
+		var balanceErr *services.OutstandingBalanceError
+		switch {
+		case errors.As(err, &balanceErr):
+			c.JSON(http.StatusConflict, Response{
+				Success: false,
+				Message: "Outstanding balance must be cleared before reconnection",
+				Data: gin.H{
+					"outstanding_balance": balanceErr.Balance,
+					"threshold":           balanceErr.Threshold,
+				},
+				Error: err.Error(),
+			})
+		case strings.Contains(err.Error(), "not found"):
+			NotFound(c, "Customer not found")
+		case strings.Contains(err.Error(), "not disconnected"):
+			ErrorResponse(c, http.StatusConflict, "Customer is not disconnected", err)
+		default:
+			InternalServerError(c, "Failed to reconnect customer", err)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "customer.reconnect",
+		TargetType: "customer",
+		TargetID:   customer.ID.Hex(),
+		Before:     map[string]interface{}{"status": "disconnected", "meter_number": meterNumber},
+		After:      map[string]interface{}{"status": customer.Status},
+	})
+
+	SuccessResponse(c, "Customer reconnected successfully", customer)
+}
+
 // GetCustomerStatistics gets customer statistics
 // @Summary Get customer statistics
 // @Description Get statistics about customers
@@ -309,7 +477,7 @@ func (h *CustomerHandler) UpdateCustomerStatus(c *gin.Context) {
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers/statistics [get]
 func (h *CustomerHandler) GetCustomerStatistics(c *gin.Context) {
-	stats, err := h.customerService.GetCustomerStatistics()
+	stats, err := h.customerService.GetCustomerStatistics(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, "Failed to get customer statistics", err)
 		return
@@ -351,7 +519,7 @@ func (h *CustomerHandler) BulkCreateCustomers(c *gin.Context) {
 	var errors []BulkCreateError
 
 	for i, customer := range customers {
-		if err := h.customerService.CreateCustomer(&customer); err != nil {
+		if err := h.customerService.CreateCustomer(c.Request.Context(), &customer); err != nil {
 			errors = append(errors, BulkCreateError{
 				Index: i,
 				Meter: customer.MeterNumber,
@@ -380,29 +548,73 @@ func (h *CustomerHandler) BulkCreateCustomers(c *gin.Context) {
 	CreatedResponse(c, "Bulk create completed", response)
 }
 
-// ✅ GetCustomers retrieves all customers with pagination - FIXED with proper imports
+// GetCustomers retrieves all customers with pagination
 // @Summary Get all customers
-// @Description Get all customers with pagination and filtering
+// @Description Get all customers with pagination, filtering and sorting
 // @Tags Customers
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
-// @Param limit query int false "Items per page" default(20)
+// @Param limit query int false "Items per page (max 200)" default(50)
 // @Param search query string false "Search term"
 // @Param zone query string false "Filter by zone"
 // @Param status query string false "Filter by status"
+// @Param customer_type query string false "Filter by customer type"
+// @Param sort query string false "Sort field, prefix with - for descending (e.g. -created_at)"
+// @Param includeArchived query bool false "Include archived customers"
 // @Success 200 {object} Response "Customers retrieved successfully"
+// @Failure 400 {object} Response "Invalid sort field"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers [get]
 func (h *CustomerHandler) GetCustomers(c *gin.Context) {
 	// Parse query parameters
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
 	search := c.Query("search")
 	zone := c.Query("zone")
 	status := c.Query("status")
+	customerType := c.Query("customer_type")
+	includeArchived := c.Query("includeArchived") == "true"
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	sort, ok := parseCustomerSort(c.Query("sort"))
+	if !ok {
+		BadRequest(c, "Invalid sort field", nil)
+		return
+	}
+
+	filter := customerListFilter(search, zone, status, customerType, includeArchived)
+
+	// Get customers from service
+	customers, total, err := h.customerService.ListCustomers(c.Request.Context(), filter, sort, page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch customers", err)
+		return
+	}
+
+	// Calculate total pages
+	totalPages := (total + limit - 1) / limit
+
+	SuccessResponse(c, "Customers retrieved successfully", gin.H{
+		"customers":   customers,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": totalPages,
+	})
+}
 
-	// Build filter
+// customerListFilter builds the filter shared by the customer list and export endpoints
+func customerListFilter(search, zone, status, customerType string, includeArchived bool) bson.M {
 	filter := bson.M{}
 	if search != "" {
 		filter["$or"] = []bson.M{
@@ -417,40 +629,57 @@ func (h *CustomerHandler) GetCustomers(c *gin.Context) {
 	}
 	if status != "" {
 		filter["status"] = status
+	} else if !includeArchived {
+		filter["status"] = bson.M{"$ne": "archived"}
 	}
+	if customerType != "" {
+		filter["customer_type"] = customerType
+	}
+	return filter
+}
 
-	// Get customers from service
-	customers, total, err := h.customerService.GetCustomers(c.Request.Context(), filter, page, limit)
-	if err != nil {
-		InternalServerError(c, "Failed to fetch customers", err)
-		return
+// customerSortFields lists the fields customers may be sorted by
+var customerSortFields = map[string]bool{
+	"created_at":   true,
+	"first_name":   true,
+	"last_name":    true,
+	"meter_number": true,
+	"zone":         true,
+	"balance":      true,
+}
+
+// parseCustomerSort turns "field" or "-field" into a sort document
+func parseCustomerSort(sort string) (bson.D, bool) {
+	if sort == "" {
+		return nil, true
 	}
 
-	// Calculate total pages
-	totalPages := int64(0)
-	if limit > 0 {
-		totalPages = (total + int64(limit) - 1) / int64(limit)
+	direction := 1
+	if strings.HasPrefix(sort, "-") {
+		direction = -1
+		sort = sort[1:]
 	}
 
-	SuccessResponse(c, "Customers retrieved successfully", gin.H{
-		"customers":   customers,
-		"total":       total,
-		"page":        page,
-		"limit":       limit,
-		"total_pages": totalPages,
-	})
+	if !customerSortFields[sort] {
+		return nil, false
+	}
+
+	return bson.D{{Key: sort, Value: direction}}, true
 }
 
-// DeleteCustomer handles customer deletion
-// @Summary Delete a customer
-// @Description Delete a customer by meter number
+// DeleteCustomer archives a customer instead of removing the record
+// @Summary Archive a customer
+// @Description Soft-delete a customer by meter number. Blocked while bills are unpaid unless force=true
 // @Tags Customers
 // @Accept json
 // @Produce json
 // @Param meterNumber path string true "Meter Number"
-// @Success 200 {object} Response "Customer deleted successfully"
+// @Param reason query string false "Reason for archiving"
+// @Param force query bool false "Archive even with unpaid bills"
+// @Success 200 {object} Response "Customer archived successfully"
 // @Failure 400 {object} Response "Invalid meter number"
 // @Failure 404 {object} Response "Customer not found"
+// @Failure 409 {object} Response "Customer has unpaid bills"
 // @Failure 500 {object} Response "Internal server error"
 // @Router /customers/meter/{meterNumber} [delete]
 func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
@@ -467,16 +696,42 @@ func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
 		return
 	}
 
-	if err := h.customerService.DeleteCustomer(meterNumber); err != nil {
+	reason := c.Query("reason")
+	force := c.Query("force") == "true"
+
+	customer, err := h.customerService.GetCustomerByMeterNumber(c.Request.Context(), meterNumber)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch customer", err)
+		return
+	}
+	if customer == nil {
+		NotFound(c, "Customer not found")
+		return
+	}
+
+	if err := h.customerService.ArchiveCustomer(c.Request.Context(), meterNumber, reason, force); err != nil {
 		if err.Error() == "customer with meter number "+meterNumber+" not found" {
 			NotFound(c, "Customer not found")
+		} else if strings.Contains(err.Error(), "has unpaid bills") {
+			ErrorResponse(c, http.StatusConflict, "Customer has unpaid bills. Use ?force=true to archive anyway", err)
+		} else if strings.Contains(err.Error(), "already archived") {
+			ErrorResponse(c, http.StatusConflict, "Customer is already archived", err)
 		} else {
-			InternalServerError(c, "Failed to delete customer", err)
+			InternalServerError(c, "Failed to archive customer", err)
 		}
 		return
 	}
 
-	SuccessResponse(c, "Customer deleted successfully", nil)
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "customer.archive",
+		TargetType: "customer",
+		TargetID:   customer.ID.Hex(),
+		Before:     map[string]interface{}{"status": customer.Status, "meter_number": meterNumber},
+		After:      map[string]interface{}{"status": "archived", "forced": force},
+		Details:    reason,
+	})
+
+	SuccessResponse(c, "Customer archived successfully", nil)
 }
 
 // UpdateStatusRequest represents status update request
@@ -485,6 +740,10 @@ type UpdateStatusRequest struct {
 	Reason string `json:"reason,omitempty"`
 }
 
+type SMSPreferencesRequest struct {
+	SMSOptOut *bool `json:"sms_opt_out"`
+}
+
 // BulkCreateResult represents successful bulk create
 type BulkCreateResult struct {
 	Meter string `json:"meter"`
@@ -494,6 +753,7 @@ type BulkCreateResult struct {
 // BulkCreateError represents failed bulk create
 type BulkCreateError struct {
 	Index int    `json:"index"`
+	Line  int    `json:"line,omitempty"` // CSV line number, for file imports
 	Meter string `json:"meter"`
 	Error string `json:"error"`
 }
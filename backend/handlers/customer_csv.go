@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"waterbilling/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maximum rows accepted by a single import, matching BulkCreateCustomers
+const maxImportRows = 1000
+
+// requiredImportColumns must appear in the CSV header row
+var requiredImportColumns = []string{"meter_number", "first_name", "last_name", "phone_number", "zone", "tariff_code"}
+
+// importColumns maps every accepted CSV column to the customer field it sets
+var importColumns = map[string]func(*models.Customer, string) error{
+	"meter_number":    func(cu *models.Customer, v string) error { cu.MeterNumber = v; return nil },
+	"account_number":  func(cu *models.Customer, v string) error { cu.AccountNumber = v; return nil },
+	"first_name":      func(cu *models.Customer, v string) error { cu.FirstName = v; return nil },
+	"last_name":       func(cu *models.Customer, v string) error { cu.LastName = v; return nil },
+	"phone_number":    func(cu *models.Customer, v string) error { cu.PhoneNumber = v; return nil },
+	"email":           func(cu *models.Customer, v string) error { cu.Email = v; return nil },
+	"id_number":       func(cu *models.Customer, v string) error { cu.IDNumber = v; return nil },
+	"street_address":  func(cu *models.Customer, v string) error { cu.Address.StreetAddress = v; return nil },
+	"city":            func(cu *models.Customer, v string) error { cu.Address.City = v; return nil },
+	"landmark":        func(cu *models.Customer, v string) error { cu.Address.Landmark = v; return nil },
+	"customer_type":   func(cu *models.Customer, v string) error { cu.CustomerType = v; return nil },
+	"connection_type": func(cu *models.Customer, v string) error { cu.ConnectionType = v; return nil },
+	"meter_type":      func(cu *models.Customer, v string) error { cu.MeterType = v; return nil },
+	"zone":            func(cu *models.Customer, v string) error { cu.Zone = v; return nil },
+	"subzone":         func(cu *models.Customer, v string) error { cu.Subzone = v; return nil },
+	"tariff_code":     func(cu *models.Customer, v string) error { cu.TariffCode = v; return nil },
+	"initial_reading": func(cu *models.Customer, v string) error {
+		if v == "" {
+			return nil
+		}
+		reading, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid initial_reading %q", v)
+		}
+		cu.InitialReading = reading
+		return nil
+	},
+}
+
+// ImportCustomers creates customers from an uploaded CSV file
+// @Summary Import customers from CSV
+// @Description Create customers from a CSV file (form field "file"). The header row must include meter_number, first_name, last_name, phone_number, zone and tariff_code; optional columns are account_number, email, id_number, street_address, city, landmark, customer_type, connection_type, meter_type, subzone and initial_reading. Maximum 1000 rows
+// @Tags Customers
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file"
+// @Success 201 {object} Response "Import completed"
+// @Failure 400 {object} Response "Invalid file or header"
+// @Router /customers/import [post]
+func (h *CustomerHandler) ImportCustomers(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		BadRequest(c, "A CSV file is required in the 'file' field", err)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		BadRequest(c, "Could not read uploaded file", err)
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		BadRequest(c, "Could not read CSV header row", err)
+		return
+	}
+
+	columns, err := parseImportHeader(header)
+	if err != nil {
+		BadRequest(c, "Invalid CSV header", err)
+		return
+	}
+
+	// Read everything first so the row cap is enforced before any customer is created
+	type csvRow struct {
+		line   int
+		record []string
+	}
+	var rows []csvRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			BadRequest(c, fmt.Sprintf("Invalid CSV at line %d", line), err)
+			return
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		rows = append(rows, csvRow{line: line, record: record})
+		if len(rows) > maxImportRows {
+			BadRequest(c, fmt.Sprintf("Maximum %d customers per import", maxImportRows), nil)
+			return
+		}
+	}
+
+	if len(rows) == 0 {
+		BadRequest(c, "No customers provided", nil)
+		return
+	}
+
+	var results []BulkCreateResult
+	var errors []BulkCreateError
+
+	for i, row := range rows {
+		customer, err := customerFromRecord(columns, row.record)
+		if err == nil {
+			err = h.customerService.CreateCustomer(c.Request.Context(), customer)
+		}
+		if err != nil {
+			errors = append(errors, BulkCreateError{
+				Index: i,
+				Line:  row.line,
+				Meter: customer.MeterNumber,
+				Error: err.Error(),
+			})
+			continue
+		}
+		results = append(results, BulkCreateResult{
+			Meter: customer.MeterNumber,
+			Name:  customer.FullName(),
+		})
+	}
+
+	response := gin.H{
+		"success": len(results),
+		"failed":  len(errors),
+		"results": results,
+		"errors":  errors,
+	}
+
+	if len(errors) > 0 && len(results) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Message: "All customers failed to import",
+			Data:    response,
+		})
+		return
+	}
+
+	CreatedResponse(c, "Import completed", response)
+}
+
+// parseImportHeader validates the header row and returns the normalised column names
+func parseImportHeader(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool)
+
+	for i, name := range header {
+		// Excel prefixes UTF-8 exports with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := importColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+
+	var missing []string
+	for _, name := range requiredImportColumns {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns: %s", strings.Join(missing, ", "))
+	}
+
+	return columns, nil
+}
+
+// customerFromRecord builds a customer from one CSV record
+func customerFromRecord(columns, record []string) (*models.Customer, error) {
+	customer := &models.Customer{}
+	for i, value := range record {
+		if i >= len(columns) {
+			break
+		}
+		if err := importColumns[columns[i]](customer, strings.TrimSpace(value)); err != nil {
+			return customer, err
+		}
+	}
+
+	for _, name := range requiredImportColumns {
+		if i := indexOf(columns, name); i >= len(record) || strings.TrimSpace(record[i]) == "" {
+			return customer, fmt.Errorf("%s is required", name)
+		}
+	}
+
+	return customer, nil
+}
+
+// isBlankRecord reports whether every field in a CSV record is empty
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// indexOf returns the position of value in values, or -1
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScopedZone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		role, assigned, requested string
+		want                      string
+		ok                        bool
+	}{
+		{"reader", "North", "", "North", true},
+		{"reader", "North", "North", "North", true},
+		{"reader", "North", "South", "", false},
+		{"reader", "", "South", "South", true},
+		{"manager", "", "South", "South", true},
+		{"manager", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set("userRole", tt.role)
+		c.Set("userZone", tt.assigned)
+
+		got, ok := scopedZone(c, tt.requested)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s in %q asking for %q: got %q/%v, want %q/%v", tt.role, tt.assigned, tt.requested, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCustomerListsRejectReaderOutsideZone(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &CustomerHandler{}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/customers/search?zone=South", nil)
+	c.Set("userRole", "reader")
+	c.Set("userZone", "North")
+	h.SearchCustomers(c)
+	if w.Code != 403 {
+		t.Errorf("search: status %d, want 403", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/customers/zone/South", nil)
+	c.Params = gin.Params{{Key: "zone", Value: "South"}}
+	c.Set("userRole", "reader")
+	c.Set("userZone", "North")
+	h.GetCustomersByZone(c)
+	if w.Code != 403 {
+		t.Errorf("zone list: status %d, want 403", w.Code)
+	}
+}
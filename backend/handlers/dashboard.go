@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http" // Add this import
 	"strconv"  // Add this import
 	"time"
 
 	"waterbilling/backend/models"   // Fixed import path
 	"waterbilling/backend/services" // Fixed import path
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -36,28 +38,28 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 	endOfMonth := time.Date(now.Year(), now.Month()+1, 0, 23, 59, 59, 0, now.Location())
 
 	// Get billing summary for current month
-	billingSummary, err := h.billingService.GetBillingSummary(startOfMonth, endOfMonth)
+	billingSummary, err := h.billingService.GetBillingSummary(c.Request.Context(), startOfMonth, endOfMonth)
 	if err != nil {
 		InternalServerError(c, "Failed to get billing summary", err)
 		return
 	}
 
 	// Get customer statistics
-	customerStats, err := h.customerService.GetCustomerStatistics()
+	customerStats, err := h.customerService.GetCustomerStatistics(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, "Failed to get customer statistics", err)
 		return
 	}
 
 	// Get overdue bills
-	overdueBills, err := h.billingService.GetOverdueBills()
+	overdueBills, err := h.billingService.GetOverdueBills(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, "Failed to get overdue bills", err)
 		return
 	}
 
 	// Get unpaid bills
-	unpaidBills, err := h.billingService.GetUnpaidBills()
+	unpaidBills, err := h.billingService.GetUnpaidBills(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, "Failed to get unpaid bills", err)
 		return
@@ -79,6 +81,7 @@ func (h *DashboardHandler) GetDashboardStats(c *gin.Context) {
 			Total:          totalRevenue,
 			Pending:        pendingRevenue,
 			CollectionRate: calculateCollectionRate(billingSummary),
+			Receivables:    customerStats.TotalArrears,
 		},
 		OverdueBills: OverdueStats{
 			Count:  len(overdueBills),
@@ -116,7 +119,7 @@ func (h *DashboardHandler) GetMonthlyReport(c *gin.Context) {
 	endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
 
 	// Get billing summary
-	billingSummary, err := h.billingService.GetBillingSummary(startDate, endDate)
+	billingSummary, err := h.billingService.GetBillingSummary(c.Request.Context(), startDate, endDate)
 	if err != nil {
 		InternalServerError(c, "Failed to get billing summary", err)
 		return
@@ -133,6 +136,109 @@ func (h *DashboardHandler) GetMonthlyReport(c *gin.Context) {
 	SuccessResponse(c, "Monthly report retrieved", monthlyReport)
 }
 
+// GetRevenueTrend gets billed and collected amounts per month for the collections chart
+func (h *DashboardHandler) GetRevenueTrend(c *gin.Context) {
+	months, err := strconv.Atoi(c.DefaultQuery("months", "12"))
+	if err != nil || months < 1 || months > maxTrendMonths {
+		BadRequest(c, fmt.Sprintf("months must be between 1 and %d", maxTrendMonths), err)
+		return
+	}
+
+	trend, err := h.billingService.GetRevenueTrend(c.Request.Context(), months)
+	if err != nil {
+		InternalServerError(c, "Failed to get revenue trend", err)
+		return
+	}
+
+	SuccessResponse(c, "Revenue trend retrieved", gin.H{
+		"months": months,
+		"trend":  trend,
+	})
+}
+
+// maxTopDebtors caps how many debtors one report returns
+const maxTopDebtors = 500
+
+// GetTopDebtors lists the customers who owe the most, for collections follow-up
+func (h *DashboardHandler) GetTopDebtors(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > maxTopDebtors {
+		BadRequest(c, fmt.Sprintf("limit must be between 1 and %d", maxTopDebtors), err)
+		return
+	}
+
+	debtors, err := h.billingService.GetTopDebtors(c.Request.Context(), limit)
+	if err != nil {
+		InternalServerError(c, "Failed to get top debtors", err)
+		return
+	}
+
+	var totalOwed float64
+	for _, debtor := range debtors {
+		totalOwed += debtor.TotalOutstanding
+	}
+
+	SuccessResponse(c, "Top debtors retrieved", gin.H{
+		"debtors":    debtors,
+		"count":      len(debtors),
+		"total_owed": utils.RoundToTwoDecimal(totalOwed),
+	})
+}
+
+// GetReceivablesAging gets outstanding balances bucketed by days past due.
+// as_of (YYYY-MM-DD) defaults to now.
+func (h *DashboardHandler) GetReceivablesAging(c *gin.Context) {
+	asOf := time.Now()
+	if asOfStr := c.Query("as_of"); asOfStr != "" {
+		date, err := utils.ParseDateString(asOfStr)
+		if err != nil {
+			BadRequest(c, "Invalid as_of date format. Use YYYY-MM-DD", err)
+			return
+		}
+		asOf = date.Add(24*time.Hour - time.Second)
+	}
+
+	report, err := h.billingService.GetReceivablesAging(c.Request.Context(), asOf)
+	if err != nil {
+		InternalServerError(c, "Failed to get receivables aging", err)
+		return
+	}
+
+	SuccessResponse(c, "Receivables aging retrieved", report)
+}
+
+// GetConsumptionDistribution gets a histogram of consumption for tariff planning.
+// period (YYYY-MM) defaults to the current month and band_size to 5 units.
+func (h *DashboardHandler) GetConsumptionDistribution(c *gin.Context) {
+	period := time.Now()
+	if p := c.Query("period"); p != "" {
+		parsed, err := time.ParseInLocation("2006-01", p, time.Local)
+		if err != nil {
+			BadRequest(c, "Invalid period, expected YYYY-MM", err)
+			return
+		}
+		period = parsed
+	}
+
+	bandSize, err := strconv.ParseFloat(c.DefaultQuery("band_size", "5"), 64)
+	if err != nil || bandSize <= 0 {
+		BadRequest(c, "band_size must be a number greater than zero", err)
+		return
+	}
+
+	bands, err := h.billingService.GetConsumptionDistribution(c.Request.Context(), period, bandSize)
+	if err != nil {
+		InternalServerError(c, "Failed to get consumption distribution", err)
+		return
+	}
+
+	SuccessResponse(c, "Consumption distribution retrieved", gin.H{
+		"period":    period.Format("2006-01"),
+		"band_size": bandSize,
+		"bands":     bands,
+	})
+}
+
 // GetZonePerformance gets performance metrics by zone
 func (h *DashboardHandler) GetZonePerformance(c *gin.Context) {
 	notImplemented(c, "Zone performance metrics not yet implemented")
@@ -140,11 +246,62 @@ func (h *DashboardHandler) GetZonePerformance(c *gin.Context) {
 
 // GetReaderPerformance gets performance metrics for meter readers
 func (h *DashboardHandler) GetReaderPerformance(c *gin.Context) {
-	notImplemented(c, "Reader performance metrics not yet implemented")
+	startDate, endDate, ok := parseReportPeriod(c)
+	if !ok {
+		return
+	}
+
+	zone := c.Query("zone")
+
+	performance, err := h.billingService.GetReaderPerformance(c.Request.Context(), startDate, endDate, zone)
+	if err != nil {
+		InternalServerError(c, "Failed to get reader performance", err)
+		return
+	}
+
+	SuccessResponse(c, "Reader performance retrieved", gin.H{
+		"period_start": startDate,
+		"period_end":   endDate,
+		"zone":         zone,
+		"readers":      performance,
+	})
 }
 
 // Helper functions
 
+// parseReportPeriod reads the optional start/end query params, defaulting to the current month.
+// It writes a 400 response and returns false when the dates are invalid.
+func parseReportPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	endDate := time.Date(now.Year(), now.Month()+1, 0, 23, 59, 59, 0, now.Location())
+
+	var err error
+	if startStr := c.Query("start"); startStr != "" {
+		startDate, err = utils.ParseDateString(startStr)
+		if err != nil {
+			BadRequest(c, "Invalid start date format. Use YYYY-MM-DD", err)
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	if endStr := c.Query("end"); endStr != "" {
+		endDate, err = utils.ParseDateString(endStr)
+		if err != nil {
+			BadRequest(c, "Invalid end date format. Use YYYY-MM-DD", err)
+			return time.Time{}, time.Time{}, false
+		}
+		endDate = endDate.Add(24*time.Hour - time.Second)
+	}
+
+	if startDate.After(endDate) {
+		BadRequest(c, "Start date must be before end date", nil)
+		return time.Time{}, time.Time{}, false
+	}
+
+	return startDate, endDate, true
+}
+
 func calculateCollectionRate(summary *services.BillingSummary) float64 {
 	var totalBilled, totalPaid float64
 	for _, statusSummary := range summary.StatusBreakdown {
@@ -181,6 +338,7 @@ type RevenueStats struct {
 	Total          float64 `json:"total"`
 	Pending        float64 `json:"pending"`
 	CollectionRate float64 `json:"collection_rate"`
+	Receivables    float64 `json:"receivables"` // Arrears across all customers
 }
 
 type OverdueStats struct {
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// exportFlushEvery is how many rows are buffered before the CSV is flushed to the client
+const exportFlushEvery = 200
+
+// ExportCustomers streams customers as CSV
+// @Summary Export customers as CSV
+// @Description Download customers matching the same filters as the customer list, optionally limited to those created between from and to (YYYY-MM-DD)
+// @Tags Customers
+// @Produce text/csv
+// @Param search query string false "Search term"
+// @Param zone query string false "Filter by zone"
+// @Param status query string false "Filter by status"
+// @Param customer_type query string false "Filter by customer type"
+// @Param includeArchived query bool false "Include archived customers"
+// @Param from query string false "Created on or after (YYYY-MM-DD)"
+// @Param to query string false "Created on or before (YYYY-MM-DD)"
+// @Success 200 {file} file "CSV file"
+// @Failure 400 {object} Response "Invalid filter"
+// @Router /customers/export [get]
+func (h *CustomerHandler) ExportCustomers(c *gin.Context) {
+	sort, ok := parseCustomerSort(c.Query("sort"))
+	if !ok {
+		BadRequest(c, "Invalid sort field", nil)
+		return
+	}
+
+	filter := customerListFilter(c.Query("search"), c.Query("zone"), c.Query("status"),
+		c.Query("customer_type"), c.Query("includeArchived") == "true")
+	if err := applyDateRange(c, filter, "created_at"); err != nil {
+		BadRequest(c, "Invalid date range", err)
+		return
+	}
+
+	w := startCSVDownload(c, "customers")
+	w.Write([]string{"meter_number", "account_number", "first_name", "last_name", "phone_number", "email",
+		"zone", "subzone", "customer_type", "tariff_code", "status", "balance", "last_reading", "created_at"})
+
+	rows := 0
+	err := h.customerService.StreamCustomers(c.Request.Context(), filter, sort, func(cu *models.Customer) error {
+		w.Write([]string{
+			cu.MeterNumber, cu.AccountNumber, cu.FirstName, cu.LastName, cu.PhoneNumber, cu.Email,
+			cu.Zone, cu.Subzone, cu.CustomerType, cu.TariffCode, cu.Status,
+			formatAmount(cu.Balance), strconv.FormatFloat(cu.LastReading, 'f', -1, 64),
+			cu.CreatedAt.Format("2006-01-02"),
+		})
+		return flushEvery(w, &rows)
+	})
+	finishCSVDownload(w, err)
+}
+
+// ExportBills streams bills as CSV
+// @Summary Export bills as CSV
+// @Description Download bills filtered by status, zone and bill date range (YYYY-MM-DD)
+// @Tags Billing
+// @Produce text/csv
+// @Param status query string false "Filter by status"
+// @Param zone query string false "Filter by customer zone"
+// @Param meter_number query string false "Filter by meter number"
+// @Param from query string false "Billed on or after (YYYY-MM-DD)"
+// @Param to query string false "Billed on or before (YYYY-MM-DD)"
+// @Success 200 {file} file "CSV file"
+// @Failure 400 {object} Response "Invalid filter"
+// @Router /billing/bills/export [get]
+func (h *BillingHandler) ExportBills(c *gin.Context) {
+	filter := bson.M{}
+	if status := c.Query("status"); status != "" && status != "all" {
+		filter["status"] = status
+	}
+	if meterNumber := c.Query("meter_number"); meterNumber != "" {
+		filter["meter_number"] = meterNumber
+	}
+	if err := applyDateRange(c, filter, "bill_date"); err != nil {
+		BadRequest(c, "Invalid date range", err)
+		return
+	}
+
+	// Bills do not store the zone, so resolve it to the zone's customers
+	if zone := c.Query("zone"); zone != "" {
+		customerIDs, err := h.billingService.GetCustomerIDsInZone(c.Request.Context(), zone)
+		if err != nil {
+			InternalServerError(c, "Failed to resolve zone", err)
+			return
+		}
+		filter["customer_id"] = bson.M{"$in": customerIDs}
+	}
+
+	w := startCSVDownload(c, "bills")
+	w.Write([]string{"bill_number", "billing_period", "bill_date", "due_date", "meter_number", "account_number",
+		"customer_name", "consumption", "water_charge", "fixed_charge", "arrears", "penalty", "total_amount",
+		"amount_paid", "balance", "status"})
+
+	rows := 0
+	err := h.billingService.StreamBills(c.Request.Context(), filter, func(b *models.Bill) error {
+		w.Write([]string{
+			b.BillNumber, b.BillingPeriod, b.BillDate.Format("2006-01-02"), b.DueDate.Format("2006-01-02"),
+			b.MeterNumber, b.AccountNumber, b.CustomerName, strconv.FormatFloat(b.Consumption, 'f', -1, 64),
+			formatAmount(b.WaterCharge), formatAmount(b.FixedCharge), formatAmount(b.Arrears), formatAmount(b.Penalty),
+			formatAmount(b.TotalAmount), formatAmount(b.AmountPaid), formatAmount(b.Balance), b.Status,
+		})
+		return flushEvery(w, &rows)
+	})
+	finishCSVDownload(w, err)
+}
+
+// applyDateRange adds an inclusive from/to (YYYY-MM-DD) range on field to filter
+func applyDateRange(c *gin.Context, filter bson.M, field string) error {
+	dateRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		start, err := utils.ParseDateString(from)
+		if err != nil {
+			return err
+		}
+		dateRange["$gte"] = start
+	}
+	if to := c.Query("to"); to != "" {
+		end, err := utils.ParseDateString(to)
+		if err != nil {
+			return err
+		}
+		dateRange["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(dateRange) > 0 {
+		filter[field] = dateRange
+	}
+	return nil
+}
+
+// startCSVDownload sets the download headers and returns a writer on the response body
+func startCSVDownload(c *gin.Context, name string) *csv.Writer {
+	filename := fmt.Sprintf("%s-%s.csv", name, time.Now().Format("2006-01-02"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	return csv.NewWriter(c.Writer)
+}
+
+// flushEvery flushes the writer every exportFlushEvery rows so the client receives data as it is read
+func flushEvery(w *csv.Writer, rows *int) error {
+	*rows++
+	if *rows%exportFlushEvery == 0 {
+		w.Flush()
+		return w.Error()
+	}
+	return nil
+}
+
+// finishCSVDownload flushes the last rows. Headers are already sent, so a failure mid-stream
+// can only be logged; the client sees a truncated file.
+func finishCSVDownload(w *csv.Writer, err error) {
+	w.Flush()
+	if err == nil {
+		err = w.Error()
+	}
+	if err != nil {
+		log.Printf("❌ CSV export stopped early: %v", err)
+	}
+}
+
+// formatAmount formats a currency amount with two decimals
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
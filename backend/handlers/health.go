@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"waterbilling/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// DetailedHealth reports database, SMS provider, index and document count status for monitoring.
+// It answers 503 when anything is degraded so uptime checks can alert on the status code alone.
+func (h *HealthHandler) DetailedHealth(c *gin.Context) {
+	report := h.healthService.Check(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// GetDatabaseStats returns database size statistics and per-collection document counts (admin only).
+// Statistics the database user may not read are left out and the report is marked partial.
+func (h *HealthHandler) GetDatabaseStats(c *gin.Context) {
+	report, err := h.healthService.DatabaseStats(c.Request.Context())
+	if err != nil {
+		ErrorResponse(c, http.StatusServiceUnavailable, "Database unavailable", err)
+		return
+	}
+
+	SuccessResponse(c, "Database stats retrieved successfully", report)
+}
@@ -1,44 +1,45 @@
 package handlers
 
 import (
-	"fmt"
-	"math/rand"
+	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"waterbilling/backend/models"
 	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type PaymentHandler struct {
 	paymentService *services.PaymentService
 	billingService *services.BillingService
+	auditService   *services.AuditService
 }
 
-func NewPaymentHandler(paymentService *services.PaymentService, billingService *services.BillingService) *PaymentHandler {
+func NewPaymentHandler(paymentService *services.PaymentService, billingService *services.BillingService, auditService *services.AuditService) *PaymentHandler {
 	return &PaymentHandler{
 		paymentService: paymentService,
 		billingService: billingService,
+		auditService:   auditService,
 	}
 }
 
-// RecordPayment handles payment recording
+// RecordPayment records a payment against a bill. This is the canonical endpoint for recording
+// payments; it goes through BillingService.RecordPayment like the M-Pesa callback and
+// POST /billing/bills/:billID/pay.
 func (h *PaymentHandler) RecordPayment(c *gin.Context) {
 	var req struct {
 		BillID        string  `json:"bill_id" binding:"required"`
-		MeterNumber   string  `json:"meter_number" binding:"required"`
-		CustomerID    string  `json:"customer_id" binding:"required"`
-		CustomerName  string  `json:"customer_name" binding:"required"`
 		Amount        float64 `json:"amount" binding:"required,gt=0"`
 		PaymentMethod string  `json:"payment_method" binding:"required"`
 		TransactionID string  `json:"transaction_id"`
 		PaymentDate   string  `json:"payment_date" binding:"required"`
-		CollectedBy   string  `json:"collected_by" binding:"required"`
 		Notes         string  `json:"notes"`
-		Status        string  `json:"status" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,13 +54,6 @@ func (h *PaymentHandler) RecordPayment(c *gin.Context) {
 		return
 	}
 
-	// Parse customer ID
-	customerObjectID, err := primitive.ObjectIDFromHex(req.CustomerID)
-	if err != nil {
-		BadRequest(c, "Invalid customer ID", err)
-		return
-	}
-
 	// Parse payment date
 	paymentDate, err := time.Parse(time.RFC3339, req.PaymentDate)
 	if err != nil {
@@ -71,44 +65,53 @@ func (h *PaymentHandler) RecordPayment(c *gin.Context) {
 		}
 	}
 
-	// Create payment record
 	payment := &models.Payment{
-		ID:            primitive.NewObjectID(),
 		BillID:        billObjectID,
-		MeterNumber:   req.MeterNumber,
-		CustomerID:    customerObjectID,
-		CustomerName:  req.CustomerName,
 		Amount:        req.Amount,
 		PaymentMethod: req.PaymentMethod,
 		TransactionID: req.TransactionID,
 		PaymentDate:   paymentDate,
-		CollectedBy:   req.CollectedBy,
+		CollectedBy:   c.GetString("username"), // The signed-in cashier, never the request body
 		Notes:         req.Notes,
-		Status:        req.Status,
-		CreatedAt:     time.Now(),
 	}
 
-	// Save payment
-	if err := h.paymentService.CreatePayment(payment); err != nil {
-		InternalServerError(c, "Failed to save payment", err)
+	// Save the payment, bill and customer balance together
+	duplicate, err := h.billingService.RecordPayment(c.Request.Context(), payment)
+	if err != nil {
+		if strings.Contains(err.Error(), "bill not found") {
+			NotFound(c, "Bill not found")
+		} else if strings.Contains(err.Error(), "already recorded") {
+			ErrorResponse(c, http.StatusConflict, "Payment already recorded", err)
+		} else if strings.Contains(err.Error(), "cannot take payments") {
+			Conflict(c, err)
+		} else {
+			InternalServerError(c, "Failed to save payment", err)
+		}
 		return
 	}
 
-	// Update bill payment status and customer balance
-	if err := h.billingService.UpdateBillPayment(req.BillID, req.Amount); err != nil {
-		// Log error but don't fail the request
-		fmt.Printf("Failed to update bill payment: %v\n", err)
+	// A retried submission with a known transaction ID returns the original payment
+	if duplicate {
+		SuccessResponse(c, "Payment already recorded", gin.H{
+			"id":             payment.ID.Hex(),
+			"receipt_number": payment.ReceiptNumber,
+			"amount":         payment.Amount,
+			"payment_date":   payment.PaymentDate,
+			"status":         payment.Status,
+			"idempotent":     true,
+		})
+		return
 	}
 
-	// Generate receipt number
-	receiptNumber := generateReceiptNumber()
+	recordAudit(c, h.auditService, paymentAuditEntry(payment))
 
 	SuccessResponse(c, "Payment recorded successfully", gin.H{
 		"id":             payment.ID.Hex(),
-		"receipt_number": receiptNumber,
+		"receipt_number": payment.ReceiptNumber,
 		"amount":         payment.Amount,
 		"payment_date":   payment.PaymentDate,
 		"status":         payment.Status,
+		"credit_amount":  payment.CreditAmount,
 	})
 }
 
@@ -122,7 +125,7 @@ func (h *PaymentHandler) GetPaymentsByMeter(c *gin.Context) {
 
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 
-	payments, err := h.paymentService.GetPaymentsByMeter(meterNumber, limit)
+	payments, err := h.paymentService.GetPaymentsByMeter(c.Request.Context(), meterNumber, limit)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch payments", err)
 		return
@@ -131,23 +134,272 @@ func (h *PaymentHandler) GetPaymentsByMeter(c *gin.Context) {
 	SuccessResponse(c, "Payments retrieved", payments)
 }
 
-// Helper function to generate receipt number
-func generateReceiptNumber() string {
-	return "RCPT-" + time.Now().Format("20060102") + "-" + randomString(6)
+// GetPaymentByReceipt finds a payment from its receipt number, with a summary of the bill it paid
+func (h *PaymentHandler) GetPaymentByReceipt(c *gin.Context) {
+	receiptNumber := strings.TrimSpace(c.Param("receiptNumber"))
+	if receiptNumber == "" {
+		BadRequest(c, "Receipt number is required", nil)
+		return
+	}
+
+	payment, err := h.paymentService.GetByReceiptNumber(c.Request.Context(), receiptNumber)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch payment", err)
+		return
+	}
+	if payment == nil {
+		NotFound(c, "No payment found for this receipt")
+		return
+	}
+
+	response := gin.H{"payment": payment}
+
+	// Lump-sum payments point at their first bill; the rest are listed in the payment's allocations
+	if !payment.BillID.IsZero() {
+		bill, err := h.billingService.GetBillByID(c.Request.Context(), payment.BillID)
+		if err != nil {
+			InternalServerError(c, "Failed to fetch bill", err)
+			return
+		}
+		if bill != nil {
+			response["bill"] = gin.H{
+				"id":             bill.ID.Hex(),
+				"bill_number":    bill.BillNumber,
+				"billing_period": bill.BillingPeriod,
+				"total_amount":   bill.TotalAmount,
+				"amount_paid":    bill.AmountPaid,
+				"balance":        bill.Balance,
+				"status":         bill.Status,
+				"due_date":       bill.DueDate,
+			}
+		}
+	}
+
+	SuccessResponse(c, "Payment retrieved", response)
 }
 
-// Fixed random string generator without sleep
-func randomString(n int) string {
-	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, n)
+// ListPayments lists payments for audits, filtered by optional from/to dates (YYYY-MM-DD),
+// method, collectedBy and meter, newest first
+func (h *PaymentHandler) ListPayments(c *gin.Context) {
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	filter := bson.M{}
+	if method := c.Query("method"); method != "" {
+		filter["payment_method"] = method
+	}
+	if collectedBy := c.Query("collectedBy"); collectedBy != "" {
+		filter["collected_by"] = collectedBy
+	}
+	if meter := c.Query("meter"); meter != "" {
+		filter["meter_number"] = meter
+	}
+
+	dateRange := bson.M{}
+	if v := c.Query("from"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid from date, use YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$gte"] = date
+	}
+	if v := c.Query("to"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid to date, use YYYY-MM-DD", err)
+			return
+		}
+		dateRange["$lt"] = date.AddDate(0, 0, 1) // Include the whole end day
+	}
+	if len(dateRange) > 0 {
+		filter["payment_date"] = dateRange
+	}
 
-	// Create a new random source seeded with current time
-	src := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(src)
+	payments, total, err := h.paymentService.ListPayments(c.Request.Context(), filter, page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch payments", err)
+		return
+	}
 
-	for i := range result {
-		result[i] = letters[r.Intn(len(letters))]
+	SuccessResponse(c, "Payments retrieved", gin.H{
+		"payments":    payments,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
+// GetCollectionSummary returns a day's takings for end-of-shift reconciliation.
+// Cashiers only see their own collections; admins and managers may name a collector or, by
+// leaving collectedBy empty, see everyone's. date (YYYY-MM-DD) defaults to today.
+func (h *PaymentHandler) GetCollectionSummary(c *gin.Context) {
+	collectedBy := c.Query("collectedBy")
+	role := c.GetString("userRole")
+	if role != "admin" && role != "manager" {
+		self := c.GetString("username")
+		if collectedBy != "" && collectedBy != self {
+			Forbidden(c, "You can only view your own collections")
+			return
+		}
+		collectedBy = self
 	}
 
-	return string(result)
+	date := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+		if err != nil {
+			BadRequest(c, "Invalid date format. Use YYYY-MM-DD", err)
+			return
+		}
+		date = parsed
+	}
+
+	summary, err := h.paymentService.GetCollectionSummary(c.Request.Context(), collectedBy, date)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch collection summary", err)
+		return
+	}
+
+	SuccessResponse(c, "Collection summary retrieved", summary)
+}
+
+// ReversePaymentRequest carries the reason a payment is being reversed
+type ReversePaymentRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReversePayment refunds a payment and restores the bill and customer balances
+func (h *PaymentHandler) ReversePayment(c *gin.Context) {
+	paymentID, err := primitive.ObjectIDFromHex(c.Param("paymentID"))
+	if err != nil {
+		BadRequest(c, "Invalid payment ID", err)
+		return
+	}
+
+	var req ReversePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "A reason is required to reverse a payment", err)
+		return
+	}
+
+	userID, exists := c.Get("userID")
+	if !exists {
+		Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.billingService.ReversePayment(c.Request.Context(), paymentID, req.Reason, userID.(string)); err != nil {
+		switch {
+		case err.Error() == "payment not found":
+			NotFound(c, "Payment not found")
+		case err.Error() == "payment already refunded":
+			ErrorResponse(c, http.StatusConflict, "Payment has already been reversed", err)
+		default:
+			InternalServerError(c, "Failed to reverse payment", err)
+		}
+		return
+	}
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		Action:     "payment.reverse",
+		TargetType: "payment",
+		TargetID:   paymentID.Hex(),
+		After:      map[string]interface{}{"status": "refunded"},
+		Details:    req.Reason,
+	})
+
+	SuccessResponse(c, "Payment reversed successfully", nil)
+}
+
+// MpesaCallback records a payment from a Safaricom C2B confirmation callback.
+// BillRefNumber is the account number the customer typed, which is their meter number. The money
+// has already been taken, so the payment is spread over the meter's unpaid bills and anything
+// left, including the whole amount when nothing is owed, is held as credit.
+func (h *PaymentHandler) MpesaCallback(c *gin.Context) {
+	var req MpesaC2BCallback
+	if err := c.ShouldBindJSON(&req); err != nil {
+		mpesaResponse(c, 1, "Rejected: invalid payload")
+		return
+	}
+
+	meterNumber := strings.TrimSpace(req.BillRefNumber)
+	if req.TransID == "" || meterNumber == "" {
+		mpesaResponse(c, 1, "Rejected: missing transaction ID or account number")
+		return
+	}
+
+	amount, err := strconv.ParseFloat(req.TransAmount, 64)
+	if err != nil || amount <= 0 {
+		mpesaResponse(c, 1, "Rejected: invalid amount")
+		return
+	}
+
+	payment := &models.Payment{
+		Amount:        amount,
+		PaymentMethod: "mpesa",
+		TransactionID: req.TransID,
+		PayerName:     strings.TrimSpace(req.FirstName + " " + req.LastName),
+		PayerPhone:    req.MSISDN,
+		CollectedBy:   "mpesa",
+	}
+
+	result, err := h.billingService.ProcessBulkPayment(c.Request.Context(), meterNumber, payment)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "customer with meter number"):
+			utils.Logf(c.Request.Context(), "⚠️ M-Pesa %s: no customer for meter %s", req.TransID, meterNumber)
+			mpesaResponse(c, 1, "Rejected: unknown account")
+		default:
+			utils.Logf(c.Request.Context(), "❌ M-Pesa %s: failed to record payment: %v", req.TransID, err)
+			mpesaResponse(c, 1, "Rejected: failed to record payment")
+		}
+		return
+	}
+
+	// Safaricom retries callbacks, so a duplicate is acknowledged, not rejected
+	if result.Duplicate {
+		utils.Logf(c.Request.Context(), "⚠️ M-Pesa %s: duplicate callback ignored", req.TransID)
+		mpesaResponse(c, 0, "Accepted")
+		return
+	}
+
+	entry := paymentAuditEntry(result.Payment)
+	entry.ActorID, entry.ActorName, entry.ActorRole = "mpesa", req.MSISDN, "system"
+	recordAudit(c, h.auditService, entry)
+
+	utils.Logf(c.Request.Context(), "✅ M-Pesa %s: KSh %.2f recorded for meter %s across %d bill(s), KSh %.2f credit",
+		req.TransID, amount, meterNumber, len(result.Bills), result.Credit)
+	mpesaResponse(c, 0, "Accepted")
+}
+
+// mpesaResponse writes the acknowledgement shape Safaricom expects
+func mpesaResponse(c *gin.Context, resultCode int, resultDesc string) {
+	c.JSON(http.StatusOK, gin.H{
+		"ResultCode": resultCode,
+		"ResultDesc": resultDesc,
+	})
+}
+
+// MpesaC2BCallback is the body Safaricom posts to the C2B confirmation URL
+type MpesaC2BCallback struct {
+	TransactionType   string `json:"TransactionType"`
+	TransID           string `json:"TransID"`
+	TransTime         string `json:"TransTime"`
+	TransAmount       string `json:"TransAmount"`
+	BusinessShortCode string `json:"BusinessShortCode"`
+	BillRefNumber     string `json:"BillRefNumber"`
+	InvoiceNumber     string `json:"InvoiceNumber"`
+	OrgAccountBalance string `json:"OrgAccountBalance"`
+	MSISDN            string `json:"MSISDN"`
+	FirstName         string `json:"FirstName"`
+	MiddleName        string `json:"MiddleName"`
+	LastName          string `json:"LastName"`
 }
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"strings"
+
+	"waterbilling/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PortalHandler struct {
+	portalService *services.PortalService
+}
+
+func NewPortalHandler(portalService *services.PortalService) *PortalHandler {
+	return &PortalHandler{
+		portalService: portalService,
+	}
+}
+
+// RequestOTPRequest identifies the customer asking for a login code
+type RequestOTPRequest struct {
+	MeterNumber string `json:"meter_number" binding:"required"`
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+// VerifyOTPRequest carries the login code sent by SMS
+type VerifyOTPRequest struct {
+	MeterNumber string `json:"meter_number" binding:"required"`
+	Code        string `json:"code" binding:"required,len=6"`
+}
+
+// RequestOTP sends a customer portal login code
+// @Summary Request portal login code
+// @Description Send a 6-digit code by SMS if the phone number is registered to the meter. The response is the same either way
+// @Tags Portal
+// @Accept json
+// @Produce json
+// @Param request body RequestOTPRequest true "Meter and phone number"
+// @Success 200 {object} Response "Code sent"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /portal/request-otp [post]
+func (h *PortalHandler) RequestOTP(c *gin.Context) {
+	var req RequestOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Meter number and phone number are required", err)
+		return
+	}
+
+	if err := h.portalService.RequestOTP(c.Request.Context(), strings.TrimSpace(req.MeterNumber), req.PhoneNumber); err != nil {
+		InternalServerError(c, "Failed to send login code", err)
+		return
+	}
+
+	SuccessResponse(c, "If the details match our records, a login code has been sent", nil)
+}
+
+// VerifyOTP exchanges a login code for a customer token
+// @Summary Verify portal login code
+// @Description Verify the SMS code and return a token that can only read the customer's own bills and readings
+// @Tags Portal
+// @Accept json
+// @Produce json
+// @Param request body VerifyOTPRequest true "Meter number and code"
+// @Success 200 {object} Response "Login successful"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 401 {object} Response "Invalid or expired code"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /portal/verify-otp [post]
+func (h *PortalHandler) VerifyOTP(c *gin.Context) {
+	var req VerifyOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Meter number and 6-digit code are required", err)
+		return
+	}
+
+	token, customer, err := h.portalService.VerifyOTP(c.Request.Context(), strings.TrimSpace(req.MeterNumber), req.Code)
+	if err != nil {
+		if err.Error() == "invalid or expired code" {
+			Unauthorized(c, "Invalid or expired code")
+		} else if err.Error() == "account is not active" {
+			Forbidden(c, "This account can no longer sign in to the portal")
+		} else {
+			InternalServerError(c, "Failed to verify code", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Login successful", gin.H{
+		"token": token,
+		"customer": gin.H{
+			"name":         customer.FullName(),
+			"meter_number": customer.MeterNumber,
+		},
+	})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPhotoSize is the largest meter photo accepted, in bytes
+const maxPhotoSize = 5 << 20
+
+// photoExtensions maps the accepted photo content types to their file extension
+var photoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// UploadReadingPhoto stores a photo of the meter as proof of a reading
+// @Summary Upload meter photo
+// @Description Attach a JPEG, PNG or WebP photo (form field "photo", max 5MB) to a meter reading. Uploading again replaces the reading's photo URL
+// @Tags Billing
+// @Accept multipart/form-data
+// @Produce json
+// @Param readingID path string true "Reading ID"
+// @Param photo formData file true "Meter photo"
+// @Success 200 {object} Response "Photo uploaded successfully"
+// @Failure 400 {object} Response "Invalid file"
+// @Failure 404 {object} Response "Reading not found"
+// @Failure 413 {object} Response "Photo too large"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /billing/readings/{readingID}/photo [post]
+func (h *BillingHandler) UploadReadingPhoto(c *gin.Context) {
+	readingID, err := primitive.ObjectIDFromHex(c.Param("readingID"))
+	if err != nil {
+		BadRequest(c, "Invalid reading ID format", err)
+		return
+	}
+
+	// Leave room for the multipart headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPhotoSize+1<<20)
+
+	fileHeader, err := c.FormFile("photo")
+	if err != nil {
+		BadRequest(c, "An image is required in the 'photo' field", err)
+		return
+	}
+
+	if fileHeader.Size > maxPhotoSize {
+		ErrorResponse(c, http.StatusRequestEntityTooLarge, "Photo exceeds the 5MB limit", nil)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		BadRequest(c, "Could not read uploaded file", err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPhotoSize+1))
+	if err != nil {
+		BadRequest(c, "Could not read uploaded file", err)
+		return
+	}
+	if len(data) > maxPhotoSize {
+		ErrorResponse(c, http.StatusRequestEntityTooLarge, "Photo exceeds the 5MB limit", nil)
+		return
+	}
+
+	// Trust the file contents rather than the client's declared type
+	contentType := http.DetectContentType(data)
+	ext, ok := photoExtensions[contentType]
+	if !ok {
+		BadRequest(c, "Photo must be a JPEG, PNG or WebP image", fmt.Errorf("unsupported content type %s", contentType))
+		return
+	}
+
+	reading, err := h.billingService.GetReadingByID(c.Request.Context(), readingID)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch reading", err)
+		return
+	}
+	if reading == nil {
+		NotFound(c, "Reading not found")
+		return
+	}
+
+	name := fmt.Sprintf("%s-%d%s", readingID.Hex(), time.Now().UnixNano(), ext)
+	photoURL, err := h.photoStore.Save(c.Request.Context(), name, contentType, data)
+	if err != nil {
+		InternalServerError(c, "Failed to store photo", err)
+		return
+	}
+
+	if err := h.billingService.SetReadingPhoto(c.Request.Context(), readingID, photoURL); err != nil {
+		if err.Error() == "reading not found" {
+			NotFound(c, "Reading not found")
+		} else {
+			InternalServerError(c, "Failed to update reading", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Photo uploaded successfully", gin.H{
+		"reading_id":      readingID.Hex(),
+		"meter_photo_url": photoURL,
+	})
+}
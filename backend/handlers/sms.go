@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"waterbilling/backend/models"
 	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -46,7 +52,7 @@ func (h *SMSHandler) SendBillNotification(c *gin.Context) {
 	}
 
 	// Get bill details
-	bill, err := h.billingService.GetBillByID(objectID)
+	bill, err := h.billingService.GetBillByID(c.Request.Context(), objectID)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch bill", err)
 		return
@@ -57,7 +63,7 @@ func (h *SMSHandler) SendBillNotification(c *gin.Context) {
 	}
 
 	// Get customer details
-	customer, err := h.billingService.GetCustomerByMeterNumber(bill.MeterNumber)
+	customer, err := h.billingService.GetCustomerByMeterNumber(c.Request.Context(), bill.MeterNumber)
 	if err != nil {
 		InternalServerError(c, "Failed to fetch customer", err)
 		return
@@ -76,6 +82,14 @@ func (h *SMSHandler) SendBillNotification(c *gin.Context) {
 	// Use the service's SendBillNotification method
 	err = h.smsService.SendBillNotification(bill, customer)
 	if err != nil {
+		if errors.Is(err, services.ErrSMSOptedOut) {
+			Conflict(c, err)
+			return
+		}
+		if strings.Contains(err.Error(), "daily SMS limit") {
+			ErrorResponse(c, http.StatusTooManyRequests, err.Error(), nil)
+			return
+		}
 		InternalServerError(c, "Failed to send SMS", err)
 		return
 	}
@@ -129,22 +143,94 @@ func (h *SMSHandler) BulkSendBillNotifications(c *gin.Context) {
 
 	if req.SendToUnpaid {
 		// Get all unpaid bills
-		bills, err = h.billingService.GetUnpaidBills()
+		bills, err = h.billingService.GetUnpaidBills(c.Request.Context())
 		if err != nil {
 			InternalServerError(c, "Failed to fetch unpaid bills", err)
 			return
 		}
 	} else {
-		// TODO: Fetch specific bills by IDs
-		notImplemented(c, "Fetching specific bills by IDs not yet implemented")
+		ids := make([]primitive.ObjectID, 0, len(req.BillIDs))
+		for _, id := range req.BillIDs {
+			objectID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				BadRequest(c, "Invalid bill ID format: "+id, err)
+				return
+			}
+			ids = append(ids, objectID)
+		}
+
+		bills, err = h.billingService.GetBillsByIDs(c.Request.Context(), ids)
+		if err != nil {
+			InternalServerError(c, "Failed to fetch bills", err)
+			return
+		}
+	}
+
+	var results []BulkSMSResult
+	var errors []BulkSMSError
+	var skipped []BulkSMSResult
+
+	// Resolve customers, skipping anyone we cannot text
+	customers := make(map[primitive.ObjectID]models.Customer)
+	var sendable []models.Bill
+	for _, bill := range bills {
+		customer, err := h.billingService.GetCustomerByMeterNumber(c.Request.Context(), bill.MeterNumber)
+		if err != nil {
+			errors = append(errors, BulkSMSError{
+				BillID: bill.ID.Hex(),
+				Meter:  bill.MeterNumber,
+				Error:  err.Error(),
+			})
+			continue
+		}
+
+		if customer.PhoneNumber == "" {
+			skipped = append(skipped, BulkSMSResult{
+				BillID:     bill.ID.Hex(),
+				BillNumber: bill.BillNumber,
+				Meter:      bill.MeterNumber,
+			})
+			continue
+		}
+
+		customers[customer.ID] = *customer
+		bill.CustomerID = customer.ID
+		sendable = append(sendable, bill)
+	}
+
+	sendErrors := h.smsService.BulkSendBillNotifications(sendable, customers)
+	for _, bill := range sendable {
+		if err := sendErrors[bill.ID]; err != nil {
+			errors = append(errors, BulkSMSError{
+				BillID: bill.ID.Hex(),
+				Meter:  bill.MeterNumber,
+				Error:  err.Error(),
+			})
+		} else {
+			results = append(results, BulkSMSResult{
+				BillID:     bill.ID.Hex(),
+				BillNumber: bill.BillNumber,
+				Meter:      bill.MeterNumber,
+			})
+		}
+	}
+
+	response := gin.H{
+		"total_bills":   len(bills),
+		"success":       len(results),
+		"failed":        len(errors),
+		"skipped":       len(skipped),
+		"results":       results,
+		"errors":        errors,
+		"skipped_bills": skipped,
+	}
+
+	if len(errors) > 0 && len(results) == 0 {
+		ErrorResponse(c, http.StatusBadRequest, "All bill notifications failed to send", nil)
 		return
 	}
 
-	// TODO: Implement bulk SMS sending
-	SuccessResponse(c, "Bulk SMS endpoint ready", gin.H{
-		"total_bills":     len(bills),
-		"action_required": "Implement bulk SMS sending logic",
-	})
+	SuccessResponse(c, "Bulk bill notifications processed", response)
 }
 
 // SendPaymentConfirmation sends payment confirmation SMS
@@ -172,66 +258,264 @@ func (h *SMSHandler) SendPaymentConfirmation(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement payment confirmation SMS
-	SuccessResponse(c, "Payment confirmation endpoint ready", gin.H{
-		"status":         "ready",
-		"next_steps":     "Implement payment confirmation logic",
-		"amount":         req.Amount,
-		"transaction_id": req.TransactionID,
+	// Resolve the customer from the bill when one is given, otherwise from the meter
+	var billID primitive.ObjectID
+	var customer *models.Customer
+	if req.BillID != "" {
+		objectID, err := primitive.ObjectIDFromHex(req.BillID)
+		if err != nil {
+			BadRequest(c, "Invalid bill ID format", err)
+			return
+		}
+
+		bill, err := h.billingService.GetBillByID(c.Request.Context(), objectID)
+		if err != nil {
+			InternalServerError(c, "Failed to fetch bill", err)
+			return
+		}
+		if bill == nil {
+			NotFound(c, "Bill not found")
+			return
+		}
+
+		billID = bill.ID
+		customer, err = h.billingService.GetCustomerByID(c.Request.Context(), bill.CustomerID)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				NotFound(c, "Customer not found")
+				return
+			}
+			InternalServerError(c, "Failed to fetch customer", err)
+			return
+		}
+	} else {
+		var err error
+		customer, err = h.billingService.GetCustomerByMeterNumber(c.Request.Context(), req.MeterNumber)
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				NotFound(c, "Customer not found")
+				return
+			}
+			InternalServerError(c, "Failed to fetch customer", err)
+			return
+		}
+	}
+
+	if customer.PhoneNumber == "" {
+		BadRequest(c, "Customer has no phone number", nil)
+		return
+	}
+
+	payment := &models.Payment{
+		BillID:        billID,
+		MeterNumber:   customer.MeterNumber,
+		CustomerID:    customer.ID,
+		CustomerName:  customer.FullName(),
+		Amount:        req.Amount,
+		TransactionID: req.TransactionID,
+		ReceiptNumber: req.ReceiptNumber,
+		PaymentDate:   time.Now(),
+	}
+
+	// The attempt is written to sms_logs whether or not it succeeds
+	logStatus, err := h.smsService.SendPaymentConfirmation(payment, customer)
+	if err != nil {
+		if errors.Is(err, services.ErrSMSOptedOut) {
+			Conflict(c, err)
+			return
+		}
+		if strings.Contains(err.Error(), "daily SMS limit") {
+			ErrorResponse(c, http.StatusTooManyRequests, err.Error(), nil)
+			return
+		}
+		InternalServerError(c, "Failed to send SMS", err)
+		return
+	}
+
+	// Quiet hours hold the message back; say so rather than claiming it went out
+	message := "Payment confirmation sent successfully"
+	if logStatus == "queued" {
+		message = "Payment confirmation queued until quiet hours end"
+	}
+
+	SuccessResponse(c, message, gin.H{
+		"meter_number":   customer.MeterNumber,
+		"customer_name":  customer.FullName(),
+		"phone":          customer.PhoneNumber,
+		"amount":         payment.Amount,
+		"receipt_number": payment.ReceiptNumber,
+		"transaction_id": payment.TransactionID,
+		"log_status":     logStatus,
 	})
 }
 
-// GetSMSLogs gets SMS sending history
+// GetSMSLogs gets a page of SMS sending history, newest first. startDate and endDate
+// (YYYY-MM-DD) are inclusive; without either, only the last 30 days are searched.
 func (h *SMSHandler) GetSMSLogs(c *gin.Context) {
-	// Build filter from query parameters
-	filter := bson.M{}
+	filter, err := smsLogFilter(c.Query("meterNumber"), c.Query("messageType"), c.Query("startDate"), c.Query("endDate"), time.Now())
+	if err != nil {
+		BadRequest(c, "Invalid date filter, use YYYY-MM-DD", err)
+		return
+	}
 
-	if meterNumber := c.Query("meterNumber"); meterNumber != "" {
-		filter["meter_number"] = meterNumber
+	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
 	}
 
-	if messageType := c.Query("messageType"); messageType != "" {
-		filter["message_type"] = messageType
+	// Check if SMS service is available
+	if h.smsService == nil {
+		InternalServerError(c, "SMS service not initialized", nil)
+		return
+	}
+
+	logs, total, err := h.smsService.GetSMSLogs(c.Request.Context(), filter, page, limit)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch SMS logs", err)
+		return
 	}
 
-	// Parse date filters (simplified)
-	if startDate := c.Query("startDate"); startDate != "" {
-		filter["sent_at"] = bson.M{"$gte": startDate}
+	SuccessResponse(c, "SMS logs retrieved", gin.H{
+		"logs":        logs,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + limit - 1) / limit,
+	})
+}
+
+// RetryFailedSMS re-sends failed messages that are due a retry. max_age_hours (default 24) and
+// max_attempts (default 3) bound which messages are tried.
+func (h *SMSHandler) RetryFailedSMS(c *gin.Context) {
+	var maxAge time.Duration
+	if v := c.Query("max_age_hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			BadRequest(c, "max_age_hours must be a positive number", err)
+			return
+		}
+		maxAge = time.Duration(hours) * time.Hour
 	}
 
-	if endDate := c.Query("endDate"); endDate != "" {
-		if startFilter, ok := filter["sent_at"].(bson.M); ok {
-			startFilter["$lte"] = endDate
-		} else {
-			filter["sent_at"] = bson.M{"$lte": endDate}
+	maxAttempts := 0
+	if v := c.Query("max_attempts"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts <= 0 {
+			BadRequest(c, "max_attempts must be a positive number", err)
+			return
 		}
+		maxAttempts = attempts
+	}
+
+	if h.smsService == nil {
+		InternalServerError(c, "SMS service not initialized", nil)
+		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	limit := int64(50)
-	if l, err := strconv.ParseInt(limitStr, 10, 64); err == nil && l > 0 {
-		limit = l
+	retried, succeeded, err := h.smsService.RetryFailedSMS(c.Request.Context(), maxAge, maxAttempts)
+	if err != nil {
+		InternalServerError(c, "Failed to retry SMS", err)
+		return
+	}
+
+	SuccessResponse(c, "Failed SMS retried", gin.H{
+		"retried":   retried,
+		"succeeded": succeeded,
+		"failed":    retried - succeeded,
+	})
+}
+
+// smsLogDefaultDays bounds an SMS log search given no dates, as sms_logs is the fastest
+// growing collection
+const smsLogDefaultDays = 30
+
+// smsLogFilter builds the sms_logs query for GetSMSLogs. sent_at is stored as a date, so the
+// range bounds must be dates too; a string bound would never match.
+func smsLogFilter(meterNumber, messageType, startDate, endDate string, now time.Time) (bson.M, error) {
+	filter := bson.M{}
+	if meterNumber != "" {
+		filter["meter_number"] = meterNumber
+	}
+	if messageType != "" {
+		filter["message_type"] = messageType
+	}
+
+	sentAt := bson.M{}
+	if startDate != "" {
+		date, err := utils.ParseDateString(startDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startDate %q: %v", startDate, err)
+		}
+		sentAt["$gte"] = date
+	}
+	if endDate != "" {
+		date, err := utils.ParseDateString(endDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endDate %q: %v", endDate, err)
+		}
+		sentAt["$lt"] = date.AddDate(0, 0, 1) // Include the whole end day
+	}
+	if len(sentAt) == 0 {
+		sentAt["$gte"] = now.AddDate(0, 0, -smsLogDefaultDays)
+	}
+	filter["sent_at"] = sentAt
+
+	return filter, nil
+}
+
+// GetSMSSpend reports SMS spend by message type and provider between from and to (YYYY-MM-DD,
+// both inclusive). The range defaults to the current month so far.
+func (h *SMSHandler) GetSMSSpend(c *gin.Context) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+
+	if v := c.Query("from"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid from date, use YYYY-MM-DD", err)
+			return
+		}
+		from = date
+	}
+	if v := c.Query("to"); v != "" {
+		date, err := utils.ParseDateString(v)
+		if err != nil {
+			BadRequest(c, "Invalid to date, use YYYY-MM-DD", err)
+			return
+		}
+		to = date.AddDate(0, 0, 1) // Include the whole end day
+	}
+	if !to.After(from) {
+		BadRequest(c, "from must be before to", nil)
+		return
 	}
 
-	// Check if SMS service is available
 	if h.smsService == nil {
 		InternalServerError(c, "SMS service not initialized", nil)
 		return
 	}
 
-	logs, err := h.smsService.GetSMSLogs(filter, limit)
+	summary, err := h.smsService.GetSpendSummary(c.Request.Context(), from, to)
 	if err != nil {
-		InternalServerError(c, "Failed to fetch SMS logs", err)
+		InternalServerError(c, "Failed to fetch SMS spend", err)
 		return
 	}
 
-	SuccessResponse(c, "SMS logs retrieved", logs)
+	SuccessResponse(c, "SMS spend retrieved", summary)
 }
 
 // SendDisconnectionWarning sends disconnection warning SMS
 func (h *SMSHandler) SendDisconnectionWarning(c *gin.Context) {
 	// Get overdue bills
-	bills, err := h.billingService.GetOverdueBills()
+	bills, err := h.billingService.GetOverdueBills(c.Request.Context())
 	if err != nil {
 		InternalServerError(c, "Failed to fetch overdue bills", err)
 		return
@@ -270,13 +554,87 @@ func (h *SMSHandler) SendOverdueReminders(c *gin.Context) {
 	})
 }
 
+// DeliveryWebhook records SMS delivery reports posted by the provider.
+// Accepts JSON or Africa's Talking form posts (id, status, failureReason).
+func (h *SMSHandler) DeliveryWebhook(c *gin.Context) {
+	secret := c.GetHeader("X-Webhook-Secret")
+	expectedSecret := os.Getenv("WEBHOOK_SECRET")
+
+	if expectedSecret != "" && secret != expectedSecret {
+		Unauthorized(c, "Invalid webhook secret")
+		return
+	}
+
+	var req SMSDeliveryReport
+	if err := c.ShouldBind(&req); err != nil {
+		BadRequest(c, "Invalid payload", err)
+		return
+	}
+
+	if req.MessageID == "" {
+		BadRequest(c, "Message ID is required", nil)
+		return
+	}
+
+	status, ok := deliveryStatuses[strings.ToLower(req.Status)]
+	if !ok {
+		BadRequest(c, "Unknown delivery status: "+req.Status, nil)
+		return
+	}
+
+	if err := h.smsService.UpdateDeliveryStatus(c.Request.Context(), req.MessageID, status, req.Error); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "SMS log not found")
+		} else {
+			InternalServerError(c, "Failed to update delivery status", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "processed", gin.H{
+		"message_id": req.MessageID,
+		"status":     status,
+	})
+}
+
+// deliveryStatuses maps provider status values onto SMSLog statuses
+var deliveryStatuses = map[string]string{
+	"delivered":   "delivered",
+	"success":     "delivered",
+	"failed":      "failed",
+	"rejected":    "failed",
+	"undelivered": "undelivered",
+	"sent":        "sent",
+	"submitted":   "sent",
+	"buffered":    "pending",
+}
+
 // Request/Response DTOs
+type SMSDeliveryReport struct {
+	MessageID string `json:"message_id" form:"id"`
+	Status    string `json:"status" form:"status"`
+	Timestamp string `json:"timestamp" form:"timestamp"`
+	Error     string `json:"error,omitempty" form:"failureReason"`
+}
+
 type BulkSMSRequest struct {
 	BillIDs      []string `json:"bill_ids,omitempty"`
 	SendToUnpaid bool     `json:"send_to_unpaid"`
 	TemplateID   string   `json:"template_id,omitempty"`
 }
 
+type BulkSMSResult struct {
+	BillID     string `json:"bill_id"`
+	BillNumber string `json:"bill_number"`
+	Meter      string `json:"meter"`
+}
+
+type BulkSMSError struct {
+	BillID string `json:"bill_id"`
+	Meter  string `json:"meter"`
+	Error  string `json:"error"`
+}
+
 type PaymentConfirmationRequest struct {
 	MeterNumber   string  `json:"meter_number,omitempty"`
 	BillID        string  `json:"bill_id,omitempty"`
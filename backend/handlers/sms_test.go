@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSMSLogFilterParsesDates(t *testing.T) {
+	filter, err := smsLogFilter("M-001", "", "2026-03-01", "2026-03-31", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sentAt, ok := filter["sent_at"].(bson.M)
+	if !ok {
+		t.Fatalf("sent_at = %#v, want a range", filter["sent_at"])
+	}
+	from, _ := sentAt["$gte"].(time.Time)
+	to, _ := sentAt["$lt"].(time.Time)
+	if !from.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("sent_at range = [%v, %v), want March 2026", sentAt["$gte"], sentAt["$lt"])
+	}
+	if filter["meter_number"] != "M-001" {
+		t.Errorf("meter_number = %v", filter["meter_number"])
+	}
+
+	if _, err := smsLogFilter("", "", "March", "", time.Now()); err == nil {
+		t.Error("invalid startDate was accepted")
+	}
+}
+
+func TestSMSLogFilterDefaultsToLastMonth(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	filter, _ := smsLogFilter("", "", "", "", now)
+
+	sentAt := filter["sent_at"].(bson.M)
+	if from := sentAt["$gte"].(time.Time); !from.Equal(now.AddDate(0, 0, -30)) {
+		t.Errorf("default range starts %s, want 30 days back", from)
+	}
+}
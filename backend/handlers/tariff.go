@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TariffHandler struct {
+	tariffService *services.TariffService
+}
+
+func NewTariffHandler(tariffService *services.TariffService) *TariffHandler {
+	return &TariffHandler{
+		tariffService: tariffService,
+	}
+}
+
+// CreateTariff creates a new tariff
+// @Summary Create a tariff
+// @Description Create a new water tariff. Tiers must be contiguous and non-overlapping
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param tariff body models.Tariff true "Tariff data"
+// @Success 201 {object} Response "Tariff created successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 409 {object} Response "Tariff already exists"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs [post]
+func (h *TariffHandler) CreateTariff(c *gin.Context) {
+	var tariff models.Tariff
+	if err := c.ShouldBindJSON(&tariff); err != nil {
+		BadRequest(c, "Invalid tariff data", err)
+		return
+	}
+
+	if tariff.Code == "" || tariff.Name == "" || tariff.CustomerType == "" {
+		BadRequest(c, "Code, name and customer type are required", nil)
+		return
+	}
+
+	if err := h.tariffService.CreateTariff(c.Request.Context(), &tariff); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			ErrorResponse(c, http.StatusConflict, "Tariff already exists", err)
+		} else if strings.HasPrefix(err.Error(), "error") || strings.HasPrefix(err.Error(), "failed") {
+			InternalServerError(c, "Failed to create tariff", err)
+		} else {
+			BadRequest(c, "Invalid tariff", err)
+		}
+		return
+	}
+
+	CreatedResponse(c, "Tariff created successfully", tariff)
+}
+
+// GetTariffs lists tariffs
+// @Summary List tariffs
+// @Description List tariffs, optionally filtered by customer type
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param customer_type query string false "Customer type"
+// @Param active query bool false "Only active tariffs"
+// @Success 200 {object} Response "Tariffs retrieved"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs [get]
+func (h *TariffHandler) GetTariffs(c *gin.Context) {
+	customerType := c.Query("customer_type")
+	activeOnly := c.Query("active") == "true"
+
+	tariffs, err := h.tariffService.ListTariffs(c.Request.Context(), customerType, activeOnly)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch tariffs", err)
+		return
+	}
+
+	SuccessResponse(c, "Tariffs retrieved", tariffs)
+}
+
+// GetTariff gets a tariff by code
+// @Summary Get tariff by code
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param code path string true "Tariff code"
+// @Success 200 {object} Response "Tariff found"
+// @Failure 404 {object} Response "Tariff not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs/{code} [get]
+func (h *TariffHandler) GetTariff(c *gin.Context) {
+	code := c.Param("code")
+
+	tariff, err := h.tariffService.GetTariffByCode(c.Request.Context(), code)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch tariff", err)
+		return
+	}
+
+	if tariff == nil {
+		NotFound(c, "Tariff not found")
+		return
+	}
+
+	SuccessResponse(c, "Tariff found", tariff)
+}
+
+// GetActiveTariff gets the tariff currently in force for a customer type
+// @Summary Get active tariff
+// @Description Get the tariff in force for a customer type on a date (defaults to today)
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param customer_type query string true "Customer type"
+// @Param date query string false "Date (YYYY-MM-DD)"
+// @Success 200 {object} Response "Tariff found"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "No active tariff"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs/active [get]
+func (h *TariffHandler) GetActiveTariff(c *gin.Context) {
+	customerType := c.Query("customer_type")
+	if customerType == "" {
+		BadRequest(c, "Customer type is required", nil)
+		return
+	}
+
+	at := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		date, err := utils.ParseDateString(dateStr)
+		if err != nil {
+			BadRequest(c, "Invalid date format. Use YYYY-MM-DD", err)
+			return
+		}
+		at = date
+	}
+
+	tariff, err := h.tariffService.GetActiveTariff(c.Request.Context(), customerType, at)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch active tariff", err)
+		return
+	}
+
+	if tariff == nil {
+		NotFound(c, "No active tariff for customer type "+customerType)
+		return
+	}
+
+	SuccessResponse(c, "Active tariff found", tariff)
+}
+
+// UpdateTariff updates a tariff
+// @Summary Update tariff
+// @Description Replace the editable fields of a tariff
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param code path string true "Tariff code"
+// @Param tariff body models.Tariff true "Tariff data"
+// @Success 200 {object} Response "Tariff updated successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Tariff not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs/{code} [put]
+func (h *TariffHandler) UpdateTariff(c *gin.Context) {
+	code := c.Param("code")
+
+	var tariff models.Tariff
+	if err := c.ShouldBindJSON(&tariff); err != nil {
+		BadRequest(c, "Invalid tariff data", err)
+		return
+	}
+
+	if err := h.tariffService.UpdateTariff(c.Request.Context(), code, &tariff); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Tariff not found")
+		} else if strings.HasPrefix(err.Error(), "error") {
+			InternalServerError(c, "Failed to update tariff", err)
+		} else {
+			BadRequest(c, "Invalid tariff", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Tariff updated successfully", nil)
+}
+
+// DeactivateTariff deactivates a tariff
+// @Summary Deactivate tariff
+// @Tags Tariffs
+// @Accept json
+// @Produce json
+// @Param code path string true "Tariff code"
+// @Success 200 {object} Response "Tariff deactivated successfully"
+// @Failure 404 {object} Response "Tariff not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /tariffs/{code} [delete]
+func (h *TariffHandler) DeactivateTariff(c *gin.Context) {
+	code := c.Param("code")
+
+	if err := h.tariffService.DeactivateTariff(c.Request.Context(), code); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFound(c, "Tariff not found")
+		} else {
+			InternalServerError(c, "Failed to deactivate tariff", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Tariff deactivated successfully", nil)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"strings"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TemplateHandler struct {
+	templateService *services.TemplateService
+}
+
+func NewTemplateHandler(templateService *services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{
+		templateService: templateService,
+	}
+}
+
+// CreateTemplate creates a notification template
+// @Summary Create a notification template
+// @Description Create an SMS or email template. Activating it deactivates the current template with the same name and language
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param template body models.NotificationTemplate true "Template data"
+// @Success 201 {object} Response "Template created successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /templates [post]
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	var template models.NotificationTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		BadRequest(c, "Invalid template data", err)
+		return
+	}
+
+	if err := h.templateService.CreateTemplate(c.Request.Context(), &template); err != nil {
+		if strings.HasPrefix(err.Error(), "error") || strings.HasPrefix(err.Error(), "failed") {
+			InternalServerError(c, "Failed to create template", err)
+		} else {
+			BadRequest(c, "Invalid template", err)
+		}
+		return
+	}
+
+	CreatedResponse(c, "Template created successfully", template)
+}
+
+// GetTemplates lists notification templates
+// @Summary List notification templates
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param language query string false "Language code (e.g. en, sw)"
+// @Param type query string false "Template type (sms, email)"
+// @Success 200 {object} Response "Templates retrieved"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /templates [get]
+func (h *TemplateHandler) GetTemplates(c *gin.Context) {
+	templates, err := h.templateService.ListTemplates(c.Request.Context(), c.Query("language"), c.Query("type"))
+	if err != nil {
+		InternalServerError(c, "Failed to fetch templates", err)
+		return
+	}
+
+	SuccessResponse(c, "Templates retrieved", templates)
+}
+
+// GetTemplate gets a notification template by ID
+// @Summary Get notification template
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Success 200 {object} Response "Template found"
+// @Failure 400 {object} Response "Invalid template ID"
+// @Failure 404 {object} Response "Template not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /templates/{id} [get]
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		BadRequest(c, "Invalid template ID format", err)
+		return
+	}
+
+	template, err := h.templateService.GetTemplateByID(c.Request.Context(), id)
+	if err != nil {
+		InternalServerError(c, "Failed to fetch template", err)
+		return
+	}
+
+	if template == nil {
+		NotFound(c, "Template not found")
+		return
+	}
+
+	SuccessResponse(c, "Template found", template)
+}
+
+// UpdateTemplate updates a notification template
+// @Summary Update notification template
+// @Description Replace the editable fields of a template
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param template body models.NotificationTemplate true "Template data"
+// @Success 200 {object} Response "Template updated successfully"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Template not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /templates/{id} [put]
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		BadRequest(c, "Invalid template ID format", err)
+		return
+	}
+
+	var template models.NotificationTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		BadRequest(c, "Invalid template data", err)
+		return
+	}
+
+	if err := h.templateService.UpdateTemplate(c.Request.Context(), id, &template); err != nil {
+		if err.Error() == "template not found" {
+			NotFound(c, "Template not found")
+		} else if strings.HasPrefix(err.Error(), "error") {
+			InternalServerError(c, "Failed to update template", err)
+		} else {
+			BadRequest(c, "Invalid template", err)
+		}
+		return
+	}
+
+	SuccessResponse(c, "Template updated successfully", template)
+}
+
+// ToggleTemplateStatus activates or deactivates a notification template
+// @Summary Activate or deactivate template
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ID"
+// @Param status body ToggleStatusRequest true "Status"
+// @Success 200 {object} Response "Template status updated"
+// @Failure 400 {object} Response "Invalid input"
+// @Failure 404 {object} Response "Template not found"
+// @Failure 500 {object} Response "Internal server error"
+// @Router /templates/{id}/status [patch]
+func (h *TemplateHandler) ToggleTemplateStatus(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		BadRequest(c, "Invalid template ID format", err)
+		return
+	}
+
+	var req ToggleStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Invalid request body", err)
+		return
+	}
+	active, ok := req.active()
+	if !ok {
+		BadRequest(c, "is_active is required", nil)
+		return
+	}
+
+	if err := h.templateService.SetTemplateStatus(c.Request.Context(), id, active); err != nil {
+		if err.Error() == "template not found" {
+			NotFound(c, "Template not found")
+		} else {
+			InternalServerError(c, "Failed to update template status", err)
+		}
+		return
+	}
+
+	status := "activated"
+	if !active {
+		status = "deactivated"
+	}
+	SuccessResponse(c, "Template "+status+" successfully", nil)
+}
@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +23,9 @@ import (
 	"waterbilling/backend/database"
 	"waterbilling/backend/handlers"
 	"waterbilling/backend/middleware"
+	"waterbilling/backend/models"
 	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
 )
 
 func main() {
@@ -29,7 +38,14 @@ func main() {
 	if err := database.Connect(); err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
-	defer database.Disconnect()
+
+	// Unique constraints must exist even if scripts/init.go was never run
+	if err := database.EnsureIndexes(); err != nil {
+		log.Printf("⚠️ %v; duplicates will not be rejected by the database", err)
+	}
+	if err := database.MigratePhoneIndex(); err != nil {
+		log.Printf("⚠️ Customer phone index: %v", err)
+	}
 
 	// Initialize collections
 	collections := initializeCollections()
@@ -41,10 +57,19 @@ func main() {
 	handlers := initializeHandlers(services)
 
 	// Initialize Gin router with middleware
-	router := setupRouter(handlers, services.JWT)
+	router := setupRouter(handlers, services.JWT, services.Photos)
+
+	// Recurring jobs stop before the database connection closes
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	startScheduler(jobsCtx, services, collections.JobLocks)
 
-	// Start server
+	// Start server; returns once in-flight requests have drained after SIGINT/SIGTERM
 	startServer(router)
+	stopJobs()
+
+	log.Println("🛑 Closing MongoDB connection")
+	database.Disconnect()
+	log.Println("👋 Shutdown complete")
 }
 
 // Collections holds all MongoDB collections
@@ -57,6 +82,10 @@ type Collections struct {
 	SMSLogs   *mongo.Collection
 	Tariffs   *mongo.Collection
 	Templates *mongo.Collection
+	Blacklist *mongo.Collection
+	OTPs      *mongo.Collection
+	Audit     *mongo.Collection
+	JobLocks  *mongo.Collection
 }
 
 func initializeCollections() *Collections {
@@ -71,6 +100,10 @@ func initializeCollections() *Collections {
 		SMSLogs:   db.Collection("sms_logs"),
 		Tariffs:   db.Collection("tariffs"),
 		Templates: db.Collection("notification_templates"),
+		Blacklist: db.Collection("jwt_blacklist"),
+		OTPs:      db.Collection("portal_otps"),
+		Audit:     db.Collection("audit_logs"),
+		JobLocks:  db.Collection("job_locks"),
 	}
 }
 
@@ -82,21 +115,56 @@ type Services struct {
 	JWT      *services.JWTService
 	SMS      *services.SMSService
 	Payment  *services.PaymentService
+	Tariff   *services.TariffService
+	Template *services.TemplateService
+	Portal   *services.PortalService
+	Reset    *services.PasswordResetService
+	Audit    *services.AuditService
+	Health   *services.HealthService
+	Photos   services.PhotoStore
 }
 
 func initializeServices(collections *Collections) *Services {
-	// JWT Service
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-secret-key-change-in-production"
-		log.Println("WARNING: Using default JWT secret. Set JWT_SECRET in .env for production!")
-	}
+	// Company name, paybill, support phone and rate used on bills and customer messages
+	services.LoadCompanyConfig()
 
+	// JWT Service - RS256 when keys are configured, otherwise HS256 with JWT_SECRET
 	tokenDuration := 24 * time.Hour // Tokens valid for 24 hours
-	jwtService := services.NewJWTService(jwtSecret, tokenDuration)
+	rsaKeys, err := services.LoadRSAKeys()
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
 
-	// Customer Service
-	customerService := services.NewCustomerService(collections.Customers, collections.Tariffs)
+	var jwtService *services.JWTService
+	if rsaKeys != nil {
+		jwtService = services.NewRSAJWTService(rsaKeys, tokenDuration, collections.Blacklist)
+		log.Println("🔑 JWT tokens signed with RS256")
+	} else {
+		const defaultJWTSecret = "your-secret-key-change-in-production"
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			jwtSecret = defaultJWTSecret
+			log.Println("WARNING: Using default JWT secret. Set JWT_SECRET in .env for production!")
+		}
+		if jwtSecret == defaultJWTSecret && os.Getenv("ENV") == "production" {
+			log.Fatal("Refusing to start in production with the default JWT secret; set JWT_SECRET or JWT_PRIVATE_KEY_PATH")
+		}
+		jwtService = services.NewJWTService(jwtSecret, tokenDuration, collections.Blacklist)
+	}
+
+	// Issuer defaults per environment so a dev token is not accepted in production
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "waterbilling"
+		if env := os.Getenv("ENV"); env != "" {
+			jwtIssuer += "-" + env
+		}
+	}
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "waterbilling-api"
+	}
+	jwtService.SetIssuerAudience(jwtIssuer, jwtAudience)
 
 	// SMS Service - Initialize FIRST so it can be passed to other services
 	smsService, err := services.NewSMSService(database.DB)
@@ -105,6 +173,12 @@ func initializeServices(collections *Collections) *Services {
 		log.Println("SMS functionality will be disabled. Set TWILIO credentials in .env to enable.")
 	}
 
+	// Customer Service
+	customerService := services.NewCustomerService(collections.Customers, collections.Tariffs, collections.Bills, smsService)
+
+	// Email Service - mock mode when SMTP is not configured
+	emailService := services.NewEmailService()
+
 	// Billing Service - NOW WITH SMS SERVICE INCLUDED
 	billingService := services.NewBillingService(
 		collections.Customers,
@@ -113,11 +187,16 @@ func initializeServices(collections *Collections) *Services {
 		collections.Payments,
 		collections.Tariffs,
 		smsService,
+		emailService,
 	)
 
 	// User Service
 	userService := services.NewUserService(collections.Users)
 	paymentService := services.NewPaymentService(collections.Payments)
+	tariffService := services.NewTariffService(collections.Tariffs)
+	templateService := services.NewTemplateService(collections.Templates)
+	portalService := services.NewPortalService(collections.OTPs, collections.Customers, smsService, jwtService)
+	photoStore := services.NewPhotoStore()
 
 	return &Services{
 		Customer: customerService,
@@ -126,6 +205,13 @@ func initializeServices(collections *Collections) *Services {
 		JWT:      jwtService,
 		SMS:      smsService,
 		Payment:  paymentService,
+		Tariff:   tariffService,
+		Template: templateService,
+		Portal:   portalService,
+		Reset:    services.NewPasswordResetService(collections.OTPs, userService, smsService, jwtService),
+		Audit:    services.NewAuditService(collections.Audit),
+		Health:   services.NewHealthService(database.DB, smsService),
+		Photos:   photoStore,
 	}
 }
 
@@ -137,21 +223,38 @@ type Handlers struct {
 	Dashboard *handlers.DashboardHandler
 	Auth      *handlers.AuthHandler
 	Payment   *handlers.PaymentHandler
+	Tariff    *handlers.TariffHandler
+	Template  *handlers.TemplateHandler
+	Portal    *handlers.PortalHandler
+	Audit     *handlers.AuditHandler
+	Health    *handlers.HealthHandler
 }
 
 func initializeHandlers(svc *Services) *Handlers {
 	return &Handlers{
-		Customer: handlers.NewCustomerHandler(svc.Customer),
+		Customer: handlers.NewCustomerHandler(svc.Customer, svc.Audit),
 		// ✅ Updated: Pass both Billing and User services to BillingHandler
-		Billing:   handlers.NewBillingHandler(svc.Billing, svc.User),
+		Billing:   handlers.NewBillingHandler(svc.Billing, svc.User, svc.Photos, svc.Audit),
 		SMS:       handlers.NewSMSHandler(svc.Billing, svc.SMS),
 		Dashboard: handlers.NewDashboardHandler(svc.Billing, svc.Customer),
-		Auth:      handlers.NewAuthHandler(svc.User, svc.JWT),
-		Payment:   handlers.NewPaymentHandler(svc.Payment, svc.Billing),
+		Auth:      handlers.NewAuthHandler(svc.User, svc.JWT, svc.Reset, svc.Audit),
+		Payment:   handlers.NewPaymentHandler(svc.Payment, svc.Billing, svc.Audit),
+		Tariff:    handlers.NewTariffHandler(svc.Tariff),
+		Template:  handlers.NewTemplateHandler(svc.Template),
+		Portal:    handlers.NewPortalHandler(svc.Portal),
+		Audit:     handlers.NewAuditHandler(svc.Audit),
+		Health:    handlers.NewHealthHandler(svc.Health),
 	}
 }
 
-func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
+// customerRecordRoles may read a customer's details, bills and readings.
+// Customers and readers are further limited to their own meter or zone by the handlers.
+var customerRecordRoles = []string{"admin", "manager", "customer_service", "cashier", "reader", "customer"}
+
+// customerListRoles may search and list customers. Readers are limited to their zone by the handlers.
+var customerListRoles = []string{"admin", "manager", "customer_service", "cashier", "reader"}
+
+func setupRouter(h *Handlers, jwtService *services.JWTService, photoStore services.PhotoStore) *gin.Engine {
 	// Set Gin mode
 	if os.Getenv("ENV") == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -161,39 +264,74 @@ func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
 
 	router := gin.New()
 
+	// Client IPs come from X-Forwarded-For only when the request arrives through one of these
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		var trusted []string
+		for _, proxy := range strings.Split(proxies, ",") {
+			trusted = append(trusted, strings.TrimSpace(proxy))
+		}
+		if err := router.SetTrustedProxies(trusted); err != nil {
+			log.Printf("⚠️ Invalid TRUSTED_PROXIES: %v", err)
+		}
+	}
+
 	// Global middleware
+	router.Use(middleware.RequestIDMiddleware())
 	router.Use(middleware.CORSMiddleware())
 	router.Use(middleware.LoggingMiddleware())
 	router.Use(gin.Recovery()) // Recovery from panics
+	router.Use(middleware.RequestTimeoutMiddleware())
+
+	// Meter photos kept on local disk are served by the API
+	if local, ok := photoStore.(*services.LocalPhotoStore); ok {
+		router.Static(local.URLPath, local.Dir)
+	}
 
 	// API Routes
 	api := router.Group("/api/v1")
 	{
 		// Public routes (no authentication required)
+		// Throttle credential guessing: RATE_LIMIT_LOGIN_RPS/_BURST per IP
+		loginLimit := middleware.RateLimitFromEnv("RATE_LIMIT_LOGIN", 1, 5)
+
 		public := api.Group("/auth")
 		{
-			public.POST("/login", h.Auth.Login)
+			public.POST("/login", loginLimit, h.Auth.Login)
 			public.POST("/refresh-token", h.Auth.RefreshToken)
-			public.POST("/register", h.Auth.Register)
 			public.POST("/setup-admin", setupInitialAdmin)
+			public.POST("/forgot-password", loginLimit, h.Auth.ForgotPassword)
+			public.POST("/reset-password", loginLimit, h.Auth.ResetForgottenPassword)
+		}
+
+		// Customer portal login (OTP by SMS)
+		portal := api.Group("/portal")
+		portal.Use(middleware.RateLimitFromEnv("RATE_LIMIT_OTP", 1, 3))
+		{
+			portal.POST("/request-otp", h.Portal.RequestOTP)
+			portal.POST("/verify-otp", h.Portal.VerifyOTP)
 		}
 
 		// Protected routes (require authentication)
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware(jwtService))
+		protected.Use(middleware.CustomerScopeMiddleware())
 		{
 			// Customer routes
 			customers := protected.Group("/customers")
 			{
 				customers.GET("", middleware.RoleMiddleware("admin", "manager"), h.Customer.GetCustomers)
 				customers.POST("", middleware.RoleMiddleware("admin", "manager"), h.Customer.CreateCustomer)
-				customers.GET("/meter/:meterNumber", h.Customer.GetCustomerByMeterNumber)
-				customers.GET("/search", h.Customer.SearchCustomers)
-				customers.GET("/zone/:zone", h.Customer.GetCustomersByZone)
+				customers.GET("/meter/:meterNumber", middleware.RoleMiddleware(customerRecordRoles...), h.Customer.GetCustomerByMeterNumber)
+				customers.GET("/search", middleware.RoleMiddleware(customerListRoles...), h.Customer.SearchCustomers)
+				customers.GET("/zone/:zone", middleware.RoleMiddleware(customerListRoles...), h.Customer.GetCustomersByZone)
 				customers.PUT("/meter/:meterNumber", middleware.RoleMiddleware("admin", "manager", "customer_service"), h.Customer.UpdateCustomer)
 				customers.PUT("/meter/:meterNumber/status", middleware.RoleMiddleware("admin", "manager"), h.Customer.UpdateCustomerStatus)
+				customers.PUT("/meter/:meterNumber/sms-preferences", middleware.RoleMiddleware("admin", "manager", "customer_service"), h.Customer.UpdateSMSPreferences)
+				customers.POST("/meter/:meterNumber/reconnect", middleware.RoleMiddleware("admin", "manager"), h.Customer.ReconnectCustomer)
 				customers.GET("/statistics", middleware.RoleMiddleware("admin", "manager"), h.Customer.GetCustomerStatistics)
 				customers.POST("/bulk", middleware.RoleMiddleware("admin"), h.Customer.BulkCreateCustomers)
+				customers.POST("/import", middleware.RoleMiddleware("admin"), h.Customer.ImportCustomers)
+				customers.GET("/export", middleware.RoleMiddleware("admin", "manager"), h.Customer.ExportCustomers)
 				customers.DELETE("/meter/:meterNumber", middleware.RoleMiddleware("admin"), h.Customer.DeleteCustomer)
 			}
 
@@ -203,20 +341,38 @@ func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
 				// Meter readings
 				billing.POST("/readings", middleware.RoleMiddleware("admin", "reader", "manager"), h.Billing.SubmitMeterReading)
 				billing.POST("/readings/bulk", middleware.RoleMiddleware("admin", "reader", "manager"), h.Billing.BulkSubmitReadings)
+				billing.POST("/readings/:readingID/dispute", middleware.RoleMiddleware("admin", "manager", "customer_service"), h.Billing.DisputeReading)
+				billing.POST("/readings/:readingID/resolve", middleware.RoleMiddleware("admin", "manager"), h.Billing.ResolveDispute)
+				billing.PUT("/readings/:readingID", middleware.RoleMiddleware("admin", "manager"), h.Billing.CorrectReading)
+				billing.POST("/readings/:readingID/photo", middleware.RoleMiddleware("admin", "reader", "manager"), h.Billing.UploadReadingPhoto)
+				billing.GET("/readings/flagged", middleware.RoleMiddleware("admin", "manager"), h.Billing.GetFlaggedReadings)
+				billing.GET("/readings/near", middleware.RoleMiddleware("admin", "manager"), h.Billing.GetReadingsNear)
+				billing.POST("/readings/estimate", middleware.RoleMiddleware("admin", "manager"), h.Billing.GenerateEstimatedReading)
 
 				// Customer billing info
-				billing.GET("/customers/:meterNumber/bills", h.Billing.GetCustomerBills)
-				billing.GET("/customers/:meterNumber/readings", h.Billing.GetCustomerReadingHistory)
-				billing.GET("/bills/:id", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Billing.GetBillByID)
+				billing.GET("/customers/:meterNumber/bills", middleware.RoleMiddleware(customerRecordRoles...), h.Billing.GetCustomerBills)
+				billing.GET("/customers/:meterNumber/readings", middleware.RoleMiddleware(customerRecordRoles...), h.Billing.GetCustomerReadingHistory)
+				billing.GET("/customers/:meterNumber/trend", middleware.RoleMiddleware(customerRecordRoles...), h.Billing.GetConsumptionTrend)
+				billing.POST("/customers/:meterNumber/pay", middleware.RoleMiddleware("admin", "cashier"), h.Billing.ProcessCustomerPayment)
+				billing.GET("/bills/:billID", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Billing.GetBillDetails)
 				billing.GET("/bills", middleware.RoleMiddleware("admin", "manager"), h.Billing.GetAllBills)
+				billing.GET("/bills/export", middleware.RoleMiddleware("admin", "manager"), h.Billing.ExportBills)
 				// Bill management
 				billing.GET("/bills/overdue", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Billing.GetOverdueBills)
 				billing.GET("/bills/unpaid", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Billing.GetUnpaidBills)
+				billing.GET("/bills/:billID/pdf", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Billing.DownloadBillPDF)
+				billing.POST("/bills/:billID/adjust", middleware.RoleMiddleware("admin", "manager"), h.Billing.AdjustBill)
+				billing.POST("/bills/:billID/cancel", middleware.RoleMiddleware("admin"), h.Billing.CancelBill)
 				billing.POST("/bills/:billID/pay", middleware.RoleMiddleware("admin", "cashier"), h.Billing.ProcessPayment)
+				billing.POST("/bills/apply-penalties", middleware.RoleMiddleware("admin"), h.Billing.ApplyLatePenalties)
+				billing.POST("/run-monthly", middleware.RoleMiddleware("admin"), h.Billing.RunMonthlyBilling)
 				// ✅ Added my-readings endpoint
 				billing.GET("/readings/my-readings", middleware.RoleMiddleware("reader"), h.Billing.GetMyReadings)
+				billing.GET("/readings/worklist", middleware.RoleMiddleware("reader"), h.Billing.GetReaderWorklist)
 				// In main.go - add this to your billing routes
 
+				billing.GET("/disconnection-candidates", middleware.RoleMiddleware("admin", "manager"), h.Billing.GetDisconnectionCandidates)
+
 				// Summary and reports
 				billing.GET("/summary", middleware.RoleMiddleware("admin", "manager"), h.Billing.GetBillingSummary)
 			}
@@ -226,24 +382,59 @@ func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
 			{
 				payments.GET("", middleware.RoleMiddleware("admin", "customer_service"), h.Payment.GetPaymentsByMeter)
 				payments.POST("", middleware.RoleMiddleware("admin", "cashier"), h.Payment.RecordPayment)
+				payments.GET("/list", middleware.RoleMiddleware("admin", "manager"), h.Payment.ListPayments)
+				payments.GET("/receipt/:receiptNumber", middleware.RoleMiddleware("admin", "manager", "cashier", "customer_service"), h.Payment.GetPaymentByReceipt)
+				payments.GET("/summary", middleware.RoleMiddleware("admin", "manager", "cashier"), h.Payment.GetCollectionSummary)
+				payments.POST("/:paymentID/reverse", middleware.PermissionMiddleware("payments:reverse"), h.Payment.ReversePayment)
+			}
+
+			// Tariff routes
+			tariffs := protected.Group("/tariffs")
+			tariffs.Use(middleware.RoleMiddleware("admin", "manager"))
+			{
+				tariffs.GET("", h.Tariff.GetTariffs)
+				tariffs.POST("", h.Tariff.CreateTariff)
+				tariffs.GET("/active", h.Tariff.GetActiveTariff)
+				tariffs.GET("/:code", h.Tariff.GetTariff)
+				tariffs.PUT("/:code", h.Tariff.UpdateTariff)
+				tariffs.DELETE("/:code", h.Tariff.DeactivateTariff)
+			}
+
+			// Notification template routes
+			templates := protected.Group("/templates")
+			templates.Use(middleware.RoleMiddleware("admin"))
+			{
+				templates.GET("", h.Template.GetTemplates)
+				templates.POST("", h.Template.CreateTemplate)
+				templates.GET("/:id", h.Template.GetTemplate)
+				templates.PUT("/:id", h.Template.UpdateTemplate)
+				templates.PATCH("/:id/status", h.Template.ToggleTemplateStatus)
 			}
 
 			// SMS routes
 			sms := protected.Group("/sms")
 			sms.Use(middleware.RoleMiddleware("admin", "manager"))
 			{
-				sms.POST("/bills/:billID/notify", h.SMS.SendBillNotification)
-				sms.POST("/bills/bulk-notify", h.SMS.BulkSendBillNotifications)
-				sms.POST("/payments/confirm", h.SMS.SendPaymentConfirmation)
-				sms.POST("/disconnection-warnings", h.SMS.SendDisconnectionWarning)
+				// Sends cost money, so they are limited per user (RATE_LIMIT_SMS_RPS/_BURST)
+				smsLimit := middleware.RateLimitFromEnv("RATE_LIMIT_SMS", 1, 10)
+
+				sms.POST("/bills/:billID/notify", smsLimit, h.SMS.SendBillNotification)
+				sms.POST("/bills/bulk-notify", smsLimit, h.SMS.BulkSendBillNotifications)
+				sms.POST("/payments/confirm", smsLimit, h.SMS.SendPaymentConfirmation)
+				sms.POST("/disconnection-warnings", smsLimit, h.SMS.SendDisconnectionWarning)
 				sms.GET("/logs", h.SMS.GetSMSLogs)
-				sms.POST("/overdue-reminders", h.SMS.SendOverdueReminders)
+				sms.GET("/spend", h.SMS.GetSMSSpend)
+				sms.POST("/overdue-reminders", smsLimit, h.SMS.SendOverdueReminders)
 			}
 
 			// Dashboard routes
 			dashboard := protected.Group("/dashboard")
 			{
 				dashboard.GET("/stats", h.Dashboard.GetDashboardStats)
+				dashboard.GET("/revenue-trend", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetRevenueTrend)
+				dashboard.GET("/top-debtors", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetTopDebtors)
+				dashboard.GET("/aging", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetReceivablesAging)
+				dashboard.GET("/consumption-distribution", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetConsumptionDistribution)
 				dashboard.GET("/reports/:year/:month", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetMonthlyReport)
 				dashboard.GET("/zones/performance", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetZonePerformance)
 				dashboard.GET("/readers/performance", middleware.RoleMiddleware("admin", "manager"), h.Dashboard.GetReaderPerformance)
@@ -255,8 +446,34 @@ func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
 			{
 				users.POST("", h.Auth.Register)
 				users.GET("", h.Auth.GetUsers)
+				users.GET("/:id", h.Auth.GetUser)
 				users.DELETE("/:id", h.Auth.DeleteUser)
-				users.PATCH("/:id/status", h.Auth.ToggleUserStatus)
+				users.PUT("/:id/status", h.Auth.ToggleUserStatus)
+				users.PATCH("/:id/status", h.Auth.ToggleUserStatus) // Used by the mobile app
+				users.PUT("/:id/permissions", h.Auth.SetUserPermissions)
+				users.POST("/:id/reset-password", h.Auth.ResetUserPassword)
+			}
+
+			// Maintenance jobs that can also be triggered by hand (admin only)
+			jobs := protected.Group("/jobs")
+			jobs.Use(middleware.RoleMiddleware("admin"))
+			{
+				jobs.POST("/mark-overdue", h.Billing.MarkOverdueBills)
+				jobs.POST("/retry-sms", h.SMS.RetryFailedSMS)
+			}
+
+			// Database usage for operations (admin only)
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RoleMiddleware("admin"))
+			{
+				admin.GET("/db-stats", h.Health.GetDatabaseStats)
+			}
+
+			// Audit trail of financial and account changes (admin only)
+			audit := protected.Group("/audit")
+			audit.Use(middleware.RoleMiddleware("admin"))
+			{
+				audit.GET("", h.Audit.GetAuditLogs)
 			}
 
 			// Profile routes (authenticated users)
@@ -272,13 +489,18 @@ func setupRouter(h *Handlers, jwtService *services.JWTService) *gin.Engine {
 		// Webhook routes (public but with secret validation)
 		webhooks := api.Group("/webhooks")
 		{
-			webhooks.POST("/sms-delivery", handleSMSDeliveryWebhook)
-			webhooks.POST("/mpesa-callback", handleMpesaWebhook)
+			webhooks.POST("/sms-delivery", h.SMS.DeliveryWebhook)
+			// Safaricom addresses only (MPESA_ALLOWED_IPS); with MPESA_CALLBACK_TOKEN set, the
+			// callback URL registered with Daraja must end in /mpesa-callback/<token>
+			mpesa := webhooks.Group("", middleware.MpesaCallbackMiddleware())
+			mpesa.POST("/mpesa-callback", h.Payment.MpesaCallback)
+			mpesa.POST("/mpesa-callback/:token", h.Payment.MpesaCallback)
 		}
 	}
 
 	// Health check and info endpoints (public)
 	router.GET("/health", healthCheck)
+	router.GET("/health/detailed", h.Health.DetailedHealth)
 	router.GET("/", rootHandler)
 	router.GET("/info", systemInfo)
 
@@ -302,9 +524,124 @@ func startServer(router *gin.Engine) {
 	log.Printf("📚 API Documentation available at http://%s/api/v1/docs", address)
 	log.Printf("🔧 Environment: %s", os.Getenv("ENV"))
 
-	if err := router.Run(address); err != nil {
-		log.Fatal("Failed to start server:", err)
+	srv := &http.Server{
+		Addr:    address,
+		Handler: router,
 	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			database.Disconnect()
+			log.Fatal("Failed to start server:", err)
+		}
+		return
+	case sig := <-stop:
+		log.Printf("🛑 Received %s, shutting down", sig)
+	}
+
+	// Stop accepting connections and let in-flight requests (payments in particular) finish
+	timeout := 30 * time.Second
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+	log.Printf("⏳ Draining connections (up to %s)", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("⚠️ Server did not drain in time: %v", err)
+		return
+	}
+	log.Println("✅ HTTP server stopped")
+}
+
+// startScheduler runs the recurring jobs in the background unless SCHEDULER_ENABLED=false.
+// Jobs that charge or message customers are off until enabled with JOB_<NAME>_ENABLED=true.
+func startScheduler(ctx context.Context, svc *Services, locks *mongo.Collection) {
+	if enabled, err := strconv.ParseBool(os.Getenv("SCHEDULER_ENABLED")); err == nil && !enabled {
+		log.Println("⏸️ Background scheduler disabled")
+		return
+	}
+
+	scheduler := services.NewScheduler(locks)
+
+	scheduler.Add(services.Job{
+		Name:     "mark_overdue",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			marked, err := svc.Billing.MarkOverdueBills(ctx)
+			return fmt.Sprintf("%d bills marked overdue", marked), err
+		},
+	}, true)
+
+	scheduler.Add(services.Job{
+		Name:     "apply_penalties",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			rate := 0.05
+			if v, err := strconv.ParseFloat(os.Getenv("PENALTY_RATE"), 64); err == nil && v > 0 && v <= 1 {
+				rate = v
+			}
+			result, err := svc.Billing.ApplyLatePenalties(ctx, rate)
+			if err != nil {
+				return "", err
+			}
+			svc.Audit.Record(ctx, models.AuditLog{
+				ActorID:    "scheduler",
+				ActorRole:  "system",
+				Action:     "bill.penalties",
+				TargetType: "bill",
+				After: map[string]interface{}{
+					"penalty_rate":    result.PenaltyRate,
+					"bills_penalized": result.BillsPenalized,
+					"total_penalty":   result.TotalPenalty,
+				},
+			})
+			return fmt.Sprintf("%d bills penalized, KSh %.2f total, %d failed",
+				result.BillsPenalized, result.TotalPenalty, result.Failed), nil
+		},
+	}, false)
+
+	scheduler.Add(services.Job{
+		Name:     "overdue_reminders",
+		Interval: 24 * time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			svc.Billing.SendOverdueReminders()
+			return "reminders queued", nil
+		},
+	}, false)
+
+	// Only sends what quiet hours held back, so it is on whenever quiet hours may be
+	scheduler.Add(services.Job{
+		Name:     "flush_sms_queue",
+		Interval: 5 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			sent, failed, err := svc.SMS.FlushQueuedSMS(ctx)
+			return fmt.Sprintf("%d queued SMS sent, %d failed", sent, failed), err
+		},
+	}, true)
+
+	scheduler.Add(services.Job{
+		Name:     "retry_sms",
+		Interval: 15 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			retried, succeeded, err := svc.SMS.RetryFailedSMS(ctx, 0, 0)
+			return fmt.Sprintf("%d SMS retried, %d sent", retried, succeeded), err
+		},
+	}, false)
+
+	scheduler.Start(ctx)
 }
 
 // Health check endpoint
@@ -334,10 +671,11 @@ func rootHandler(c *gin.Context) {
 		"service": "Water Billing System API",
 		"version": "1.0.0",
 		"endpoints": map[string]string{
-			"api":    "/api/v1",
-			"docs":   "/api/v1/docs",
-			"health": "/health",
-			"info":   "/info",
+			"api":             "/api/v1",
+			"docs":            "/api/v1/docs",
+			"health":          "/health",
+			"detailed_health": "/health/detailed",
+			"info":            "/info",
 		},
 		"description": "API for water company billing system with customer management, meter readings, billing, and SMS notifications",
 	})
@@ -365,44 +703,20 @@ func systemInfo(c *gin.Context) {
 	})
 }
 
-// SMS delivery webhook handler
-func handleSMSDeliveryWebhook(c *gin.Context) {
-	var payload struct {
-		MessageID string `json:"message_id"`
-		Status    string `json:"status"`
-		Timestamp string `json:"timestamp"`
-		Error     string `json:"error,omitempty"`
-	}
-
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid payload"})
-		return
-	}
-
-	secret := c.GetHeader("X-Webhook-Secret")
-	expectedSecret := os.Getenv("WEBHOOK_SECRET")
-
-	if expectedSecret != "" && secret != expectedSecret {
-		c.JSON(401, gin.H{"error": "Invalid webhook secret"})
-		return
-	}
-
-	c.JSON(200, gin.H{"status": "processed"})
-}
-
-// M-Pesa webhook handler
-func handleMpesaWebhook(c *gin.Context) {
-	c.JSON(200, gin.H{"status": "received"})
-}
-
 // Helper function to get SMS provider info
 func getSMSProviderInfo() string {
-	if os.Getenv("TWILIO_ACCOUNT_SID") != "" {
+	switch os.Getenv("SMS_PROVIDER") {
+	case "twilio":
 		return "Twilio"
+	case "africastalking":
+		return "Africa's Talking"
 	}
 	if os.Getenv("AFRICASTALKING_API_KEY") != "" {
 		return "Africa's Talking"
 	}
+	if os.Getenv("TWILIO_ACCOUNT_SID") != "" {
+		return "Twilio"
+	}
 	return "Not configured"
 }
 
@@ -411,7 +725,7 @@ func setupInitialAdmin(c *gin.Context) {
 	var req struct {
 		Username  string `json:"username" binding:"required"`
 		Email     string `json:"email" binding:"required,email"`
-		Password  string `json:"password" binding:"required,min=6"`
+		Password  string `json:"password" binding:"required"`
 		FirstName string `json:"first_name" binding:"required"`
 		LastName  string `json:"last_name" binding:"required"`
 		Phone     string `json:"phone" binding:"required"`
@@ -426,6 +740,15 @@ func setupInitialAdmin(c *gin.Context) {
 		return
 	}
 
+	if err := utils.ValidatePassword(req.Password, req.Username, req.Email); err != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "weak_password",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	collections := initializeCollections()
 
 	count, err := collections.Users.CountDocuments(c.Request.Context(), gin.H{})
@@ -459,22 +782,23 @@ func setupInitialAdmin(c *gin.Context) {
 
 	now := time.Now()
 	user := bson.M{
-		"_id":           primitive.NewObjectID(),
-		"first_name":    req.FirstName,
-		"last_name":     req.LastName,
-		"email":         req.Email,
-		"phone_number":  req.Phone,
-		"username":      req.Username,
-		"password":      string(hashedPassword),
-		"role":          "admin",
-		"department":    "Administration",
-		"employee_id":   "ADMIN001",
-		"assigned_zone": nil,
-		"permissions":   []string{"*"},
-		"is_active":     true,
-		"last_login":    nil,
-		"created_at":    now,
-		"updated_at":    now,
+		"_id":                 primitive.NewObjectID(),
+		"first_name":          req.FirstName,
+		"last_name":           req.LastName,
+		"email":               req.Email,
+		"phone_number":        req.Phone,
+		"username":            req.Username,
+		"password":            string(hashedPassword),
+		"role":                "admin",
+		"department":          "Administration",
+		"employee_id":         "ADMIN001",
+		"assigned_zone":       nil,
+		"permissions":         []string{"*"},
+		"is_active":           true,
+		"last_login":          nil,
+		"password_changed_at": now,
+		"created_at":          now,
+		"updated_at":          now,
 	}
 
 	result, err := collections.Users.InsertOne(c.Request.Context(), user)
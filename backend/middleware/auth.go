@@ -1,12 +1,16 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"waterbilling/backend/services"
+	"waterbilling/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,9 +21,10 @@ func AuthMiddleware(jwtService *services.JWTService) gin.HandlerFunc {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Authorization header required",
-				"error":   "missing_token",
+				"success":    false,
+				"message":    "Authorization header required",
+				"error":      "missing_token",
+				"request_id": c.GetString("requestID"),
 			})
 			c.Abort()
 			return
@@ -29,9 +34,10 @@ func AuthMiddleware(jwtService *services.JWTService) gin.HandlerFunc {
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Invalid authorization format",
-				"error":   "invalid_format",
+				"success":    false,
+				"message":    "Invalid authorization format",
+				"error":      "invalid_format",
+				"request_id": c.GetString("requestID"),
 			})
 			c.Abort()
 			return
@@ -41,34 +47,83 @@ func AuthMiddleware(jwtService *services.JWTService) gin.HandlerFunc {
 
 		// Validate token
 		claims, err := jwtService.ValidateToken(token)
+		if err != nil || !claims.IsAccessToken() {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success":    false,
+				"message":    "Invalid or expired token",
+				"error":      "invalid_token",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		// Reject tokens revoked by logout
+		revoked, err := jwtService.IsTokenRevoked(c.Request.Context(), token, claims)
 		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":    false,
+				"message":    "Failed to verify token",
+				"error":      "token_check_failed",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Invalid or expired token",
-				"error":   "invalid_token",
+				"success":    false,
+				"message":    "Token has been revoked",
+				"error":      "revoked_token",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		// After an admin password reset the token is only good for choosing a new password
+		if claims.MustChangePassword && !passwordChangeRoute(c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":    false,
+				"message":    "You must change your password before continuing",
+				"error":      "password_change_required",
+				"request_id": c.GetString("requestID"),
 			})
 			c.Abort()
 			return
 		}
 
 		// Set user info in context
+		c.Set("token", token)
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("userRole", claims.Role)
+		c.Set("userPermissions", claims.Permissions)
+		c.Set("meterNumber", claims.MeterNumber)
+		c.Set("userZone", claims.Zone)
 
 		c.Next()
 	}
 }
 
+// passwordChangeRoute reports whether a route stays open to a user who must change their
+// password: viewing their profile, changing the password and logging out
+func passwordChangeRoute(route string) bool {
+	return strings.HasSuffix(route, "/profile") ||
+		strings.HasSuffix(route, "/profile/change-password") ||
+		strings.HasSuffix(route, "/profile/logout")
+}
+
 // RoleMiddleware checks if user has required role
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("userRole")
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"success": false,
-				"message": "Not authenticated",
-				"error":   "not_authenticated",
+				"success":    false,
+				"message":    "Not authenticated",
+				"error":      "not_authenticated",
+				"request_id": c.GetString("requestID"),
 			})
 			c.Abort()
 			return
@@ -85,9 +140,84 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 
 		if !hasRole {
 			c.JSON(http.StatusForbidden, gin.H{
-				"success": false,
-				"message": "Insufficient permissions",
-				"error":   "insufficient_permissions",
+				"success":    false,
+				"message":    "Insufficient permissions",
+				"error":      "insufficient_permissions",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// customerRoutes are the only routes a customer portal token may call, with the method allowed.
+// Routes with a :meterNumber parameter are further limited to the customer's own meter.
+var customerRoutes = map[string]string{
+	"/api/v1/customers/meter/:meterNumber":            http.MethodGet,
+	"/api/v1/billing/customers/:meterNumber/bills":    http.MethodGet,
+	"/api/v1/billing/customers/:meterNumber/readings": http.MethodGet,
+	"/api/v1/profile/logout":                          http.MethodPost,
+}
+
+// CustomerScopeMiddleware confines customer portal tokens to their own meter's read-only routes.
+// Staff tokens pass through unchanged.
+func CustomerScopeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("userRole"); role != "customer" {
+			c.Next()
+			return
+		}
+
+		meterNumber, _ := c.Get("meterNumber")
+		method, allowed := customerRoutes[c.FullPath()]
+		if !allowed || c.Request.Method != method ||
+			(strings.Contains(c.FullPath(), ":meterNumber") && (meterNumber == "" || c.Param("meterNumber") != meterNumber)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":    false,
+				"message":    "Customers can only view their own account",
+				"error":      "insufficient_permissions",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PermissionMiddleware checks if user has the given permission, or the "*" wildcard.
+// Admins always pass, so accounts created before permissions were enforced keep their access.
+// Permissions come from the token, so changes take effect at the user's next login.
+func PermissionMiddleware(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("userRole"); role == "admin" {
+			c.Next()
+			return
+		}
+
+		value, exists := c.Get("userPermissions")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success":    false,
+				"message":    "Not authenticated",
+				"error":      "not_authenticated",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		permissions, _ := value.([]string)
+		if !HasPermission(permissions, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success":    false,
+				"message":    "Insufficient permissions",
+				"error":      "insufficient_permissions",
+				"request_id": c.GetString("requestID"),
 			})
 			c.Abort()
 			return
@@ -97,12 +227,23 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
+// HasPermission reports whether permissions grant permission, either directly or via "*"
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == "*" || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // CORSMiddleware handles CORS
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
@@ -114,6 +255,40 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// RequestIDMiddleware gives every request an ID, taken from an inbound X-Request-ID header
+// or generated. The ID is echoed in the response header, set in the gin context as "requestID"
+// and carried by the request context so services can log it with utils.Logf.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = utils.NewRequestID()
+		}
+
+		c.Set("requestID", requestID)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), requestID))
+		c.Header("X-Request-ID", requestID)
+
+		c.Next()
+	}
+}
+
+// validRequestID accepts caller-supplied IDs of up to 128 letters, digits, '-', '_' and '.',
+// so they can't be used to inject anything into logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // LoggingMiddleware logs requests
 func LoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -129,7 +304,26 @@ func LoggingMiddleware() gin.HandlerFunc {
 		method := c.Request.Method
 		path := c.Request.URL.Path
 		status := c.Writer.Status()
+		requestID := c.GetString("requestID")
+
+		log.Printf("[%s] [%s] %s %s %d %v", requestID, clientIP, method, path, status, duration)
+	}
+}
 
-		fmt.Printf("[%s] %s %s %d %v\n", clientIP, method, path, status, duration)
+// RequestTimeoutMiddleware puts a deadline on the request context so database work is cancelled
+// when a request runs too long or the client goes away.
+// REQUEST_TIMEOUT_SECONDS sets the deadline (default 60).
+func RequestTimeoutMiddleware() gin.HandlerFunc {
+	timeout := 60 * time.Second
+	if v, err := strconv.Atoi(os.Getenv("REQUEST_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
 	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"waterbilling/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+
+	var seen string
+	router.GET("/ping", func(c *gin.Context) {
+		seen = utils.RequestID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		inbound string
+		keep    bool
+	}{
+		{"inbound ID is kept", "mpesa-7f3a.01", true},
+		{"missing ID is generated", "", false},
+		{"unsafe ID is replaced", "abc\ninjected", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.inbound != "" {
+				req.Header.Set("X-Request-ID", tt.inbound)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Header().Get("X-Request-ID")
+			if got == "" {
+				t.Fatal("response has no X-Request-ID header")
+			}
+			if tt.keep && got != tt.inbound {
+				t.Errorf("X-Request-ID = %q, want inbound %q", got, tt.inbound)
+			}
+			if !tt.keep && (got == tt.inbound || len(got) != 36) {
+				t.Errorf("X-Request-ID = %q, want a generated UUID", got)
+			}
+			if seen != got {
+				t.Errorf("request context ID = %q, want %q", seen, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseIPAllowlist(t *testing.T) {
+	list := parseIPAllowlist("")
+	if !list.contains("196.201.214.200") || list.contains("203.0.113.9") {
+		t.Error("default allowlist should hold Safaricom's callback addresses only")
+	}
+
+	list = parseIPAllowlist("10.0.0.0/8, 192.0.2.7, not-an-ip")
+	for ip, want := range map[string]bool{"10.20.30.40": true, "192.0.2.7": true, "192.0.2.8": false, "garbage": false} {
+		if got := list.contains(ip); got != want {
+			t.Errorf("contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if parseIPAllowlist("*") != nil {
+		t.Error(`"*" should disable the address check`)
+	}
+}
+
+func TestMpesaCallbackMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MPESA_ALLOWED_IPS", "192.0.2.0/24")
+	t.Setenv("MPESA_CALLBACK_TOKEN", "s3cret")
+
+	router := gin.New()
+	mpesa := router.Group("", MpesaCallbackMiddleware())
+	mpesa.POST("/cb", func(c *gin.Context) { c.Status(http.StatusOK) })
+	mpesa.POST("/cb/:token", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		path   string
+		remote string
+		want   int
+	}{
+		{"allowed address and token", "/cb/s3cret", "192.0.2.10:5000", http.StatusOK},
+		{"wrong token", "/cb/guess", "192.0.2.10:5000", http.StatusUnauthorized},
+		{"missing token", "/cb", "192.0.2.10:5000", http.StatusUnauthorized},
+		{"outside allowlist", "/cb/s3cret", "203.0.113.9:5000", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenBucket holds up to burst tokens and refills at rps tokens a second
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one bucket per client key
+type rateLimiter struct {
+	mu        sync.Mutex
+	rps       float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(rps, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rps:     float64(rps),
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from key's bucket. When the bucket is empty it returns false and how long
+// until the next token is available.
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	bucket, ok := rl.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*rl.rps)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rl.rps * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have refilled completely, so idle clients don't accumulate.
+// It runs at most once a minute.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+
+	refill := time.Duration(rl.burst / rl.rps * float64(time.Second))
+	for key, bucket := range rl.buckets {
+		if now.Sub(bucket.last) > refill {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// RateLimitMiddleware allows each client rps requests a second with bursts of up to burst.
+// Authenticated requests are limited per user, anonymous ones per IP. Over the limit the
+// request is rejected with 429 and a Retry-After header. rps of 0 or less disables the limit.
+func RateLimitMiddleware(rps int, burst int) gin.HandlerFunc {
+	if rps <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := newRateLimiter(rps, burst)
+
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID, exists := c.Get("userID"); exists {
+			key = fmt.Sprintf("user:%v", userID)
+		}
+
+		allowed, wait := limiter.allow(key, time.Now())
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"success":    false,
+				"message":    "Too many requests, please try again later",
+				"error":      "rate_limited",
+				"request_id": c.GetString("requestID"),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RateLimitFromEnv builds a RateLimitMiddleware from <prefix>_RPS and <prefix>_BURST,
+// falling back to rps and burst when they are unset
+func RateLimitFromEnv(prefix string, rps, burst int) gin.HandlerFunc {
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_RPS")); err == nil {
+		rps = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_BURST")); err == nil && v > 0 {
+		burst = v
+	}
+	return RateLimitMiddleware(rps, burst)
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(2, 3)
+	now := time.Date(2026, time.January, 1, 8, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("ip:10.0.0.1", now); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+
+	ok, wait := limiter.allow("ip:10.0.0.1", now)
+	if ok {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms at 2 rps", wait)
+	}
+
+	if ok, _ := limiter.allow("ip:10.0.0.2", now); !ok {
+		t.Error("another client shares the first client's bucket")
+	}
+
+	if ok, _ := limiter.allow("ip:10.0.0.1", now.Add(wait)); !ok {
+		t.Error("request after the wait was rejected")
+	}
+}
+
+func TestRateLimitMiddlewareRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", RateLimitMiddleware(1, 1), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", w.Code)
+	}
+
+	w := send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want \"1\"", got)
+	}
+}
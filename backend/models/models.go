@@ -1,6 +1,7 @@
 package models
 
 import (
+	"math"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -46,14 +47,16 @@ type Customer struct {
 	AverageConsumption float64    `bson:"average_consumption,omitempty" json:"average_consumption,omitempty"`
 
 	// Financial Information
-	Balance       float64 `bson:"balance" json:"balance" default:"0"` // Positive = credit, Negative = arrears
+	Balance       float64 `bson:"balance" json:"balance" default:"0"` // Positive = amount owed, Negative = credit
 	TotalPaid     float64 `bson:"total_paid,omitempty" json:"total_paid,omitempty"`
 	TotalConsumed float64 `bson:"total_consumed,omitempty" json:"total_consumed,omitempty"`
 
 	// Status Information
-	Status              string     `bson:"status" json:"status" default:"active"` // "active", "inactive", "disconnected", "pending", "suspended"
+	Status              string     `bson:"status" json:"status" default:"active"` // "active", "inactive", "disconnected", "pending", "suspended", "archived"
 	DisconnectionReason string     `bson:"disconnection_reason,omitempty" json:"disconnection_reason,omitempty"`
 	ReconnectionDate    *time.Time `bson:"reconnection_date,omitempty" json:"reconnection_date,omitempty"`
+	ArchiveReason       string     `bson:"archive_reason,omitempty" json:"archive_reason,omitempty"`
+	DeletedAt           *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"` // Set when the customer is archived
 
 	// Additional Information
 	EmergencyContact  string `bson:"emergency_contact,omitempty" json:"emergency_contact,omitempty"`
@@ -63,6 +66,9 @@ type Customer struct {
 	NumberOfOccupants int    `bson:"number_of_occupants,omitempty" json:"number_of_occupants,omitempty"`
 	Notes             string `bson:"notes,omitempty" json:"notes,omitempty"`
 
+	// Communication Preferences
+	SMSOptOut bool `bson:"sms_opt_out,omitempty" json:"sms_opt_out"` // No SMS apart from login codes and, when required, disconnection notices
+
 	// Timestamps
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
@@ -96,7 +102,8 @@ type MeterReading struct {
 	RatePerUnit float64 `bson:"rate_per_unit" json:"rate_per_unit"`
 	WaterCharge float64 `bson:"water_charge" json:"water_charge"` // consumption * rate
 	FixedCharge float64 `bson:"fixed_charge" json:"fixed_charge"`
-	Arrears     float64 `bson:"arrears,omitempty" json:"arrears,omitempty"` // Previous balance brought forward
+	Proration   float64 `bson:"proration_factor,omitempty" json:"proration_factor,omitempty"` // Share of the fixed charge billed for a mid-month connection; unset when billed in full
+	Arrears     float64 `bson:"arrears,omitempty" json:"arrears,omitempty"`                   // Previous balance brought forward
 	Penalty     float64 `bson:"penalty,omitempty" json:"penalty,omitempty"`
 	Discount    float64 `bson:"discount,omitempty" json:"discount,omitempty"`
 	TotalAmount float64 `bson:"total_amount" json:"total_amount"` // Sum of all charges
@@ -108,11 +115,11 @@ type MeterReading struct {
 	ReaderName    string             `bson:"reader_name" json:"reader_name"`
 
 	// Location & Verification
-	Location         GeoLocation `bson:"location,omitempty" json:"location,omitempty"`
-	MeterPhotoURL    string      `bson:"meter_photo_url,omitempty" json:"meter_photo_url,omitempty"`
-	IsVerified       bool        `bson:"is_verified" json:"is_verified" default:"false"`
-	VerifiedBy       string      `bson:"verified_by,omitempty" json:"verified_by,omitempty"`
-	VerificationDate *time.Time  `bson:"verification_date,omitempty" json:"verification_date,omitempty"`
+	Location         *GeoLocation `bson:"location,omitempty" json:"location,omitempty"` // Nil when not captured; an empty point breaks the 2dsphere index
+	MeterPhotoURL    string       `bson:"meter_photo_url,omitempty" json:"meter_photo_url,omitempty"`
+	IsVerified       bool         `bson:"is_verified" json:"is_verified" default:"false"`
+	VerifiedBy       string       `bson:"verified_by,omitempty" json:"verified_by,omitempty"`
+	VerificationDate *time.Time   `bson:"verification_date,omitempty" json:"verification_date,omitempty"`
 
 	// Additional Info
 	MeterCondition string `bson:"meter_condition,omitempty" json:"meter_condition,omitempty"` // "good", "damaged", "tampered"
@@ -125,9 +132,26 @@ type MeterReading struct {
 	Season        string `bson:"season,omitempty" json:"season,omitempty"` // "dry", "wet", "normal"
 
 	// Status
-	Status        string `bson:"status" json:"status"` // "recorded", "billed", "verified", "disputed"
-	DisputeReason string `bson:"dispute_reason,omitempty" json:"dispute_reason,omitempty"`
-	Resolution    string `bson:"resolution,omitempty" json:"resolution,omitempty"`
+	Status        string     `bson:"status" json:"status"` // "recorded", "estimated", "billed", "verified", "disputed", "cancelled"
+	DisputeReason string     `bson:"dispute_reason,omitempty" json:"dispute_reason,omitempty"`
+	DisputedBy    string     `bson:"disputed_by,omitempty" json:"disputed_by,omitempty"`
+	DisputedAt    *time.Time `bson:"disputed_at,omitempty" json:"disputed_at,omitempty"`
+	Resolution    string     `bson:"resolution,omitempty" json:"resolution,omitempty"`
+	ResolvedBy    string     `bson:"resolved_by,omitempty" json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+
+	// Estimate reconciliation (set on the first actual reading after an estimate)
+	EstimateDeviation float64 `bson:"estimate_deviation,omitempty" json:"estimate_deviation,omitempty"` // % difference from the estimated consumption
+	NeedsReview       bool    `bson:"needs_review,omitempty" json:"needs_review,omitempty"`
+	ReviewReason      string  `bson:"review_reason,omitempty" json:"review_reason,omitempty"`
+	Rollover          bool    `bson:"rollover,omitempty" json:"rollover,omitempty"` // Meter wrapped past its maximum since the previous reading
+
+	// Correction (set when staff fix a misread value; the bill is raised again)
+	OriginalReading  *float64   `bson:"original_reading,omitempty" json:"original_reading,omitempty"` // Value first recorded, kept across corrections
+	CorrectionReason string     `bson:"correction_reason,omitempty" json:"correction_reason,omitempty"`
+	CorrectedBy      string     `bson:"corrected_by,omitempty" json:"corrected_by,omitempty"`
+	CorrectedAt      *time.Time `bson:"corrected_at,omitempty" json:"corrected_at,omitempty"`
+
 	// Timestamps
 	CreatedAt time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
@@ -152,22 +176,32 @@ type Bill struct {
 	PreviousReading float64 `bson:"previous_reading" json:"previous_reading"`
 	CurrentReading  float64 `bson:"current_reading" json:"current_reading"`
 	Consumption     float64 `bson:"consumption" json:"consumption"`
+	Unit            string  `bson:"unit" json:"unit"` // Unit readings and consumption are measured in, e.g. m³
 
 	// Charges Breakdown
-	RatePerUnit  float64 `bson:"rate_per_unit" json:"rate_per_unit"`
-	WaterCharge  float64 `bson:"water_charge" json:"water_charge"` // consumption * rate
-	FixedCharge  float64 `bson:"fixed_charge" json:"fixed_charge"`
-	Arrears      float64 `bson:"arrears" json:"arrears"`                     // Previous balance
-	Penalty      float64 `bson:"penalty,omitempty" json:"penalty,omitempty"` // Late payment penalty
-	Discount     float64 `bson:"discount,omitempty" json:"discount,omitempty"`
-	Tax          float64 `bson:"tax,omitempty" json:"tax,omitempty"` // VAT or other taxes
-	OtherCharges float64 `bson:"other_charges,omitempty" json:"other_charges,omitempty"`
-	TotalAmount  float64 `bson:"total_amount" json:"total_amount"`
+	RatePerUnit      float64          `bson:"rate_per_unit" json:"rate_per_unit"`
+	WaterCharge      float64          `bson:"water_charge" json:"water_charge"` // consumption * rate
+	FixedCharge      float64          `bson:"fixed_charge" json:"fixed_charge"`
+	Proration        float64          `bson:"proration_factor,omitempty" json:"proration_factor,omitempty"`     // Share of the fixed charge billed for a mid-month connection; unset when billed in full
+	Arrears          float64          `bson:"arrears" json:"arrears"`                                           // Owed on earlier bills at bill date; not part of TotalAmount
+	Penalty          float64          `bson:"penalty,omitempty" json:"penalty,omitempty"`                       // Late payment penalty
+	PenaltyAppliedAt *time.Time       `bson:"penalty_applied_at,omitempty" json:"penalty_applied_at,omitempty"` // Last time a penalty was charged
+	Discount         float64          `bson:"discount,omitempty" json:"discount,omitempty"`
+	Tax              float64          `bson:"tax,omitempty" json:"tax,omitempty"` // VAT or other taxes
+	OtherCharges     float64          `bson:"other_charges,omitempty" json:"other_charges,omitempty"`
+	TotalAmount      float64          `bson:"total_amount" json:"total_amount"`
+	Flagged          bool             `bson:"flagged,omitempty" json:"flagged,omitempty"`         // Reading needs review; customer not notified
+	Adjustments      []BillAdjustment `bson:"adjustments,omitempty" json:"adjustments,omitempty"` // Audit trail of credits and extra charges
+
+	// Cancellation
+	CancellationReason string     `bson:"cancellation_reason,omitempty" json:"cancellation_reason,omitempty"`
+	CancelledBy        string     `bson:"cancelled_by,omitempty" json:"cancelled_by,omitempty"`
+	CancelledAt        *time.Time `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
 
 	// Payment Information
 	AmountPaid    float64    `bson:"amount_paid" json:"amount_paid" default:"0"`
 	Balance       float64    `bson:"balance" json:"balance"` // total_amount - amount_paid
-	Status        string     `bson:"status" json:"status"`   // "pending", "paid", "overdue", "partially_paid", "cancelled"
+	Status        string     `bson:"status" json:"status"`   // "pending", "paid", "overdue", "partially_paid", "disputed", "cancelled"
 	PaymentDate   *time.Time `bson:"payment_date,omitempty" json:"payment_date,omitempty"`
 	PaymentMethod string     `bson:"payment_method,omitempty" json:"payment_method,omitempty"` // "cash", "mpesa", "bank", "cheque", "credit_card"
 	TransactionID string     `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
@@ -187,63 +221,107 @@ type Bill struct {
 	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
 }
 
+// PaymentAllocation is the part of a payment applied to one bill
+type PaymentAllocation struct {
+	BillID     primitive.ObjectID `bson:"bill_id" json:"bill_id"`
+	BillNumber string             `bson:"bill_number" json:"bill_number"`
+	Amount     float64            `bson:"amount" json:"amount"`
+}
+
+// BillAdjustment records a manual credit (positive) or extra charge (negative) on a bill
+type BillAdjustment struct {
+	Amount     float64   `bson:"amount" json:"amount"`
+	Reason     string    `bson:"reason" json:"reason"`
+	AdjustedBy string    `bson:"adjusted_by" json:"adjusted_by"`
+	AdjustedAt time.Time `bson:"adjusted_at" json:"adjusted_at"`
+}
+
 // User represents system users (admin, meter readers, cashiers, etc.)
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	FirstName    string             `bson:"first_name" json:"first_name"`
-	LastName     string             `bson:"last_name" json:"last_name"`
-	Email        string             `bson:"email" json:"email"`
-	PhoneNumber  string             `bson:"phone_number" json:"phone_number"`
-	Username     string             `bson:"username" json:"username"`
-	Password     string             `bson:"password" json:"-"` // Hashed password
-	Role         string             `bson:"role" json:"role"`  // "admin", "reader", "cashier", "manager", "customer_service"
-	MeterNumber  string             `bson:"meter_number,omitempty" json:"meter_number,omitempty"`
-	Department   string             `bson:"department,omitempty" json:"department,omitempty"`
-	EmployeeID   string             `bson:"employee_id,omitempty" json:"employee_id,omitempty"`
-	AssignedZone string             `bson:"assigned_zone,omitempty" json:"assigned_zone,omitempty"` // For meter readers
-	Permissions  []string           `bson:"permissions,omitempty" json:"permissions,omitempty"`     // Fine-grained permissions
-	IsActive     bool               `bson:"is_active" json:"is_active" default:"true"`
-	LastLogin    *time.Time         `bson:"last_login,omitempty" json:"last_login,omitempty"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	ID                 primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FirstName          string             `bson:"first_name" json:"first_name"`
+	LastName           string             `bson:"last_name" json:"last_name"`
+	Email              string             `bson:"email" json:"email"`
+	PhoneNumber        string             `bson:"phone_number" json:"phone_number"`
+	Username           string             `bson:"username" json:"username"`
+	Password           string             `bson:"password" json:"-"` // Hashed password
+	Role               string             `bson:"role" json:"role"`  // "admin", "reader", "cashier", "manager", "customer_service"
+	MeterNumber        string             `bson:"meter_number,omitempty" json:"meter_number,omitempty"`
+	Department         string             `bson:"department,omitempty" json:"department,omitempty"`
+	EmployeeID         string             `bson:"employee_id,omitempty" json:"employee_id,omitempty"`
+	AssignedZone       string             `bson:"assigned_zone,omitempty" json:"assigned_zone,omitempty"` // For meter readers
+	Permissions        []string           `bson:"permissions,omitempty" json:"permissions,omitempty"`     // Fine-grained permissions
+	IsActive           bool               `bson:"is_active" json:"is_active" default:"true"`
+	LastLogin          *time.Time         `bson:"last_login,omitempty" json:"last_login,omitempty"`
+	FailedLogins       int                `bson:"failed_login_attempts" json:"-"`
+	PasswordChangedAt  *time.Time         `bson:"password_changed_at,omitempty" json:"password_changed_at,omitempty"`
+	MustChangePassword bool               `bson:"must_change_password,omitempty" json:"must_change_password,omitempty"` // Set by an admin reset; cleared when the user picks their own
+	LockedUntil        *time.Time         `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	CreatedAt          time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt          time.Time          `bson:"updated_at" json:"updated_at"`
 }
 
 // Payment represents a payment transaction
 type Payment struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	BillID        primitive.ObjectID `bson:"bill_id" json:"bill_id"`
-	MeterNumber   string             `bson:"meter_number" json:"meter_number"`
-	CustomerID    primitive.ObjectID `bson:"customer_id" json:"customer_id"`
-	CustomerName  string             `bson:"customer_name" json:"customer_name"`
-	PaymentDate   time.Time          `bson:"payment_date" json:"payment_date"`
-	Amount        float64            `bson:"amount" json:"amount"`
-	PaymentMethod string             `bson:"payment_method" json:"payment_method"` // "cash", "mpesa", "bank", "cheque"
-	TransactionID string             `bson:"transaction_id" json:"transaction_id"` // MPesa code, bank ref, etc.
-	ReceiptNumber string             `bson:"receipt_number" json:"receipt_number"`
-	PayerName     string             `bson:"payer_name,omitempty" json:"payer_name,omitempty"`
-	PayerPhone    string             `bson:"payer_phone,omitempty" json:"payer_phone,omitempty"`
-	CollectedBy   string             `bson:"collected_by" json:"collected_by"` // User who collected payment
-	Status        string             `bson:"status" json:"status"`             // "completed", "pending", "failed", "refunded"
-	Notes         string             `bson:"notes,omitempty" json:"notes,omitempty"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	BillID         primitive.ObjectID  `bson:"bill_id" json:"bill_id"`
+	MeterNumber    string              `bson:"meter_number" json:"meter_number"`
+	CustomerID     primitive.ObjectID  `bson:"customer_id" json:"customer_id"`
+	CustomerName   string              `bson:"customer_name" json:"customer_name"`
+	PaymentDate    time.Time           `bson:"payment_date" json:"payment_date"`
+	Amount         float64             `bson:"amount" json:"amount"`
+	PaymentMethod  string              `bson:"payment_method" json:"payment_method"`           // "cash", "mpesa", "bank", "cheque"
+	TransactionID  string              `bson:"transaction_id,omitempty" json:"transaction_id"` // MPesa code, bank ref, etc.; unset when empty so the sparse unique index skips it
+	ReceiptNumber  string              `bson:"receipt_number,omitempty" json:"receipt_number"`
+	PayerName      string              `bson:"payer_name,omitempty" json:"payer_name,omitempty"`
+	PayerPhone     string              `bson:"payer_phone,omitempty" json:"payer_phone,omitempty"`
+	CollectedBy    string              `bson:"collected_by" json:"collected_by"` // User who collected payment
+	Status         string              `bson:"status" json:"status"`             // "completed", "pending", "failed", "refunded"
+	Notes          string              `bson:"notes,omitempty" json:"notes,omitempty"`
+	CreditAmount   float64             `bson:"credit_amount,omitempty" json:"credit_amount,omitempty"` // Overpayment held on the customer balance
+	Allocations    []PaymentAllocation `bson:"allocations,omitempty" json:"allocations,omitempty"`     // Split across bills for lump-sum payments
+	ReversalReason string              `bson:"reversal_reason,omitempty" json:"reversal_reason,omitempty"`
+	ReversedBy     string              `bson:"reversed_by,omitempty" json:"reversed_by,omitempty"`
+	ReversedAt     *time.Time          `bson:"reversed_at,omitempty" json:"reversed_at,omitempty"`
+	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// AuditLog records a financial or account change and who made it
+type AuditLog struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"id"`
+	ActorID    string                 `bson:"actor_id" json:"actor_id"` // User ID, or "mpesa" for payment callbacks
+	ActorName  string                 `bson:"actor_name,omitempty" json:"actor_name,omitempty"`
+	ActorRole  string                 `bson:"actor_role,omitempty" json:"actor_role,omitempty"`
+	Action     string                 `bson:"action" json:"action"`           // e.g. "payment.record", "payment.reverse", "bill.adjust", "customer.status", "user.create"
+	TargetType string                 `bson:"target_type" json:"target_type"` // "payment", "bill", "customer", "user", "reading"
+	TargetID   string                 `bson:"target_id" json:"target_id"`
+	Before     map[string]interface{} `bson:"before,omitempty" json:"before,omitempty"` // Changed fields before the action, where known
+	After      map[string]interface{} `bson:"after,omitempty" json:"after,omitempty"`
+	Details    string                 `bson:"details,omitempty" json:"details,omitempty"` // e.g. the reason given
+	IPAddress  string                 `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	RequestID  string                 `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	CreatedAt  time.Time              `bson:"created_at" json:"created_at"`
 }
 
 // SMSLog tracks sent messages
 type SMSLog struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	CustomerID   primitive.ObjectID `bson:"customer_id" json:"customer_id"`
-	BillID       primitive.ObjectID `bson:"bill_id,omitempty" json:"bill_id,omitempty"`
-	MeterNumber  string             `bson:"meter_number" json:"meter_number"`
-	PhoneNumber  string             `bson:"phone_number" json:"phone_number"`
-	CustomerName string             `bson:"customer_name,omitempty" json:"customer_name,omitempty"`
-	MessageType  string             `bson:"message_type" json:"message_type"` // "bill_notification", "payment_confirmation", "reminder", "disconnection_warning"
-	Message      string             `bson:"message" json:"message"`
-	Status       string             `bson:"status" json:"status"`                             // "sent", "failed", "delivered", "pending"
-	Provider     string             `bson:"provider,omitempty" json:"provider,omitempty"`     // "twilio", "africas_talking", "nexmo"
-	MessageID    string             `bson:"message_id,omitempty" json:"message_id,omitempty"` // Provider's message ID
-	Cost         float64            `bson:"cost,omitempty" json:"cost,omitempty"`
-	Error        string             `bson:"error,omitempty" json:"error,omitempty"`
-	SentAt       time.Time          `bson:"sent_at" json:"sent_at"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CustomerID    primitive.ObjectID `bson:"customer_id" json:"customer_id"`
+	BillID        primitive.ObjectID `bson:"bill_id,omitempty" json:"bill_id,omitempty"`
+	MeterNumber   string             `bson:"meter_number" json:"meter_number"`
+	PhoneNumber   string             `bson:"phone_number" json:"phone_number"`
+	CustomerName  string             `bson:"customer_name,omitempty" json:"customer_name,omitempty"`
+	MessageType   string             `bson:"message_type" json:"message_type"`                         // "bill_notification", "payment_confirmation", "reminder", "disconnection_warning"
+	ReceiptNumber string             `bson:"receipt_number,omitempty" json:"receipt_number,omitempty"` // Set on payment confirmations
+	Message       string             `bson:"message" json:"message"`
+	Status        string             `bson:"status" json:"status"`                             // "sent", "failed", "delivered", "undelivered", "pending", "queued", "skipped_opt_out"
+	Provider      string             `bson:"provider,omitempty" json:"provider,omitempty"`     // "twilio", "africas_talking", "nexmo"
+	MessageID     string             `bson:"message_id,omitempty" json:"message_id,omitempty"` // Provider's message ID
+	Cost          float64            `bson:"cost,omitempty" json:"cost,omitempty"`
+	Error         string             `bson:"error,omitempty" json:"error,omitempty"`
+	Attempts      int                `bson:"attempts,omitempty" json:"attempts,omitempty"`           // Sends tried, including retries; older logs without it had one
+	NextRetryAt   *time.Time         `bson:"next_retry_at,omitempty" json:"next_retry_at,omitempty"` // Earliest retry of a failed send
+	SentAt        time.Time          `bson:"sent_at" json:"sent_at"`
 }
 
 // NotificationTemplate for SMS/Email messages
@@ -269,8 +347,10 @@ type Tariff struct {
 	Description  string             `bson:"description,omitempty" json:"description,omitempty"`
 
 	// Rate Structure (could be tiered)
-	BaseRate    float64 `bson:"base_rate" json:"base_rate"`       // Rate per cubic meter
-	FixedCharge float64 `bson:"fixed_charge" json:"fixed_charge"` // Monthly fixed charge
+	BaseRate    float64 `bson:"base_rate" json:"base_rate"`                   // Rate per cubic meter
+	FixedCharge float64 `bson:"fixed_charge" json:"fixed_charge"`             // Monthly fixed charge
+	DueDays     int     `bson:"due_days,omitempty" json:"due_days,omitempty"` // Payment terms in days; 0 uses BILL_DUE_DAYS
+	Unit        string  `bson:"unit,omitempty" json:"unit,omitempty"`         // Unit consumption is billed in; empty means DefaultUnit
 
 	// Tiered rates (optional)
 	Tiers []TariffTier `bson:"tiers,omitempty" json:"tiers,omitempty"`
@@ -283,6 +363,9 @@ type Tariff struct {
 	UpdatedAt     time.Time  `bson:"updated_at" json:"updated_at"`
 }
 
+// DefaultUnit is the unit water is metered and billed in unless a tariff sets another
+const DefaultUnit = "m³"
+
 // TariffTier for tiered pricing (e.g., 0-10m³ @ 50, 11-20m³ @ 75, etc.)
 type TariffTier struct {
 	MinConsumption float64 `bson:"min_consumption" json:"min_consumption"`
@@ -290,6 +373,16 @@ type TariffTier struct {
 	Rate           float64 `bson:"rate" json:"rate"`
 }
 
+// PasswordExpired reports whether the password is older than maxAge.
+// Users who have never changed their password are measured from account creation.
+func (u *User) PasswordExpired(maxAge time.Duration) bool {
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	return time.Since(changedAt) > maxAge
+}
+
 // Helper Methods for Customer
 func (c *Customer) FullName() string {
 	return c.FirstName + " " + c.LastName
@@ -300,9 +393,58 @@ func (c *Customer) UpdateLastReading(reading float64, date time.Time) {
 	c.LastReadingDate = &date
 }
 
+// AmountOwed is what the customer owes across all bills. Bills add to Balance and payments take
+// it off, so a positive balance is owed and a negative one is credit.
+func (c *Customer) AmountOwed() float64 {
+	if c.Balance > 0 {
+		return c.Balance
+	}
+	return 0
+}
+
+// Credit is what the customer has paid in advance of their bills
+func (c *Customer) Credit() float64 {
+	if c.Balance < 0 {
+		return -c.Balance
+	}
+	return 0
+}
+
 // Helper Methods for Bill
+// TotalOutstanding is the bill's own balance plus the arrears on earlier bills when it was raised
+func (b *Bill) TotalOutstanding() float64 {
+	return math.Round((b.Balance+b.Arrears)*100) / 100
+}
+
+// ConsumptionUnit is the unit the bill's readings are in, DefaultUnit for bills raised before
+// bills recorded one
+func (b *Bill) ConsumptionUnit() string {
+	if b.Unit == "" {
+		return DefaultUnit
+	}
+	return b.Unit
+}
+
 func (b *Bill) IsOverdue() bool {
-	return b.Status == "pending" && time.Now().After(b.DueDate)
+	return b.Status == "overdue" || (b.Status == "pending" && time.Now().After(b.DueDate))
+}
+
+// ApplyPayment applies at most the bill's outstanding balance and returns how much was applied
+// and how much is left over. The excess is never recorded on the bill, so AmountPaid stays at or
+// below TotalAmount; callers carry it to the customer as credit.
+func (b *Bill) ApplyPayment(amount float64, method string, transactionID string) (applied, excess float64) {
+	applied = amount
+	if b.Balance < applied {
+		applied = b.Balance
+	}
+	if applied < 0 {
+		applied = 0
+	}
+	applied = math.Round(applied*100) / 100
+	excess = math.Round((amount-applied)*100) / 100
+
+	b.UpdatePayment(applied, method, transactionID)
+	return applied, excess
 }
 
 func (b *Bill) UpdatePayment(amount float64, method string, transactionID string) {
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestApplyPaymentOverpayment(t *testing.T) {
+	bill := &Bill{TotalAmount: 1000, Balance: 1000, Status: "pending"}
+
+	applied, excess := bill.ApplyPayment(1500, "mpesa", "TXN123")
+
+	if applied != 1000 {
+		t.Errorf("applied = %.2f, want 1000.00", applied)
+	}
+	if excess != 500 {
+		t.Errorf("excess = %.2f, want 500.00", excess)
+	}
+	if bill.AmountPaid != 1000 {
+		t.Errorf("AmountPaid = %.2f, want 1000.00", bill.AmountPaid)
+	}
+	if bill.Balance != 0 {
+		t.Errorf("Balance = %.2f, want 0.00", bill.Balance)
+	}
+	if bill.Status != "paid" {
+		t.Errorf("Status = %q, want %q", bill.Status, "paid")
+	}
+}
+
+func TestApplyPaymentPartial(t *testing.T) {
+	bill := &Bill{TotalAmount: 1000, Balance: 1000, Status: "pending"}
+
+	applied, excess := bill.ApplyPayment(400, "cash", "")
+
+	if applied != 400 || excess != 0 {
+		t.Errorf("applied, excess = %.2f, %.2f, want 400.00, 0.00", applied, excess)
+	}
+	if bill.Balance != 600 {
+		t.Errorf("Balance = %.2f, want 600.00", bill.Balance)
+	}
+	if bill.Status != "partially_paid" {
+		t.Errorf("Status = %q, want %q", bill.Status, "partially_paid")
+	}
+}
+
+func TestPaymentOmitsEmptyTransactionID(t *testing.T) {
+	raw, err := bson.Marshal(Payment{Amount: 500, PaymentMethod: "cash"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// An empty string would be indexed, so a second cash payment would collide
+	if _, err := bson.Raw(raw).LookupErr("transaction_id"); err == nil {
+		t.Error("cash payment without a transaction ID stored transaction_id")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"waterbilling/backend/database"
+	"waterbilling/backend/models"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -26,6 +27,15 @@ func main() {
 	// Create collections with validation
 	createCollections()
 
+	// Clear placeholder reading locations so the 2dsphere index can be built
+	clearEmptyReadingLocations()
+
+	// Record the unit on bills raised before bills carried one
+	backfillBillUnits()
+
+	// Drop empty transaction IDs so the sparse unique index skips them
+	clearEmptyTransactionIDs()
+
 	// Create indexes
 	createIndexes()
 
@@ -72,7 +82,7 @@ func createCollections() {
 				},
 				"status": bson.M{
 					"bsonType": "string",
-					"enum":     []string{"active", "inactive", "disconnected", "pending", "suspended"},
+					"enum":     []string{"active", "inactive", "disconnected", "pending", "suspended", "archived"},
 				},
 			},
 		},
@@ -96,8 +106,11 @@ func createCollections() {
 		"payments",
 		"users",
 		"sms_logs",
+		"sms_queue",
 		"notification_templates",
 		"tariffs",
+		"jwt_blacklist",
+		"portal_otps",
 	}
 
 	for _, collName := range collectionsToCreate {
@@ -108,6 +121,63 @@ func createCollections() {
 	}
 }
 
+// backfillBillUnits sets the default unit on bills saved before the unit was recorded, so every
+// bill reports the unit its readings are in
+func backfillBillUnits() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := database.DB.Collection("bills").UpdateMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"unit": bson.M{"$exists": false}}, bson.M{"unit": ""}}},
+		bson.M{"$set": bson.M{"unit": models.DefaultUnit}},
+	)
+	if err != nil {
+		log.Printf("Error backfilling bill units: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		fmt.Printf("✓ Set unit %s on %d bills\n", models.DefaultUnit, result.ModifiedCount)
+	}
+}
+
+// clearEmptyTransactionIDs removes the empty transaction ID older cash payments were saved with;
+// the unique index only skips payments without the field, so a second "" is a duplicate
+func clearEmptyTransactionIDs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := database.DB.Collection("payments").UpdateMany(ctx,
+		bson.M{"transaction_id": ""},
+		bson.M{"$unset": bson.M{"transaction_id": ""}},
+	)
+	if err != nil {
+		log.Printf("Error clearing empty transaction IDs: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		fmt.Printf("✓ Cleared empty transaction ID from %d payments\n", result.ModifiedCount)
+	}
+}
+
+// clearEmptyReadingLocations removes the empty location (no coordinates) older readings were
+// saved with; the 2dsphere index rejects documents whose location is not a valid point
+func clearEmptyReadingLocations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := database.DB.Collection("meter_readings").UpdateMany(ctx,
+		bson.M{"location": bson.M{"$exists": true}, "location.coordinates": bson.M{"$not": bson.M{"$size": 2}}},
+		bson.M{"$unset": bson.M{"location": ""}},
+	)
+	if err != nil {
+		log.Printf("Error clearing empty reading locations: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		fmt.Printf("✓ Cleared empty location from %d readings\n", result.ModifiedCount)
+	}
+}
+
 func createIndexes() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -126,11 +196,8 @@ func createIndexes() {
 			Keys:    bson.D{{Key: "account_number", Value: 1}},
 			Options: options.Index().SetUnique(true).SetSparse(true).SetName("account_number_unique"),
 		},
-		// Phone number should be unique
-		{
-			Keys:    bson.D{{Key: "phone_number", Value: 1}},
-			Options: options.Index().SetUnique(true).SetName("phone_number_unique"),
-		},
+		// Phone number is unique unless ALLOW_SHARED_PHONE is set
+		database.PhoneIndex(),
 		// Zone index for geographic queries
 		{
 			Keys:    bson.D{{Key: "zone", Value: 1}},
@@ -206,6 +273,11 @@ func createIndexes() {
 			Keys:    bson.D{{Key: "status", Value: 1}},
 			Options: options.Index().SetName("reading_status"),
 		},
+		// GPS location for proximity checks
+		{
+			Keys:    bson.D{{Key: "location", Value: "2dsphere"}},
+			Options: options.Index().SetName("reading_location_2dsphere"),
+		},
 	}
 
 	// 3. BILLS COLLECTION INDEXES
@@ -332,6 +404,11 @@ func createIndexes() {
 			Keys:    bson.D{{Key: "meter_number", Value: 1}},
 			Options: options.Index().SetName("customer_sms_history"),
 		},
+		// Per-customer daily send limit
+		{
+			Keys:    bson.D{{Key: "customer_id", Value: 1}, {Key: "sent_at", Value: -1}},
+			Options: options.Index().SetName("customer_daily_sms"),
+		},
 		// Message type for analytics
 		{
 			Keys:    bson.D{{Key: "message_type", Value: 1}},
@@ -363,6 +440,53 @@ func createIndexes() {
 		},
 	}
 
+	// 8. JWT BLACKLIST INDEXES
+	blacklistIndexes := []mongo.IndexModel{
+		// Drop revoked tokens once they would have expired anyway
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("jwt_blacklist_ttl"),
+		},
+	}
+
+	// 9. PORTAL OTP INDEXES
+	otpIndexes := []mongo.IndexModel{
+		// Drop login codes once they expire
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("portal_otp_ttl"),
+		},
+	}
+
+	// Messages held for quiet hours, flushed in send_after order
+	smsQueueIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "send_after", Value: 1}},
+			Options: options.Index().SetName("sms_queue_send_after"),
+		},
+	}
+
+	auditIndexes := []mongo.IndexModel{
+		// Newest first, optionally by action
+		{
+			Keys:    bson.D{{Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_created_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_action_date"),
+		},
+		// Everything one user did, or that happened to one entity
+		{
+			Keys:    bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_actor_date"),
+		},
+		{
+			Keys:    bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("audit_target_date"),
+		},
+	}
+
 	// Create all indexes
 	collections := map[string][]mongo.IndexModel{
 		"customers":      customerIndexes,
@@ -371,7 +495,11 @@ func createIndexes() {
 		"payments":       paymentIndexes,
 		"users":          userIndexes,
 		"sms_logs":       smsLogIndexes,
+		"sms_queue":      smsQueueIndexes,
 		"tariffs":        tariffIndexes,
+		"jwt_blacklist":  blacklistIndexes,
+		"portal_otps":    otpIndexes,
+		"audit_logs":     auditIndexes,
 	}
 
 	for collectionName, indexes := range collections {
@@ -420,7 +548,7 @@ func createAdminUser() {
 		"role":         "admin",
 		"employee_id":  "EMP001",
 		"department":   "Administration",
-		"permissions":  []string{"all"},
+		"permissions":  []string{"*"},
 		"is_active":    true,
 		"created_at":   time.Now(),
 		"updated_at":   time.Now(),
@@ -463,6 +591,7 @@ func createDefaultTariff() {
 		"description":    "Default residential tariff for water billing",
 		"base_rate":      100.0,
 		"fixed_charge":   150.0,
+		"unit":           models.DefaultUnit,
 		"effective_date": time.Now(),
 		"is_active":      true,
 		"created_at":     time.Now(),
@@ -488,8 +617,8 @@ func createNotificationTemplates() {
 		{
 			"template_type": "sms",
 			"name":          "Bill Notification",
-			"body":          "Dear {customer_name},\nYour water bill {bill_number} is ready.\nMeter: {meter_number}\nConsumption: {consumption} m³\nAmount Due: Ksh {amount}\nDue Date: {due_date}\nPay via M-Pesa: Paybill 123456 Account: {meter_number}\nThank you!",
-			"variables":     []string{"{customer_name}", "{bill_number}", "{meter_number}", "{consumption}", "{amount}", "{due_date}"},
+			"body":          "Dear {customer_name},\nYour water bill {bill_number} is ready.\nMeter: {meter_number}\nConsumption: {consumption} {unit}\nAmount Due: Ksh {amount}\nDue Date: {due_date}\nPay via M-Pesa: Paybill {paybill} Account: {meter_number}\nThank you!",
+			"variables":     []string{"{customer_name}", "{bill_number}", "{meter_number}", "{consumption}", "{unit}", "{amount}", "{due_date}", "{paybill}"},
 			"language":      "en",
 			"is_active":     true,
 			"created_at":    time.Now(),
@@ -508,8 +637,8 @@ func createNotificationTemplates() {
 		{
 			"template_type": "sms",
 			"name":          "Disconnection Warning",
-			"body":          "Dear {customer_name},\nYour water account {meter_number} has overdue balance of Ksh {amount}.\nPay before {final_date} to avoid disconnection.\nPay via M-Pesa: Paybill 123456 Account: {meter_number}",
-			"variables":     []string{"{customer_name}", "{meter_number}", "{amount}", "{final_date}"},
+			"body":          "Dear {customer_name},\nYour water account {meter_number} has overdue balance of Ksh {amount}.\nPay before {final_date} to avoid disconnection.\nPay via M-Pesa: Paybill {paybill} Account: {meter_number}",
+			"variables":     []string{"{customer_name}", "{meter_number}", "{amount}", "{final_date}", "{paybill}"},
 			"language":      "en",
 			"is_active":     true,
 			"created_at":    time.Now(),
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AuditService struct {
+	collection Collection
+}
+
+func NewAuditService(collection *mongo.Collection) *AuditService {
+	return &AuditService{
+		collection: wrapCollection(collection),
+	}
+}
+
+// Record stores an audit entry. The change being audited has already been made, so a failure
+// here is logged rather than returned. The write outlives the request's deadline.
+func (as *AuditService) Record(ctx context.Context, entry models.AuditLog) {
+	if as == nil {
+		return
+	}
+
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+	if entry.RequestID == "" {
+		entry.RequestID = utils.RequestID(ctx)
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	if _, err := as.collection.InsertOne(writeCtx, entry); err != nil {
+		utils.Logf(ctx, "❌ Failed to record audit entry %s on %s %s: %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// ListAuditLogs returns one page of the audit entries matching filter, newest first, with the
+// total number that match
+func (as *AuditService) ListAuditLogs(ctx context.Context, filter bson.M, page, limit int64) ([]models.AuditLog, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"created_at": -1})
+
+	cursor, err := as.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching audit logs: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditLog{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, 0, fmt.Errorf("error decoding audit logs: %v", err)
+	}
+
+	total, err := as.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting audit logs: %v", err)
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GenerateBillPDF renders a printable bill and marks it as printed.
+// The header uses the company name and, if set, the image at COMPANY_LOGO_PATH.
+func (bs *BillingService) GenerateBillPDF(ctx context.Context, billID primitive.ObjectID) ([]byte, error) {
+	bill, err := bs.GetBillByID(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	if bill == nil {
+		return nil, fmt.Errorf("bill not found")
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Water Bill "+bill.BillNumber, true)
+	pdf.AddPage()
+
+	if logo := os.Getenv("COMPANY_LOGO_PATH"); logo != "" {
+		if _, err := os.Stat(logo); err == nil {
+			pdf.ImageOptions(logo, 10, 10, 25, 0, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+			pdf.SetX(40)
+		} else {
+			log.Printf("⚠️ Company logo not found at %s", logo)
+		}
+	}
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, company.Name, "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.CellFormat(0, 8, "Water Bill - "+bill.BillingPeriod, "", 1, "L", false, 0, "")
+	pdf.Ln(10)
+
+	// Core fonts are cp1252; translate so units such as m³ print correctly
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	row := func(label, value string, bold bool) {
+		style := ""
+		if bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 11)
+		pdf.CellFormat(70, 8, label, "B", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 8, tr(value), "B", 1, "R", false, 0, "")
+	}
+	money := func(amount float64) string {
+		return fmt.Sprintf("KSh %.2f", amount)
+	}
+
+	row("Bill Number", bill.BillNumber, false)
+	row("Customer", bill.CustomerName, false)
+	row("Account Number", bill.AccountNumber, false)
+	row("Meter Number", bill.MeterNumber, false)
+	row("Bill Date", bill.BillDate.Format("02 Jan 2006"), false)
+	pdf.Ln(6)
+
+	unit := bill.ConsumptionUnit()
+	row("Previous Reading", fmt.Sprintf("%.1f %s", bill.PreviousReading, unit), false)
+	row("Current Reading", fmt.Sprintf("%.1f %s", bill.CurrentReading, unit), false)
+	row("Consumption", fmt.Sprintf("%.1f %s", bill.Consumption, unit), false)
+	pdf.Ln(6)
+
+	row("Water Charge", money(bill.WaterCharge), false)
+	if bill.Proration > 0 {
+		row(fmt.Sprintf("Fixed Charge (%.0f%% of month)", bill.Proration*100), money(bill.FixedCharge), false)
+	} else {
+		row("Fixed Charge", money(bill.FixedCharge), false)
+	}
+	row("Penalty", money(bill.Penalty), false)
+	// Adjustments show so the lines add up to the total
+	if bill.OtherCharges > 0 {
+		row("Other Charges", money(bill.OtherCharges), false)
+	}
+	if bill.Discount > 0 {
+		row("Discount", "-"+money(bill.Discount), false)
+	}
+	row("Total Amount", money(bill.TotalAmount), true)
+	row("Amount Paid", money(bill.AmountPaid), false)
+	row("Balance Due", money(bill.Balance), true)
+	if bill.Arrears > 0 {
+		row("Arrears (earlier bills)", money(bill.Arrears), false)
+		row("Total Outstanding", money(bill.TotalOutstanding()), true)
+	}
+	row("Due Date", bill.DueDate.Format("02 Jan 2006"), true)
+	pdf.Ln(10)
+
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, 6, fmt.Sprintf("Pay via M-Pesa: Paybill %s, Account %s.\nPlease pay by the due date to avoid service interruption.\nQueries: %s",
+		company.Paybill, bill.MeterNumber, company.SupportPhone), "", "L", false)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render bill PDF: %v", err)
+	}
+
+	bs.markBillAsPrinted(bill.ID)
+
+	return buf.Bytes(), nil
+}
+
+// markBillAsPrinted records that a bill has been printed
+func (bs *BillingService) markBillAsPrinted(billID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"printed":    true,
+			"printed_at": time.Now(),
+		},
+	}
+
+	_, err := bs.billsCollection.UpdateByID(ctx, billID, update)
+	if err != nil {
+		log.Printf("⚠️ Failed to update printed status for bill %s: %v", billID.Hex(), err)
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"waterbilling/backend/models"
 	"waterbilling/backend/utils"
@@ -17,29 +22,31 @@ import (
 )
 
 type BillingService struct {
-	customersCollection *mongo.Collection
-	readingsCollection  *mongo.Collection
-	billsCollection     *mongo.Collection
-	paymentsCollection  *mongo.Collection
-	tariffsCollection   *mongo.Collection
+	customersCollection Collection
+	readingsCollection  Collection
+	billsCollection     Collection
+	paymentsCollection  Collection
+	tariffsCollection   Collection
 	smsService          *SMSService // ADDED: SMS service for notifications
+	emailService        *EmailService
 }
 
-// UPDATED: Added smsService parameter
-func NewBillingService(customers, readings, bills, payments, tariffs *mongo.Collection, smsService *SMSService) *BillingService {
+// UPDATED: Added smsService and emailService parameters
+func NewBillingService(customers, readings, bills, payments, tariffs *mongo.Collection, smsService *SMSService, emailService *EmailService) *BillingService {
 	return &BillingService{
-		customersCollection: customers,
-		readingsCollection:  readings,
-		billsCollection:     bills,
-		paymentsCollection:  payments,
-		tariffsCollection:   tariffs,
+		customersCollection: wrapCollection(customers),
+		readingsCollection:  wrapCollection(readings),
+		billsCollection:     wrapCollection(bills),
+		paymentsCollection:  wrapCollection(payments),
+		tariffsCollection:   wrapCollection(tariffs),
 		smsService:          smsService, // ADDED: Store SMS service
+		emailService:        emailService,
 	}
 }
 
 // GetCustomerByMeterNumber retrieves a customer by meter number
-func (bs *BillingService) GetCustomerByMeterNumber(meterNumber string) (*models.Customer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (bs *BillingService) GetCustomerByMeterNumber(ctx context.Context, meterNumber string) (*models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var customer models.Customer
@@ -54,16 +61,33 @@ func (bs *BillingService) GetCustomerByMeterNumber(meterNumber string) (*models.
 	return &customer, nil
 }
 
+// GetCustomerByID fetches a customer by ID
+func (bs *BillingService) GetCustomerByID(ctx context.Context, id primitive.ObjectID) (*models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var customer models.Customer
+	err := bs.customersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&customer)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("customer %s not found", id.Hex())
+		}
+		return nil, fmt.Errorf("error fetching customer: %v", err)
+	}
+
+	return &customer, nil
+}
+
 // GetCustomerPreviousReading gets the last reading for a customer
-func (bs *BillingService) GetCustomerPreviousReading(meterNumber string) (*models.MeterReading, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (bs *BillingService) GetCustomerPreviousReading(ctx context.Context, meterNumber string) (*models.MeterReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var reading models.MeterReading
 	opts := options.FindOne().SetSort(bson.M{"reading_date": -1})
 	err := bs.readingsCollection.FindOne(
 		ctx,
-		bson.M{"meter_number": meterNumber},
+		bson.M{"meter_number": meterNumber, "status": bson.M{"$ne": "cancelled"}},
 		opts,
 	).Decode(&reading)
 
@@ -77,10 +101,23 @@ func (bs *BillingService) GetCustomerPreviousReading(meterNumber string) (*model
 	return &reading, nil
 }
 
-// SubmitMeterReading processes a new meter reading with FLAT RATE pricing
-func (bs *BillingService) SubmitMeterReading(readingRequest *models.MeterReading) (*models.Bill, error) {
+// SubmitMeterReading processes a new meter reading with FLAT RATE pricing.
+// A meter has one reading per month; a second one is rejected with a "reading ... already
+// exists" error.
+func (bs *BillingService) SubmitMeterReading(ctx context.Context, readingRequest *models.MeterReading) (*models.Bill, error) {
+	return bs.submitMeterReading(ctx, readingRequest, false)
+}
+
+// ReplaceMeterReading records a reading in place of the one already held for the meter that
+// month, in one transaction: the old reading is removed, its bill is cancelled and taken off the
+// customer balance, and the new reading is billed. It fails if the old bill has payments.
+func (bs *BillingService) ReplaceMeterReading(ctx context.Context, readingRequest *models.MeterReading) (*models.Bill, error) {
+	return bs.submitMeterReading(ctx, readingRequest, true)
+}
+
+func (bs *BillingService) submitMeterReading(ctx context.Context, readingRequest *models.MeterReading, overwrite bool) (*models.Bill, error) {
 	// Start session for transaction
-	session, err := bs.readingsCollection.Database().Client().StartSession()
+	session, err := bs.readingsCollection.StartSession()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start session: %v", err)
 	}
@@ -89,92 +126,83 @@ func (bs *BillingService) SubmitMeterReading(readingRequest *models.MeterReading
 	var resultBill *models.Bill
 	var customer *models.Customer // Moved outside for SMS access
 
-	err = mongo.WithSession(context.Background(), session, func(sc mongo.SessionContext) error {
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
 		// Start transaction
 		if err = session.StartTransaction(); err != nil {
 			return fmt.Errorf("failed to start transaction: %v", err)
 		}
 
+		// 0. One reading per meter per month, unless the existing one is being replaced or was
+		// cancelled, e.g. when a dispute was upheld
+		var existing models.MeterReading
+		err = bs.readingsCollection.FindOne(sc, bson.M{
+			"meter_number": readingRequest.MeterNumber,
+			"month":        readingRequest.ReadingDate.Format("2006-01"),
+			"year":         readingRequest.ReadingDate.Year(),
+		}).Decode(&existing)
+		if err != nil && err != mongo.ErrNoDocuments {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("error checking for an existing reading: %v", err)
+		}
+		if err == nil {
+			if !overwrite && existing.Status != "cancelled" {
+				session.AbortTransaction(sc)
+				return duplicateReadingError(readingRequest.MeterNumber, readingRequest.ReadingDate)
+			}
+			if err = bs.removeReading(sc, &existing); err != nil {
+				session.AbortTransaction(sc)
+				return err
+			}
+		}
+
 		// 1. Get customer details
-		customer, err = bs.GetCustomerByMeterNumber(readingRequest.MeterNumber)
+		customer, err = bs.GetCustomerByMeterNumber(sc, readingRequest.MeterNumber)
 		if err != nil {
 			session.AbortTransaction(sc)
 			return err
 		}
 
 		// 2. Get previous reading
-		previousReading, err := bs.GetCustomerPreviousReading(readingRequest.MeterNumber)
-
-		// Set previous reading value
-		var previousReadingValue float64
-		if previousReading != nil {
-			previousReadingValue = previousReading.CurrentReading
-		} else {
-			// First reading for this customer
-			previousReadingValue = customer.InitialReading
-		}
-
-		// 3. Validate and calculate consumption
-		if readingRequest.CurrentReading < previousReadingValue {
+		previousReading, err := bs.GetCustomerPreviousReading(sc, readingRequest.MeterNumber)
+		if err != nil {
 			session.AbortTransaction(sc)
-			return fmt.Errorf("current reading (%.2f) cannot be less than previous reading (%.2f)",
-				readingRequest.CurrentReading, previousReadingValue)
+			return err
 		}
 
-		consumption := readingRequest.CurrentReading - previousReadingValue
-
-		// 4. Calculate charges using SIMPLE FLAT RATE (KSh 100 per unit)
-		ratePerUnit := 100.0 // KSh 100 per unit
-		waterCharge := consumption * ratePerUnit
-		fixedCharge := 0.0 // No fixed charges
-		arrears := 0.0     // Start with zero arrears
-
-		// If customer has negative balance, add to arrears
-		if customer.Balance < 0 {
-			arrears = -customer.Balance
+		// Standing charge and payment terms from the customer's tariff
+		tariff, err := bs.customerTariff(sc, customer)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
 		}
+		fixedCharge := fixedChargeFor(customer, tariff)
 
-		// 5. Prepare meter reading record
-		reading := &models.MeterReading{
-			ID:              primitive.NewObjectID(),
-			MeterNumber:     readingRequest.MeterNumber,
-			CustomerID:      customer.ID,
-			AccountNumber:   customer.AccountNumber,
-			CustomerName:    customer.FullName(),
-			ReadingDate:     readingRequest.ReadingDate,
-			PreviousReading: previousReadingValue,
-			CurrentReading:  readingRequest.CurrentReading,
-			Consumption:     consumption,
-			RatePerUnit:     ratePerUnit,
-			WaterCharge:     waterCharge,
-			FixedCharge:     fixedCharge,
-			ReadingType:     readingRequest.ReadingType,
-			ReadingMethod:   readingRequest.ReadingMethod,
-			ReaderID:        readingRequest.ReaderID,
-			ReaderName:      readingRequest.ReaderName,
-			Month:           readingRequest.ReadingDate.Format("2006-01"),
-			Year:            readingRequest.ReadingDate.Year(),
-			BillingPeriod:   utils.GetBillingPeriod(readingRequest.ReadingDate),
-			Status:          "recorded",
-			CreatedAt:       time.Now(),
+		// 3-5. Validate, calculate charges and prepare the reading record
+		reading, arrears, err := prepareReading(readingRequest, customer, previousReading, fixedCharge)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
 		}
 
 		// 6. Insert meter reading
 		_, err = bs.readingsCollection.InsertOne(sc, reading)
 		if err != nil {
 			session.AbortTransaction(sc)
+			if mongo.IsDuplicateKeyError(err) {
+				return duplicateReadingError(reading.MeterNumber, reading.ReadingDate)
+			}
 			return fmt.Errorf("failed to save meter reading: %v", err)
 		}
 
 		// 7. Generate bill
-		bill, err := bs.generateBill(sc, customer, reading, arrears)
+		bill, err := bs.generateBill(sc, customer, reading, arrears, tariff)
 		if err != nil {
 			session.AbortTransaction(sc)
 			return err
 		}
 
 		// 8. Update customer with latest reading and new balance
-		err = bs.updateCustomerAfterBilling(sc, customer.ID, reading.CurrentReading, reading.ReadingDate, bill.TotalAmount)
+		err = bs.updateCustomerAfterBilling(sc, customer.ID, reading, bill.TotalAmount)
 		if err != nil {
 			session.AbortTransaction(sc)
 			return err
@@ -194,6 +222,12 @@ func (bs *BillingService) SubmitMeterReading(readingRequest *models.MeterReading
 		return nil, err
 	}
 
+	// Flagged readings are held for review instead of notifying the customer
+	if resultBill != nil && resultBill.Flagged {
+		utils.Logf(ctx, "⚠️ Bill %s flagged for review; customer not notified", resultBill.BillNumber)
+		return resultBill, nil
+	}
+
 	// ============ NEW: SMS NOTIFICATION ============
 	// Send SMS notification to customer (non-blocking)
 	if resultBill != nil && customer != nil && customer.PhoneNumber != "" {
@@ -201,63 +235,242 @@ func (bs *BillingService) SubmitMeterReading(readingRequest *models.MeterReading
 		go bs.sendBillSMSNotification(resultBill, customer)
 	} else {
 		if customer == nil {
-			log.Println("⚠️ Cannot send SMS: customer is nil")
+			utils.Logf(ctx, "⚠️ Cannot send SMS: customer is nil")
 		} else if customer.PhoneNumber == "" {
-			log.Printf("⚠️ Cannot send SMS: customer %s has no phone number", customer.MeterNumber)
+			utils.Logf(ctx, "⚠️ Cannot send SMS: customer %s has no phone number", customer.MeterNumber)
 		}
 	}
 
+	// Email the bill as well when the customer has an address on file
+	if resultBill != nil && customer != nil && customer.Email != "" && bs.emailService != nil {
+		go bs.sendBillEmailNotification(resultBill, customer)
+	}
+
 	return resultBill, nil
 }
 
-// NEW: Send bill SMS notification
-// sendBillSMSNotification sends an SMS to the customer with bill details
-func (bs *BillingService) sendBillSMSNotification(bill *models.Bill, customer *models.Customer) {
-	// Small delay to ensure bill is fully saved
-	time.Sleep(200 * time.Millisecond)
+// duplicateReadingError is returned when a meter already has a reading for the month of date
+func duplicateReadingError(meterNumber string, date time.Time) error {
+	return fmt.Errorf("a reading for meter %s already exists for %s", meterNumber, date.Format("January 2006"))
+}
 
-	// Format billing period
-	month := bill.BillingPeriod
-	if month == "" {
-		month = time.Now().Format("January 2006")
+// removeReading deletes a reading that is being replaced and reverses its bill inside the
+// caller's transaction
+func (bs *BillingService) removeReading(sc mongo.SessionContext, reading *models.MeterReading) error {
+	if err := bs.voidReadingBill(sc, reading, "replacing", "", ""); err != nil {
+		return err
 	}
 
-	// Format due date
-	dueDate := bill.DueDate.Format("02 Jan 2006")
+	if _, err := bs.readingsCollection.DeleteOne(sc, bson.M{"_id": reading.ID}); err != nil {
+		return fmt.Errorf("failed to remove reading: %v", err)
+	}
 
-	// Calculate amount in KSh
-	amount := bill.TotalAmount
+	return nil
+}
 
-	// Format the SMS message
-	message := fmt.Sprintf(`Dear %s,
+// voidReadingBill reverses the bill raised from reading inside the caller's transaction, before
+// the reading is replaced or corrected. The bill is kept as cancelled with a zero balance, renamed
+// so the new bill can reuse its number; its balance comes off the customer and their last reading,
+// its date, consumption and average roll back to before the reading. A bill with payments is
+// refused. reason and actingUser, when given, are recorded as the cancellation.
+func (bs *BillingService) voidReadingBill(sc mongo.SessionContext, reading *models.MeterReading, action, reason, actingUser string) error {
+	now := time.Now()
 
-Your water bill for %s is now ready.
+	// A corrected reading also has the bills voided by earlier corrections
+	var bill models.Bill
+	err := bs.billsCollection.FindOne(sc, bson.M{
+		"reading_id": reading.ID,
+		"status":     bson.M{"$ne": "cancelled"},
+	}).Decode(&bill)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("error fetching bill: %v", err)
+	}
 
-Meter: %s
-Previous Reading: %.1f units
-Current Reading: %.1f units
-Consumption: %.1f units
-Amount Due: KSh %.0f
-Due Date: %s
+	if err == nil {
+		if bill.AmountPaid > 0 {
+			return fmt.Errorf("bill %s has payments against it; reverse them before %s the reading", bill.BillNumber, action)
+		}
 
-Please make payment to avoid service interruption.
+		outstanding := bill.Balance
+		if err = bs.voidBill(sc, &bill, reason, actingUser, now); err != nil {
+			return err
+		}
 
-Thank you,
-Rochi Pure Water`,
-		customer.FullName(),
-		month,
-		bill.MeterNumber,
-		bill.PreviousReading,
-		bill.CurrentReading,
-		bill.Consumption,
-		amount,
-		dueDate)
+		previous, err := bs.readingBefore(sc, reading)
+		if err != nil {
+			return err
+		}
+		average, err := bs.averageConsumption(sc, bill.CustomerID, reading.ID)
+		if err != nil {
+			return err
+		}
 
-	// Send the SMS
+		update := readingRollbackUpdate(reading, previous, outstanding, average, now)
+		if _, err = bs.customersCollection.UpdateByID(sc, bill.CustomerID, update); err != nil {
+			return fmt.Errorf("failed to update customer: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// readingRollbackUpdate takes a voided reading's bill off the customer and puts their last
+// reading, its date and their average back to what they were before it. previous is nil when
+// the reading was the first, and average nil when no other readings count towards it.
+func readingRollbackUpdate(reading, previous *models.MeterReading, outstanding float64, average *float64, now time.Time) bson.M {
+	set := bson.M{
+		"last_reading": reading.PreviousReading,
+		"updated_at":   now,
+	}
+	unset := bson.M{}
+	if previous != nil {
+		set["last_reading_date"] = previous.ReadingDate
+	} else {
+		unset["last_reading_date"] = ""
+	}
+	if average != nil {
+		set["average_consumption"] = *average
+	} else {
+		unset["average_consumption"] = ""
+	}
+
+	update := bson.M{
+		"$inc": bson.M{
+			"balance":        -outstanding,
+			"total_consumed": -reading.Consumption,
+		},
+		"$set": set,
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
+// prepareReading validates a submitted reading against the previous one and builds the reading
+// record with its charges, returning it with the arrears to carry onto the bill.
+// previousReading is nil for a customer's first reading.
+func prepareReading(readingRequest *models.MeterReading, customer *models.Customer,
+	previousReading *models.MeterReading, fixedCharge float64) (*models.MeterReading, float64, error) {
+
+	// Set previous reading value
+	var previousReadingValue float64
+	if previousReading != nil {
+		previousReadingValue = previousReading.CurrentReading
+	} else {
+		// First reading for this customer
+		previousReadingValue = customer.InitialReading
+	}
+
+	// 3. Validate and calculate consumption.
+	// An actual reading after an estimate may come in below the estimate; it is then
+	// only checked against the last real reading and flagged for review.
+	reconciling := previousReading != nil && previousReading.ReadingType == "estimated" &&
+		readingRequest.ReadingType != "estimated"
+
+	floor := previousReadingValue
+	if reconciling {
+		floor = previousReading.PreviousReading
+	}
+	// A reading far below the previous one on a meter close to its maximum is a rollover
+	consumption := readingRequest.CurrentReading - previousReadingValue
+	meterMax := meterMaxFor(customer.MeterSize)
+	var rollover bool
+	if readingRequest.CurrentReading < floor && !reconciling {
+		consumption, rollover = rolloverConsumption(previousReadingValue, readingRequest.CurrentReading, meterMax)
+	}
+	if readingRequest.CurrentReading < floor && !rollover {
+		return nil, 0, fmt.Errorf("current reading (%.2f) cannot be less than previous reading (%.2f)",
+			readingRequest.CurrentReading, floor)
+	}
+
+	var estimateDeviation float64
+	var needsReview bool
+	var reviewReason string
+	if rollover {
+		// Always checked by a person: a misread can look like a rollover
+		needsReview = true
+		reviewReason = fmt.Sprintf("meter rollover from %.0f to %.0f past %.0f; %.1f units billed",
+			previousReadingValue, readingRequest.CurrentReading, meterMax, consumption)
+	} else if reconciling {
+		estimateDeviation, needsReview = reconcileEstimate(previousReading, consumption)
+		if needsReview {
+			reviewReason = fmt.Sprintf("consumption deviates %.0f%% from the estimate", estimateDeviation)
+		}
+		if consumption < 0 {
+			// Over-estimated: nothing further to bill this period
+			consumption = 0
+		}
+	} else if readingRequest.ReadingType != "estimated" {
+		reviewReason = checkConsumptionAnomaly(consumption, customer.AverageConsumption)
+		needsReview = reviewReason != ""
+	}
+
+	// 4. Calculate charges at the flat rate per unit (RATE_PER_UNIT)
+	ratePerUnit := company.RatePerUnit
+	waterCharge := consumption * ratePerUnit
+	// Whatever is still owed on earlier bills, shown on the new bill for reference
+	arrears := customer.AmountOwed()
+
+	// A customer connected part way through the month pays only for the days connected
+	proration := prorationFactor(customer.ConnectionDate, readingRequest.ReadingDate)
+	if proration < 1 {
+		fixedCharge = utils.RoundToTwoDecimal(fixedCharge * proration)
+	} else {
+		proration = 0
+	}
+
+	// Prepare meter reading record
+	reading := &models.MeterReading{
+		ID:                primitive.NewObjectID(),
+		MeterNumber:       readingRequest.MeterNumber,
+		CustomerID:        customer.ID,
+		AccountNumber:     customer.AccountNumber,
+		CustomerName:      customer.FullName(),
+		ReadingDate:       readingRequest.ReadingDate,
+		PreviousReading:   previousReadingValue,
+		CurrentReading:    readingRequest.CurrentReading,
+		Consumption:       consumption,
+		RatePerUnit:       ratePerUnit,
+		WaterCharge:       waterCharge,
+		FixedCharge:       fixedCharge,
+		Proration:         proration,
+		ReadingType:       readingRequest.ReadingType,
+		ReadingMethod:     readingRequest.ReadingMethod,
+		ReaderID:          readingRequest.ReaderID,
+		ReaderName:        readingRequest.ReaderName,
+		Location:          readingRequest.Location,
+		Month:             readingRequest.ReadingDate.Format("2006-01"),
+		Year:              readingRequest.ReadingDate.Year(),
+		BillingPeriod:     utils.GetBillingPeriod(readingRequest.ReadingDate),
+		Status:            "recorded",
+		Notes:             readingRequest.Notes,
+		EstimateDeviation: estimateDeviation,
+		NeedsReview:       needsReview,
+		ReviewReason:      reviewReason,
+		Rollover:          rollover,
+		CreatedAt:         time.Now(),
+	}
+	if reading.ReadingType == "estimated" {
+		reading.Status = "estimated"
+	}
+
+	return reading, arrears, nil
+}
+
+// NEW: Send bill SMS notification
+// sendBillSMSNotification sends an SMS to the customer with bill details
+func (bs *BillingService) sendBillSMSNotification(bill *models.Bill, customer *models.Customer) {
+	// Small delay to ensure bill is fully saved
+	time.Sleep(200 * time.Millisecond)
+
+	// Send the SMS, or queue it during quiet hours
 	log.Printf("📱 Sending SMS to %s (%s)", customer.FullName(), customer.PhoneNumber)
-	err := bs.smsService.SendSMS(customer.PhoneNumber, message)
+	err := bs.smsService.SendBillNotification(bill, customer)
 
-	if err != nil {
+	if errors.Is(err, ErrSMSOptedOut) {
+		log.Printf("🔕 Bill SMS for %s skipped: customer opted out", bill.BillNumber)
+	} else if err != nil {
 		log.Printf("❌ Failed to send SMS to %s: %v", customer.PhoneNumber, err)
 	} else {
 		log.Printf("✅ SMS sent successfully to %s (%s) for bill %s",
@@ -286,12 +499,58 @@ func (bs *BillingService) markSMSAsSent(billID primitive.ObjectID) {
 	}
 }
 
+// sendBillEmailNotification emails the bill to the customer
+func (bs *BillingService) sendBillEmailNotification(bill *models.Bill, customer *models.Customer) {
+	if err := bs.emailService.SendBillEmail(bill, customer); err != nil {
+		log.Printf("❌ Failed to email bill %s to %s: %v", bill.BillNumber, customer.Email, err)
+		return
+	}
+
+	log.Printf("✅ Bill %s emailed to %s", bill.BillNumber, customer.Email)
+	bs.markEmailAsSent(bill.ID)
+}
+
+// markEmailAsSent marks the bill record as emailed
+func (bs *BillingService) markEmailAsSent(billID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"email_sent":    true,
+			"email_sent_at": time.Now(),
+		},
+	}
+
+	_, err := bs.billsCollection.UpdateByID(ctx, billID, update)
+	if err != nil {
+		log.Printf("⚠️ Failed to update email sent status for bill %s: %v", billID.Hex(), err)
+	}
+}
+
 // generateBill creates a bill from a meter reading using FLAT RATE pricing
 func (bs *BillingService) generateBill(sc mongo.SessionContext, customer *models.Customer,
-	reading *models.MeterReading, arrears float64) (*models.Bill, error) {
+	reading *models.MeterReading, arrears float64, tariff *models.Tariff) (*models.Bill, error) {
+
+	bill := newBill(customer, reading, arrears, tariff)
+
+	// Insert bill
+	_, err := bs.billsCollection.InsertOne(sc, bill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bill: %v", err)
+	}
 
-	// Calculate total amount: water charge + arrears (no fixed charges)
-	totalAmount := reading.WaterCharge + arrears
+	return bill, nil
+}
+
+// newBill builds the bill for a prepared meter reading, on the payment terms and in the unit of
+// tariff (nil for none). Arrears are recorded for the customer's information only: earlier bills
+// keep their own balances, so adding them to this bill's total would count them twice.
+func newBill(customer *models.Customer, reading *models.MeterReading, arrears float64, tariff *models.Tariff) *models.Bill {
+	billDate := time.Now()
+
+	// This period's charges only
+	totalAmount := reading.WaterCharge + reading.FixedCharge
 	totalAmount = utils.RoundToTwoDecimal(totalAmount)
 
 	// Generate bill number
@@ -306,35 +565,146 @@ func (bs *BillingService) generateBill(sc mongo.SessionContext, customer *models
 		AccountNumber:   customer.AccountNumber,
 		CustomerName:    customer.FullName(),
 		BillNumber:      billNumber,
-		BillDate:        time.Now(),
-		DueDate:         time.Now().AddDate(0, 1, 0), // Due in 1 month
+		BillDate:        billDate,
+		DueDate:         billDate.AddDate(0, 0, billDueDays(tariff)),
 		BillingPeriod:   reading.BillingPeriod,
 		PreviousReading: reading.PreviousReading,
 		CurrentReading:  reading.CurrentReading,
 		Consumption:     reading.Consumption,
+		Unit:            consumptionUnit(tariff),
 		RatePerUnit:     reading.RatePerUnit,
 		WaterCharge:     reading.WaterCharge,
-		FixedCharge:     0.0, // No fixed charges
+		FixedCharge:     reading.FixedCharge,
+		Proration:       reading.Proration,
 		Arrears:         arrears,
 		TotalAmount:     totalAmount,
 		Balance:         totalAmount, // Initially balance equals total amount
 		Status:          "pending",
+		Flagged:         reading.NeedsReview,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
 
-	// Insert bill
-	_, err := bs.billsCollection.InsertOne(sc, bill)
+	return bill
+}
+
+// customerTariff returns the customer's active tariff, or nil if they have none
+func (bs *BillingService) customerTariff(sc mongo.SessionContext, customer *models.Customer) (*models.Tariff, error) {
+	if customer.TariffCode == "" {
+		return nil, nil
+	}
+
+	var tariff models.Tariff
+	err := bs.tariffsCollection.FindOne(sc, bson.M{
+		"code":      customer.TariffCode,
+		"is_active": true,
+	}).Decode(&tariff)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create bill: %v", err)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil // No active tariff
+		}
+		return nil, fmt.Errorf("error fetching tariff %s: %v", customer.TariffCode, err)
 	}
 
-	return bill, nil
+	return &tariff, nil
+}
+
+// prorationFactor is the fraction of the reading's calendar month the customer was connected,
+// counting the connection day. It is 1 unless the connection date falls in that month.
+func prorationFactor(connectionDate, readingDate time.Time) float64 {
+	if connectionDate.IsZero() {
+		return 1
+	}
+	connected := connectionDate.In(readingDate.Location())
+	if connected.Year() != readingDate.Year() || connected.Month() != readingDate.Month() {
+		return 1
+	}
+
+	daysInMonth := time.Date(readingDate.Year(), readingDate.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return float64(daysInMonth-connected.Day()+1) / float64(daysInMonth)
+}
+
+// fixedChargeFor returns the monthly fixed charge for a customer.
+// A non-zero customer override wins, otherwise the tariff's charge is used.
+func fixedChargeFor(customer *models.Customer, tariff *models.Tariff) float64 {
+	if customer.FixedCharge != 0 {
+		return customer.FixedCharge
+	}
+	if tariff == nil {
+		return 0
+	}
+	return tariff.FixedCharge
+}
+
+// billDueDays returns how many days after the bill date payment is due: the tariff's terms
+// when set, otherwise BILL_DUE_DAYS (default 30)
+func billDueDays(tariff *models.Tariff) int {
+	if tariff != nil && tariff.DueDays > 0 {
+		return tariff.DueDays
+	}
+
+	if v, err := strconv.Atoi(os.Getenv("BILL_DUE_DAYS")); err == nil && v > 0 {
+		return v
+	}
+	return 30
+}
+
+// consumptionUnit is the tariff's billing unit, or models.DefaultUnit when it sets none
+func consumptionUnit(tariff *models.Tariff) string {
+	if tariff != nil && tariff.Unit != "" {
+		return tariff.Unit
+	}
+	return models.DefaultUnit
+}
+
+// averageWindow is how many recent actual readings make up a customer's average consumption
+const averageWindow = 6
+
+// averageConsumption returns the mean consumption over the customer's last few actual readings,
+// counting zero-consumption months. Estimated readings are left out since they are derived
+// from the average, as is the reading excluding (NilObjectID for none). Returns nil when there
+// is no history yet.
+func (bs *BillingService) averageConsumption(sc mongo.SessionContext, customerID, excluding primitive.ObjectID) (*float64, error) {
+	opts := options.Find().
+		SetSort(bson.M{"reading_date": -1}).
+		SetLimit(averageWindow).
+		SetProjection(bson.M{"consumption": 1})
+
+	filter := bson.M{
+		"customer_id":  customerID,
+		"reading_type": bson.M{"$ne": "estimated"},
+		"status":       bson.M{"$ne": "cancelled"},
+	}
+	if !excluding.IsZero() {
+		filter["_id"] = bson.M{"$ne": excluding}
+	}
+	cursor, err := bs.readingsCollection.Find(sc, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reading history: %v", err)
+	}
+	defer cursor.Close(sc)
+
+	var readings []models.MeterReading
+	if err = cursor.All(sc, &readings); err != nil {
+		return nil, fmt.Errorf("error decoding reading history: %v", err)
+	}
+
+	if len(readings) == 0 {
+		return nil, nil
+	}
+
+	var total float64
+	for _, r := range readings {
+		total += r.Consumption
+	}
+	average := utils.RoundToTwoDecimal(total / float64(len(readings)))
+
+	return &average, nil
 }
 
 // updateCustomerAfterBilling updates customer's last reading and adds the new bill amount to balance
 func (bs *BillingService) updateCustomerAfterBilling(sc mongo.SessionContext,
-	customerID primitive.ObjectID, currentReading float64, readingDate time.Time, billAmount float64) error {
+	customerID primitive.ObjectID, reading *models.MeterReading, billAmount float64) error {
 
 	// Get current customer to get current balance
 	var customer models.Customer
@@ -343,28 +713,12 @@ func (bs *BillingService) updateCustomerAfterBilling(sc mongo.SessionContext,
 		return fmt.Errorf("customer not found: %v", err)
 	}
 
-	// ✅ FIXED: ADD bill amount to balance (they owe more)
-	newBalance := customer.Balance + billAmount
-	newBalance = utils.RoundToTwoDecimal(newBalance)
-
-	// Calculate total consumed
-	totalConsumed := customer.TotalConsumed
-	if customer.LastReading > 0 {
-		totalConsumed += (currentReading - customer.LastReading)
-	} else {
-		totalConsumed += currentReading
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			"last_reading":      currentReading,
-			"last_reading_date": readingDate,
-			"balance":           newBalance,
-			"updated_at":        time.Now(),
-			"total_consumed":    totalConsumed,
-		},
+	averageConsumption, err := bs.averageConsumption(sc, customerID, primitive.NilObjectID)
+	if err != nil {
+		return err
 	}
 
+	update := customerBillingUpdate(reading, billAmount, averageConsumption)
 	_, err = bs.customersCollection.UpdateByID(sc, customerID, update)
 	if err != nil {
 		return fmt.Errorf("failed to update customer: %v", err)
@@ -373,170 +727,1038 @@ func (bs *BillingService) updateCustomerAfterBilling(sc mongo.SessionContext,
 	return nil
 }
 
-// ProcessPayment processes a payment for a bill
-func (bs *BillingService) ProcessPayment(payment *models.Payment) error {
-	session, err := bs.paymentsCollection.Database().Client().StartSession()
-	if err != nil {
-		return fmt.Errorf("failed to start session: %v", err)
+// customerBillingUpdate builds the customer update for a new bill: the latest reading, the bill
+// added to the balance (they owe more), consumption totals and, when known, the new average.
+// The reading's own consumption is added, which already accounts for meter rollover. Balance and
+// totals are incremented rather than set, so a payment recorded since the customer was loaded
+// is not overwritten.
+func customerBillingUpdate(reading *models.MeterReading, billAmount float64, averageConsumption *float64) bson.M {
+	set := bson.M{
+		"last_reading":      reading.CurrentReading,
+		"last_reading_date": reading.ReadingDate,
+		"updated_at":        time.Now(),
+	}
+	if averageConsumption != nil {
+		set["average_consumption"] = *averageConsumption
 	}
-	defer session.EndSession(context.Background())
 
-	err = mongo.WithSession(context.Background(), session, func(sc mongo.SessionContext) error {
-		if err = session.StartTransaction(); err != nil {
-			return fmt.Errorf("failed to start transaction: %v", err)
-		}
+	return bson.M{
+		"$set": set,
+		"$inc": bson.M{
+			"balance":        billAmount,
+			"total_consumed": reading.Consumption,
+		},
+	}
+}
 
-		// 1. Get the bill
-		var bill models.Bill
-		err := bs.billsCollection.FindOne(sc, bson.M{"_id": payment.BillID}).Decode(&bill)
-		if err != nil {
-			session.AbortTransaction(sc)
-			return fmt.Errorf("bill not found: %v", err)
-		}
+// estimateSampleSize is how many recent actual readings are averaged when a customer has no average consumption
+const estimateSampleSize = 3
 
-		// 2. Validate payment amount
-		if payment.Amount <= 0 {
-			session.AbortTransaction(sc)
-			return errors.New("payment amount must be greater than 0")
-		}
+// GenerateEstimatedReading bills a meter that could not be read, using the customer's
+// average consumption or, failing that, the average of their last few actual readings
+func (bs *BillingService) GenerateEstimatedReading(ctx context.Context, meterNumber string, readingDate time.Time) (*models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-		// 3. Create payment record
-		payment.ID = primitive.NewObjectID()
-		payment.PaymentDate = time.Now()
-		payment.Status = "completed"
-		payment.CreatedAt = time.Now()
+	customer, err := bs.GetCustomerByMeterNumber(ctx, meterNumber)
+	if err != nil {
+		return nil, err
+	}
 
-		// Generate receipt number if not provided
-		if payment.ReceiptNumber == "" {
-			payment.ReceiptNumber = utils.GenerateReceiptNumber()
-		}
+	period := readingDate.Format("2006-01")
+	count, err := bs.readingsCollection.CountDocuments(ctx, bson.M{"meter_number": meterNumber, "month": period})
+	if err != nil {
+		return nil, fmt.Errorf("error checking existing readings: %v", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("a reading already exists for meter %s in %s", meterNumber, period)
+	}
 
-		_, err = bs.paymentsCollection.InsertOne(sc, payment)
+	estimate := customer.AverageConsumption
+	if estimate <= 0 {
+		opts := options.Find().SetSort(bson.M{"reading_date": -1}).SetLimit(estimateSampleSize)
+		cursor, err := bs.readingsCollection.Find(ctx, bson.M{
+			"meter_number": meterNumber,
+			"reading_type": bson.M{"$ne": "estimated"},
+		}, opts)
 		if err != nil {
-			session.AbortTransaction(sc)
-			return fmt.Errorf("failed to save payment: %v", err)
+			return nil, fmt.Errorf("error fetching reading history: %v", err)
 		}
+		defer cursor.Close(ctx)
 
-		// 4. Update bill payment status
-		bill.UpdatePayment(payment.Amount, payment.PaymentMethod, payment.TransactionID)
-		bill.UpdatedAt = time.Now()
-
-		_, err = bs.billsCollection.ReplaceOne(sc, bson.M{"_id": bill.ID}, bill)
-		if err != nil {
-			session.AbortTransaction(sc)
-			return fmt.Errorf("failed to update bill: %v", err)
+		var history []models.MeterReading
+		if err = cursor.All(ctx, &history); err != nil {
+			return nil, fmt.Errorf("error decoding reading history: %v", err)
 		}
 
-		// 5. Update customer balance (add payment to balance)
-		err = bs.updateCustomerBalance(sc, bill.CustomerID, payment.Amount)
-		if err != nil {
-			session.AbortTransaction(sc)
-			return err
+		for _, r := range history {
+			estimate += r.Consumption
 		}
-
-		if err = session.CommitTransaction(sc); err != nil {
-			return fmt.Errorf("failed to commit transaction: %v", err)
+		if len(history) > 0 {
+			estimate /= float64(len(history))
 		}
+	}
 
-		return nil
-	})
-
-	return err
-}
-
-// UpdateBillPayment updates a bill's payment status and customer's balance
-func (s *BillingService) UpdateBillPayment(billID string, amount float64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	objectID, err := primitive.ObjectIDFromHex(billID)
-	if err != nil {
-		return fmt.Errorf("invalid bill ID: %v", err)
+	if estimate <= 0 {
+		return nil, fmt.Errorf("no consumption history to estimate meter %s from", meterNumber)
 	}
 
-	var bill models.Bill
-	err = s.billsCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&bill)
+	previousReading, err := bs.GetCustomerPreviousReading(ctx, meterNumber)
 	if err != nil {
-		return fmt.Errorf("bill not found: %v", err)
+		return nil, err
 	}
+	previousValue := customer.InitialReading
+	if previousReading != nil {
+		previousValue = previousReading.CurrentReading
+	}
+
+	return bs.SubmitMeterReading(ctx, &models.MeterReading{
+		MeterNumber:    meterNumber,
+		CurrentReading: utils.RoundToTwoDecimal(previousValue + estimate),
+		ReadingDate:    readingDate,
+		ReadingType:    "estimated",
+		ReadingMethod:  "system",
+		ReaderName:     "System estimate",
+		Notes:          fmt.Sprintf("Estimated consumption of %.2f units", estimate),
+	})
+}
 
-	// Calculate new amount paid and balance
-	newAmountPaid := bill.AmountPaid + amount
-	newBalance := bill.TotalAmount - newAmountPaid
+// meterMaxFor is the value at which a meter of the given size wraps back to zero. It reads
+// METER_MAX_<SIZE> (for example METER_MAX_20MM for "20mm"), then METER_MAX, and defaults
+// to 100000 for a five-digit register.
+func meterMaxFor(meterSize string) float64 {
+	size := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, meterSize)
 
-	// Determine new status
-	status := bill.Status
-	if newBalance <= 0 {
-		status = "paid"
-	} else if newAmountPaid > 0 {
-		status = "partially_paid"
+	if size != "" {
+		if v, err := strconv.ParseFloat(os.Getenv("METER_MAX_"+size), 64); err == nil && v > 0 {
+			return v
+		}
 	}
-
-	// Update the bill
-	billUpdate := bson.M{
-		"$set": bson.M{
-			"amount_paid": newAmountPaid,
-			"balance":     newBalance,
-			"status":      status,
-			"updated_at":  time.Now(),
-		},
+	if v, err := strconv.ParseFloat(os.Getenv("METER_MAX"), 64); err == nil && v > 0 {
+		return v
 	}
+	return 100000
+}
 
-	result, err := s.billsCollection.UpdateByID(ctx, objectID, billUpdate)
-	if err != nil {
-		return fmt.Errorf("failed to update bill: %v", err)
+// rolloverConsumption works out consumption for a reading below the previous one, assuming the
+// meter wrapped past meterMax. It only treats the drop as a rollover when it is larger than
+// METER_ROLLOVER_THRESHOLD percent of meterMax (default 50) and both readings fit on the meter;
+// a smaller drop is a misread and ok is false.
+func rolloverConsumption(previous, current, meterMax float64) (consumption float64, ok bool) {
+	thresholdPercent := 50.0
+	if v, err := strconv.ParseFloat(os.Getenv("METER_ROLLOVER_THRESHOLD"), 64); err == nil && v > 0 && v <= 100 {
+		thresholdPercent = v
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("bill not found")
+	if current < 0 || previous >= meterMax || current >= meterMax {
+		return 0, false
 	}
-
-	// ✅ NOW UPDATE THE CUSTOMER'S BALANCE
-	// Find the customer by meter number
-	var customer models.Customer
-	err = s.customersCollection.FindOne(ctx, bson.M{"meter_number": bill.MeterNumber}).Decode(&customer)
-	if err != nil {
-		// Log error but don't fail the payment
-		fmt.Printf("Warning: Customer not found for meter %s: %v\n", bill.MeterNumber, err)
-		return nil
+	if previous-current <= meterMax*thresholdPercent/100 {
+		return 0, false
 	}
 
-	// ✅ FIXED: Calculate new customer balance based on credit/debt status
-	var newCustomerBalance float64
+	return utils.RoundToTwoDecimal(meterMax - previous + current), true
+}
 
-	if customer.Balance < 0 {
-		// Customer has CREDIT (negative balance)
-		// They are using credit to pay - balance should INCREASE (toward zero)
-		newCustomerBalance = customer.Balance + amount
-		log.Printf("Credit payment: Balance was %.2f, payment %.2f, new balance %.2f",
-			customer.Balance, amount, newCustomerBalance)
-	} else {
-		// Customer has DEBT (positive balance)
-		// They are paying down debt - balance should DECREASE
-		newCustomerBalance = customer.Balance - amount
+// reconcileEstimate compares the consumption measured since an estimate with the estimated
+// consumption. The deviation is a percentage; it is flagged when it exceeds
+// ESTIMATE_REVIEW_THRESHOLD (default 25%).
+func reconcileEstimate(estimate *models.MeterReading, consumption float64) (float64, bool) {
+	if estimate.Consumption <= 0 {
+		return 0, consumption < 0
 	}
 
-	newCustomerBalance = utils.RoundToTwoDecimal(newCustomerBalance)
+	deviation := utils.RoundToTwoDecimal((consumption - estimate.Consumption) / estimate.Consumption * 100)
 
-	// Update customer balance
-	customerUpdate := bson.M{
-		"$set": bson.M{
-			"balance":    newCustomerBalance,
-			"updated_at": time.Now(),
-			"total_paid": customer.TotalPaid + amount,
+	threshold := 25.0
+	if v, err := strconv.ParseFloat(os.Getenv("ESTIMATE_REVIEW_THRESHOLD"), 64); err == nil && v > 0 {
+		threshold = v
+	}
+
+	return deviation, math.Abs(deviation) > threshold || consumption < 0
+}
+
+// checkConsumptionAnomaly returns why a consumption looks wrong against the customer's average,
+// or "" if it looks normal. A reading is flagged when it is more than READING_HIGH_MULTIPLIER
+// times the average (default 3) or more than READING_LOW_PERCENT below it (default 70).
+func checkConsumptionAnomaly(consumption, average float64) string {
+	if average <= 0 {
+		return ""
+	}
+
+	highMultiplier := 3.0
+	if v, err := strconv.ParseFloat(os.Getenv("READING_HIGH_MULTIPLIER"), 64); err == nil && v > 0 {
+		highMultiplier = v
+	}
+	lowPercent := 70.0
+	if v, err := strconv.ParseFloat(os.Getenv("READING_LOW_PERCENT"), 64); err == nil && v > 0 && v <= 100 {
+		lowPercent = v
+	}
+
+	if consumption > average*highMultiplier {
+		return fmt.Sprintf("consumption %.1f is over %.1fx the average of %.1f", consumption, highMultiplier, average)
+	}
+	if consumption < average*(1-lowPercent/100) {
+		return fmt.Sprintf("consumption %.1f is more than %.0f%% below the average of %.1f", consumption, lowPercent, average)
+	}
+
+	return ""
+}
+
+// GetFlaggedReadings retrieves readings held for review, newest first
+func (bs *BillingService) GetFlaggedReadings(ctx context.Context, page, limit int64) ([]models.MeterReading, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"needs_review": true}
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"reading_date": -1})
+
+	cursor, err := bs.readingsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching flagged readings: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var readings []models.MeterReading
+	if err = cursor.All(ctx, &readings); err != nil {
+		return nil, 0, fmt.Errorf("error decoding flagged readings: %v", err)
+	}
+
+	total, err := bs.readingsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting flagged readings: %v", err)
+	}
+
+	return readings, total, nil
+}
+
+// maxNearReadings caps how many readings a proximity search returns
+const maxNearReadings = 100
+
+// GetReadingsNear returns readings captured within radiusMeters of a point, nearest first.
+// It relies on the 2dsphere index on location created by the init script.
+func (bs *BillingService) GetReadingsNear(ctx context.Context, lng, lat, radiusMeters float64) ([]models.MeterReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := utils.ValidateCoordinates(lng, lat); err != nil {
+		return nil, err
+	}
+	if radiusMeters <= 0 {
+		return nil, errors.New("radius must be greater than 0")
+	}
+
+	filter := bson.M{
+		"location": bson.M{
+			"$near": bson.M{
+				"$geometry": bson.M{
+					"type":        "Point",
+					"coordinates": []float64{lng, lat},
+				},
+				"$maxDistance": radiusMeters,
+			},
 		},
 	}
 
-	_, err = s.customersCollection.UpdateByID(ctx, customer.ID, customerUpdate)
+	cursor, err := bs.readingsCollection.Find(ctx, filter, options.Find().SetLimit(maxNearReadings))
+	if err != nil {
+		if isMissingGeoIndex(err) {
+			return nil, errors.New("geospatial index missing on meter_readings.location")
+		}
+		return nil, fmt.Errorf("error fetching nearby readings: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var readings []models.MeterReading
+	if err = cursor.All(ctx, &readings); err != nil {
+		if isMissingGeoIndex(err) {
+			return nil, errors.New("geospatial index missing on meter_readings.location")
+		}
+		return nil, fmt.Errorf("error decoding nearby readings: %v", err)
+	}
+
+	return readings, nil
+}
+
+// isMissingGeoIndex reports whether a $near query failed for lack of a geospatial index
+func isMissingGeoIndex(err error) bool {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(291) { // NoQueryExecutionPlans
+		return true
+	}
+	return strings.Contains(err.Error(), "unable to find index for $geoNear query")
+}
+
+// RecordPayment records a payment against a bill. It is the single path for recording payments:
+// the payment, the bill and the customer balance are written in one transaction, and the
+// payment's meter and customer details are taken from the bill.
+// Only the bill's outstanding balance is applied to it; any overpayment is stored on the payment as
+// CreditAmount. The customer balance always drops by the full payment, so after overpaying a
+// KSh 1,000 bill with KSh 1,200 the bill shows AmountPaid 1,000 and Balance 0, and a customer who
+// owed only that bill has Balance -200 (in credit).
+//
+// If a payment with the same non-empty TransactionID already exists, nothing is written: payment is
+// overwritten with the existing record and duplicate is true, so retried submissions are safe.
+func (bs *BillingService) RecordPayment(ctx context.Context, payment *models.Payment) (duplicate bool, err error) {
+	session, err := bs.paymentsCollection.StartSession()
+	if err != nil {
+		return false, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err = session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. Return the existing payment for a transaction ID we have already seen
+		if payment.TransactionID != "" {
+			var existing models.Payment
+			err := bs.paymentsCollection.FindOne(sc, bson.M{"transaction_id": payment.TransactionID}).Decode(&existing)
+			if err == nil {
+				session.AbortTransaction(sc)
+				*payment = existing
+				duplicate = true
+				return nil
+			}
+			if err != mongo.ErrNoDocuments {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("error checking transaction ID: %v", err)
+			}
+		}
+
+		// 2. Apply the payment to the bill and the customer balance
+		bill, excess, err := bs.applyBillPayment(sc, payment.BillID, payment.Amount, payment.PaymentMethod, payment.TransactionID)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+		payment.MeterNumber = bill.MeterNumber
+		payment.CustomerID = bill.CustomerID
+		payment.CustomerName = bill.CustomerName
+		payment.CreditAmount = excess
+
+		// 3. Create payment record
+		stampPayment(payment, time.Now())
+
+		_, err = bs.paymentsCollection.InsertOne(sc, payment)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if field, ok := utils.IsDuplicateKeyError(err); ok {
+				return duplicatePaymentError(field, payment.TransactionID)
+			}
+			return fmt.Errorf("failed to save payment: %v", err)
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		return nil
+	})
+
+	// Confirm the payment to the customer once it has committed (non-blocking)
+	if err == nil && !duplicate && bs.smsService != nil {
+		confirmed := *payment
+		go bs.sendPaymentConfirmation(&confirmed)
+	}
+
+	return duplicate, err
+}
+
+// sendPaymentConfirmation texts the customer a receipt for a recorded payment with their new balance
+func (bs *BillingService) sendPaymentConfirmation(payment *models.Payment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var customer models.Customer
+	if err := bs.customersCollection.FindOne(ctx, bson.M{"_id": payment.CustomerID}).Decode(&customer); err != nil {
+		log.Printf("⚠️ Cannot send payment confirmation for receipt %s: customer not found: %v", payment.ReceiptNumber, err)
+		return
+	}
+
+	if customer.PhoneNumber == "" {
+		log.Printf("⚠️ Cannot send payment confirmation: customer %s has no phone number", customer.MeterNumber)
+		return
+	}
+
+	if _, err := bs.smsService.SendPaymentConfirmation(payment, &customer); errors.Is(err, ErrSMSOptedOut) {
+		return
+	} else if err != nil {
+		log.Printf("❌ Failed to send payment confirmation to %s: %v", customer.PhoneNumber, err)
+		return
+	}
+
+	log.Printf("✅ Payment confirmation sent to %s for receipt %s", customer.PhoneNumber, payment.ReceiptNumber)
+}
+
+// stampPayment fills in the fields the server owns on a new payment: its ID, creation time and
+// status and, unless the caller gave them, the payment date and receipt number. RecordPayment does
+// this on the caller's payment, so handlers can return it as the receipt. A new payment is always
+// completed; only ReversePayment moves it on.
+func stampPayment(payment *models.Payment, now time.Time) {
+	payment.ID = primitive.NewObjectID()
+	payment.CreatedAt = now
+	payment.Status = "completed"
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = now
+	}
+	if payment.ReceiptNumber == "" {
+		payment.ReceiptNumber = utils.GenerateReceiptNumber()
+	}
+}
+
+// applyBillPayment applies amount to a bill and takes it off the customer balance inside the
+// caller's transaction. It returns the updated bill and the part of amount the bill could not
+// take, which is left as credit on the customer balance. Cancelled and disputed bills take no
+// payments.
+func (bs *BillingService) applyBillPayment(sc mongo.SessionContext, billID primitive.ObjectID,
+	amount float64, method, txnID string) (*models.Bill, float64, error) {
+
+	var bill models.Bill
+	err := bs.billsCollection.FindOne(sc, bson.M{"_id": billID}).Decode(&bill)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bill not found: %v", err)
+	}
+
+	if amount <= 0 {
+		return nil, 0, errors.New("payment amount must be greater than 0")
+	}
+
+	if bill.Status == "cancelled" || bill.Status == "disputed" {
+		return nil, 0, fmt.Errorf("bill %s is %s and cannot take payments", bill.BillNumber, bill.Status)
+	}
+
+	// Apply what the bill can take; the rest becomes customer credit
+	_, excess := bill.ApplyPayment(amount, method, txnID)
+	bill.UpdatedAt = time.Now()
+
+	_, err = bs.billsCollection.ReplaceOne(sc, bson.M{"_id": bill.ID}, bill)
 	if err != nil {
-		fmt.Printf("Warning: Failed to update customer balance for meter %s: %v\n", bill.MeterNumber, err)
-		// Don't fail the payment if customer update fails, just log it
+		return nil, 0, fmt.Errorf("failed to update bill: %v", err)
 	}
 
+	// Take the full payment, including any credit, off the customer balance
+	if err := bs.updateCustomerBalance(sc, bill.CustomerID, amount); err != nil {
+		return nil, 0, err
+	}
+
+	return &bill, excess, nil
+}
+
+// BulkPaymentResult describes how a lump-sum payment was spread across bills
+type BulkPaymentResult struct {
+	Payment       *models.Payment `json:"payment"`
+	Bills         []models.Bill   `json:"bills"`
+	AmountApplied float64         `json:"amount_applied"`
+	Credit        float64         `json:"credit"`    // Left over after all bills were cleared; held on the customer balance
+	Duplicate     bool            `json:"duplicate"` // The transaction ID was already recorded; Payment is the original
+}
+
+// ProcessBulkPayment applies a lump-sum payment to a meter's unpaid bills, oldest first, in one
+// transaction. A single payment record carries the per-bill allocations; anything left over
+// is kept as credit on the customer balance, so the payment is recorded even when nothing is owed.
+// The customer is sent a payment confirmation once it has committed.
+// payment gives the amount, method, transaction ID and payer details; the rest is filled in here.
+// A transaction ID that is already recorded writes nothing and returns the original payment with
+// Duplicate set, so retried submissions are safe.
+func (bs *BillingService) ProcessBulkPayment(ctx context.Context, meterNumber string, payment *models.Payment) (*BulkPaymentResult, error) {
+	amount, method, txnID := payment.Amount, payment.PaymentMethod, payment.TransactionID
+	if amount <= 0 {
+		return nil, errors.New("payment amount must be greater than 0")
+	}
+
+	customer, err := bs.GetCustomerByMeterNumber(ctx, meterNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := bs.paymentsCollection.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	result := &BulkPaymentResult{}
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. Return the existing payment for a transaction ID we have already seen
+		if txnID != "" {
+			var existing models.Payment
+			err := bs.paymentsCollection.FindOne(sc, bson.M{"transaction_id": txnID}).Decode(&existing)
+			if err == nil {
+				session.AbortTransaction(sc)
+				result.Payment = &existing
+				result.Duplicate = true
+				return nil
+			}
+			if err != mongo.ErrNoDocuments {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("error checking transaction ID: %v", err)
+			}
+		}
+
+		// 2. Unpaid bills, oldest first
+		opts := options.Find().SetSort(bson.D{{Key: "due_date", Value: 1}, {Key: "bill_date", Value: 1}})
+		cursor, err := bs.billsCollection.Find(sc, bson.M{
+			"meter_number": meterNumber,
+			"status":       bson.M{"$in": []string{"pending", "partially_paid", "overdue"}},
+			"balance":      bson.M{"$gt": 0},
+		}, opts)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("error fetching unpaid bills: %v", err)
+		}
+
+		var bills []models.Bill
+		if err = cursor.All(sc, &bills); err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("error decoding unpaid bills: %v", err)
+		}
+
+		// 3. Allocate the amount across them
+		remaining := amount
+		var allocations []models.PaymentAllocation
+		for i := range bills {
+			if remaining <= 0 {
+				break
+			}
+
+			bill := &bills[i]
+			applied, excess := bill.ApplyPayment(remaining, method, txnID)
+			if _, err = bs.billsCollection.ReplaceOne(sc, bson.M{"_id": bill.ID}, bill); err != nil {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("failed to update bill: %v", err)
+			}
+
+			allocations = append(allocations, models.PaymentAllocation{
+				BillID:     bill.ID,
+				BillNumber: bill.BillNumber,
+				Amount:     applied,
+			})
+			result.Bills = append(result.Bills, *bill)
+			result.AmountApplied += applied
+			remaining = excess
+		}
+
+		// 4. One payment record with the breakdown
+		stampPayment(payment, time.Now())
+		payment.MeterNumber = meterNumber
+		payment.CustomerID = customer.ID
+		payment.CustomerName = customer.FullName()
+		payment.Allocations = allocations
+		if len(allocations) > 0 {
+			payment.BillID = allocations[0].BillID
+		}
+		if remaining > 0 {
+			payment.CreditAmount = remaining
+			if payment.Notes == "" {
+				payment.Notes = fmt.Sprintf("KSh %.2f held as credit", remaining)
+			}
+		}
+
+		if _, err = bs.paymentsCollection.InsertOne(sc, payment); err != nil {
+			session.AbortTransaction(sc)
+			if field, ok := utils.IsDuplicateKeyError(err); ok {
+				return duplicatePaymentError(field, txnID)
+			}
+			return fmt.Errorf("failed to save payment: %v", err)
+		}
+
+		// 5. The whole amount comes off what the customer owes; any excess leaves them in credit
+		if err = bs.updateCustomerBalance(sc, customer.ID, amount); err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		if err := session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		result.Payment = payment
+		result.AmountApplied = utils.RoundToTwoDecimal(result.AmountApplied)
+		result.Credit = remaining
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Confirm the whole amount received, as RecordPayment does (non-blocking)
+	if bs.smsService != nil && !result.Duplicate {
+		confirmed := *result.Payment
+		go bs.sendPaymentConfirmation(&confirmed)
+	}
+
+	return result, nil
+}
+
+// ReversePayment refunds a completed payment: the payment is marked refunded, the amount is
+// taken off the bill and the customer owes it again and no longer counts it as paid.
+// reversedBy is the acting user's ID.
+func (bs *BillingService) ReversePayment(ctx context.Context, paymentID primitive.ObjectID, reason, reversedBy string) error {
+	session, err := bs.paymentsCollection.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err = session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. Get the payment
+		var payment models.Payment
+		err := bs.paymentsCollection.FindOne(sc, bson.M{"_id": paymentID}).Decode(&payment)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("payment not found")
+			}
+			return fmt.Errorf("error fetching payment: %v", err)
+		}
+
+		if payment.Status == "refunded" {
+			session.AbortTransaction(sc)
+			return errors.New("payment already refunded")
+		}
+
+		// 2. Mark the payment refunded
+		now := time.Now()
+		_, err = bs.paymentsCollection.UpdateByID(sc, payment.ID, bson.M{
+			"$set": bson.M{
+				"status":          "refunded",
+				"reversal_reason": reason,
+				"reversed_by":     reversedBy,
+				"reversed_at":     now,
+			},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update payment: %v", err)
+		}
+
+		// 3. Take the amount off each bill it paid and recompute their status.
+		// Lump-sum payments carry allocations; single-bill payments applied everything but their
+		// overpayment credit to BillID.
+		allocations := payment.Allocations
+		if len(allocations) == 0 && !payment.BillID.IsZero() {
+			applied := utils.RoundToTwoDecimal(payment.Amount - payment.CreditAmount)
+			allocations = []models.PaymentAllocation{{BillID: payment.BillID, Amount: applied}}
+		}
+
+		for _, allocation := range allocations {
+			var bill models.Bill
+			err = bs.billsCollection.FindOne(sc, bson.M{"_id": allocation.BillID}).Decode(&bill)
+			if err != nil {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("bill not found: %v", err)
+			}
+
+			bill.AmountPaid = utils.RoundToTwoDecimal(bill.AmountPaid - allocation.Amount)
+			if bill.AmountPaid < 0 {
+				bill.AmountPaid = 0
+			}
+			bill.Balance = utils.RoundToTwoDecimal(bill.TotalAmount - bill.AmountPaid)
+
+			status := billStatus(&bill, now)
+			billUpdate := bson.M{"$set": bson.M{
+				"amount_paid": bill.AmountPaid,
+				"balance":     bill.Balance,
+				"status":      status,
+				"updated_at":  now,
+			}}
+
+			if status != "paid" {
+				billUpdate["$unset"] = bson.M{"payment_date": "", "payment_method": "", "transaction_id": ""}
+			}
+
+			if _, err = bs.billsCollection.UpdateByID(sc, bill.ID, billUpdate); err != nil {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("failed to update bill: %v", err)
+			}
+		}
+
+		// 4. The customer owes the reversed amount again
+		_, err = bs.customersCollection.UpdateByID(sc, payment.CustomerID, bson.M{
+			"$inc": bson.M{"balance": payment.Amount, "total_paid": -payment.Amount},
+			"$set": bson.M{"updated_at": now},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update customer balance: %v", err)
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// AdjustBill applies a manual adjustment to a bill. A positive adjustment is a credit recorded as a
+// discount; a negative one is an extra charge recorded under other charges. The customer balance
+// moves by the same amount and the adjustment is appended to the bill's audit trail.
+func (bs *BillingService) AdjustBill(ctx context.Context, billID primitive.ObjectID, adjustment float64, reason string, actingUser string) (*models.Bill, error) {
+	if adjustment == 0 {
+		return nil, errors.New("adjustment amount cannot be zero")
+	}
+	if reason == "" {
+		return nil, errors.New("adjustment reason is required")
+	}
+
+	session, err := bs.billsCollection.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	var resultBill models.Bill
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err = session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. Get the bill
+		var bill models.Bill
+		err := bs.billsCollection.FindOne(sc, bson.M{"_id": billID}).Decode(&bill)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("bill not found")
+			}
+			return fmt.Errorf("error fetching bill: %v", err)
+		}
+
+		if bill.Status == "cancelled" {
+			session.AbortTransaction(sc)
+			return errors.New("cannot adjust a cancelled bill")
+		}
+
+		// A credit can only take off what is still owed; more would leave the bill with a negative balance
+		if adjustment > bill.Balance {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("credit of %.2f exceeds bill balance of %.2f", adjustment, bill.Balance)
+		}
+
+		// 2. Apply the adjustment
+		now := time.Now()
+		if adjustment > 0 {
+			bill.Discount = utils.RoundToTwoDecimal(bill.Discount + adjustment)
+		} else {
+			bill.OtherCharges = utils.RoundToTwoDecimal(bill.OtherCharges - adjustment)
+		}
+		bill.TotalAmount = utils.RoundToTwoDecimal(bill.TotalAmount - adjustment)
+		bill.Balance = utils.RoundToTwoDecimal(bill.TotalAmount - bill.AmountPaid)
+		bill.Status = billStatus(&bill, now)
+		bill.Adjustments = append(bill.Adjustments, models.BillAdjustment{
+			Amount:     adjustment,
+			Reason:     reason,
+			AdjustedBy: actingUser,
+			AdjustedAt: now,
+		})
+		bill.UpdatedAt = now
+
+		if _, err = bs.billsCollection.ReplaceOne(sc, bson.M{"_id": bill.ID}, bill); err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update bill: %v", err)
+		}
+
+		// 3. Move the customer balance by the same amount
+		_, err = bs.customersCollection.UpdateByID(sc, bill.CustomerID, bson.M{
+			"$inc": bson.M{"balance": -adjustment},
+			"$set": bson.M{"updated_at": now},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update customer balance: %v", err)
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		resultBill = bill
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &resultBill, nil
+}
+
+// CancelBill voids an unpaid bill. Its outstanding amount comes off the customer balance, the
+// balance on the bill is zeroed and the bill number is released for reuse.
+// Bills with payments against them must be reversed or adjusted instead.
+func (bs *BillingService) CancelBill(ctx context.Context, billID primitive.ObjectID, reason, actingUser string) (*models.Bill, error) {
+	if reason == "" {
+		return nil, errors.New("cancellation reason is required")
+	}
+
+	session, err := bs.billsCollection.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	var resultBill models.Bill
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err = session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. Get the bill
+		var bill models.Bill
+		err := bs.billsCollection.FindOne(sc, bson.M{"_id": billID}).Decode(&bill)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("bill not found")
+			}
+			return fmt.Errorf("error fetching bill: %v", err)
+		}
+
+		if bill.Status == "cancelled" {
+			session.AbortTransaction(sc)
+			return errors.New("bill is already cancelled")
+		}
+
+		// 2. Void the bill
+		now := time.Now()
+		outstanding := bill.Balance
+		if err = bs.voidBill(sc, &bill, reason, actingUser, now); err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		// 3. The customer no longer owes what was outstanding on it
+		_, err = bs.customersCollection.UpdateByID(sc, bill.CustomerID, bson.M{
+			"$inc": bson.M{"balance": -outstanding},
+			"$set": bson.M{"updated_at": now},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update customer balance: %v", err)
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		resultBill = bill
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &resultBill, nil
+}
+
+// voidBill cancels bill inside the caller's transaction: the balance on it is zeroed and the bill
+// number is released for reuse. reason and actingUser, when given, are recorded as the
+// cancellation. Bills with payments against them are refused. Taking the outstanding amount off
+// the customer is left to the caller.
+func (bs *BillingService) voidBill(sc mongo.SessionContext, bill *models.Bill, reason, actingUser string, now time.Time) error {
+	if bill.AmountPaid > 0 {
+		return fmt.Errorf("bill %s has payments against it; reverse the payments or adjust the bill instead", bill.BillNumber)
+	}
+
+	bill.Status = "cancelled"
+	bill.BillNumber = bill.BillNumber + "-VOID-" + bill.ID.Hex()[18:]
+	bill.Balance = 0
+	if reason != "" {
+		bill.CancellationReason = reason
+		bill.CancelledBy = actingUser
+		bill.CancelledAt = &now
+	}
+	bill.UpdatedAt = now
+
+	if _, err := bs.billsCollection.ReplaceOne(sc, bson.M{"_id": bill.ID}, bill); err != nil {
+		return fmt.Errorf("failed to update bill: %v", err)
+	}
 	return nil
 }
 
-// updateCustomerBalance updates customer's balance after payment
+// DisputeReading marks a reading and its bill as disputed. Disputed bills are left out of penalty runs.
+func (bs *BillingService) DisputeReading(ctx context.Context, readingID primitive.ObjectID, reason, actingUser string) error {
+	session, err := bs.readingsCollection.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		var reading models.MeterReading
+		err := bs.readingsCollection.FindOne(sc, bson.M{"_id": readingID}).Decode(&reading)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("reading not found")
+			}
+			return fmt.Errorf("error fetching reading: %v", err)
+		}
+
+		if reading.Status == "disputed" || reading.Status == "cancelled" {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("reading is already %s", reading.Status)
+		}
+
+		now := time.Now()
+		_, err = bs.readingsCollection.UpdateByID(sc, readingID, bson.M{
+			"$set": bson.M{
+				"status":         "disputed",
+				"dispute_reason": reason,
+				"disputed_by":    actingUser,
+				"disputed_at":    now,
+				"updated_at":     now,
+			},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update reading: %v", err)
+		}
+
+		_, err = bs.billsCollection.UpdateOne(sc,
+			bson.M{"reading_id": readingID, "status": bson.M{"$ne": "cancelled"}},
+			bson.M{"$set": bson.M{"status": "disputed", "updated_at": now}},
+		)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update bill: %v", err)
+		}
+
+		if err := session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+		return nil
+	})
+}
+
+// ResolveDispute closes a dispute. The reading either stands, returning to "recorded" with its
+// bill status recomputed, or is cancelled along with its bill as voidReadingBill does: the bill
+// is voided, its balance taken off the customer and their reading history rolled back, and the
+// month can then be read again. A bill with payments cannot be cancelled this way.
+func (bs *BillingService) ResolveDispute(ctx context.Context, readingID primitive.ObjectID, resolution string, cancelBill bool, actingUser string) error {
+	session, err := bs.readingsCollection.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		var reading models.MeterReading
+		err := bs.readingsCollection.FindOne(sc, bson.M{"_id": readingID}).Decode(&reading)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("reading not found")
+			}
+			return fmt.Errorf("error fetching reading: %v", err)
+		}
+
+		if reading.Status != "disputed" {
+			session.AbortTransaction(sc)
+			return errors.New("reading is not disputed")
+		}
+
+		now := time.Now()
+		readingStatus := "recorded"
+		if cancelBill {
+			readingStatus = "cancelled"
+			if err = bs.voidReadingBill(sc, &reading, "cancelling", "Dispute upheld: "+resolution, actingUser); err != nil {
+				session.AbortTransaction(sc)
+				return err
+			}
+		}
+
+		_, err = bs.readingsCollection.UpdateByID(sc, readingID, bson.M{
+			"$set": bson.M{
+				"status":      readingStatus,
+				"resolution":  resolution,
+				"resolved_by": actingUser,
+				"resolved_at": now,
+				"updated_at":  now,
+			},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update reading: %v", err)
+		}
+
+		if !cancelBill {
+			var bill models.Bill
+			err = bs.billsCollection.FindOne(sc, bson.M{
+				"reading_id": readingID,
+				"status":     bson.M{"$ne": "cancelled"},
+			}).Decode(&bill)
+			if err != nil && err != mongo.ErrNoDocuments {
+				session.AbortTransaction(sc)
+				return fmt.Errorf("error fetching bill: %v", err)
+			}
+			if err == nil {
+				_, err = bs.billsCollection.UpdateByID(sc, bill.ID, bson.M{
+					"$set": bson.M{"status": billStatus(&bill, now), "updated_at": now},
+				})
+				if err != nil {
+					session.AbortTransaction(sc)
+					return fmt.Errorf("failed to update bill: %v", err)
+				}
+			}
+		}
+
+		if err := session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+		return nil
+	})
+}
+
+// billStatus works out a bill's status from what has been paid against it
+func billStatus(bill *models.Bill, now time.Time) string {
+	switch {
+	case bill.Balance <= 0:
+		return "paid"
+	case bill.AmountPaid > 0:
+		return "partially_paid"
+	case bill.DueDate.Before(now):
+		return "overdue"
+	default:
+		return "pending"
+	}
+}
+
+// updateCustomerBalance updates customer's balance after payment.
+// Bills add to the balance, so a payment always reduces it; paying more than is owed
+// takes the balance below zero, which is credit against future bills.
 func (bs *BillingService) updateCustomerBalance(sc mongo.SessionContext,
 	customerID primitive.ObjectID, paymentAmount float64) error {
 
@@ -547,18 +1769,7 @@ func (bs *BillingService) updateCustomerBalance(sc mongo.SessionContext,
 		return fmt.Errorf("customer not found: %v", err)
 	}
 
-	// ✅ FIXED: Calculate new balance based on credit/debt status
-	var newBalance float64
-
-	if customer.Balance < 0 {
-		// Customer has CREDIT - using credit increases balance (toward zero)
-		newBalance = customer.Balance + paymentAmount
-	} else {
-		// Customer has DEBT - paying reduces balance
-		newBalance = customer.Balance - paymentAmount
-	}
-
-	newBalance = utils.RoundToTwoDecimal(newBalance)
+	newBalance := utils.RoundToTwoDecimal(customer.Balance - paymentAmount)
 
 	update := bson.M{
 		"$set": bson.M{
@@ -579,8 +1790,8 @@ func (bs *BillingService) updateCustomerBalance(sc mongo.SessionContext,
 }
 
 // GetCustomerBills retrieves all bills for a customer by meter number
-func (bs *BillingService) GetCustomerBills(meterNumber string, status string, limit int64) ([]models.Bill, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (bs *BillingService) GetCustomerBills(ctx context.Context, meterNumber string, status string, limit int64) ([]models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{"meter_number": meterNumber}
@@ -595,92 +1806,269 @@ func (bs *BillingService) GetCustomerBills(meterNumber string, status string, li
 
 	cursor, err := bs.billsCollection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching bills: %v", err)
+		return nil, fmt.Errorf("error fetching bills: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bills []models.Bill
+	if err = cursor.All(ctx, &bills); err != nil {
+		return nil, fmt.Errorf("error decoding bills: %v", err)
+	}
+
+	return bills, nil
+}
+
+// GetCustomerReadingHistory gets reading history for a customer
+func (bs *BillingService) GetCustomerReadingHistory(ctx context.Context, meterNumber string, limit int64) ([]models.MeterReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"reading_date": -1})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := bs.readingsCollection.Find(ctx, bson.M{"meter_number": meterNumber}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reading history: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var readings []models.MeterReading
+	if err = cursor.All(ctx, &readings); err != nil {
+		return nil, fmt.Errorf("error decoding readings: %v", err)
+	}
+
+	return readings, nil
+}
+
+// MarkOverdueBills moves pending bills past their due date with a balance left to "overdue"
+// and returns how many were updated. Partially paid bills keep their status, as in billStatus.
+func (bs *BillingService) MarkOverdueBills(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	result, err := bs.billsCollection.UpdateMany(ctx, bson.M{
+		"status":   "pending",
+		"due_date": bson.M{"$lt": now},
+		"balance":  bson.M{"$gt": 0},
+	}, bson.M{"$set": bson.M{
+		"status":     "overdue",
+		"updated_at": now,
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("error marking overdue bills: %v", err)
+	}
+
+	return int(result.ModifiedCount), nil
+}
+
+// GetOverdueBills returns all bills with overdue status, most overdue first.
+// Statuses are kept current by MarkOverdueBills.
+func (bs *BillingService) GetOverdueBills(ctx context.Context) ([]models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status": "overdue",
+	}
+
+	cursor, err := bs.billsCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"due_date": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching overdue bills: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bills []models.Bill
+	if err = cursor.All(ctx, &bills); err != nil {
+		return nil, fmt.Errorf("error decoding overdue bills: %v", err)
+	}
+
+	return bills, nil
+}
+
+// ApplyLatePenalties marks bills overdue and charges a penalty on every overdue bill.
+// A bill is penalized at most once per calendar month, tracked via penalty_applied_at.
+func (bs *BillingService) ApplyLatePenalties(ctx context.Context, penaltyRate float64) (*PenaltyRunResult, error) {
+	if penaltyRate <= 0 || penaltyRate > 1 {
+		return nil, errors.New("penalty rate must be between 0 and 1")
+	}
+
+	// Penalties go on overdue bills, so bring statuses up to date first
+	if _, err := bs.MarkOverdueBills(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	filter := bson.M{
+		"status":  "overdue",
+		"balance": bson.M{"$gt": 0},
+		"$or": []bson.M{
+			{"penalty_applied_at": bson.M{"$exists": false}},
+			{"penalty_applied_at": bson.M{"$lt": startOfMonth}},
+		},
+	}
+
+	cursor, err := bs.billsCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bills for penalties: %v", err)
 	}
 	defer cursor.Close(ctx)
 
 	var bills []models.Bill
 	if err = cursor.All(ctx, &bills); err != nil {
-		return nil, fmt.Errorf("error decoding bills: %v", err)
+		return nil, fmt.Errorf("error decoding bills for penalties: %v", err)
 	}
 
-	return bills, nil
-}
+	result := &PenaltyRunResult{PenaltyRate: penaltyRate}
 
-// GetCustomerReadingHistory gets reading history for a customer
-func (bs *BillingService) GetCustomerReadingHistory(meterNumber string, limit int64) ([]models.MeterReading, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	for _, bill := range bills {
+		penalty := utils.RoundToTwoDecimal(bill.Balance * penaltyRate)
+		if penalty <= 0 {
+			continue
+		}
 
-	opts := options.Find().SetSort(bson.M{"reading_date": -1})
-	if limit > 0 {
-		opts.SetLimit(limit)
+		// A failed bill is left unpenalized, so the next run picks it up again
+		if err := bs.applyBillPenalty(ctx, &bill, penalty, startOfMonth, now); err != nil {
+			utils.Logf(ctx, "⚠️ Failed to apply penalty to bill %s: %v", bill.BillNumber, err)
+			result.Failed++
+			continue
+		}
+
+		result.BillsPenalized++
+		result.TotalPenalty += penalty
 	}
 
-	cursor, err := bs.readingsCollection.Find(ctx, bson.M{"meter_number": meterNumber}, opts)
+	result.TotalPenalty = utils.RoundToTwoDecimal(result.TotalPenalty)
+	return result, nil
+}
+
+// applyBillPenalty adds penalty to a bill and to its customer's balance in one transaction.
+// The bill is only charged if it has not been penalized since startOfMonth, so a bill penalized
+// by a concurrent run is left alone.
+func (bs *BillingService) applyBillPenalty(ctx context.Context, bill *models.Bill, penalty float64, startOfMonth, now time.Time) error {
+	session, err := bs.billsCollection.StartSession()
 	if err != nil {
-		return nil, fmt.Errorf("error fetching reading history: %v", err)
+		return fmt.Errorf("failed to start session: %v", err)
 	}
-	defer cursor.Close(ctx)
+	defer session.EndSession(context.Background())
 
-	var readings []models.MeterReading
-	if err = cursor.All(ctx, &readings); err != nil {
-		return nil, fmt.Errorf("error decoding readings: %v", err)
-	}
+	return mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
 
-	return readings, nil
+		filter := bson.M{
+			"_id": bill.ID,
+			"$or": []bson.M{
+				{"penalty_applied_at": bson.M{"$exists": false}},
+				{"penalty_applied_at": bson.M{"$lt": startOfMonth}},
+			},
+		}
+		update := bson.M{
+			"$inc": bson.M{
+				"penalty":      penalty,
+				"total_amount": penalty,
+				"balance":      penalty,
+			},
+			"$set": bson.M{
+				"status":             "overdue",
+				"penalty_applied_at": now,
+				"updated_at":         now,
+			},
+		}
+
+		res, err := bs.billsCollection.UpdateOne(sc, filter, update)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update bill: %v", err)
+		}
+		if res.MatchedCount == 0 {
+			session.AbortTransaction(sc)
+			return errors.New("bill already penalized this month")
+		}
+
+		// The penalty is owed by the customer, so it also goes onto their balance
+		_, err = bs.customersCollection.UpdateByID(sc, bill.CustomerID, bson.M{
+			"$inc": bson.M{"balance": penalty},
+			"$set": bson.M{"updated_at": now},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update customer balance: %v", err)
+		}
+
+		if err := session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+
+		return nil
+	})
 }
 
-// GetOverdueBills returns all overdue bills
-func (bs *BillingService) GetOverdueBills() ([]models.Bill, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetUnpaidBills returns all unpaid bills (pending and overdue)
+func (bs *BillingService) GetUnpaidBills(ctx context.Context) ([]models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{
-		"status":   "pending",
-		"due_date": bson.M{"$lt": time.Now()},
+		"status": bson.M{"$in": []string{"pending", "overdue"}},
 	}
 
 	cursor, err := bs.billsCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"due_date": 1}))
 	if err != nil {
-		return nil, fmt.Errorf("error fetching overdue bills: %v", err)
+		return nil, fmt.Errorf("error fetching unpaid bills: %v", err)
 	}
 	defer cursor.Close(ctx)
 
 	var bills []models.Bill
 	if err = cursor.All(ctx, &bills); err != nil {
-		return nil, fmt.Errorf("error decoding overdue bills: %v", err)
+		return nil, fmt.Errorf("error decoding unpaid bills: %v", err)
 	}
 
 	return bills, nil
 }
 
-// GetUnpaidBills returns all unpaid bills (pending and overdue)
-func (bs *BillingService) GetUnpaidBills() ([]models.Bill, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// ListBillsByDueDate returns a page of the bills matching filter, oldest due date first, with
+// the total number that match
+func (bs *BillingService) ListBillsByDueDate(ctx context.Context, filter bson.M, page, limit int) ([]models.Bill, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{
-		"status": bson.M{"$in": []string{"pending", "overdue"}},
+	total, err := bs.billsCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting bills: %v", err)
 	}
 
-	cursor, err := bs.billsCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"due_date": 1}))
+	opts := options.Find().
+		SetSort(bson.D{{Key: "due_date", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip(int64((page - 1) * limit)).
+		SetLimit(int64(limit))
+
+	cursor, err := bs.billsCollection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching unpaid bills: %v", err)
+		return nil, 0, fmt.Errorf("error fetching bills: %v", err)
 	}
 	defer cursor.Close(ctx)
 
 	var bills []models.Bill
 	if err = cursor.All(ctx, &bills); err != nil {
-		return nil, fmt.Errorf("error decoding unpaid bills: %v", err)
+		return nil, 0, fmt.Errorf("error decoding bills: %v", err)
 	}
 
-	return bills, nil
+	return bills, total, nil
 }
 
-// GetReadingsByReader retrieves readings for a specific reader ID
-func (s *BillingService) GetReadingsByReader(readerID string, page, limit int) ([]models.MeterReading, int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetReadingsByReader retrieves readings for a specific reader ID, newest first.
+// A non-zero from or to limits reading_date to from <= date < to.
+func (s *BillingService) GetReadingsByReader(ctx context.Context, readerID string, from, to time.Time, page, limit int) ([]models.MeterReading, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(readerID)
@@ -689,6 +2077,17 @@ func (s *BillingService) GetReadingsByReader(readerID string, page, limit int) (
 	}
 
 	filter := bson.M{"reader_id": objectID}
+	dateRange := bson.M{}
+	if !from.IsZero() {
+		dateRange["$gte"] = from
+	}
+	if !to.IsZero() {
+		dateRange["$lt"] = to
+	}
+	if len(dateRange) > 0 {
+		filter["reading_date"] = dateRange
+	}
+
 	skip := (page - 1) * limit
 
 	opts := options.Find().
@@ -698,26 +2097,105 @@ func (s *BillingService) GetReadingsByReader(readerID string, page, limit int) (
 
 	cursor, err := s.readingsCollection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("error fetching readings: %v", err)
 	}
 	defer cursor.Close(ctx)
 
 	var readings []models.MeterReading
 	if err = cursor.All(ctx, &readings); err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("error decoding readings: %v", err)
 	}
 
 	total, err := s.readingsCollection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, fmt.Errorf("error counting readings: %v", err)
 	}
 
 	return readings, total, nil
 }
 
+// WorklistEntry is a meter a reader still has to read this billing period
+type WorklistEntry struct {
+	MeterNumber     string         `json:"meter_number"`
+	AccountNumber   string         `json:"account_number"`
+	CustomerName    string         `json:"customer_name"`
+	PhoneNumber     string         `json:"phone_number"`
+	Address         models.Address `json:"address"`
+	Subzone         string         `json:"subzone,omitempty"`
+	MeterLocation   string         `json:"meter_location,omitempty"`
+	LastReading     float64        `json:"last_reading"`
+	LastReadingDate *time.Time     `json:"last_reading_date,omitempty"`
+}
+
+// GetReaderWorklist returns the active customers in a zone with no actual reading yet for the
+// billing period containing at, sorted by meter number. Estimated and cancelled readings
+// do not count, so those meters stay on the list.
+func (bs *BillingService) GetReaderWorklist(ctx context.Context, zone string, at time.Time) ([]WorklistEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"meter_number": 1})
+	cursor, err := bs.customersCollection.Find(ctx, bson.M{"zone": zone, "status": "active"}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching customers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var customers []models.Customer
+	if err = cursor.All(ctx, &customers); err != nil {
+		return nil, fmt.Errorf("error decoding customers: %v", err)
+	}
+
+	worklist := []WorklistEntry{}
+	if len(customers) == 0 {
+		return worklist, nil
+	}
+
+	meters := make([]string, len(customers))
+	for i, customer := range customers {
+		meters[i] = customer.MeterNumber
+	}
+
+	readMeters, err := bs.readingsCollection.Distinct(ctx, "meter_number", bson.M{
+		"meter_number": bson.M{"$in": meters},
+		"month":        at.Format("2006-01"),
+		"reading_type": bson.M{"$ne": "estimated"},
+		"status":       bson.M{"$ne": "cancelled"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching readings for period: %v", err)
+	}
+
+	read := make(map[string]bool, len(readMeters))
+	for _, meter := range readMeters {
+		if m, ok := meter.(string); ok {
+			read[m] = true
+		}
+	}
+
+	for _, customer := range customers {
+		if read[customer.MeterNumber] {
+			continue
+		}
+		worklist = append(worklist, WorklistEntry{
+			MeterNumber:     customer.MeterNumber,
+			AccountNumber:   customer.AccountNumber,
+			CustomerName:    customer.FullName(),
+			PhoneNumber:     customer.PhoneNumber,
+			Address:         customer.Address,
+			Subzone:         customer.Subzone,
+			MeterLocation:   customer.MeterLocation,
+			LastReading:     customer.LastReading,
+			LastReadingDate: customer.LastReadingDate,
+		})
+	}
+
+	return worklist, nil
+}
+
 // GetBillingSummary returns billing summary for a period
-func (bs *BillingService) GetBillingSummary(startDate, endDate time.Time) (*BillingSummary, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (bs *BillingService) GetBillingSummary(ctx context.Context, startDate, endDate time.Time) (*BillingSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Match bills within date range
@@ -784,9 +2262,191 @@ func (bs *BillingService) GetBillingSummary(startDate, endDate time.Time) (*Bill
 	return summary, nil
 }
 
+// GetReaderPerformance aggregates meter readings per reader for a period.
+// An optional zone restricts the report to readers assigned to that zone.
+func (bs *BillingService) GetReaderPerformance(ctx context.Context, startDate, endDate time.Time, zone string) ([]ReaderPerformance, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "reading_date", Value: bson.D{
+				{Key: "$gte", Value: startDate},
+				{Key: "$lte", Value: endDate},
+			}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$reader_id"},
+			{Key: "reader_name", Value: bson.D{{Key: "$first", Value: "$reader_name"}}},
+			{Key: "readings_submitted", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "meters", Value: bson.D{{Key: "$addToSet", Value: "$meter_number"}}},
+			{Key: "average_consumption", Value: bson.D{{Key: "$avg", Value: "$consumption"}}},
+			{Key: "estimated_readings", Value: bson.D{{Key: "$sum", Value: bson.D{
+				{Key: "$cond", Value: bson.A{bson.D{{Key: "$eq", Value: bson.A{"$reading_type", "estimated"}}}, 1, 0}},
+			}}}},
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "users"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "reader"},
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "zone", Value: bson.D{{Key: "$ifNull", Value: bson.A{
+				bson.D{{Key: "$arrayElemAt", Value: bson.A{"$reader.assigned_zone", 0}}}, "",
+			}}}},
+			{Key: "meters_covered", Value: bson.D{{Key: "$size", Value: "$meters"}}},
+		}}},
+	}
+
+	if zone != "" {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "zone", Value: zone}}}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "reader", Value: 0},
+			{Key: "meters", Value: 0},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "readings_submitted", Value: -1}}}},
+	)
+
+	cursor, err := bs.readingsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating reader performance: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var performance []ReaderPerformance
+	if err = cursor.All(ctx, &performance); err != nil {
+		return nil, fmt.Errorf("error decoding reader performance: %v", err)
+	}
+
+	for i := range performance {
+		performance[i].ActualReadings = performance[i].ReadingsSubmitted - performance[i].EstimatedReadings
+		performance[i].AverageConsumption = utils.RoundToTwoDecimal(performance[i].AverageConsumption)
+	}
+
+	return performance, nil
+}
+
+// GetDisconnectionCandidates lists active customers whose oldest unpaid bill has been overdue
+// for more than graceDays and whose total outstanding exceeds minBalance, largest debt first
+func (bs *BillingService) GetDisconnectionCandidates(ctx context.Context, graceDays int, minBalance float64) ([]DisconnectionCandidate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cutoff := time.Now().AddDate(0, 0, -graceDays)
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{"pending", "partially_paid", "overdue"}}}},
+			{Key: "balance", Value: bson.D{{Key: "$gt", Value: 0}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$customer_id"},
+			{Key: "total_outstanding", Value: bson.D{{Key: "$sum", Value: "$balance"}}},
+			{Key: "oldest_due_date", Value: bson.D{{Key: "$min", Value: "$due_date"}}},
+			{Key: "unpaid_bills", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "oldest_due_date", Value: bson.D{{Key: "$lt", Value: cutoff}}},
+			{Key: "total_outstanding", Value: bson.D{{Key: "$gt", Value: minBalance}}},
+		}}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "customers"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "customer"},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$customer"}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "customer.status", Value: "active"}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "total_outstanding", Value: -1}}}},
+	}
+
+	cursor, err := bs.billsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating disconnection candidates: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []DisconnectionCandidate
+	if err = cursor.All(ctx, &candidates); err != nil {
+		return nil, fmt.Errorf("error decoding disconnection candidates: %v", err)
+	}
+
+	for i := range candidates {
+		candidates[i].TotalOutstanding = utils.RoundToTwoDecimal(candidates[i].TotalOutstanding)
+		candidates[i].DaysOverdue = int(time.Since(candidates[i].OldestDueDate).Hours() / 24)
+	}
+
+	return candidates, nil
+}
+
+// GetTopDebtors lists the limit meters with the largest outstanding bill balances, largest first,
+// with how many of their bills are overdue and how old the oldest unpaid one is
+func (bs *BillingService) GetTopDebtors(ctx context.Context, limit int) ([]DebtorSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{"pending", "partially_paid", "overdue"}}}},
+			{Key: "balance", Value: bson.D{{Key: "$gt", Value: 0}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$meter_number"},
+			{Key: "customer_name", Value: bson.D{{Key: "$first", Value: "$customer_name"}}},
+			{Key: "total_outstanding", Value: bson.D{{Key: "$sum", Value: "$balance"}}},
+			{Key: "unpaid_bills", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "overdue_bills", Value: bson.D{{Key: "$sum", Value: bson.D{
+				{Key: "$cond", Value: bson.A{bson.D{{Key: "$lt", Value: bson.A{"$due_date", now}}}, 1, 0}},
+			}}}},
+			{Key: "oldest_bill_date", Value: bson.D{{Key: "$min", Value: "$bill_date"}}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "total_outstanding", Value: -1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "customers"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "meter_number"},
+			{Key: "as", Value: "customer"},
+		}}},
+		bson.D{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$customer"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "phone_number", Value: "$customer.phone_number"},
+			{Key: "zone", Value: "$customer.zone"},
+		}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "customer", Value: 0}}}},
+	}
+
+	cursor, err := bs.billsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating top debtors: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var debtors []DebtorSummary
+	if err = cursor.All(ctx, &debtors); err != nil {
+		return nil, fmt.Errorf("error decoding top debtors: %v", err)
+	}
+
+	for i := range debtors {
+		debtors[i].TotalOutstanding = utils.RoundToTwoDecimal(debtors[i].TotalOutstanding)
+		debtors[i].OldestBillAgeDays = int(now.Sub(debtors[i].OldestBillDate).Hours() / 24)
+	}
+
+	return debtors, nil
+}
+
 // GetBillByID retrieves a bill by its ID
-func (bs *BillingService) GetBillByID(id primitive.ObjectID) (*models.Bill, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (bs *BillingService) GetBillByID(ctx context.Context, id primitive.ObjectID) (*models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var bill models.Bill
@@ -801,6 +2461,152 @@ func (bs *BillingService) GetBillByID(id primitive.ObjectID) (*models.Bill, erro
 	return &bill, nil
 }
 
+// GetReadingByID retrieves a meter reading by its ID, returning nil if it does not exist
+func (bs *BillingService) GetReadingByID(ctx context.Context, id primitive.ObjectID) (*models.MeterReading, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var reading models.MeterReading
+	err := bs.readingsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&reading)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching reading: %v", err)
+	}
+
+	return &reading, nil
+}
+
+// SetReadingPhoto records where the photo backing a meter reading is stored
+func (bs *BillingService) SetReadingPhoto(ctx context.Context, readingID primitive.ObjectID, photoURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := bs.readingsCollection.UpdateByID(ctx, readingID, bson.M{
+		"$set": bson.M{
+			"meter_photo_url": photoURL,
+			"updated_at":      time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error updating reading: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("reading not found")
+	}
+
+	return nil
+}
+
+// GetBillsByIDs retrieves all bills matching the given IDs
+func (bs *BillingService) GetBillsByIDs(ctx context.Context, ids []primitive.ObjectID) ([]models.Bill, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := bs.billsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bills: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var bills []models.Bill
+	if err = cursor.All(ctx, &bills); err != nil {
+		return nil, fmt.Errorf("error decoding bills: %v", err)
+	}
+
+	return bills, nil
+}
+
+// GetBillPayments retrieves all payments recorded against a bill, including lump-sum payments
+// allocated to it, each showing only the amount that went to this bill
+func (bs *BillingService) GetBillPayments(ctx context.Context, billID primitive.ObjectID) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"bill_id": billID},
+		bson.M{"allocations.bill_id": billID},
+	}}
+	opts := options.Find().SetSort(bson.M{"payment_date": -1})
+	cursor, err := bs.paymentsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bill payments: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []models.Payment
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, fmt.Errorf("error decoding bill payments: %v", err)
+	}
+
+	onBill := payments[:0]
+	for _, payment := range payments {
+		if payment, ok := paymentOnBill(payment, billID); ok {
+			onBill = append(onBill, payment)
+		}
+	}
+	return onBill, nil
+}
+
+// paymentOnBill returns payment as it applies to billID, and false if it did not touch the bill.
+// A lump-sum payment is narrowed to the amount allocated to the bill; its credit belongs to the
+// customer, not to any one bill.
+func paymentOnBill(payment models.Payment, billID primitive.ObjectID) (models.Payment, bool) {
+	if len(payment.Allocations) == 0 {
+		return payment, payment.BillID == billID
+	}
+
+	for _, allocation := range payment.Allocations {
+		if allocation.BillID == billID {
+			payment.BillID = billID
+			payment.Amount = allocation.Amount
+			payment.CreditAmount = 0
+			return payment, true
+		}
+	}
+	return payment, false
+}
+
+// GetPaymentsForBills fetches the payments on each of billIDs in one query, keyed by bill and
+// newest first. A lump-sum payment is listed under every bill it was allocated to, with the
+// amount that bill received. Bills without payments are absent from the map.
+func (bs *BillingService) GetPaymentsForBills(ctx context.Context, billIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Payment, error) {
+	byBill := make(map[primitive.ObjectID][]models.Payment)
+	if len(billIDs) == 0 {
+		return byBill, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"bill_id": bson.M{"$in": billIDs}},
+		bson.M{"allocations.bill_id": bson.M{"$in": billIDs}},
+	}}
+	opts := options.Find().SetSort(bson.M{"payment_date": -1})
+	cursor, err := bs.paymentsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching bill payments: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []models.Payment
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, fmt.Errorf("error decoding bill payments: %v", err)
+	}
+
+	for _, billID := range billIDs {
+		for _, payment := range payments {
+			if payment, ok := paymentOnBill(payment, billID); ok {
+				byBill[billID] = append(byBill[billID], payment)
+			}
+		}
+	}
+	return byBill, nil
+}
+
 // GetAllBills returns all bills with pagination and optional status filter
 func (bs *BillingService) GetAllBills(ctx context.Context, page, limit int, status string) ([]models.Bill, int64, error) {
 	// Build filter
@@ -840,6 +2646,49 @@ func (bs *BillingService) GetAllBills(ctx context.Context, page, limit int, stat
 	return bills, total, nil
 }
 
+// GetCustomerIDsInZone returns the IDs of every customer in a zone
+func (bs *BillingService) GetCustomerIDsInZone(ctx context.Context, zone string) ([]primitive.ObjectID, error) {
+	values, err := bs.customersCollection.Distinct(ctx, "_id", bson.M{"zone": zone})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching customers in zone: %v", err)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// StreamBills calls fn for each bill matching filter, newest first, reading from a cursor so
+// large exports are never held in memory. Iteration stops at the first error fn returns.
+func (bs *BillingService) StreamBills(ctx context.Context, filter bson.M, fn func(*models.Bill) error) error {
+	opts := options.Find().SetSort(bson.M{"bill_date": -1}).SetBatchSize(500)
+
+	cursor, err := bs.billsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("error fetching bills: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var bill models.Bill
+		if err := cursor.Decode(&bill); err != nil {
+			return fmt.Errorf("error decoding bill: %v", err)
+		}
+		if err := fn(&bill); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error reading bills: %v", err)
+	}
+	return nil
+}
+
 // sendPaymentSMS sends an SMS confirmation when payment is received
 func (bs *BillingService) sendPaymentSMS(payment *models.Payment, customer *models.Customer, bill *models.Bill) {
 
@@ -858,18 +2707,19 @@ Receipt: %s
 Bill Period: %s
 Remaining Balance: KSh %.0f
 
-Thank you for choosing Rochi Pure Water.`,
+Thank you for choosing %s.`,
 		customer.FullName(),
 		payment.Amount,
 		paymentDate,
 		payment.PaymentMethod,
 		payment.ReceiptNumber,
 		bill.BillingPeriod,
-		bill.Balance)
+		bill.Balance,
+		company.Name)
 
 	// Send the SMS
 	log.Printf("📱 Sending payment confirmation SMS to %s (%s)", customer.FullName(), customer.PhoneNumber)
-	err := bs.smsService.SendSMS(customer.PhoneNumber, message)
+	_, err := bs.smsService.SendSMS(customer.PhoneNumber, message)
 
 	if err != nil {
 		log.Printf("❌ Failed to send payment SMS to %s: %v", customer.PhoneNumber, err)
@@ -883,6 +2733,10 @@ func (bs *BillingService) SendOverdueReminders() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if _, err := bs.MarkOverdueBills(ctx); err != nil {
+		log.Printf("Error marking overdue bills: %v", err)
+	}
+
 	// Find all overdue bills
 	filter := bson.M{
 		"status":  "overdue",
@@ -928,15 +2782,23 @@ Amount Due: KSh %.0f
 Original Due Date: %s
 
 Please make immediate payment to avoid service disconnection.
+Pay via M-Pesa: Paybill %s, Account %s
 
 Thank you,
-Rochi Pure Water`,
+%s`,
 		customer.FullName(),
 		bill.BillingPeriod,
 		bill.Balance,
-		dueDate)
+		dueDate,
+		company.Paybill,
+		bill.MeterNumber,
+		company.Name)
 
-	err := bs.smsService.SendSMS(customer.PhoneNumber, message)
+	result, err := bs.smsService.sendNotice(customer, message, false)
+	bs.smsService.logSMS(customer.ID, bill.ID, customer.PhoneNumber, message, result, err, "reminder")
+	if errors.Is(err, ErrSMSOptedOut) {
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to send overdue reminder to %s: %v", customer.PhoneNumber, err)
 	} else {
@@ -951,6 +2813,48 @@ type BillingSummary struct {
 	StatusBreakdown map[string]StatusSummary `json:"status_breakdown"`
 }
 
+// ReaderPerformance represents reading metrics for a single meter reader
+type ReaderPerformance struct {
+	ReaderID           primitive.ObjectID `bson:"_id" json:"reader_id"`
+	ReaderName         string             `bson:"reader_name" json:"reader_name"`
+	Zone               string             `bson:"zone" json:"zone"`
+	ReadingsSubmitted  int64              `bson:"readings_submitted" json:"readings_submitted"`
+	MetersCovered      int64              `bson:"meters_covered" json:"meters_covered"`
+	AverageConsumption float64            `bson:"average_consumption" json:"average_consumption"`
+	EstimatedReadings  int64              `bson:"estimated_readings" json:"estimated_readings"`
+	ActualReadings     int64              `bson:"-" json:"actual_readings"`
+}
+
+// DisconnectionCandidate is a customer due for disconnection with what they owe
+type DisconnectionCandidate struct {
+	Customer         models.Customer `bson:"customer" json:"customer"`
+	TotalOutstanding float64         `bson:"total_outstanding" json:"total_outstanding"`
+	OldestDueDate    time.Time       `bson:"oldest_due_date" json:"oldest_due_date"`
+	UnpaidBills      int64           `bson:"unpaid_bills" json:"unpaid_bills"`
+	DaysOverdue      int             `bson:"-" json:"days_overdue"`
+}
+
+// DebtorSummary is what one meter owes across its unpaid bills
+type DebtorSummary struct {
+	MeterNumber       string    `bson:"_id" json:"meter_number"`
+	CustomerName      string    `bson:"customer_name" json:"customer_name"`
+	PhoneNumber       string    `bson:"phone_number" json:"phone_number"`
+	Zone              string    `bson:"zone" json:"zone"`
+	TotalOutstanding  float64   `bson:"total_outstanding" json:"total_outstanding"`
+	UnpaidBills       int64     `bson:"unpaid_bills" json:"unpaid_bills"`
+	OverdueBills      int64     `bson:"overdue_bills" json:"overdue_bills"`
+	OldestBillDate    time.Time `bson:"oldest_bill_date" json:"oldest_bill_date"`
+	OldestBillAgeDays int       `bson:"-" json:"oldest_bill_age_days"`
+}
+
+// PenaltyRunResult summarizes a late penalty run
+type PenaltyRunResult struct {
+	PenaltyRate    float64 `json:"penalty_rate"`
+	BillsPenalized int     `json:"bills_penalized"`
+	Failed         int     `json:"failed"`
+	TotalPenalty   float64 `json:"total_penalty"`
+}
+
 // StatusSummary represents summary for a specific bill status
 type StatusSummary struct {
 	Count       int32   `json:"count"`
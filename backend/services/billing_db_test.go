@@ -0,0 +1,570 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// submitTestReading submits an actual reading for meterNumber taken at date
+func submitTestReading(bs *BillingService, meterNumber string, current float64, date time.Time) (*models.Bill, error) {
+	return bs.SubmitMeterReading(context.Background(), &models.MeterReading{
+		MeterNumber:    meterNumber,
+		CurrentReading: current,
+		ReadingDate:    date,
+		ReadingType:    "actual",
+		ReadingMethod:  "field_agent",
+	})
+}
+
+func findTestCustomer(t *testing.T, db *mongo.Database, id primitive.ObjectID) models.Customer {
+	t.Helper()
+
+	var customer models.Customer
+	if err := db.Collection("customers").FindOne(context.Background(), bson.M{"_id": id}).Decode(&customer); err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+	return customer
+}
+
+func TestSubmitMeterReadingNewCustomer(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000001", 10, 0)
+
+	bill, err := submitTestReading(bs, customer.MeterNumber, 25, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+
+	// First reading is measured from the meter's initial reading
+	if bill.PreviousReading != 10 || bill.Consumption != 15 {
+		t.Errorf("previous/consumption = %v/%v, want 10/15", bill.PreviousReading, bill.Consumption)
+	}
+	wantCharge := 15 * company.RatePerUnit
+	if bill.WaterCharge != wantCharge || bill.TotalAmount != wantCharge || bill.Balance != wantCharge {
+		t.Errorf("charge/total/balance = %v/%v/%v, want %v", bill.WaterCharge, bill.TotalAmount, bill.Balance, wantCharge)
+	}
+	if bill.Status != "pending" {
+		t.Errorf("status = %s, want pending", bill.Status)
+	}
+
+	updated := findTestCustomer(t, db, customer.ID)
+	if updated.LastReading != 25 || updated.Balance != wantCharge {
+		t.Errorf("customer last reading/balance = %v/%v, want 25/%v", updated.LastReading, updated.Balance, wantCharge)
+	}
+
+	if sent := waitForSMS(t, sender, 1); len(sent) != 1 || sent[0].To != customer.PhoneNumber {
+		t.Errorf("bill SMS = %+v, want one message to %s", sent, customer.PhoneNumber)
+	}
+}
+
+func TestSubmitMeterReadingConsumption(t *testing.T) {
+	bs, _, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000002", 100, 0)
+
+	now := time.Now()
+	first, err := submitTestReading(bs, customer.MeterNumber, 120, now.AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("first reading: %v", err)
+	}
+
+	second, err := submitTestReading(bs, customer.MeterNumber, 132.5, now)
+	if err != nil {
+		t.Fatalf("second reading: %v", err)
+	}
+	if second.PreviousReading != 120 || second.Consumption != 12.5 {
+		t.Errorf("previous/consumption = %v/%v, want 120/12.5", second.PreviousReading, second.Consumption)
+	}
+	// Last month's bill is still unpaid: shown as arrears, not added to this bill
+	if second.Arrears != first.TotalAmount || second.TotalAmount != 12.5*company.RatePerUnit {
+		t.Errorf("arrears/total = %v/%v, want %v/%v", second.Arrears, second.TotalAmount, first.TotalAmount, 12.5*company.RatePerUnit)
+	}
+
+	if _, err := submitTestReading(bs, customer.MeterNumber, 140, now); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second reading in a month: err = %v, want already exists", err)
+	}
+}
+
+func TestSubmitMeterReadingRejectsBackwardsReading(t *testing.T) {
+	bs, _, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000003", 500, 0)
+
+	// Far from the meter's maximum, so this is a misread rather than a rollover
+	_, err := submitTestReading(bs, customer.MeterNumber, 400, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "cannot be less than previous reading") {
+		t.Fatalf("err = %v, want a backwards reading error", err)
+	}
+
+	count, _ := db.Collection("bills").CountDocuments(context.Background(), bson.M{})
+	if updated := findTestCustomer(t, db, customer.ID); count != 0 || updated.Balance != 0 || updated.LastReading != 500 {
+		t.Errorf("after rejection: %d bills, balance %v, last reading %v; want nothing written", count, updated.Balance, updated.LastReading)
+	}
+}
+
+func TestCorrectReading(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000005", 10, 0)
+
+	original, err := submitTestReading(bs, customer.MeterNumber, 25, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+
+	bill, err := bs.CorrectReading(context.Background(), original.ReadingID, 20, "digits transposed", "admin1")
+	if err != nil {
+		t.Fatalf("CorrectReading: %v", err)
+	}
+	wantCharge := 10 * company.RatePerUnit
+	if bill.ID == original.ID || bill.Consumption != 10 || bill.TotalAmount != wantCharge {
+		t.Errorf("reissued bill consumption/total = %v/%v, want a new bill for 10/%v", bill.Consumption, bill.TotalAmount, wantCharge)
+	}
+
+	var voided models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": original.ID}).Decode(&voided); err != nil {
+		t.Fatalf("find original bill: %v", err)
+	}
+	if voided.Status != "cancelled" {
+		t.Errorf("original bill status = %s, want cancelled", voided.Status)
+	}
+
+	var reading models.MeterReading
+	if err := db.Collection("meter_readings").FindOne(context.Background(), bson.M{"_id": original.ReadingID}).Decode(&reading); err != nil {
+		t.Fatalf("find reading: %v", err)
+	}
+	if reading.CurrentReading != 20 || reading.Consumption != 10 || reading.OriginalReading == nil || *reading.OriginalReading != 25 {
+		t.Errorf("reading current/consumption/original = %v/%v/%v, want 20/10/25", reading.CurrentReading, reading.Consumption, reading.OriginalReading)
+	}
+
+	// The customer owes only the reissued bill
+	if updated := findTestCustomer(t, db, customer.ID); updated.LastReading != 20 || updated.Balance != wantCharge {
+		t.Errorf("customer last reading/balance = %v/%v, want 20/%v", updated.LastReading, updated.Balance, wantCharge)
+	}
+
+	// A second correction voids the reissued bill, not the one already cancelled
+	again, err := bs.CorrectReading(context.Background(), original.ReadingID, 22, "second look", "admin1")
+	if err != nil {
+		t.Fatalf("second CorrectReading: %v", err)
+	}
+	var reissued models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&reissued); err != nil {
+		t.Fatalf("find reissued bill: %v", err)
+	}
+	if reissued.Status != "cancelled" || again.Consumption != 12 {
+		t.Errorf("after second correction: first reissue %s, new consumption %v; want cancelled and 12", reissued.Status, again.Consumption)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != again.TotalAmount {
+		t.Errorf("customer balance = %v, want only the latest bill %v", updated.Balance, again.TotalAmount)
+	}
+
+	if _, err := bs.CorrectReading(context.Background(), original.ReadingID, 5, "typo", "admin1"); err == nil ||
+		!strings.Contains(err.Error(), "cannot be less than previous reading") {
+		t.Errorf("correction below the previous reading: err = %v, want a backwards reading error", err)
+	}
+}
+
+func TestResolveDisputeCancelsBill(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000006", 10, 0)
+
+	now := time.Now()
+	bill, err := submitTestReading(bs, customer.MeterNumber, 40, now)
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+
+	if err := bs.DisputeReading(context.Background(), bill.ReadingID, "meter misread", "cs1"); err != nil {
+		t.Fatalf("DisputeReading: %v", err)
+	}
+	if err := bs.ResolveDispute(context.Background(), bill.ReadingID, "reader confirmed misread", true, "manager1"); err != nil {
+		t.Fatalf("ResolveDispute: %v", err)
+	}
+
+	var voided models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&voided); err != nil {
+		t.Fatalf("find bill: %v", err)
+	}
+	if voided.Status != "cancelled" || voided.Balance != 0 || !strings.Contains(voided.BillNumber, "-VOID-") {
+		t.Errorf("bill status/balance/number = %s/%v/%s, want a zeroed, renamed cancelled bill", voided.Status, voided.Balance, voided.BillNumber)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != 0 || updated.LastReading != 10 || updated.TotalConsumed != 0 {
+		t.Errorf("customer balance/last reading/total = %v/%v/%v, want 0/10/0", updated.Balance, updated.LastReading, updated.TotalConsumed)
+	}
+
+	// The voided bill takes no payments
+	payment := &models.Payment{BillID: bill.ID, Amount: 100, PaymentMethod: "cash"}
+	if _, err := bs.RecordPayment(context.Background(), payment); err == nil || !strings.Contains(err.Error(), "cannot take payments") {
+		t.Errorf("paying a cancelled bill: got %v, want a cannot take payments error", err)
+	}
+
+	// The month can be read and billed again
+	if _, err := submitTestReading(bs, customer.MeterNumber, 25, now); err != nil {
+		t.Errorf("re-reading the month after the dispute: %v", err)
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      float64
+		wantStatus  string
+		wantBalance float64 // Left on the bill
+		wantCredit  float64 // Overpayment held on the customer
+	}{
+		{"full", 1000, "paid", 0, 0},
+		{"partial", 400, "partially_paid", 600, 0},
+		{"overpayment", 1200, "paid", 0, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs, sender, db := newTestBillingService(t)
+			customer := insertTestCustomer(t, db, "MTR00000004", 0, 0)
+
+			// A KSh 1,000 bill
+			bill, err := submitTestReading(bs, customer.MeterNumber, 1000/company.RatePerUnit, time.Now())
+			if err != nil {
+				t.Fatalf("SubmitMeterReading: %v", err)
+			}
+			waitForSMS(t, sender, 1)
+
+			payment := &models.Payment{BillID: bill.ID, Amount: tt.amount, PaymentMethod: "mpesa", TransactionID: "TXN" + tt.name}
+			duplicate, err := bs.RecordPayment(context.Background(), payment)
+			if err != nil || duplicate {
+				t.Fatalf("RecordPayment: duplicate %v, err %v", duplicate, err)
+			}
+			if payment.ReceiptNumber == "" || payment.CustomerID != customer.ID || payment.CreditAmount != tt.wantCredit {
+				t.Errorf("payment = receipt %q, customer %s, credit %v; want a receipt, %s, %v",
+					payment.ReceiptNumber, payment.CustomerID.Hex(), payment.CreditAmount, customer.ID.Hex(), tt.wantCredit)
+			}
+
+			var stored models.Bill
+			if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&stored); err != nil {
+				t.Fatalf("find bill: %v", err)
+			}
+			if stored.Status != tt.wantStatus || stored.Balance != tt.wantBalance {
+				t.Errorf("bill status/balance = %s/%v, want %s/%v", stored.Status, stored.Balance, tt.wantStatus, tt.wantBalance)
+			}
+
+			updated := findTestCustomer(t, db, customer.ID)
+			if updated.Balance != 1000-tt.amount {
+				t.Errorf("customer balance = %v, want %v", updated.Balance, 1000-tt.amount)
+			}
+
+			// A retried submission returns the same payment without charging twice
+			retry := &models.Payment{BillID: bill.ID, Amount: tt.amount, PaymentMethod: "mpesa", TransactionID: "TXN" + tt.name}
+			if duplicate, err := bs.RecordPayment(context.Background(), retry); err != nil || !duplicate || retry.ID != payment.ID {
+				t.Errorf("retry: duplicate %v, err %v, id %s; want the first payment back", duplicate, err, retry.ID.Hex())
+			}
+			if again := findTestCustomer(t, db, customer.ID); again.Balance != updated.Balance {
+				t.Errorf("retry changed customer balance from %v to %v", updated.Balance, again.Balance)
+			}
+		})
+	}
+}
+
+func TestReversePayment(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000007", 0, 0)
+
+	// A KSh 1,000 bill paid in full
+	bill, err := submitTestReading(bs, customer.MeterNumber, 1000/company.RatePerUnit, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+
+	payment := &models.Payment{BillID: bill.ID, Amount: 1000, PaymentMethod: "mpesa", TransactionID: "TXNREV1"}
+	if _, err := bs.RecordPayment(context.Background(), payment); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+
+	if err := bs.ReversePayment(context.Background(), payment.ID, "duplicate M-Pesa entry", "admin1"); err != nil {
+		t.Fatalf("ReversePayment: %v", err)
+	}
+
+	var stored models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&stored); err != nil {
+		t.Fatalf("find bill: %v", err)
+	}
+	if stored.AmountPaid != 0 || stored.Balance != 1000 || stored.Status == "paid" {
+		t.Errorf("bill paid/balance/status = %v/%v/%s, want 0/1000 unpaid", stored.AmountPaid, stored.Balance, stored.Status)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != 1000 || updated.TotalPaid != 0 {
+		t.Errorf("customer balance/total paid = %v/%v, want 1000/0", updated.Balance, updated.TotalPaid)
+	}
+
+	if err := bs.ReversePayment(context.Background(), payment.ID, "again", "admin1"); err == nil {
+		t.Error("reversing a refunded payment twice should fail")
+	}
+}
+
+func TestReversePaymentWithCredit(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000008", 0, 0)
+
+	bill, err := submitTestReading(bs, customer.MeterNumber, 1000/company.RatePerUnit, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+
+	// KSh 500, then KSh 800 of which only 500 is applied and 300 is held as credit
+	first := &models.Payment{BillID: bill.ID, Amount: 500, PaymentMethod: "cash"}
+	if _, err := bs.RecordPayment(context.Background(), first); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+	second := &models.Payment{BillID: bill.ID, Amount: 800, PaymentMethod: "mpesa", TransactionID: "TXNREV2"}
+	if _, err := bs.RecordPayment(context.Background(), second); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+	if second.CreditAmount != 300 {
+		t.Fatalf("credit amount = %v, want 300", second.CreditAmount)
+	}
+
+	if err := bs.ReversePayment(context.Background(), second.ID, "wrong account", "admin1"); err != nil {
+		t.Fatalf("ReversePayment: %v", err)
+	}
+
+	var stored models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&stored); err != nil {
+		t.Fatalf("find bill: %v", err)
+	}
+	if stored.AmountPaid != 500 || stored.Balance != 500 {
+		t.Errorf("bill paid/balance = %v/%v, want 500/500", stored.AmountPaid, stored.Balance)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != 500 || updated.TotalPaid != 500 {
+		t.Errorf("customer balance/total paid = %v/%v, want 500/500", updated.Balance, updated.TotalPaid)
+	}
+}
+
+func TestProcessBulkPaymentWithoutBills(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000010", 0, 0)
+
+	payment := &models.Payment{Amount: 500, PaymentMethod: "mpesa", TransactionID: "TXNBULK1", PayerPhone: "254700000000"}
+	result, err := bs.ProcessBulkPayment(context.Background(), customer.MeterNumber, payment)
+	if err != nil {
+		t.Fatalf("ProcessBulkPayment: %v", err)
+	}
+	if len(result.Bills) != 0 || result.Credit != 500 {
+		t.Errorf("bills/credit = %d/%v, want 0/500", len(result.Bills), result.Credit)
+	}
+
+	var stored models.Payment
+	if err := db.Collection("payments").FindOne(context.Background(), bson.M{"transaction_id": "TXNBULK1"}).Decode(&stored); err != nil {
+		t.Fatalf("find payment: %v", err)
+	}
+	if stored.CustomerID != customer.ID || stored.CreditAmount != 500 || stored.PayerPhone != "254700000000" {
+		t.Errorf("payment customer/credit/payer = %s/%v/%s, want %s/500/254700000000",
+			stored.CustomerID.Hex(), stored.CreditAmount, stored.PayerPhone, customer.ID.Hex())
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != -500 {
+		t.Errorf("customer balance = %v, want -500", updated.Balance)
+	}
+
+	// The customer is told the payment arrived
+	if sent := waitForSMS(t, sender, 1); len(sent) != 1 || !strings.Contains(sent[0].Body, "KSh 500.00") {
+		t.Errorf("confirmations sent = %+v, want one for KSh 500.00", sent)
+	}
+
+	// A retried callback returns the original payment, not a second one
+	retry := &models.Payment{Amount: 500, PaymentMethod: "mpesa", TransactionID: "TXNBULK1"}
+	again, err := bs.ProcessBulkPayment(context.Background(), customer.MeterNumber, retry)
+	if err != nil {
+		t.Fatalf("retried payment: %v", err)
+	}
+	if !again.Duplicate || again.Payment.ID != stored.ID {
+		t.Errorf("retried payment: duplicate %v, payment %s, want the original %s", again.Duplicate, again.Payment.ID.Hex(), stored.ID.Hex())
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != -500 {
+		t.Errorf("customer balance after retry = %v, want -500", updated.Balance)
+	}
+}
+
+func TestGetPaymentsForBillsSpreadPayment(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000011", 0, 0)
+
+	now := time.Now()
+	older, err := submitTestReading(bs, customer.MeterNumber, 10, now.AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	newer, err := submitTestReading(bs, customer.MeterNumber, 20, now)
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 2)
+
+	// Clears the older bill and half of the newer one
+	half := newer.Balance / 2
+	payment := &models.Payment{Amount: older.Balance + half, PaymentMethod: "mpesa", TransactionID: "TXNSPREAD1"}
+	if _, err := bs.ProcessBulkPayment(context.Background(), customer.MeterNumber, payment); err != nil {
+		t.Fatalf("ProcessBulkPayment: %v", err)
+	}
+
+	byBill, err := bs.GetPaymentsForBills(context.Background(), []primitive.ObjectID{older.ID, newer.ID})
+	if err != nil {
+		t.Fatalf("GetPaymentsForBills: %v", err)
+	}
+	for _, tt := range []struct {
+		bill *models.Bill
+		want float64
+	}{{older, older.Balance}, {newer, half}} {
+		payments := byBill[tt.bill.ID]
+		if len(payments) != 1 || payments[0].Amount != tt.want {
+			t.Errorf("bill %s payments = %+v, want one of %v", tt.bill.BillNumber, payments, tt.want)
+		}
+	}
+
+	payments, err := bs.GetBillPayments(context.Background(), newer.ID)
+	if err != nil {
+		t.Fatalf("GetBillPayments: %v", err)
+	}
+	if len(payments) != 1 || payments[0].Amount != half {
+		t.Errorf("newer bill payments = %+v, want one of %v", payments, half)
+	}
+}
+
+func TestApplyLatePenalties(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000009", 0, 0)
+
+	bill, err := submitTestReading(bs, customer.MeterNumber, 1000/company.RatePerUnit, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+
+	// Make the bill overdue
+	if _, err := db.Collection("bills").UpdateByID(context.Background(), bill.ID, bson.M{
+		"$set": bson.M{"due_date": time.Now().AddDate(0, 0, -1)},
+	}); err != nil {
+		t.Fatalf("backdate bill: %v", err)
+	}
+
+	result, err := bs.ApplyLatePenalties(context.Background(), 0.05)
+	if err != nil {
+		t.Fatalf("ApplyLatePenalties: %v", err)
+	}
+	if result.BillsPenalized != 1 || result.TotalPenalty != 50 || result.Failed != 0 {
+		t.Errorf("penalized/total/failed = %d/%v/%d, want 1/50/0", result.BillsPenalized, result.TotalPenalty, result.Failed)
+	}
+
+	var stored models.Bill
+	if err := db.Collection("bills").FindOne(context.Background(), bson.M{"_id": bill.ID}).Decode(&stored); err != nil {
+		t.Fatalf("find bill: %v", err)
+	}
+	if stored.Penalty != 50 || stored.TotalAmount != 1050 || stored.Balance != 1050 || stored.Status != "overdue" {
+		t.Errorf("bill penalty/total/balance/status = %v/%v/%v/%s, want 50/1050/1050/overdue",
+			stored.Penalty, stored.TotalAmount, stored.Balance, stored.Status)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Balance != 1050 {
+		t.Errorf("customer balance = %v, want 1050", updated.Balance)
+	}
+
+	// A second run in the same month charges nothing
+	result, err = bs.ApplyLatePenalties(context.Background(), 0.05)
+	if err != nil {
+		t.Fatalf("ApplyLatePenalties again: %v", err)
+	}
+	if result.BillsPenalized != 0 {
+		t.Errorf("second run penalized %d bills, want 0", result.BillsPenalized)
+	}
+}
+
+func TestGetBillingSummaryStatusBreakdown(t *testing.T) {
+	bs, _, db := newTestBillingService(t)
+
+	now := time.Now()
+	bills := []interface{}{
+		models.Bill{ID: primitive.NewObjectID(), BillNumber: "B1", BillDate: now, Status: "paid", TotalAmount: 1000, AmountPaid: 1000},
+		models.Bill{ID: primitive.NewObjectID(), BillNumber: "B2", BillDate: now, Status: "paid", TotalAmount: 500, AmountPaid: 500},
+		models.Bill{ID: primitive.NewObjectID(), BillNumber: "B3", BillDate: now, Status: "partially_paid", TotalAmount: 800, AmountPaid: 300, Balance: 500},
+		models.Bill{ID: primitive.NewObjectID(), BillNumber: "B4", BillDate: now, Status: "pending", TotalAmount: 700, Balance: 700},
+		// Outside the period
+		models.Bill{ID: primitive.NewObjectID(), BillNumber: "B5", BillDate: now.AddDate(0, -2, 0), Status: "pending", TotalAmount: 900, Balance: 900},
+	}
+	if _, err := db.Collection("bills").InsertMany(context.Background(), bills); err != nil {
+		t.Fatalf("insert bills: %v", err)
+	}
+
+	summary, err := bs.GetBillingSummary(context.Background(), now.AddDate(0, 0, -7), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetBillingSummary: %v", err)
+	}
+
+	want := map[string]StatusSummary{
+		"paid":           {Count: 2, TotalAmount: 1500, TotalPaid: 1500},
+		"partially_paid": {Count: 1, TotalAmount: 800, TotalPaid: 300},
+		"pending":        {Count: 1, TotalAmount: 700, TotalPaid: 0},
+	}
+	if len(summary.StatusBreakdown) != len(want) {
+		t.Errorf("breakdown = %+v, want %d statuses", summary.StatusBreakdown, len(want))
+	}
+	for status, w := range want {
+		if got := summary.StatusBreakdown[status]; got != w {
+			t.Errorf("%s = %+v, want %+v", status, got, w)
+		}
+	}
+}
+
+func TestUpdateCustomerStatusDoesNotReconnect(t *testing.T) {
+	_, _, db := newTestBillingService(t)
+	cs := NewCustomerService(db.Collection("customers"), db.Collection("tariffs"), db.Collection("bills"), nil)
+	customer := insertTestCustomer(t, db, "MTR00000040", 0, 1500)
+	ctx := context.Background()
+
+	if err := cs.UpdateCustomerStatus(ctx, customer.MeterNumber, "disconnected", "arrears"); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+
+	// Marking a disconnected customer active would skip the balance check on reconnect
+	err := cs.UpdateCustomerStatus(ctx, customer.MeterNumber, "active", "")
+	if err == nil || !strings.Contains(err.Error(), "must be reconnected") {
+		t.Errorf("activate disconnected customer: got %v, want a reconnect error", err)
+	}
+	if updated := findTestCustomer(t, db, customer.ID); updated.Status != "disconnected" {
+		t.Errorf("status = %s, want disconnected", updated.Status)
+	}
+
+	if err := cs.UpdateCustomerStatus(ctx, "MTR00000041", "active", ""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("unknown meter: got %v, want not found", err)
+	}
+}
+
+func TestAdjustBillCreditLimitedToBalance(t *testing.T) {
+	bs, sender, db := newTestBillingService(t)
+	customer := insertTestCustomer(t, db, "MTR00000042", 0, 0)
+
+	// A KSh 1,000 bill with KSh 600 already paid
+	bill, err := submitTestReading(bs, customer.MeterNumber, 1000/company.RatePerUnit, time.Now())
+	if err != nil {
+		t.Fatalf("SubmitMeterReading: %v", err)
+	}
+	waitForSMS(t, sender, 1)
+	if _, err := bs.RecordPayment(context.Background(), &models.Payment{BillID: bill.ID, Amount: 600, PaymentMethod: "cash"}); err != nil {
+		t.Fatalf("RecordPayment: %v", err)
+	}
+
+	if _, err := bs.AdjustBill(context.Background(), bill.ID, 500, "goodwill", "manager1"); err == nil || !strings.Contains(err.Error(), "exceeds bill balance") {
+		t.Errorf("credit above the balance: got %v, want an exceeds bill balance error", err)
+	}
+
+	adjusted, err := bs.AdjustBill(context.Background(), bill.ID, 400, "goodwill", "manager1")
+	if err != nil {
+		t.Fatalf("AdjustBill: %v", err)
+	}
+	if adjusted.Balance != 0 || adjusted.TotalAmount != 600 {
+		t.Errorf("bill balance/total = %v/%v, want 0/600", adjusted.Balance, adjusted.TotalAmount)
+	}
+}
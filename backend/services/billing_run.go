@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BillingRunError is a customer the monthly run could not bill
+type BillingRunError struct {
+	Meter string `json:"meter"`
+	Error string `json:"error"`
+}
+
+// BillingRunResult summarises a monthly billing run. Billed counts bills created from readings
+// taken in the period, Estimated those created from consumption history, and Skipped the
+// customers that were already billed or could not be estimated.
+type BillingRunResult struct {
+	Period    string            `json:"period"` // YYYY-MM
+	Customers int               `json:"customers"`
+	Billed    int               `json:"billed"`
+	Estimated int               `json:"estimated"`
+	Skipped   int               `json:"skipped"`
+	Errored   int               `json:"errored"`
+	Errors    []BillingRunError `json:"errors,omitempty"`
+}
+
+// RunMonthlyBilling makes sure every active metered customer has a bill for period. A reading in
+// the period that has no bill is billed; a customer with no reading gets an estimate. Customers
+// already billed for the period are skipped, so the run can be repeated safely.
+func (bs *BillingService) RunMonthlyBilling(ctx context.Context, period time.Time) (*BillingRunResult, error) {
+	now := time.Now()
+	month := period.Format("2006-01")
+	if month > now.Format("2006-01") {
+		return nil, fmt.Errorf("cannot bill future period %s", month)
+	}
+
+	customers, readings, billed, err := bs.billingRunState(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BillingRunResult{Period: month, Customers: len(customers)}
+	estimateDate := billingRunEstimateDate(period, now)
+
+	for i := range customers {
+		customer := &customers[i]
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+
+		var unbilled *models.MeterReading
+		alreadyBilled := false
+		for j := range readings[customer.MeterNumber] {
+			reading := &readings[customer.MeterNumber][j]
+			if billed[reading.ID] {
+				alreadyBilled = true
+				break
+			}
+			if reading.Status != "cancelled" && unbilled == nil {
+				unbilled = reading
+			}
+		}
+
+		switch {
+		case alreadyBilled:
+			result.Skipped++
+
+		case unbilled != nil:
+			if _, err := bs.billReading(ctx, unbilled); err != nil {
+				result.fail(customer.MeterNumber, err)
+				continue
+			}
+			result.Billed++
+
+		case len(readings[customer.MeterNumber]) > 0:
+			// Every reading this period was cancelled, e.g. after a dispute; leave it for review
+			result.Skipped++
+
+		default:
+			_, err := bs.GenerateEstimatedReading(ctx, customer.MeterNumber, estimateDate)
+			switch {
+			case err == nil:
+				result.Estimated++
+			case strings.Contains(err.Error(), "no consumption history"),
+				strings.Contains(err.Error(), "already exists"):
+				result.Skipped++
+			default:
+				result.fail(customer.MeterNumber, err)
+			}
+		}
+	}
+
+	utils.Logf(ctx, "🧾 Monthly billing %s: %d billed, %d estimated, %d skipped, %d errored",
+		month, result.Billed, result.Estimated, result.Skipped, result.Errored)
+
+	return result, nil
+}
+
+func (r *BillingRunResult) fail(meter string, err error) {
+	r.Errored++
+	r.Errors = append(r.Errors, BillingRunError{Meter: meter, Error: err.Error()})
+}
+
+// billingRunState loads the active metered customers, their readings for month by meter, and
+// which of those readings already have a bill. A cancelled bill counts, so the run does not
+// re-bill a reading an admin deliberately voided.
+func (bs *BillingService) billingRunState(ctx context.Context, month string) ([]models.Customer, map[string][]models.MeterReading, map[primitive.ObjectID]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cursor, err := bs.customersCollection.Find(ctx, bson.M{
+		"status":          "active",
+		"connection_type": bson.M{"$ne": "unmetered"},
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error fetching customers: %v", err)
+	}
+	var customers []models.Customer
+	if err = cursor.All(ctx, &customers); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding customers: %v", err)
+	}
+
+	cursor, err = bs.readingsCollection.Find(ctx, bson.M{"month": month})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error fetching readings for period: %v", err)
+	}
+	var periodReadings []models.MeterReading
+	if err = cursor.All(ctx, &periodReadings); err != nil {
+		return nil, nil, nil, fmt.Errorf("error decoding readings: %v", err)
+	}
+
+	readings := make(map[string][]models.MeterReading)
+	readingIDs := make([]primitive.ObjectID, len(periodReadings))
+	for i, reading := range periodReadings {
+		readings[reading.MeterNumber] = append(readings[reading.MeterNumber], reading)
+		readingIDs[i] = reading.ID
+	}
+
+	billed := make(map[primitive.ObjectID]bool)
+	if len(readingIDs) == 0 {
+		return customers, readings, billed, nil
+	}
+
+	ids, err := bs.billsCollection.Distinct(ctx, "reading_id", bson.M{
+		"reading_id": bson.M{"$in": readingIDs},
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error fetching bills for period: %v", err)
+	}
+	for _, id := range ids {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			billed[oid] = true
+		}
+	}
+
+	return customers, readings, billed, nil
+}
+
+// billReading raises the bill for a reading that was saved without one, carrying the customer's
+// current arrears as a normal submission would
+func (bs *BillingService) billReading(ctx context.Context, reading *models.MeterReading) (*models.Bill, error) {
+	session, err := bs.readingsCollection.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	var bill *models.Bill
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		customer, err := bs.GetCustomerByMeterNumber(sc, reading.MeterNumber)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		tariff, err := bs.customerTariff(sc, customer)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		bill, err = bs.generateBill(sc, customer, reading, customer.AmountOwed(), tariff)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		err = bs.updateCustomerAfterBilling(sc, customer.ID, reading, bill.TotalAmount)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// billingRunEstimateDate is the reading date given to estimates: now for the current month,
+// otherwise the last day of the period
+func billingRunEstimateDate(period, now time.Time) time.Time {
+	if period.Year() == now.Year() && period.Month() == now.Month() {
+		return now
+	}
+	return time.Date(period.Year(), period.Month()+1, 0, 12, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,417 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewBillDueDateFromTariff(t *testing.T) {
+	t.Setenv("BILL_DUE_DAYS", "")
+
+	customer := &models.Customer{MeterNumber: "MTR001"}
+	reading := &models.MeterReading{MeterNumber: "MTR001", WaterCharge: 500}
+
+	tests := []struct {
+		name   string
+		tariff *models.Tariff
+		want   int
+	}{
+		{"commercial terms", &models.Tariff{Code: "COM-A", DueDays: 14}, 14},
+		{"residential terms", &models.Tariff{Code: "RES-A", DueDays: 30}, 30},
+		{"tariff without terms", &models.Tariff{Code: "RES-B"}, 30},
+		{"no tariff", nil, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bill := newBill(customer, reading, 0, tt.tariff)
+
+			if want := bill.BillDate.AddDate(0, 0, tt.want); !bill.DueDate.Equal(want) {
+				t.Errorf("DueDate = %v, want %v (%d days after bill date)", bill.DueDate, want, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBillUnit(t *testing.T) {
+	customer := &models.Customer{MeterNumber: "MTR001"}
+	reading := &models.MeterReading{MeterNumber: "MTR001", Consumption: 12}
+
+	if bill := newBill(customer, reading, 0, nil); bill.Unit != models.DefaultUnit {
+		t.Errorf("no tariff: unit = %q, want %q", bill.Unit, models.DefaultUnit)
+	}
+	if bill := newBill(customer, reading, 0, &models.Tariff{Unit: "litres"}); bill.Unit != "litres" {
+		t.Errorf("litres tariff: unit = %q, want litres", bill.Unit)
+	}
+
+	// Bills saved before the unit was recorded report the default in messages
+	vars := billTemplateVars(&models.Bill{Consumption: 12}, customer)
+	if vars["unit"] != models.DefaultUnit {
+		t.Errorf("template unit for an old bill = %q, want %q", vars["unit"], models.DefaultUnit)
+	}
+}
+
+func TestBillDueDaysEnvDefault(t *testing.T) {
+	t.Setenv("BILL_DUE_DAYS", "21")
+
+	if got := billDueDays(nil); got != 21 {
+		t.Errorf("billDueDays(nil) = %d, want 21", got)
+	}
+	if got := billDueDays(&models.Tariff{DueDays: 14}); got != 14 {
+		t.Errorf("billDueDays(14-day tariff) = %d, want 14", got)
+	}
+}
+
+func TestTrendMonthsCoverEveryMonth(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+
+	start := trendStart(now, 4)
+	if want := time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Fatalf("trendStart = %v, want %v", start, want)
+	}
+
+	got := trendMonths(start, 4)
+	want := []string{"2025-12", "2026-01", "2026-02", "2026-03"}
+	if len(got) != len(want) {
+		t.Fatalf("trendMonths = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("trendMonths[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPrepareReadingRollover(t *testing.T) {
+	t.Setenv("METER_MAX", "")
+	t.Setenv("METER_MAX_15MM", "")
+	t.Setenv("METER_ROLLOVER_THRESHOLD", "")
+
+	tests := []struct {
+		name            string
+		previous        float64
+		current         float64
+		wantConsumption float64
+		wantRollover    bool
+		wantErr         bool
+	}{
+		{"normal reading", 1200, 1250, 50, false, false},
+		{"rollover past the maximum", 99990, 12, 22, true, false},
+		{"small drop is a misread", 1250, 1200, 0, false, true},
+		{"previous reading beyond the meter", 150000, 12, 0, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customer := &models.Customer{MeterNumber: "MTR001", MeterSize: "15mm", LastReading: tt.previous}
+			previous := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: tt.previous, ReadingType: "actual"}
+			request := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: tt.current, ReadingType: "actual", ReadingDate: time.Now()}
+
+			reading, _, err := prepareReading(request, customer, previous, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareReading error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if reading.Consumption != tt.wantConsumption {
+				t.Errorf("Consumption = %v, want %v", reading.Consumption, tt.wantConsumption)
+			}
+			if reading.Rollover != tt.wantRollover {
+				t.Errorf("Rollover = %v, want %v", reading.Rollover, tt.wantRollover)
+			}
+			if tt.wantRollover && !reading.NeedsReview {
+				t.Error("rollover reading should need review")
+			}
+
+			// The customer's total grows by what was billed, not by current - last reading
+			update := customerBillingUpdate(reading, 0, nil)
+			if got := update["$inc"].(bson.M)["total_consumed"]; got != tt.wantConsumption {
+				t.Errorf("total_consumed increment = %v, want %v", got, tt.wantConsumption)
+			}
+		})
+	}
+}
+
+func TestMeterMaxForSize(t *testing.T) {
+	t.Setenv("METER_MAX", "1000000")
+	t.Setenv("METER_MAX_20MM", "10000")
+
+	if got := meterMaxFor("20mm"); got != 10000 {
+		t.Errorf("meterMaxFor(20mm) = %v, want 10000", got)
+	}
+	if got := meterMaxFor("15mm"); got != 1000000 {
+		t.Errorf("meterMaxFor(15mm) = %v, want the METER_MAX default 1000000", got)
+	}
+}
+
+func TestLoadCompanyConfigRate(t *testing.T) {
+	saved := company
+	t.Cleanup(func() { company = saved })
+
+	t.Setenv("COMPANY_NAME", "Kiambu Water")
+	t.Setenv("MPESA_PAYBILL", "")
+	t.Setenv("SUPPORT_PHONE", "")
+	t.Setenv("RATE_PER_UNIT", "85.5")
+
+	config := LoadCompanyConfig()
+	if config.Name != "Kiambu Water" || config.Paybill != saved.Paybill || config.RatePerUnit != 85.5 {
+		t.Fatalf("LoadCompanyConfig = %+v", config)
+	}
+
+	customer := &models.Customer{MeterNumber: "MTR001"}
+	previous := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 100, ReadingType: "actual"}
+	request := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 110, ReadingType: "actual", ReadingDate: time.Now()}
+
+	reading, _, err := prepareReading(request, customer, previous, 0)
+	if err != nil {
+		t.Fatalf("prepareReading: %v", err)
+	}
+	if reading.WaterCharge != 855 {
+		t.Errorf("WaterCharge = %v, want 10 units at the configured 85.5", reading.WaterCharge)
+	}
+
+	t.Setenv("RATE_PER_UNIT", "free")
+	if got := LoadCompanyConfig().RatePerUnit; got != 85.5 {
+		t.Errorf("invalid RATE_PER_UNIT changed the rate to %v", got)
+	}
+}
+
+func TestBillingRunEstimateDate(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+
+	if got := billingRunEstimateDate(time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC), now); !got.Equal(now) {
+		t.Errorf("current period estimate date = %v, want now", got)
+	}
+
+	got := billingRunEstimateDate(time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC), now)
+	if got.Format("2006-01-02") != "2026-02-28" {
+		t.Errorf("past period estimate date = %v, want the last day of February", got)
+	}
+}
+
+// Customer balance: bills add to it and payments take it off, so positive is owed and negative is
+// credit. A bill's Balance is what is left to pay on that bill alone.
+func TestBalanceConventionBillThenPartialPayment(t *testing.T) {
+	customer := &models.Customer{MeterNumber: "MTR001", Balance: 300} // 300 still owed on an earlier bill
+	previous := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 100, ReadingType: "actual"}
+	request := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 105, ReadingType: "actual", ReadingDate: time.Now()}
+
+	reading, arrears, err := prepareReading(request, customer, previous, 50)
+	if err != nil {
+		t.Fatalf("prepareReading: %v", err)
+	}
+	if arrears != 300 {
+		t.Fatalf("arrears = %v, want the 300 owed", arrears)
+	}
+
+	bill := newBill(customer, reading, arrears, nil)
+	charges := reading.WaterCharge + 50
+	if bill.TotalAmount != charges || bill.Balance != charges {
+		t.Errorf("bill total/balance = %v/%v, want this period's charges %v without arrears", bill.TotalAmount, bill.Balance, charges)
+	}
+	if bill.TotalOutstanding() != charges+300 {
+		t.Errorf("TotalOutstanding = %v, want %v", bill.TotalOutstanding(), charges+300)
+	}
+
+	update := customerBillingUpdate(reading, bill.TotalAmount, nil)
+	customer.Balance += update["$inc"].(bson.M)["balance"].(float64)
+	if customer.Balance != 300+charges || customer.AmountOwed() != 300+charges {
+		t.Errorf("after billing balance = %v, want %v owed", customer.Balance, 300+charges)
+	}
+
+	applied, excess := bill.ApplyPayment(200, "cash", "")
+	customer.Balance -= 200 // as updateCustomerBalance does
+	if applied != 200 || excess != 0 || bill.Balance != charges-200 || bill.Status != "partially_paid" {
+		t.Errorf("bill after partial payment = applied %v, excess %v, balance %v, %s", applied, excess, bill.Balance, bill.Status)
+	}
+	if customer.AmountOwed() != 100+charges || customer.Credit() != 0 {
+		t.Errorf("owed/credit after payment = %v/%v, want %v/0", customer.AmountOwed(), customer.Credit(), 100+charges)
+	}
+}
+
+func TestPrepareReadingCreditIsNotArrears(t *testing.T) {
+	customer := &models.Customer{MeterNumber: "MTR001", Balance: -200}
+	previous := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 100, ReadingType: "actual"}
+	request := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 105, ReadingType: "actual", ReadingDate: time.Now()}
+
+	_, arrears, err := prepareReading(request, customer, previous, 0)
+	if err != nil {
+		t.Fatalf("prepareReading: %v", err)
+	}
+	if arrears != 0 {
+		t.Errorf("arrears = %v for a customer in credit, want 0", arrears)
+	}
+	if customer.Credit() != 200 || customer.AmountOwed() != 0 {
+		t.Errorf("credit/owed = %v/%v, want 200/0", customer.Credit(), customer.AmountOwed())
+	}
+}
+
+func TestProrationFactor(t *testing.T) {
+	tests := []struct {
+		name      string
+		connected time.Time
+		read      time.Time
+		want      float64
+	}{
+		{"30-day month, connected on the 1st", time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 4, 28, 0, 0, 0, 0, time.UTC), 1},
+		{"30-day month, connected mid-month", time.Date(2026, 4, 16, 9, 0, 0, 0, time.UTC), time.Date(2026, 4, 28, 0, 0, 0, 0, time.UTC), 15.0 / 30},
+		{"30-day month, connected on the last day", time.Date(2026, 4, 30, 9, 0, 0, 0, time.UTC), time.Date(2026, 4, 30, 17, 0, 0, 0, time.UTC), 1.0 / 30},
+		{"31-day month, connected on the 1st", time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 5, 28, 0, 0, 0, 0, time.UTC), 1},
+		{"31-day month, connected mid-month", time.Date(2026, 5, 20, 9, 0, 0, 0, time.UTC), time.Date(2026, 5, 28, 0, 0, 0, 0, time.UTC), 12.0 / 31},
+		{"31-day month, connected on the last day", time.Date(2026, 5, 31, 9, 0, 0, 0, time.UTC), time.Date(2026, 5, 31, 17, 0, 0, 0, time.UTC), 1.0 / 31},
+		{"connected in an earlier month", time.Date(2026, 3, 20, 9, 0, 0, 0, time.UTC), time.Date(2026, 5, 28, 0, 0, 0, 0, time.UTC), 1},
+		{"no connection date", time.Time{}, time.Date(2026, 5, 28, 0, 0, 0, 0, time.UTC), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prorationFactor(tt.connected, tt.read); got != tt.want {
+				t.Errorf("prorationFactor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareReadingProratesFixedCharge(t *testing.T) {
+	customer := &models.Customer{MeterNumber: "MTR001", ConnectionDate: time.Date(2026, 4, 16, 9, 0, 0, 0, time.UTC)}
+	request := &models.MeterReading{MeterNumber: "MTR001", CurrentReading: 5, ReadingType: "actual",
+		ReadingDate: time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC)}
+
+	reading, _, err := prepareReading(request, customer, nil, 300)
+	if err != nil {
+		t.Fatalf("prepareReading: %v", err)
+	}
+	if reading.FixedCharge != 150 || reading.Proration != 0.5 {
+		t.Errorf("fixed charge/proration = %v/%v, want 150/0.5", reading.FixedCharge, reading.Proration)
+	}
+	if bill := newBill(customer, reading, 0, nil); bill.Proration != 0.5 {
+		t.Errorf("bill proration = %v, want 0.5", bill.Proration)
+	}
+
+	// The next month is billed in full
+	request.ReadingDate = time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	reading, _, err = prepareReading(request, customer, nil, 300)
+	if err != nil {
+		t.Fatalf("prepareReading: %v", err)
+	}
+	if reading.FixedCharge != 300 || reading.Proration != 0 {
+		t.Errorf("second month fixed charge/proration = %v/%v, want 300/0", reading.FixedCharge, reading.Proration)
+	}
+}
+
+func TestStampPaymentFillsReceipt(t *testing.T) {
+	now := time.Now()
+
+	payment := &models.Payment{Amount: 500, PaymentMethod: "cash"}
+	stampPayment(payment, now)
+	if payment.ID.IsZero() || payment.ReceiptNumber == "" || payment.Status != "completed" || !payment.PaymentDate.Equal(now) {
+		t.Errorf("stamped payment = %+v, want ID, receipt number, completed status and today's date", payment)
+	}
+
+	given := &models.Payment{ReceiptNumber: "RCP-MANUAL-1", PaymentDate: now.AddDate(0, 0, -2)}
+	stampPayment(given, now)
+	if given.ReceiptNumber != "RCP-MANUAL-1" || given.PaymentDate.Equal(now) {
+		t.Errorf("stampPayment overwrote caller fields: %+v", given)
+	}
+
+	// The status is the server's, whatever the client sent
+	refunded := &models.Payment{Status: "refunded"}
+	stampPayment(refunded, now)
+	if refunded.Status != "completed" {
+		t.Errorf("status = %s, want completed", refunded.Status)
+	}
+}
+
+func TestConsumptionBands(t *testing.T) {
+	bands, boundaries, openEnded := consumptionBands(5, 12)
+	if openEnded || len(bands) != 3 || len(boundaries) != 4 {
+		t.Fatalf("got %d bands, %d boundaries, open-ended %v; want 3, 4, false", len(bands), len(boundaries), openEnded)
+	}
+	if bands[0].Label != "0-5" || bands[2].Label != "10-15" || boundaries[3] != 15 {
+		t.Errorf("bands = %s .. %s up to %v, want 0-5 .. 10-15 up to 15", bands[0].Label, bands[2].Label, boundaries[3])
+	}
+
+	// A consumption on a boundary starts the next band
+	if bands, _, _ := consumptionBands(5, 10); len(bands) != 3 {
+		t.Errorf("highest of 10 gave %d bands, want 3", len(bands))
+	}
+
+	bands, boundaries, openEnded = consumptionBands(1, 5000)
+	if !openEnded || len(bands) != maxConsumptionBands || len(boundaries) != maxConsumptionBands {
+		t.Fatalf("got %d bands, %d boundaries, open-ended %v; want %d, %d, true",
+			len(bands), len(boundaries), openEnded, maxConsumptionBands, maxConsumptionBands)
+	}
+	top := bands[len(bands)-1]
+	if top.Label != "49+" || top.Min != boundaries[len(boundaries)-1] || top.Max != 0 {
+		t.Errorf("top band = %+v, want open-ended 49+", top)
+	}
+}
+
+func TestReadingRollbackUpdate(t *testing.T) {
+	now := time.Now()
+	lastMonth := now.AddDate(0, -1, 0)
+	reading := &models.MeterReading{PreviousReading: 120, CurrentReading: 140, Consumption: 20}
+	previous := &models.MeterReading{CurrentReading: 120, ReadingDate: lastMonth}
+	average := 15.5
+
+	update := readingRollbackUpdate(reading, previous, 2000, &average, now)
+	inc, set := update["$inc"].(bson.M), update["$set"].(bson.M)
+	if inc["balance"] != -2000.0 || inc["total_consumed"] != -20.0 {
+		t.Errorf("$inc = %v, want balance -2000 and total_consumed -20", inc)
+	}
+	if set["last_reading"] != 120.0 || set["last_reading_date"] != lastMonth || set["average_consumption"] != 15.5 {
+		t.Errorf("$set = %v, want the previous reading, its date and the average without this reading", set)
+	}
+	if _, ok := update["$unset"]; ok {
+		t.Errorf("$unset = %v, want nothing unset", update["$unset"])
+	}
+
+	// Voiding a customer's only reading clears what it set
+	update = readingRollbackUpdate(reading, nil, 2000, nil, now)
+	unset, _ := update["$unset"].(bson.M)
+	if _, ok := unset["last_reading_date"]; !ok {
+		t.Errorf("first reading: $unset = %v, want last_reading_date cleared", unset)
+	}
+	if _, ok := unset["average_consumption"]; !ok {
+		t.Errorf("first reading: $unset = %v, want average_consumption cleared", unset)
+	}
+}
+
+func TestPaymentOnBill(t *testing.T) {
+	first, second, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	single := models.Payment{BillID: first, Amount: 800, CreditAmount: 300}
+	if got, ok := paymentOnBill(single, first); !ok || got.Amount != 800 {
+		t.Errorf("single-bill payment on its bill = %v/%v, want 800/true", got.Amount, ok)
+	}
+	if _, ok := paymentOnBill(single, other); ok {
+		t.Error("single-bill payment reported on another bill")
+	}
+
+	lump := models.Payment{BillID: first, Amount: 1500, CreditAmount: 200, Allocations: []models.PaymentAllocation{
+		{BillID: first, Amount: 1000},
+		{BillID: second, Amount: 300},
+	}}
+	for _, tt := range []struct {
+		bill primitive.ObjectID
+		want float64
+	}{{first, 1000}, {second, 300}} {
+		got, ok := paymentOnBill(lump, tt.bill)
+		if !ok || got.Amount != tt.want || got.BillID != tt.bill || got.CreditAmount != 0 {
+			t.Errorf("lump sum on %s = %v/%s/%v, want %v on that bill with no credit", tt.bill.Hex(), got.Amount, got.BillID.Hex(), got.CreditAmount, tt.want)
+		}
+	}
+	if _, ok := paymentOnBill(lump, other); ok {
+		t.Error("lump sum reported on a bill it did not pay")
+	}
+	if lump.Amount != 1500 {
+		t.Error("paymentOnBill changed the caller's payment")
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BulkReadingResult is a reading from a batch that was billed
+type BulkReadingResult struct {
+	Meter      string  `json:"meter"`
+	BillNumber string  `json:"bill_number"`
+	Amount     float64 `json:"amount"`
+}
+
+// BulkReadingError is a reading from a batch that was rejected, by its position in the batch
+type BulkReadingError struct {
+	Index int    `json:"index"`
+	Meter string `json:"meter"`
+	Error string `json:"error"`
+}
+
+// bulkReadingRow is a batch reading that passed validation and is waiting to be written
+type bulkReadingRow struct {
+	index    int
+	customer *models.Customer
+	reading  *models.MeterReading
+	bill     *models.Bill
+}
+
+// BulkSubmitReadings bills a batch of meter readings in a single session. Customers, previous
+// readings and tariffs are loaded with one query each and readings and bills are written with
+// InsertMany. A reading that fails is reported by its index without failing the rest of the batch.
+func (bs *BillingService) BulkSubmitReadings(ctx context.Context, readings []*models.MeterReading) ([]BulkReadingResult, []BulkReadingError) {
+	var results []BulkReadingResult
+	var failures []BulkReadingError
+
+	fail := func(index int, err error) {
+		failures = append(failures, BulkReadingError{
+			Index: index,
+			Meter: readings[index].MeterNumber,
+			Error: err.Error(),
+		})
+	}
+
+	session, err := bs.readingsCollection.StartSession()
+	if err != nil {
+		for i := range readings {
+			fail(i, fmt.Errorf("failed to start session: %v", err))
+		}
+		return results, failures
+	}
+	defer session.EndSession(context.Background())
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		// 1. A meter may appear once per batch; its previous reading would otherwise be stale
+		seen := make(map[string]bool)
+		var meters []string
+		var pending []int
+		for i, reading := range readings {
+			if seen[reading.MeterNumber] {
+				fail(i, fmt.Errorf("duplicate reading for meter %s in batch", reading.MeterNumber))
+				continue
+			}
+			seen[reading.MeterNumber] = true
+			meters = append(meters, reading.MeterNumber)
+			pending = append(pending, i)
+		}
+
+		// 2. Load customers, previous readings and tariffs for the whole batch
+		customers, err := bs.customersByMeter(sc, meters)
+		if err != nil {
+			for _, i := range pending {
+				fail(i, err)
+			}
+			return err
+		}
+
+		previousReadings, err := bs.previousReadingsByMeter(sc, meters)
+		if err != nil {
+			for _, i := range pending {
+				fail(i, err)
+			}
+			return err
+		}
+
+		tariffs, err := bs.tariffsByCode(sc, customers)
+		if err != nil {
+			for _, i := range pending {
+				fail(i, err)
+			}
+			return err
+		}
+
+		// 3. Validate each reading and prepare its bill
+		var rows []bulkReadingRow
+		for _, i := range pending {
+			customer, ok := customers[readings[i].MeterNumber]
+			if !ok {
+				fail(i, fmt.Errorf("customer with meter number %s not found", readings[i].MeterNumber))
+				continue
+			}
+
+			tariff := tariffs[customer.TariffCode]
+			reading, arrears, err := prepareReading(readings[i], customer, previousReadings[customer.MeterNumber],
+				fixedChargeFor(customer, tariff))
+			if err != nil {
+				fail(i, err)
+				continue
+			}
+
+			rows = append(rows, bulkReadingRow{
+				index:    i,
+				customer: customer,
+				reading:  reading,
+				bill:     newBill(customer, reading, arrears, tariff),
+			})
+		}
+
+		// 4. Write the batch in one transaction. If particular rows are rejected by the
+		// database, report them and retry with the rest; each retry drops at least one row.
+		for len(rows) > 0 {
+			rowErrors, err := bs.writeReadingBatch(sc, session, rows)
+			if err == nil {
+				break
+			}
+
+			if len(rowErrors) == 0 {
+				for _, row := range rows {
+					fail(row.index, err)
+				}
+				rows = nil
+				break
+			}
+
+			var remaining []bulkReadingRow
+			for position, row := range rows {
+				if rowErr, ok := rowErrors[position]; ok {
+					fail(row.index, rowErr)
+					continue
+				}
+				remaining = append(remaining, row)
+			}
+			rows = remaining
+		}
+
+		for _, row := range rows {
+			results = append(results, BulkReadingResult{
+				Meter:      row.customer.MeterNumber,
+				BillNumber: row.bill.BillNumber,
+				Amount:     row.bill.TotalAmount,
+			})
+
+			// Flagged readings are held for review instead of notifying the customer
+			if row.bill.Flagged {
+				utils.Logf(ctx, "⚠️ Bill %s flagged for review; customer not notified", row.bill.BillNumber)
+				continue
+			}
+			if row.customer.PhoneNumber != "" {
+				go bs.sendBillSMSNotification(row.bill, row.customer)
+			}
+			if row.customer.Email != "" && bs.emailService != nil {
+				go bs.sendBillEmailNotification(row.bill, row.customer)
+			}
+		}
+
+		return nil
+	})
+
+	return results, failures
+}
+
+// writeReadingBatch inserts the readings and bills for a batch and updates the customers in one
+// transaction. When the database rejects particular documents, the errors are returned keyed by
+// the row's position in rows so the caller can drop them and retry.
+func (bs *BillingService) writeReadingBatch(sc mongo.SessionContext, session mongo.Session,
+	rows []bulkReadingRow) (map[int]error, error) {
+
+	if err := session.StartTransaction(); err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	readingDocs := make([]interface{}, len(rows))
+	billDocs := make([]interface{}, len(rows))
+	customerIDs := make([]primitive.ObjectID, len(rows))
+	for i, row := range rows {
+		readingDocs[i] = row.reading
+		billDocs[i] = row.bill
+		customerIDs[i] = row.customer.ID
+	}
+
+	if _, err := bs.readingsCollection.InsertMany(sc, readingDocs); err != nil {
+		session.AbortTransaction(sc)
+		rowErrors := writeErrorsByIndex(err, "failed to save meter reading")
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			for _, writeErr := range bulkErr.WriteErrors {
+				if writeErr.Code == 11000 {
+					reading := rows[writeErr.Index].reading
+					rowErrors[writeErr.Index] = duplicateReadingError(reading.MeterNumber, reading.ReadingDate)
+				}
+			}
+		}
+		return rowErrors, fmt.Errorf("failed to save meter readings: %v", err)
+	}
+
+	if _, err := bs.billsCollection.InsertMany(sc, billDocs); err != nil {
+		session.AbortTransaction(sc)
+		return writeErrorsByIndex(err, "failed to create bill"), fmt.Errorf("failed to create bills: %v", err)
+	}
+
+	// Averages include the readings just inserted
+	averages, err := bs.averageConsumptions(sc, customerIDs)
+	if err != nil {
+		session.AbortTransaction(sc)
+		return nil, err
+	}
+
+	updates := make([]mongo.WriteModel, len(rows))
+	for i, row := range rows {
+		var average *float64
+		if value, ok := averages[row.customer.ID]; ok {
+			average = &value
+		}
+
+		update := customerBillingUpdate(row.reading, row.bill.TotalAmount, average)
+		updates[i] = mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": row.customer.ID}).SetUpdate(update)
+	}
+
+	if _, err := bs.customersCollection.BulkWrite(sc, updates); err != nil {
+		session.AbortTransaction(sc)
+		return writeErrorsByIndex(err, "failed to update customer"), fmt.Errorf("failed to update customers: %v", err)
+	}
+
+	if err := session.CommitTransaction(sc); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil, nil
+}
+
+// writeErrorsByIndex maps the per-document errors of a failed InsertMany or BulkWrite to the
+// index of the document that caused them. Returns nil for errors not tied to a document.
+func writeErrorsByIndex(err error, prefix string) map[int]error {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 {
+		return nil
+	}
+
+	rowErrors := make(map[int]error, len(bulkErr.WriteErrors))
+	for _, writeErr := range bulkErr.WriteErrors {
+		rowErrors[writeErr.Index] = fmt.Errorf("%s: %s", prefix, writeErr.Message)
+	}
+	return rowErrors
+}
+
+// customersByMeter loads the customers for a set of meter numbers, keyed by meter number
+func (bs *BillingService) customersByMeter(sc mongo.SessionContext, meters []string) (map[string]*models.Customer, error) {
+	cursor, err := bs.customersCollection.Find(sc, bson.M{"meter_number": bson.M{"$in": meters}})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching customers: %v", err)
+	}
+	defer cursor.Close(sc)
+
+	var customers []models.Customer
+	if err = cursor.All(sc, &customers); err != nil {
+		return nil, fmt.Errorf("error decoding customers: %v", err)
+	}
+
+	byMeter := make(map[string]*models.Customer, len(customers))
+	for i := range customers {
+		byMeter[customers[i].MeterNumber] = &customers[i]
+	}
+	return byMeter, nil
+}
+
+// previousReadingsByMeter returns the latest non-cancelled reading for each meter, keyed by
+// meter number. Meters without a reading yet are left out.
+func (bs *BillingService) previousReadingsByMeter(sc mongo.SessionContext, meters []string) (map[string]*models.MeterReading, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"meter_number": bson.M{"$in": meters},
+			"status":       bson.M{"$ne": "cancelled"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"reading_date": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$meter_number",
+			"reading": bson.M{"$first": "$$ROOT"},
+		}}},
+	}
+
+	cursor, err := bs.readingsCollection.Aggregate(sc, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching previous readings: %v", err)
+	}
+	defer cursor.Close(sc)
+
+	var latest []struct {
+		MeterNumber string              `bson:"_id"`
+		Reading     models.MeterReading `bson:"reading"`
+	}
+	if err = cursor.All(sc, &latest); err != nil {
+		return nil, fmt.Errorf("error decoding previous readings: %v", err)
+	}
+
+	byMeter := make(map[string]*models.MeterReading, len(latest))
+	for i := range latest {
+		byMeter[latest[i].MeterNumber] = &latest[i].Reading
+	}
+	return byMeter, nil
+}
+
+// tariffsByCode returns the active tariffs used by the customers, keyed by tariff code
+func (bs *BillingService) tariffsByCode(sc mongo.SessionContext, customers map[string]*models.Customer) (map[string]*models.Tariff, error) {
+	var codes []string
+	for _, customer := range customers {
+		if customer.TariffCode != "" {
+			codes = append(codes, customer.TariffCode)
+		}
+	}
+
+	byCode := make(map[string]*models.Tariff)
+	if len(codes) == 0 {
+		return byCode, nil
+	}
+
+	cursor, err := bs.tariffsCollection.Find(sc, bson.M{
+		"code":      bson.M{"$in": codes},
+		"is_active": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tariffs: %v", err)
+	}
+	defer cursor.Close(sc)
+
+	var tariffs []models.Tariff
+	if err = cursor.All(sc, &tariffs); err != nil {
+		return nil, fmt.Errorf("error decoding tariffs: %v", err)
+	}
+
+	for i := range tariffs {
+		byCode[tariffs[i].Code] = &tariffs[i]
+	}
+	return byCode, nil
+}
+
+// averageConsumptions is averageConsumption for several customers in one aggregation, keyed by
+// customer ID. Customers without any actual readings are left out.
+func (bs *BillingService) averageConsumptions(sc mongo.SessionContext, customerIDs []primitive.ObjectID) (map[primitive.ObjectID]float64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"customer_id":  bson.M{"$in": customerIDs},
+			"reading_type": bson.M{"$ne": "estimated"},
+			"status":       bson.M{"$ne": "cancelled"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"reading_date": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          "$customer_id",
+			"consumptions": bson.M{"$push": "$consumption"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"average": bson.M{"$avg": bson.M{"$slice": bson.A{"$consumptions", averageWindow}}},
+		}}},
+	}
+
+	cursor, err := bs.readingsCollection.Aggregate(sc, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reading history: %v", err)
+	}
+	defer cursor.Close(sc)
+
+	var rows []struct {
+		CustomerID primitive.ObjectID `bson:"_id"`
+		Average    float64            `bson:"average"`
+	}
+	if err = cursor.All(sc, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding reading history: %v", err)
+	}
+
+	averages := make(map[primitive.ObjectID]float64, len(rows))
+	for _, row := range rows {
+		averages[row.CustomerID] = utils.RoundToTwoDecimal(row.Average)
+	}
+	return averages, nil
+}
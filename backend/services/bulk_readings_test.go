@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestWriteErrorsByIndex(t *testing.T) {
+	err := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 2, Code: 11000, Message: "duplicate key"}},
+		{WriteError: mongo.WriteError{Index: 0, Code: 121, Message: "validation failed"}},
+	}}
+
+	rowErrors := writeErrorsByIndex(fmt.Errorf("insert: %w", err), "failed to create bill")
+	if len(rowErrors) != 2 {
+		t.Fatalf("rowErrors = %v, want errors for rows 0 and 2", rowErrors)
+	}
+	if got := rowErrors[2].Error(); got != "failed to create bill: duplicate key" {
+		t.Errorf("row 2 error = %q", got)
+	}
+	if _, ok := rowErrors[1]; ok {
+		t.Error("row 1 had no write error but was reported")
+	}
+
+	// Errors not tied to a document leave the caller to fail the whole batch
+	if rowErrors := writeErrorsByIndex(errors.New("connection reset"), "failed"); rowErrors != nil {
+		t.Errorf("plain error: rowErrors = %v, want nil", rowErrors)
+	}
+}
+
+func TestBulkSubmitReadings(t *testing.T) {
+	bs, _, db := newTestBillingService(t)
+	first := insertTestCustomer(t, db, "MTR00000101", 10, 300)
+	second := insertTestCustomer(t, db, "MTR00000102", 500, 0)
+
+	now := time.Now()
+	readings := []*models.MeterReading{
+		{MeterNumber: first.MeterNumber, CurrentReading: 25, ReadingDate: now, ReadingType: "actual"},
+		{MeterNumber: second.MeterNumber, CurrentReading: 400, ReadingDate: now, ReadingType: "actual"}, // Backwards
+		{MeterNumber: "MTR00000404", CurrentReading: 10, ReadingDate: now, ReadingType: "actual"},       // Unknown meter
+		{MeterNumber: first.MeterNumber, CurrentReading: 30, ReadingDate: now, ReadingType: "actual"},   // Repeated in batch
+	}
+
+	results, failures := bs.BulkSubmitReadings(context.Background(), readings)
+	if len(results) != 1 || results[0].Meter != first.MeterNumber {
+		t.Fatalf("results = %+v, want only %s billed", results, first.MeterNumber)
+	}
+
+	wantErrors := map[int]string{1: "cannot be less than previous reading", 2: "not found", 3: "duplicate reading"}
+	if len(failures) != len(wantErrors) {
+		t.Fatalf("failures = %+v, want %d", failures, len(wantErrors))
+	}
+	for _, failure := range failures {
+		if want, ok := wantErrors[failure.Index]; !ok || !strings.Contains(failure.Error, want) {
+			t.Errorf("failure at %d = %q, want %q", failure.Index, failure.Error, want)
+		}
+	}
+
+	// The bill is added to what was already owed
+	charge := 15 * company.RatePerUnit
+	if updated := findTestCustomer(t, db, first.ID); updated.Balance != 300+charge || updated.LastReading != 25 || updated.TotalConsumed != 15 {
+		t.Errorf("customer balance/last reading/total = %v/%v/%v, want %v/25/15",
+			updated.Balance, updated.LastReading, updated.TotalConsumed, 300+charge)
+	}
+	if updated := findTestCustomer(t, db, second.ID); updated.Balance != 0 || updated.LastReading != 500 {
+		t.Errorf("rejected customer balance/last reading = %v/%v, want unchanged", updated.Balance, updated.LastReading)
+	}
+}
+
+// benchmarkReadingBatch is the size of the batches BenchmarkBulkSubmitReadings submits
+const benchmarkReadingBatch = 100
+
+// BenchmarkBulkSubmitReadings compares a batch written with BulkSubmitReadings against the same
+// readings submitted one at a time:
+//
+//	MONGODB_TEST_URI=... go test ./services/ -run '^$' -bench BulkSubmitReadings
+func BenchmarkBulkSubmitReadings(b *testing.B) {
+	bs, _, db := newTestBillingService(b)
+
+	batch := 0
+	newBatch := func() []*models.MeterReading {
+		batch++
+		readings := make([]*models.MeterReading, benchmarkReadingBatch)
+		for i := range readings {
+			meter := fmt.Sprintf("MTR%04d%04d", batch, i)
+			insertTestCustomer(b, db, meter, 0, 0)
+			readings[i] = &models.MeterReading{MeterNumber: meter, CurrentReading: 20, ReadingDate: time.Now(), ReadingType: "actual"}
+		}
+		return readings
+	}
+
+	b.Run("bulk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			readings := newBatch()
+			b.StartTimer()
+
+			if _, failures := bs.BulkSubmitReadings(context.Background(), readings); len(failures) > 0 {
+				b.Fatalf("BulkSubmitReadings: %+v", failures[0])
+			}
+		}
+	})
+
+	b.Run("one at a time", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			readings := newBatch()
+			b.StartTimer()
+
+			for _, reading := range readings {
+				if _, err := bs.SubmitMeterReading(context.Background(), reading); err != nil {
+					b.Fatalf("SubmitMeterReading: %v", err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeCustomers is a Collection serving FindOne from a map keyed by meter number. Other
+// methods are left to the embedded nil Collection and panic if a test reaches them.
+type fakeCustomers struct {
+	Collection
+	byMeter map[string]models.Customer
+}
+
+func (f fakeCustomers) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	meter, _ := filter.(bson.M)["meter_number"].(string)
+	customer, ok := f.byMeter[meter]
+	if !ok {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(customer, nil, nil)
+}
+
+func TestWrapCollectionKeepsNil(t *testing.T) {
+	if wrapCollection(nil) != nil {
+		t.Error("wrapCollection(nil) should be a nil Collection")
+	}
+}
+
+func TestWrappedCollectionStartsSession(t *testing.T) {
+	// Connect does not dial, and sessions are created client-side, so no server is needed
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := wrapCollection(client.Database("waterbilling").Collection("bills"))
+	session, err := collection.StartSession()
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	session.EndSession(context.Background())
+}
+
+func TestBillingServiceWithFakeCollection(t *testing.T) {
+	bs := &BillingService{customersCollection: fakeCustomers{byMeter: map[string]models.Customer{
+		"MTR001": {MeterNumber: "MTR001", FirstName: "Jane", LastName: "Wanjiru", Balance: 250},
+	}}}
+
+	customer, err := bs.GetCustomerByMeterNumber(context.Background(), "MTR001")
+	if err != nil {
+		t.Fatalf("GetCustomerByMeterNumber: %v", err)
+	}
+	if customer.FullName() != "Jane Wanjiru" || customer.AmountOwed() != 250 {
+		t.Errorf("customer = %s owing %v, want Jane Wanjiru owing 250", customer.FullName(), customer.AmountOwed())
+	}
+
+	if _, err := bs.GetCustomerByMeterNumber(context.Background(), "MTR404"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("unknown meter: err = %v, want not found", err)
+	}
+}
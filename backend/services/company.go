@@ -0,0 +1,52 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+// CompanyConfig holds the company details printed on bills and in customer messages
+type CompanyConfig struct {
+	Name         string
+	Paybill      string  // M-Pesa paybill customers pay to, with their meter number as the account
+	SupportPhone string  // Number customers are told to call
+	RatePerUnit  float64 // KSh per unit of water consumed
+}
+
+// company is the active configuration. It holds the built-in defaults until LoadCompanyConfig runs.
+var company = CompanyConfig{
+	Name:         "Rochi Pure Water",
+	Paybill:      "123456",
+	SupportPhone: "0700 000 000",
+	RatePerUnit:  100,
+}
+
+// LoadCompanyConfig reads COMPANY_NAME, MPESA_PAYBILL, SUPPORT_PHONE and RATE_PER_UNIT, keeping
+// the default for any that are unset, and makes the result the active configuration.
+// It is called once at startup, before any requests are served.
+func LoadCompanyConfig() CompanyConfig {
+	config := company
+
+	if v := os.Getenv("COMPANY_NAME"); v != "" {
+		config.Name = v
+	}
+	if v := os.Getenv("MPESA_PAYBILL"); v != "" {
+		config.Paybill = v
+	}
+	if v := os.Getenv("SUPPORT_PHONE"); v != "" {
+		config.SupportPhone = v
+	}
+	if v := os.Getenv("RATE_PER_UNIT"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 {
+			log.Printf("⚠️ Ignoring invalid RATE_PER_UNIT %q; using KSh %.2f", v, config.RatePerUnit)
+		} else {
+			config.RatePerUnit = rate
+		}
+	}
+
+	company = config
+	log.Printf("✅ Company settings: %s, paybill %s, KSh %.2f per unit", config.Name, config.Paybill, config.RatePerUnit)
+	return config
+}
@@ -2,9 +2,16 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"waterbilling/backend/database"
 	"waterbilling/backend/models"
 	"waterbilling/backend/utils"
 
@@ -15,20 +22,24 @@ import (
 )
 
 type CustomerService struct {
-	customersCollection *mongo.Collection
-	tariffsCollection   *mongo.Collection
+	customersCollection Collection
+	tariffsCollection   Collection
+	billsCollection     Collection
+	smsService          *SMSService
 }
 
-func NewCustomerService(customers, tariffs *mongo.Collection) *CustomerService {
+func NewCustomerService(customers, tariffs, bills *mongo.Collection, smsService *SMSService) *CustomerService {
 	return &CustomerService{
-		customersCollection: customers,
-		tariffsCollection:   tariffs,
+		customersCollection: wrapCollection(customers),
+		tariffsCollection:   wrapCollection(tariffs),
+		billsCollection:     wrapCollection(bills),
+		smsService:          smsService,
 	}
 }
 
 // CreateCustomer creates a new customer
-func (cs *CustomerService) CreateCustomer(customer *models.Customer) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (cs *CustomerService) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Validate meter number
@@ -37,7 +48,14 @@ func (cs *CustomerService) CreateCustomer(customer *models.Customer) error {
 	}
 
 	// Format phone number
-	customer.PhoneNumber = utils.FormatPhoneNumber(customer.PhoneNumber)
+	phone, err := utils.FormatPhoneNumber(customer.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if err := utils.ValidatePhoneNumber(phone); err != nil {
+		return err
+	}
+	customer.PhoneNumber = phone
 
 	// Set default values
 	if customer.ConnectionDate.IsZero() {
@@ -65,13 +83,31 @@ func (cs *CustomerService) CreateCustomer(customer *models.Customer) error {
 	customer.ID = primitive.NewObjectID()
 
 	// Check if meter number already exists
-	existing, _ := cs.GetCustomerByMeterNumber(customer.MeterNumber)
+	existing, _ := cs.GetCustomerByMeterNumber(ctx, customer.MeterNumber)
 	if existing != nil {
 		return fmt.Errorf("customer with meter number %s already exists", customer.MeterNumber)
 	}
 
-	// Insert customer
-	_, err := cs.customersCollection.InsertOne(ctx, customer)
+	// One phone per customer unless shared household phones are allowed
+	if !database.AllowSharedPhone() {
+		var holder models.Customer
+		err = cs.customersCollection.FindOne(ctx, bson.M{"phone_number": customer.PhoneNumber}).Decode(&holder)
+		if err == nil {
+			return fmt.Errorf("phone number %s is already registered to meter %s", customer.PhoneNumber, holder.MeterNumber)
+		}
+		if err != mongo.ErrNoDocuments {
+			return fmt.Errorf("error checking phone number: %v", err)
+		}
+	}
+
+	// Insert customer; the unique indexes catch duplicates the check above missed
+	_, err = cs.customersCollection.InsertOne(ctx, customer)
+	if field, ok := utils.IsDuplicateKeyError(err); ok {
+		if field == "meter number" {
+			return fmt.Errorf("customer with meter number %s already exists", customer.MeterNumber)
+		}
+		return fmt.Errorf("customer with this %s already exists", field)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create customer: %v", err)
 	}
@@ -80,8 +116,8 @@ func (cs *CustomerService) CreateCustomer(customer *models.Customer) error {
 }
 
 // GetCustomerByMeterNumber retrieves customer by meter number
-func (cs *CustomerService) GetCustomerByMeterNumber(meterNumber string) (*models.Customer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (cs *CustomerService) GetCustomerByMeterNumber(ctx context.Context, meterNumber string) (*models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var customer models.Customer
@@ -97,8 +133,8 @@ func (cs *CustomerService) GetCustomerByMeterNumber(meterNumber string) (*models
 }
 
 // UpdateCustomer updates customer information
-func (cs *CustomerService) UpdateCustomer(meterNumber string, updates map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (cs *CustomerService) UpdateCustomer(ctx context.Context, meterNumber string, updates map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Remove fields that shouldn't be updated
@@ -108,7 +144,14 @@ func (cs *CustomerService) UpdateCustomer(meterNumber string, updates map[string
 
 	// Format phone number if being updated
 	if phone, ok := updates["phone_number"].(string); ok {
-		updates["phone_number"] = utils.FormatPhoneNumber(phone)
+		formatted, err := utils.FormatPhoneNumber(phone)
+		if err != nil {
+			return err
+		}
+		if err := utils.ValidatePhoneNumber(formatted); err != nil {
+			return err
+		}
+		updates["phone_number"] = formatted
 	}
 
 	updates["updated_at"] = time.Now()
@@ -120,6 +163,9 @@ func (cs *CustomerService) UpdateCustomer(meterNumber string, updates map[string
 		update,
 	)
 
+	if field, ok := utils.IsDuplicateKeyError(err); ok {
+		return fmt.Errorf("customer with this %s already exists", field)
+	}
 	if err != nil {
 		return fmt.Errorf("error updating customer: %v", err)
 	}
@@ -131,17 +177,67 @@ func (cs *CustomerService) UpdateCustomer(meterNumber string, updates map[string
 	return nil
 }
 
+// maxSearchResults caps how many customers a search returns
+const maxSearchResults = 100
+
+// isIdentifierFragment reports whether a search term looks like the start of a meter or account
+// number, such as "MTR-00": a single word containing a digit. Long all-digit terms are treated as
+// phone numbers.
+func isIdentifierFragment(term string) bool {
+	if term == "" || len(term) > 20 {
+		return false
+	}
+
+	hasDigit, allDigits := false, true
+	for _, r := range term {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsLetter(r), r == '-', r == '_', r == '/':
+			allDigits = false
+		default:
+			return false
+		}
+	}
+
+	return hasDigit && !(allDigits && len(term) >= 9)
+}
+
+// identifierPrefixFilter matches meter or account numbers starting with prefix. The patterns are
+// anchored and case-sensitive so they can use the unique indexes; an upper-cased variant covers
+// fragments typed in lower case.
+func identifierPrefixFilter(prefix string) []bson.M {
+	prefixes := []string{prefix}
+	if upper := strings.ToUpper(prefix); upper != prefix {
+		prefixes = append(prefixes, upper)
+	}
+
+	var clauses []bson.M
+	for _, p := range prefixes {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(p)}
+		clauses = append(clauses,
+			bson.M{"meter_number": pattern},
+			bson.M{"account_number": pattern},
+		)
+	}
+	return clauses
+}
+
 // SearchCustomers searches customers by various criteria
-func (cs *CustomerService) SearchCustomers(searchTerm string, zone string, status string,
-	customerType string, limit int64) ([]models.Customer, error) {
+func (cs *CustomerService) SearchCustomers(ctx context.Context, searchTerm string, zone string, status string,
+	customerType string, includeArchived bool, limit int64) ([]models.Customer, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{}
+	sort := bson.M{"first_name": 1}
 
-	// Text search
-	if searchTerm != "" {
+	// Meter and account fragments match by prefix, which $text can't do; names and phones use $text
+	if prefix := strings.TrimSpace(searchTerm); isIdentifierFragment(prefix) {
+		filter["$or"] = identifierPrefixFilter(prefix)
+		sort = bson.M{"meter_number": 1}
+	} else if searchTerm != "" {
 		filter["$text"] = bson.M{"$search": searchTerm}
 	}
 
@@ -150,9 +246,11 @@ func (cs *CustomerService) SearchCustomers(searchTerm string, zone string, statu
 		filter["zone"] = zone
 	}
 
-	// Filter by status
+	// Filter by status, hiding archived customers unless asked for
 	if status != "" {
 		filter["status"] = status
+	} else if !includeArchived {
+		filter["status"] = bson.M{"$ne": "archived"}
 	}
 
 	// Filter by customer type
@@ -160,11 +258,10 @@ func (cs *CustomerService) SearchCustomers(searchTerm string, zone string, statu
 		filter["customer_type"] = customerType
 	}
 
-	opts := options.Find()
-	if limit > 0 {
-		opts.SetLimit(limit)
+	if limit <= 0 || limit > maxSearchResults {
+		limit = maxSearchResults
 	}
-	opts.SetSort(bson.M{"first_name": 1})
+	opts := options.Find().SetLimit(limit).SetSort(sort)
 
 	cursor, err := cs.customersCollection.Find(ctx, filter, opts)
 	if err != nil {
@@ -180,14 +277,19 @@ func (cs *CustomerService) SearchCustomers(searchTerm string, zone string, statu
 	return customers, nil
 }
 
-// GetCustomersByZone gets all customers in a specific zone
-func (cs *CustomerService) GetCustomersByZone(zone string) ([]models.Customer, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// GetCustomersByZone gets all active customers in a specific zone, optionally including archived ones
+func (cs *CustomerService) GetCustomersByZone(ctx context.Context, zone string, includeArchived bool) ([]models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	filter := bson.M{"zone": zone, "status": "active"}
+	if includeArchived {
+		filter["status"] = bson.M{"$in": []string{"active", "archived"}}
+	}
+
 	cursor, err := cs.customersCollection.Find(
 		ctx,
-		bson.M{"zone": zone, "status": "active"},
+		filter,
 		options.Find().SetSort(bson.M{"meter_number": 1}),
 	)
 	if err != nil {
@@ -203,9 +305,10 @@ func (cs *CustomerService) GetCustomersByZone(zone string) ([]models.Customer, e
 	return customers, nil
 }
 
-// UpdateCustomerStatus updates customer status
-func (cs *CustomerService) UpdateCustomerStatus(meterNumber string, status string, reason string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// UpdateCustomerStatus updates customer status. A disconnected customer is not made active here:
+// reconnection goes through ReconnectCustomer, which checks the outstanding balance.
+func (cs *CustomerService) UpdateCustomerStatus(ctx context.Context, meterNumber string, status string, reason string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	update := bson.M{
@@ -223,14 +326,44 @@ func (cs *CustomerService) UpdateCustomerStatus(meterNumber string, status strin
 		update["$set"].(bson.M)["reconnection_date"] = &now
 	}
 
+	filter := bson.M{"meter_number": meterNumber}
+	if status == "active" {
+		filter["status"] = bson.M{"$ne": "disconnected"}
+	}
+
+	result, err := cs.customersCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error updating customer status: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		if status == "active" {
+			count, err := cs.customersCollection.CountDocuments(ctx, bson.M{"meter_number": meterNumber})
+			if err != nil {
+				return fmt.Errorf("error checking customer: %v", err)
+			}
+			if count > 0 {
+				return errors.New("customer is disconnected and must be reconnected")
+			}
+		}
+		return fmt.Errorf("customer with meter number %s not found", meterNumber)
+	}
+
+	return nil
+}
+
+// SetSMSOptOut records whether a customer wants SMS notifications
+func (cs *CustomerService) SetSMSOptOut(ctx context.Context, meterNumber string, optOut bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
 	result, err := cs.customersCollection.UpdateOne(
 		ctx,
 		bson.M{"meter_number": meterNumber},
-		update,
+		bson.M{"$set": bson.M{"sms_opt_out": optOut, "updated_at": time.Now()}},
 	)
-
 	if err != nil {
-		return fmt.Errorf("error updating customer status: %v", err)
+		return fmt.Errorf("error updating SMS preferences: %v", err)
 	}
 
 	if result.MatchedCount == 0 {
@@ -240,9 +373,72 @@ func (cs *CustomerService) UpdateCustomerStatus(meterNumber string, status strin
 	return nil
 }
 
+// OutstandingBalanceError is returned when a customer still owes more than the reconnection threshold
+type OutstandingBalanceError struct {
+	Balance   float64
+	Threshold float64
+}
+
+func (e *OutstandingBalanceError) Error() string {
+	return fmt.Sprintf("outstanding balance of KSh %.2f must be cleared before reconnection", e.Balance)
+}
+
+// ReconnectCustomer restores supply to a disconnected customer whose balance is at or below
+// RECONNECTION_BALANCE_THRESHOLD (default 0) and sends the reconnection notice
+func (cs *CustomerService) ReconnectCustomer(ctx context.Context, meterNumber string) (*models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	customer, err := cs.GetCustomerByMeterNumber(ctx, meterNumber)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, fmt.Errorf("customer with meter number %s not found", meterNumber)
+	}
+
+	if customer.Status != "disconnected" {
+		return nil, fmt.Errorf("customer is %s, not disconnected", customer.Status)
+	}
+
+	threshold := 0.0
+	if v, err := strconv.ParseFloat(os.Getenv("RECONNECTION_BALANCE_THRESHOLD"), 64); err == nil && v >= 0 {
+		threshold = v
+	}
+	if customer.Balance > threshold {
+		return nil, &OutstandingBalanceError{Balance: customer.Balance, Threshold: threshold}
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":            "active",
+			"reconnection_date": now,
+			"updated_at":        now,
+		},
+		"$unset": bson.M{"disconnection_reason": ""},
+	}
+
+	if _, err := cs.customersCollection.UpdateByID(ctx, customer.ID, update); err != nil {
+		return nil, fmt.Errorf("error reconnecting customer: %v", err)
+	}
+
+	customer.Status = "active"
+	customer.ReconnectionDate = &now
+	customer.DisconnectionReason = ""
+
+	if cs.smsService != nil && customer.PhoneNumber != "" {
+		if err := cs.smsService.SendReconnectionNotice(customer); err != nil && !errors.Is(err, ErrSMSOptedOut) {
+			utils.Logf(ctx, "⚠️ Failed to send reconnection notice to %s: %v", customer.PhoneNumber, err)
+		}
+	}
+
+	return customer, nil
+}
+
 // GetCustomerStatistics returns customer statistics
-func (cs *CustomerService) GetCustomerStatistics() (*CustomerStatistics, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (cs *CustomerService) GetCustomerStatistics(ctx context.Context) (*CustomerStatistics, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Total customers
@@ -288,26 +484,7 @@ func (cs *CustomerService) GetCustomerStatistics() (*CustomerStatistics, error)
 		return nil, fmt.Errorf("error decoding customer types: %v", err)
 	}
 
-	customerTypes := make(map[string]int64)
-	for _, result := range typeResults {
-		id, ok := result["_id"].(string)
-		if !ok {
-			continue
-		}
-
-		// FIXED: Handle MongoDB numeric types
-		switch v := result["count"].(type) {
-		case int32:
-			customerTypes[id] = int64(v)
-		case int64:
-			customerTypes[id] = v
-		case float64:
-			customerTypes[id] = int64(v)
-		default:
-			customerTypes[id] = 0
-			fmt.Printf("Warning: unexpected type for count: %T\n", v)
-		}
-	}
+	customerTypes := countBuckets(typeResults)
 
 	// Customers by zone
 	zonePipeline := mongo.Pipeline{
@@ -330,73 +507,119 @@ func (cs *CustomerService) GetCustomerStatistics() (*CustomerStatistics, error)
 		return nil, fmt.Errorf("error decoding zones: %v", err)
 	}
 
-	topZones := make(map[string]int64)
-	for _, result := range zoneResults {
-		id, ok := result["_id"].(string)
-		if !ok {
-			continue
+	topZones := countBuckets(zoneResults)
+
+	balances, err := cs.balanceTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CustomerStatistics{
+		Total:          total,
+		Active:         active,
+		Inactive:       inactive,
+		Disconnected:   disconnected,
+		CustomerTypes:  customerTypes,
+		TopZones:       topZones,
+		TotalArrears:   utils.RoundToTwoDecimal(balances.Arrears),
+		TotalCredit:    utils.RoundToTwoDecimal(balances.Credit),
+		AverageBalance: utils.RoundToTwoDecimal(balances.Average),
+		InArrears:      balances.InArrears,
+	}, nil
+}
+
+// customerBalances are customer balances summed across the book
+type customerBalances struct {
+	Arrears   float64 `bson:"arrears"`
+	Credit    float64 `bson:"credit"`
+	Average   float64 `bson:"average"`
+	InArrears int64   `bson:"in_arrears"`
+}
+
+// balanceTotals sums customer balances. A positive balance is owed and a negative one credit, so
+// credit is negated to give it as a positive figure.
+func (cs *CustomerService) balanceTotals(ctx context.Context) (customerBalances, error) {
+	owing := bson.M{"$gt": bson.A{"$balance", 0}}
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"arrears":    bson.M{"$sum": bson.M{"$cond": bson.A{owing, "$balance", 0}}},
+			"credit":     bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$balance", 0}}, bson.M{"$multiply": bson.A{"$balance", -1}}, 0}}},
+			"average":    bson.M{"$avg": "$balance"},
+			"in_arrears": bson.M{"$sum": bson.M{"$cond": bson.A{owing, 1, 0}}},
+		}}},
+	}
+
+	var totals customerBalances
+
+	cursor, err := cs.customersCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return totals, fmt.Errorf("error aggregating balances: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	// No customers means no group document, and zero totals
+	if cursor.Next(ctx) {
+		if err = cursor.Decode(&totals); err != nil {
+			return totals, fmt.Errorf("error decoding balances: %v", err)
 		}
+	}
+	return totals, cursor.Err()
+}
 
-		// FIXED: Handle MongoDB numeric types
+// unassignedBucket groups customers with no value for the field being counted
+const unassignedBucket = "Unassigned"
+
+// countBuckets turns {_id, count} group results into a map. A missing or empty group key is
+// counted under "Unassigned", and the count may come back as any numeric BSON type.
+func countBuckets(results []bson.M) map[string]int64 {
+	buckets := make(map[string]int64, len(results))
+	for _, result := range results {
+		key, _ := result["_id"].(string)
+		if key == "" {
+			key = unassignedBucket
+		}
+
+		var count int64
 		switch v := result["count"].(type) {
 		case int32:
-			topZones[id] = int64(v)
+			count = int64(v)
 		case int64:
-			topZones[id] = v
+			count = v
 		case float64:
-			topZones[id] = int64(v)
-		default:
-			topZones[id] = 0
-			fmt.Printf("Warning: unexpected type for count in zones: %T\n", v)
+			count = int64(v)
 		}
+		buckets[key] += count
 	}
-
-	return &CustomerStatistics{
-		Total:         total,
-		Active:        active,
-		Inactive:      inactive,
-		Disconnected:  disconnected,
-		CustomerTypes: customerTypes,
-		TopZones:      topZones,
-	}, nil
+	return buckets
 }
 
-// GetCustomers retrieves all customers with pagination
-func (cs *CustomerService) GetCustomers(ctx context.Context, filter bson.M, page, limit int) ([]models.Customer, int64, error) {
-	// Validate pagination parameters
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 {
-		limit = 20
-	}
-	if limit > 100 {
-		limit = 100
+// ListCustomers retrieves customers matching filter with pagination and sorting
+func (cs *CustomerService) ListCustomers(ctx context.Context, filter bson.M, sort bson.D, page, limit int64) ([]models.Customer, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
 	}
 
-	// Calculate skip for pagination
 	skip := (page - 1) * limit
-
-	// Set options with pagination and sorting
 	opts := options.Find().
-		SetSkip(int64(skip)).
-		SetLimit(int64(limit)).
-		SetSort(bson.M{"created_at": -1})
+		SetSkip(skip).
+		SetLimit(limit).
+		SetSort(sort)
 
-	// Execute query - FIXED: Use customersCollection instead of collection
 	cursor, err := cs.customersCollection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error fetching customers: %v", err)
 	}
 	defer cursor.Close(ctx)
 
-	// Decode results
 	var customers []models.Customer
 	if err = cursor.All(ctx, &customers); err != nil {
 		return nil, 0, fmt.Errorf("error decoding customers: %v", err)
 	}
 
-	// Get total count for pagination - FIXED: Use customersCollection instead of collection
 	total, err := cs.customersCollection.CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error counting customers: %v", err)
@@ -405,13 +628,43 @@ func (cs *CustomerService) GetCustomers(ctx context.Context, filter bson.M, page
 	return customers, total, nil
 }
 
-// DeleteCustomer removes a customer by meter number
-func (cs *CustomerService) DeleteCustomer(meterNumber string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// StreamCustomers calls fn for each customer matching filter, reading from a cursor so large
+// exports are never held in memory. Iteration stops at the first error fn returns.
+func (cs *CustomerService) StreamCustomers(ctx context.Context, filter bson.M, sort bson.D, fn func(*models.Customer) error) error {
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+
+	cursor, err := cs.customersCollection.Find(ctx, filter, options.Find().SetSort(sort).SetBatchSize(500))
+	if err != nil {
+		return fmt.Errorf("error fetching customers: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var customer models.Customer
+		if err := cursor.Decode(&customer); err != nil {
+			return fmt.Errorf("error decoding customer: %v", err)
+		}
+		if err := fn(&customer); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("error reading customers: %v", err)
+	}
+	return nil
+}
+
+// ArchiveCustomer soft-deletes a customer by marking them archived.
+// Customers with unpaid bills are only archived when force is set.
+func (cs *CustomerService) ArchiveCustomer(ctx context.Context, meterNumber, reason string, force bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// First, check if customer exists
-	customer, err := cs.GetCustomerByMeterNumber(meterNumber)
+	customer, err := cs.GetCustomerByMeterNumber(ctx, meterNumber)
 	if err != nil {
 		return fmt.Errorf("error checking customer: %v", err)
 	}
@@ -419,15 +672,51 @@ func (cs *CustomerService) DeleteCustomer(meterNumber string) error {
 		return fmt.Errorf("customer with meter number %s not found", meterNumber)
 	}
 
-	// Optional: Check if customer has any unpaid bills before deleting
-	// You might want to prevent deletion if they have outstanding balance
+	if customer.Status == "archived" {
+		return fmt.Errorf("customer with meter number %s is already archived", meterNumber)
+	}
+
+	if !force {
+		cursor, err := cs.billsCollection.Find(ctx, bson.M{
+			"meter_number": meterNumber,
+			"status":       bson.M{"$in": []string{"pending", "partially_paid", "overdue"}},
+		})
+		if err != nil {
+			return fmt.Errorf("error checking unpaid bills: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		var bills []models.Bill
+		if err = cursor.All(ctx, &bills); err != nil {
+			return fmt.Errorf("error decoding unpaid bills: %v", err)
+		}
+
+		if len(bills) > 0 {
+			billNumbers := make([]string, len(bills))
+			for i, bill := range bills {
+				billNumbers[i] = bill.BillNumber
+			}
+			return fmt.Errorf("customer with meter number %s has unpaid bills: %s",
+				meterNumber, strings.Join(billNumbers, ", "))
+		}
+	}
+
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"status":         "archived",
+			"archive_reason": reason,
+			"deleted_at":     now,
+			"updated_at":     now,
+		},
+	}
 
-	result, err := cs.customersCollection.DeleteOne(ctx, bson.M{"meter_number": meterNumber})
+	result, err := cs.customersCollection.UpdateOne(ctx, bson.M{"meter_number": meterNumber}, update)
 	if err != nil {
-		return fmt.Errorf("failed to delete customer: %v", err)
+		return fmt.Errorf("failed to archive customer: %v", err)
 	}
 
-	if result.DeletedCount == 0 {
+	if result.MatchedCount == 0 {
 		return fmt.Errorf("customer with meter number %s not found", meterNumber)
 	}
 
@@ -442,4 +731,10 @@ type CustomerStatistics struct {
 	Disconnected  int64            `json:"disconnected"`
 	CustomerTypes map[string]int64 `json:"customer_types"`
 	TopZones      map[string]int64 `json:"top_zones"`
+
+	// Money across all customers; positive balances are owed, negative ones credit
+	TotalArrears   float64 `json:"total_arrears"`   // Amount owed
+	TotalCredit    float64 `json:"total_credit"`    // Prepaid credit held, as a positive figure
+	AverageBalance float64 `json:"average_balance"` // Signed, so negative when credit dominates
+	InArrears      int64   `json:"in_arrears"`      // Customers with a positive balance
 }
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIsIdentifierFragment(t *testing.T) {
+	tests := []struct {
+		term string
+		want bool
+	}{
+		{"MTR-00", true},
+		{"mtr12", true},
+		{"00123", true},
+		{"ACC/2024/1", true},
+		{"0712345678", false}, // phone number
+		{"+254712345678", false},
+		{"Wanjiru", false},
+		{"John Kamau", false},
+		{"MTR 001", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIdentifierFragment(tt.term); got != tt.want {
+			t.Errorf("isIdentifierFragment(%q) = %v, want %v", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifierPrefixFilterIsAnchored(t *testing.T) {
+	clauses := identifierPrefixFilter("mtr-0.")
+	if len(clauses) != 4 {
+		t.Fatalf("got %d clauses, want meter and account for both cases", len(clauses))
+	}
+
+	want := map[string]bool{`^mtr-0\.`: true, `^MTR-0\.`: true}
+	for _, clause := range clauses {
+		for field, value := range clause {
+			regex, ok := value.(primitive.Regex)
+			if !ok || !want[regex.Pattern] || regex.Options != "" {
+				t.Errorf("%s: %v is not an anchored, case-sensitive prefix", field, value)
+			}
+		}
+	}
+}
+
+func TestCountBucketsUnassignedAndNumericTypes(t *testing.T) {
+	results := []bson.M{
+		{"_id": "Zone A", "count": int32(4)},
+		{"_id": "Zone B", "count": int64(3)},
+		{"_id": nil, "count": int32(2)},
+		{"count": float64(1)},
+		{"_id": "", "count": int32(1)},
+		{"_id": "Zone C", "count": "bad"},
+	}
+
+	buckets := countBuckets(results)
+
+	want := map[string]int64{"Zone A": 4, "Zone B": 3, "Unassigned": 4, "Zone C": 0}
+	for key, count := range want {
+		if buckets[key] != count {
+			t.Errorf("buckets[%q] = %d, want %d", key, buckets[key], count)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+
+	"waterbilling/backend/models"
+)
+
+type EmailService struct {
+	host      string
+	port      string
+	username  string
+	password  string
+	from      string
+	isEnabled bool
+}
+
+func NewEmailService() *EmailService {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+
+	if host == "" || from == "" {
+		log.Println("⚠️ SMTP settings not found. Using mock email service.")
+		return &EmailService{isEnabled: false}
+	}
+
+	log.Printf("✅ Email Service initialized with SMTP server %s:%s", host, port)
+	return &EmailService{
+		host:      host,
+		port:      port,
+		username:  os.Getenv("SMTP_USER"),
+		password:  os.Getenv("SMTP_PASS"),
+		from:      from,
+		isEnabled: true,
+	}
+}
+
+// SendEmail sends an HTML email
+func (e *EmailService) SendEmail(to, subject, htmlBody string) error {
+	if !e.isEnabled {
+		log.Printf("[MOCK EMAIL] To: %s, Subject: %s", to, subject)
+		return nil
+	}
+
+	headers := []string{
+		"From: " + e.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/html; charset=\"UTF-8\"",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + htmlBody
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	if err := smtp.SendMail(e.host+":"+e.port, auth, e.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// SendBillEmail renders and emails a bill to the customer
+func (e *EmailService) SendBillEmail(bill *models.Bill, customer *models.Customer) error {
+	if customer.Email == "" {
+		return fmt.Errorf("customer %s has no email address", customer.MeterNumber)
+	}
+
+	var body bytes.Buffer
+	data := struct {
+		Company      CompanyConfig
+		CustomerName string
+		Bill         *models.Bill
+		DueDate      string
+	}{
+		Company:      company,
+		CustomerName: customer.FullName(),
+		Bill:         bill,
+		DueDate:      bill.DueDate.Format("02 Jan 2006"),
+	}
+	if err := billEmailTemplate.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to render bill email: %v", err)
+	}
+
+	subject := fmt.Sprintf("Your water bill %s - %s", bill.BillNumber, bill.BillingPeriod)
+	return e.SendEmail(customer.Email, subject, body.String())
+}
+
+var billEmailTemplate = template.Must(template.New("bill").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; color: #333;">
+  <h2>{{.Company.Name}}</h2>
+  <p>Dear {{.CustomerName}},</p>
+  <p>Your water bill for {{.Bill.BillingPeriod}} is now ready.</p>
+  <table cellpadding="6" style="border-collapse: collapse;">
+    <tr><td>Bill Number</td><td>{{.Bill.BillNumber}}</td></tr>
+    <tr><td>Meter</td><td>{{.Bill.MeterNumber}}</td></tr>
+    <tr><td>Previous Reading</td><td>{{printf "%.1f" .Bill.PreviousReading}} {{.Bill.ConsumptionUnit}}</td></tr>
+    <tr><td>Current Reading</td><td>{{printf "%.1f" .Bill.CurrentReading}} {{.Bill.ConsumptionUnit}}</td></tr>
+    <tr><td>Consumption</td><td>{{printf "%.1f" .Bill.Consumption}} {{.Bill.ConsumptionUnit}}</td></tr>
+    <tr><td>Water Charge</td><td>KSh {{printf "%.2f" .Bill.WaterCharge}}</td></tr>
+    <tr><td>Fixed Charge</td><td>KSh {{printf "%.2f" .Bill.FixedCharge}}</td></tr>
+    <tr><td><strong>Amount Due</strong></td><td><strong>KSh {{printf "%.2f" .Bill.TotalAmount}}</strong></td></tr>
+    {{if gt .Bill.Arrears 0.0}}<tr><td>Arrears (earlier bills)</td><td>KSh {{printf "%.2f" .Bill.Arrears}}</td></tr>
+    <tr><td><strong>Total Outstanding</strong></td><td><strong>KSh {{printf "%.2f" .Bill.TotalOutstanding}}</strong></td></tr>{{end}}
+    <tr><td>Due Date</td><td>{{.DueDate}}</td></tr>
+  </table>
+  <p>Pay via M-Pesa: Paybill {{.Company.Paybill}}, Account {{.Bill.MeterNumber}}.<br>
+  Please make payment to avoid service interruption. For queries call {{.Company.SupportPhone}}.</p>
+  <p>Thank you,<br>{{.Company.Name}}</p>
+</body>
+</html>
+`))
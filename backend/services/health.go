@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"waterbilling/backend/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// requiredIndexes are the indexes the services rely on for uniqueness and lookups, by collection.
+// They are created by scripts/init.go. The customers phone index depends on ALLOW_SHARED_PHONE
+// and is added in Check.
+var requiredIndexes = map[string][]string{
+	"customers":      {"meter_number_unique", "account_number_unique"},
+	"meter_readings": {"meter_month_year_unique", "reading_location_2dsphere"},
+	"bills":          {"bill_number_unique", "meter_bill_status"},
+	"payments":       {"transaction_id_unique", "receipt_number_unique"},
+	"users":          {"username_unique", "email_unique"},
+	"sms_logs":       {"customer_daily_sms"},
+	"tariffs":        {"tariff_code_unique"},
+	"jwt_blacklist":  {"jwt_blacklist_ttl"},
+	"portal_otps":    {"portal_otp_ttl"},
+	"audit_logs":     {"audit_created_at"},
+}
+
+// CollectionHealth is the state of one collection in a detailed health report
+type CollectionHealth struct {
+	Documents      int64    `json:"documents"` // Estimated from collection metadata
+	MissingIndexes []string `json:"missing_indexes,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+// HealthReport is the result of the detailed health check
+type HealthReport struct {
+	Status      string                      `json:"status"` // "ok" or "degraded"
+	Database    string                      `json:"database"`
+	SMSEnabled  bool                        `json:"sms_enabled"`
+	SMSProvider string                      `json:"sms_provider"`
+	Collections map[string]CollectionHealth `json:"collections"`
+	CheckedIn   string                      `json:"checked_in"`
+}
+
+type HealthService struct {
+	db         *mongo.Database
+	smsService *SMSService
+}
+
+func NewHealthService(db *mongo.Database, smsService *SMSService) *HealthService {
+	return &HealthService{
+		db:         db,
+		smsService: smsService,
+	}
+}
+
+// Check pings the database, counts documents and looks for missing indexes in every collection
+// with required indexes. All checks share a timeout of a few seconds, so a slow database gives a
+// degraded report rather than a hung request.
+func (hs *HealthService) Check(ctx context.Context) *HealthReport {
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	report := &HealthReport{
+		Status:      "ok",
+		Database:    "connected",
+		SMSProvider: "mock",
+		Collections: make(map[string]CollectionHealth, len(requiredIndexes)),
+	}
+	if hs.smsService != nil {
+		report.SMSEnabled = hs.smsService.IsEnabled()
+		report.SMSProvider = hs.smsService.Provider()
+	}
+
+	if err := hs.db.Client().Ping(ctx, nil); err != nil {
+		report.Status = "degraded"
+		report.Database = "disconnected"
+		report.CheckedIn = time.Since(started).String()
+		return report
+	}
+
+	for name, indexes := range requiredIndexes {
+		if name == "customers" {
+			indexes = append(indexes[:len(indexes):len(indexes)], database.PhoneIndexName())
+		}
+		health := hs.checkCollection(ctx, hs.db.Collection(name), indexes)
+		if health.Error != "" || len(health.MissingIndexes) > 0 {
+			report.Status = "degraded"
+		}
+		report.Collections[name] = health
+	}
+
+	report.CheckedIn = time.Since(started).String()
+	return report
+}
+
+// DatabaseStatsReport is database and per-collection usage for admins. Partial is set when
+// some statistics could not be read, usually because the database user lacks dbStats or
+// collStats; whatever could be read is still included.
+type DatabaseStatsReport struct {
+	Database    string                            `json:"database"`
+	Stats       map[string]interface{}            `json:"stats,omitempty"`
+	Collections map[string]map[string]interface{} `json:"collections"`
+	Partial     bool                              `json:"partial"`
+	Errors      []string                          `json:"errors,omitempty"`
+}
+
+// DatabaseStats gathers dbStats and the stats of every collection within a few seconds. Only a
+// missing database is an error.
+func (hs *HealthService) DatabaseStats(ctx context.Context) (*DatabaseStatsReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if database.DB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	report := &DatabaseStatsReport{
+		Database:    database.DB.Name(),
+		Collections: make(map[string]map[string]interface{}),
+	}
+	fail := func(err error) {
+		report.Partial = true
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	stats, err := database.GetDatabaseStats(ctx)
+	if err != nil {
+		fail(err)
+	}
+	report.Stats = stats
+
+	// Without listCollections, fall back to the collections the services use
+	names, err := database.ListCollections(ctx)
+	if err != nil {
+		fail(err)
+		names = make([]string, 0, len(requiredIndexes))
+		for name := range requiredIndexes {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		collection, err := database.GetCollectionStats(ctx, name)
+		if err != nil {
+			fail(fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		if _, refused := collection["stats_error"]; refused {
+			report.Partial = true
+		}
+		report.Collections[name] = collection
+	}
+
+	return report, nil
+}
+
+func (hs *HealthService) checkCollection(ctx context.Context, collection *mongo.Collection, required []string) CollectionHealth {
+	var health CollectionHealth
+
+	count, err := collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.Documents = count
+
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer cursor.Close(ctx)
+
+	var indexes []bson.M
+	if err = cursor.All(ctx, &indexes); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	present := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		if name, ok := index["name"].(string); ok {
+			present[name] = true
+		}
+	}
+	for _, name := range required {
+		if !present[name] {
+			health.MissingIndexes = append(health.MissingIndexes, name)
+		}
+	}
+
+	return health
+}
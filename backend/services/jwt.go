@@ -1,75 +1,295 @@
 package services
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"waterbilling/backend/models"
 
 	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type JWTService struct {
 	secretKey     string
 	tokenDuration time.Duration
+	blacklist     Collection
+
+	// RS256 signing, used instead of secretKey when publicKeys is set. signingKey is nil on
+	// instances that only verify tokens.
+	signingKey *rsa.PrivateKey
+	keyID      string
+	publicKeys map[string]*rsa.PublicKey // By kid, including retired keys still accepted
+
+	// Stamped on every token and required when validating, when set
+	issuer   string
+	audience string
+}
+
+// revokedToken is a jwt_blacklist entry. A TTL index on expires_at removes it once the token
+// would have expired anyway.
+type revokedToken struct {
+	ID        string    `bson:"_id"`
+	UserID    string    `bson:"user_id"`
+	RevokedAt time.Time `bson:"revoked_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
 }
 
+// refreshTokenTTL is how long a refresh token lasts, whatever the access token duration
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	TokenType   string   `json:"token_type"`
+	Permissions []string `json:"permissions,omitempty"`
+	MeterNumber string   `json:"meter_number,omitempty"` // Set on customer portal tokens
+	Zone        string   `json:"zone,omitempty"`         // Assigned zone, for meter readers
+
+	// The user must choose a new password before the token can be used for anything else
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewJWTService(secretKey string, tokenDuration time.Duration) *JWTService {
+// IsAccessToken reports whether the token may be used to call the API.
+// Tokens issued before token_type existed carry no type and are treated as access tokens.
+func (c *Claims) IsAccessToken() bool {
+	return c.TokenType == TokenTypeAccess || c.TokenType == ""
+}
+
+// NewJWTService returns a JWTService that signs and verifies HS256 tokens with secretKey
+func NewJWTService(secretKey string, tokenDuration time.Duration, blacklist *mongo.Collection) *JWTService {
 	return &JWTService{
 		secretKey:     secretKey,
 		tokenDuration: tokenDuration,
+		blacklist:     wrapCollection(blacklist),
+	}
+}
+
+// RSAKeys configures RS256 tokens. SigningKey signs new tokens under the kid KeyID; tokens
+// signed by any key in PublicKeys are accepted too, so a retired key keeps working until its
+// tokens expire. Without a SigningKey tokens can only be verified.
+type RSAKeys struct {
+	SigningKey *rsa.PrivateKey
+	KeyID      string
+	PublicKeys map[string]*rsa.PublicKey
+}
+
+// NewRSAJWTService returns a JWTService that signs and verifies RS256 tokens with keys.
+// The signing key's own public key is always accepted; its kid defaults to one derived from it.
+func NewRSAJWTService(keys *RSAKeys, tokenDuration time.Duration, blacklist *mongo.Collection) *JWTService {
+	publicKeys := make(map[string]*rsa.PublicKey, len(keys.PublicKeys)+1)
+	for kid, key := range keys.PublicKeys {
+		publicKeys[kid] = key
+	}
+
+	keyID := keys.KeyID
+	if keys.SigningKey != nil {
+		if keyID == "" {
+			keyID = rsaKeyID(&keys.SigningKey.PublicKey)
+		}
+		publicKeys[keyID] = &keys.SigningKey.PublicKey
+	}
+
+	return &JWTService{
+		tokenDuration: tokenDuration,
+		blacklist:     wrapCollection(blacklist),
+		signingKey:    keys.SigningKey,
+		keyID:         keyID,
+		publicKeys:    publicKeys,
+	}
+}
+
+// LoadRSAKeys reads the RS256 key configuration, returning nil when none is set.
+// JWT_PRIVATE_KEY_PATH is the PEM private key to sign with and JWT_KEY_ID its kid.
+// JWT_PUBLIC_KEYS is a comma-separated list of kid=path PEM public keys that are also accepted,
+// such as the key being rotated out.
+func LoadRSAKeys() (*RSAKeys, error) {
+	keys := &RSAKeys{KeyID: os.Getenv("JWT_KEY_ID"), PublicKeys: make(map[string]*rsa.PublicKey)}
+
+	if path := os.Getenv("JWT_PRIVATE_KEY_PATH"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT private key: %v", err)
+		}
+		if keys.SigningKey, err = jwt.ParseRSAPrivateKeyFromPEM(pem); err != nil {
+			return nil, fmt.Errorf("invalid JWT private key %s: %v", path, err)
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("JWT_PUBLIC_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, found := strings.Cut(entry, "=")
+		if !found || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_PUBLIC_KEYS entry %q, expected kid=path", entry)
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT public key %s: %v", kid, err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT public key %s: %v", kid, err)
+		}
+		keys.PublicKeys[kid] = key
+	}
+
+	if keys.SigningKey == nil && len(keys.PublicKeys) == 0 {
+		return nil, nil
 	}
+	return keys, nil
+}
+
+// rsaKeyID derives a stable kid from a public key: the start of its SHA-256 fingerprint
+func rsaKeyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SetIssuerAudience sets the iss and aud claims put on new tokens. Once set, tokens without
+// the same issuer and audience are rejected, so tokens from another environment or service
+// sharing the key are not accepted.
+func (js *JWTService) SetIssuerAudience(issuer, audience string) {
+	js.issuer = issuer
+	js.audience = audience
+}
+
+// sign stamps the issuer and audience on claims and signs them with the configured key
+func (js *JWTService) sign(claims *Claims) (string, error) {
+	claims.Issuer = js.issuer
+	if js.audience != "" {
+		claims.Audience = jwt.ClaimStrings{js.audience}
+	}
+
+	if js.publicKeys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(js.secretKey))
+	}
+	if js.signingKey == nil {
+		return "", fmt.Errorf("no JWT signing key configured; this instance can only verify tokens")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = js.keyID
+	return token.SignedString(js.signingKey)
+}
+
+// verificationKey returns the key a token must be signed with. Only the configured algorithm
+// is accepted, so an RS256 public key can never be used as an HMAC secret.
+func (js *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if js.publicKeys == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(js.secretKey), nil
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := js.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
 }
 
 // GenerateToken generates a JWT token for a user
 func (js *JWTService) GenerateToken(user *models.User) (string, error) {
 	claims := Claims{
-		UserID:   user.ID.Hex(),
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:      user.ID.Hex(),
+		Username:    user.Username,
+		Role:        user.Role,
+		TokenType:   TokenTypeAccess,
+		Permissions: user.Permissions,
+		Zone:        user.AssignedZone,
+
+		MustChangePassword: user.MustChangePassword,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(js.tokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   user.ID.Hex(),
+			ID:        primitive.NewObjectID().Hex(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(js.secretKey))
+	return js.sign(&claims)
+}
+
+// GenerateCustomerToken generates an access token for a customer portal login.
+// The token carries role "customer" and the customer's meter number.
+func (js *JWTService) GenerateCustomerToken(customer *models.Customer) (string, error) {
+	claims := Claims{
+		UserID:      customer.ID.Hex(),
+		Username:    customer.MeterNumber,
+		Role:        "customer",
+		TokenType:   TokenTypeAccess,
+		MeterNumber: customer.MeterNumber,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(js.tokenDuration)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   customer.ID.Hex(),
+			ID:        primitive.NewObjectID().Hex(),
+		},
+	}
+
+	return js.sign(&claims)
 }
 
 // GenerateRefreshToken generates a refresh token
 func (js *JWTService) GenerateRefreshToken(user *models.User) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID:   user.ID.Hex(),
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:      user.ID.Hex(),
+		Username:    user.Username,
+		Role:        user.Role,
+		TokenType:   TokenTypeRefresh,
+		Permissions: user.Permissions,
+		Zone:        user.AssignedZone,
+
+		MustChangePassword: user.MustChangePassword,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(js.tokenDuration * 24 * 7)), // 7 days
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(refreshTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Subject:   user.ID.Hex(),
+			ID:        primitive.NewObjectID().Hex(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(js.secretKey))
+	return js.sign(&claims)
 }
 
 // ValidateToken validates a JWT token
 func (js *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(js.secretKey), nil
-	})
+	var opts []jwt.ParserOption
+	if js.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(js.issuer))
+	}
+	if js.audience != "" {
+		opts = append(opts, jwt.WithAudience(js.audience))
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, js.verificationKey, opts...)
 
 	if err != nil {
 		return nil, err
@@ -82,27 +302,111 @@ func (js *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
-// RefreshToken refreshes an expired token
-func (js *JWTService) RefreshToken(refreshToken string) (string, error) {
+// ValidateRefreshToken returns the claims of a refresh token that may still be exchanged.
+// Access tokens and revoked refresh tokens are rejected. The new access token is issued from
+// the user's current record, so role, permission and zone changes apply at the next refresh.
+func (js *JWTService) ValidateRefreshToken(ctx context.Context, refreshToken string) (*Claims, error) {
 	claims, err := js.ValidateToken(refreshToken)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Create new token with same claims but new expiration
-	newClaims := &Claims{
-		UserID:   claims.UserID,
-		Username: claims.Username,
-		Role:     claims.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(js.tokenDuration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Subject:   claims.Subject,
-		},
+	if claims.TokenType != TokenTypeRefresh {
+		return nil, fmt.Errorf("invalid token type: refresh token required")
+	}
+
+	revoked, err := js.IsTokenRevoked(ctx, refreshToken, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("refresh token has been revoked")
+	}
+
+	return claims, nil
+}
+
+// RevokeToken blacklists a token until it expires.
+// Tokens are keyed by their jti; tokens issued before jti was added fall back to their signature.
+func (js *JWTService) RevokeToken(ctx context.Context, tokenString string) error {
+	claims, err := js.ValidateToken(tokenString)
+	if err != nil {
+		return err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	return token.SignedString([]byte(js.secretKey))
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	entry := revokedToken{
+		ID:        revocationKey(tokenString, claims),
+		UserID:    claims.UserID,
+		RevokedAt: time.Now(),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	_, err = js.blacklist.InsertOne(ctx, entry)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to revoke token: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens revokes every token issued to a user before the current second, such as when
+// their account is deactivated. Token issue times only have second precision, so the revocation
+// is recorded to the second and tokens issued within it, like a login straight after a password
+// reset, are unaffected.
+func (js *JWTService) RevokeUserTokens(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now().Truncate(time.Second)
+	// Kept until the longest-lived token, a refresh token, issued now would expire
+	expiresAt := now.Add(refreshTokenTTL)
+
+	_, err := js.blacklist.UpdateOne(ctx, bson.M{"_id": userRevocationKey(userID)}, bson.M{
+		"$set": bson.M{"user_id": userID, "revoked_at": now, "expires_at": expiresAt},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %v", err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether a validated token has been blacklisted, on its own or by
+// revoking all of its user's tokens after it was issued
+func (js *JWTService) IsTokenRevoked(ctx context.Context, tokenString string, claims *Claims) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": revocationKey(tokenString, claims)}
+	if claims.UserID != "" && claims.IssuedAt != nil {
+		filter = bson.M{"$or": bson.A{
+			filter,
+			bson.M{"_id": userRevocationKey(claims.UserID), "revoked_at": bson.M{"$gt": claims.IssuedAt.Time}},
+		}}
+	}
+
+	count, err := js.blacklist.CountDocuments(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("error checking token blacklist: %v", err)
+	}
+
+	return count > 0, nil
+}
+
+// revocationKey identifies a token in the blacklist
+func revocationKey(tokenString string, claims *Claims) string {
+	if claims.ID != "" {
+		return claims.ID
+	}
+	return tokenString[strings.LastIndex(tokenString, ".")+1:]
+}
+
+// userRevocationKey identifies the blacklist entry revoking all of a user's tokens
+func userRevocationKey(userID string) string {
+	return "user:" + userID
 }
 
 // GetTokenDuration returns the token duration
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRevokeUserTokensBySecond(t *testing.T) {
+	db := testDatabase(t)
+	js := NewJWTService("test-secret", time.Hour, db.Collection("jwt_blacklist"))
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "cashier"}
+
+	// A token from a few seconds before the revocation
+	issued := time.Now().Add(-3 * time.Second)
+	old := &Claims{
+		UserID:    user.ID.Hex(),
+		Username:  user.Username,
+		Role:      user.Role,
+		TokenType: TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(issued.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(issued),
+			ID:        primitive.NewObjectID().Hex(),
+		},
+	}
+	oldToken, err := js.sign(old)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := js.RevokeUserTokens(context.Background(), user.ID.Hex()); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	// Logging straight back in must not be caught by the revocation
+	newToken, err := js.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		token       string
+		wantRevoked bool
+	}{
+		{"token issued before", oldToken, true},
+		{"token issued straight after", newToken, false},
+	} {
+		claims, err := js.ValidateToken(tt.token)
+		if err != nil {
+			t.Fatalf("%s: ValidateToken: %v", tt.name, err)
+		}
+		revoked, err := js.IsTokenRevoked(context.Background(), tt.token, claims)
+		if err != nil {
+			t.Fatalf("%s: IsTokenRevoked: %v", tt.name, err)
+		}
+		if revoked != tt.wantRevoked {
+			t.Errorf("%s: revoked = %v, want %v", tt.name, revoked, tt.wantRevoked)
+		}
+	}
+}
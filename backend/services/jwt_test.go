@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func TestRS256TokenRoundTrip(t *testing.T) {
+	js := NewRSAJWTService(&RSAKeys{SigningKey: testRSAKey(t), KeyID: "2026-10"}, time.Hour, nil)
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "admin"}
+
+	tokenString, err := js.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &Claims{})
+	if err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	if token.Method.Alg() != "RS256" || token.Header["kid"] != "2026-10" {
+		t.Errorf("header = %v, want RS256 with kid 2026-10", token.Header)
+	}
+
+	claims, err := js.ValidateToken(tokenString)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.Username != "jdoe" || claims.Role != "admin" {
+		t.Errorf("claims = %s/%s, want jdoe/admin", claims.Username, claims.Role)
+	}
+}
+
+func TestRS256KeyRotation(t *testing.T) {
+	oldKey, newKey := testRSAKey(t), testRSAKey(t)
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "cashier"}
+
+	oldToken, err := NewRSAJWTService(&RSAKeys{SigningKey: oldKey, KeyID: "old"}, time.Hour, nil).GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	rotated := NewRSAJWTService(&RSAKeys{
+		SigningKey: newKey,
+		KeyID:      "new",
+		PublicKeys: map[string]*rsa.PublicKey{"old": &oldKey.PublicKey},
+	}, time.Hour, nil)
+	if _, err := rotated.ValidateToken(oldToken); err != nil {
+		t.Errorf("token signed with the retired key: %v", err)
+	}
+
+	// Once the old key is dropped its tokens stop validating
+	retired := NewRSAJWTService(&RSAKeys{SigningKey: newKey, KeyID: "new"}, time.Hour, nil)
+	if _, err := retired.ValidateToken(oldToken); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("after removing the old key: err = %v, want unknown signing key", err)
+	}
+
+	// An instance holding only public keys verifies but cannot sign
+	verifier := NewRSAJWTService(&RSAKeys{PublicKeys: map[string]*rsa.PublicKey{"old": &oldKey.PublicKey}}, time.Hour, nil)
+	if _, err := verifier.ValidateToken(oldToken); err != nil {
+		t.Errorf("verify-only instance: %v", err)
+	}
+	if _, err := verifier.GenerateToken(user); err == nil {
+		t.Error("verify-only instance signed a token")
+	}
+}
+
+func TestRS256RejectsHS256Tokens(t *testing.T) {
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "admin"}
+	hsToken, err := NewJWTService("secret", time.Hour, nil).GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	js := NewRSAJWTService(&RSAKeys{SigningKey: testRSAKey(t)}, time.Hour, nil)
+	if _, err := js.ValidateToken(hsToken); err == nil {
+		t.Error("RS256 service accepted an HS256 token")
+	}
+}
+
+func TestLoadRSAKeys(t *testing.T) {
+	dir := t.TempDir()
+	signing, retired := testRSAKey(t), testRSAKey(t)
+
+	privatePath := filepath.Join(dir, "private.pem")
+	writePEM(t, privatePath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(signing))
+	publicDER, err := x509.MarshalPKIXPublicKey(&retired.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	publicPath := filepath.Join(dir, "old.pem")
+	writePEM(t, publicPath, "PUBLIC KEY", publicDER)
+
+	t.Setenv("JWT_PRIVATE_KEY_PATH", "")
+	t.Setenv("JWT_PUBLIC_KEYS", "")
+	if keys, err := LoadRSAKeys(); keys != nil || err != nil {
+		t.Fatalf("unconfigured: keys %v, err %v; want nil, nil", keys, err)
+	}
+
+	t.Setenv("JWT_PRIVATE_KEY_PATH", privatePath)
+	t.Setenv("JWT_KEY_ID", "current")
+	t.Setenv("JWT_PUBLIC_KEYS", "old="+publicPath)
+	keys, err := LoadRSAKeys()
+	if err != nil {
+		t.Fatalf("LoadRSAKeys: %v", err)
+	}
+	if keys.KeyID != "current" || !keys.SigningKey.Equal(signing) || !keys.PublicKeys["old"].Equal(&retired.PublicKey) {
+		t.Errorf("keys = kid %s with %d public keys, want current with the retired key", keys.KeyID, len(keys.PublicKeys))
+	}
+
+	t.Setenv("JWT_PUBLIC_KEYS", publicPath)
+	if _, err := LoadRSAKeys(); err == nil {
+		t.Error("public key without a kid was accepted")
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestRefreshTokenLastsAWeek(t *testing.T) {
+	js := NewJWTService("test-secret", 24*time.Hour, nil)
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "reader"}
+
+	refresh, err := js.GenerateRefreshToken(user)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	claims, err := js.ValidateToken(refresh)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != refreshTokenTTL {
+		t.Errorf("refresh token lasts %s, want %s", ttl, refreshTokenTTL)
+	}
+}
+
+func TestValidateRefreshTokenRejectsAccessToken(t *testing.T) {
+	js := NewJWTService("test-secret", time.Hour, nil)
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "reader"}
+
+	access, err := js.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := js.ValidateRefreshToken(context.Background(), access); err == nil || !strings.Contains(err.Error(), "refresh token required") {
+		t.Errorf("access token: err = %v, want refresh token required", err)
+	}
+}
+
+func TestIssuerAndAudienceEnforced(t *testing.T) {
+	user := &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: "admin"}
+
+	dev := NewJWTService("shared-secret", time.Hour, nil)
+	dev.SetIssuerAudience("waterbilling-development", "waterbilling-api")
+	prod := NewJWTService("shared-secret", time.Hour, nil)
+	prod.SetIssuerAudience("waterbilling-production", "waterbilling-api")
+	other := NewJWTService("shared-secret", time.Hour, nil)
+	other.SetIssuerAudience("waterbilling-production", "reports-api")
+
+	tokenString, err := prod.GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := prod.ValidateToken(tokenString)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.Issuer != "waterbilling-production" || len(claims.Audience) != 1 || claims.Audience[0] != "waterbilling-api" {
+		t.Errorf("iss/aud = %s/%v, want waterbilling-production/[waterbilling-api]", claims.Issuer, claims.Audience)
+	}
+
+	if _, err := dev.ValidateToken(tokenString); err == nil {
+		t.Error("token from another issuer was accepted")
+	}
+	if _, err := other.ValidateToken(tokenString); err == nil {
+		t.Error("token for another audience was accepted")
+	}
+
+	// Tokens minted before issuer and audience were configured carry neither
+	legacy, err := NewJWTService("shared-secret", time.Hour, nil).GenerateToken(user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := prod.ValidateToken(legacy); err == nil {
+		t.Error("token without iss/aud was accepted")
+	}
+}
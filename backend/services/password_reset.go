@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PasswordResetService lets a user who forgot their password set a new one with a code sent
+// by SMS to the phone number on their account. Codes share the portal OTP collection, keyed
+// by user so they never clash with a meter's login code.
+type PasswordResetService struct {
+	otpsCollection Collection
+	userService    *UserService
+	smsService     *SMSService
+	jwtService     *JWTService
+}
+
+func NewPasswordResetService(otps *mongo.Collection, userService *UserService, smsService *SMSService, jwtService *JWTService) *PasswordResetService {
+	return &PasswordResetService{
+		otpsCollection: wrapCollection(otps),
+		userService:    userService,
+		smsService:     smsService,
+		jwtService:     jwtService,
+	}
+}
+
+// passwordResetKey is the OTP collection key for a user's reset code
+func passwordResetKey(user *models.User) string {
+	return "password_reset:" + user.ID.Hex()
+}
+
+// RequestReset texts a reset code to the user's phone. Unknown usernames, inactive accounts and
+// accounts without a phone number are not reported, so the endpoint cannot be used to find
+// out which accounts exist.
+func (ps *PasswordResetService) RequestReset(ctx context.Context, username string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	user, err := ps.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil
+		}
+		return err
+	}
+	if !user.IsActive || user.PhoneNumber == "" {
+		utils.Logf(ctx, "⚠️ Password reset requested for %s, which is inactive or has no phone number", username)
+		return nil
+	}
+
+	code, err := issueOTP(ctx, ps.otpsCollection, passwordResetKey(user))
+	if err != nil || code == "" {
+		return err
+	}
+
+	if ps.smsService == nil {
+		return errors.New("SMS service is not available")
+	}
+	return ps.smsService.SendPasswordResetCode(user, code, otpTTL())
+}
+
+// ResetWithCode sets a new password for username if code is the one sent to them. The user's
+// existing tokens are revoked and any login lockout is cleared. It returns the user for
+// auditing.
+func (ps *PasswordResetService) ResetWithCode(ctx context.Context, username, code, newPassword string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	user, err := ps.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, errors.New("invalid or expired code")
+		}
+		return nil, err
+	}
+
+	if err := utils.ValidatePassword(newPassword, user.Username, user.Email); err != nil {
+		return nil, err
+	}
+
+	if err := verifyOTP(ctx, ps.otpsCollection, passwordResetKey(user), code); err != nil {
+		return nil, err
+	}
+
+	if err := ps.userService.ChangePassword(ctx, user.ID.Hex(), newPassword); err != nil {
+		return nil, err
+	}
+
+	if err := ps.jwtService.RevokeUserTokens(ctx, user.ID.Hex()); err != nil {
+		return nil, fmt.Errorf("password reset but existing sessions could not be revoked: %v", err)
+	}
+
+	return user, nil
+}
@@ -3,9 +3,11 @@ package services
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,31 +15,61 @@ import (
 )
 
 type PaymentService struct {
-	collection *mongo.Collection
+	collection Collection
 }
 
 func NewPaymentService(collection *mongo.Collection) *PaymentService {
 	return &PaymentService{
-		collection: collection,
+		collection: wrapCollection(collection),
 	}
 }
 
-// CreatePayment inserts a new payment record
-func (s *PaymentService) CreatePayment(payment *models.Payment) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// duplicatePaymentError describes a payment insert that hit a unique index. A receipt number
+// collision is reported as such rather than as a repeated transaction.
+func duplicatePaymentError(field, transactionID string) error {
+	if field == "transaction ID" && transactionID != "" {
+		return fmt.Errorf("payment with transaction ID %s already recorded", transactionID)
+	}
+	return fmt.Errorf("payment with this %s already recorded", field)
+}
+
+// GetPaymentByTransactionID returns the payment recorded under a transaction ID, or nil if there is none
+func (s *PaymentService) GetPaymentByTransactionID(ctx context.Context, transactionID string) (*models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	_, err := s.collection.InsertOne(ctx, payment)
+	var payment models.Payment
+	err := s.collection.FindOne(ctx, bson.M{"transaction_id": transactionID}).Decode(&payment)
 	if err != nil {
-		return fmt.Errorf("failed to create payment: %v", err)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching payment: %v", err)
 	}
 
-	return nil
+	return &payment, nil
+}
+
+// GetByReceiptNumber returns the payment with a receipt number, or nil if there is none
+func (s *PaymentService) GetByReceiptNumber(ctx context.Context, receiptNumber string) (*models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var payment models.Payment
+	err := s.collection.FindOne(ctx, bson.M{"receipt_number": receiptNumber}).Decode(&payment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching payment: %v", err)
+	}
+
+	return &payment, nil
 }
 
 // GetPaymentsByMeter retrieves payments for a specific meter
-func (s *PaymentService) GetPaymentsByMeter(meterNumber string, limit int) ([]models.Payment, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *PaymentService) GetPaymentsByMeter(ctx context.Context, meterNumber string, limit int) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{"meter_number": meterNumber}
@@ -56,3 +88,119 @@ func (s *PaymentService) GetPaymentsByMeter(meterNumber string, limit int) ([]mo
 
 	return payments, nil
 }
+
+// ListPayments returns one page of the payments matching filter, newest first, with the total
+// number that match. Sorting on payment_date lets the payment date indexes serve the query.
+func (s *PaymentService) ListPayments(ctx context.Context, filter bson.M, page, limit int64) ([]models.Payment, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSkip((page - 1) * limit).
+		SetLimit(limit).
+		SetSort(bson.M{"payment_date": -1})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error fetching payments: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	payments := []models.Payment{}
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, 0, fmt.Errorf("error decoding payments: %v", err)
+	}
+
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting payments: %v", err)
+	}
+
+	return payments, total, nil
+}
+
+// MethodTotal is what was collected through one payment method
+type MethodTotal struct {
+	PaymentMethod string  `json:"payment_method"`
+	Count         int     `json:"count"`
+	Total         float64 `json:"total"`
+}
+
+// CollectionSummary is a collector's takings for one day, for reconciling against the drawer
+type CollectionSummary struct {
+	CollectedBy string           `json:"collected_by,omitempty"` // Empty when the summary covers every collector
+	Date        string           `json:"date"`                   // YYYY-MM-DD
+	Count       int              `json:"count"`
+	Total       float64          `json:"total"`
+	ByMethod    []MethodTotal    `json:"by_method"`
+	Receipts    []models.Payment `json:"receipts"`
+	Excluded    int              `json:"excluded"` // Refunded or failed receipts, listed but left out of the totals
+}
+
+// GetCollectionSummary totals the payments collectedBy took on date's calendar day, per payment
+// method, with every receipt in time order. An empty collectedBy covers every collector.
+// Refunded and failed payments are listed but not counted.
+func (s *PaymentService) GetCollectionSummary(ctx context.Context, collectedBy string, date time.Time) (*CollectionSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	start := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	filter := bson.M{
+		"payment_date": bson.M{"$gte": start, "$lt": start.AddDate(0, 0, 1)},
+	}
+	if collectedBy != "" {
+		filter["collected_by"] = collectedBy
+	}
+
+	opts := options.Find().SetSort(bson.M{"payment_date": 1})
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payments: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var payments []models.Payment
+	if err = cursor.All(ctx, &payments); err != nil {
+		return nil, fmt.Errorf("error decoding payments: %v", err)
+	}
+
+	summary := &CollectionSummary{
+		CollectedBy: collectedBy,
+		Date:        start.Format("2006-01-02"),
+		ByMethod:    []MethodTotal{},
+		Receipts:    payments,
+	}
+	if summary.Receipts == nil {
+		summary.Receipts = []models.Payment{}
+	}
+
+	byMethod := make(map[string]*MethodTotal)
+	for _, payment := range payments {
+		if payment.Status == "refunded" || payment.Status == "failed" {
+			summary.Excluded++
+			continue
+		}
+
+		total, ok := byMethod[payment.PaymentMethod]
+		if !ok {
+			total = &MethodTotal{PaymentMethod: payment.PaymentMethod}
+			byMethod[payment.PaymentMethod] = total
+		}
+		total.Count++
+		total.Total += payment.Amount
+
+		summary.Count++
+		summary.Total += payment.Amount
+	}
+
+	for _, total := range byMethod {
+		total.Total = utils.RoundToTwoDecimal(total.Total)
+		summary.ByMethod = append(summary.ByMethod, *total)
+	}
+	sort.Slice(summary.ByMethod, func(i, j int) bool {
+		return summary.ByMethod[i].PaymentMethod < summary.ByMethod[j].PaymentMethod
+	})
+	summary.Total = utils.RoundToTwoDecimal(summary.Total)
+
+	return summary, nil
+}
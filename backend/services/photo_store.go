@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PhotoStore saves an uploaded meter photo under name and returns the URL it is served from
+type PhotoStore interface {
+	Save(ctx context.Context, name, contentType string, data []byte) (string, error)
+}
+
+// NewPhotoStore picks where meter photos are kept. PHOTO_STORAGE=s3 uses an S3-compatible
+// bucket (S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY and optionally
+// S3_PUBLIC_URL); otherwise photos are written under PHOTO_UPLOAD_DIR and served by the API.
+func NewPhotoStore() PhotoStore {
+	if strings.ToLower(os.Getenv("PHOTO_STORAGE")) == "s3" {
+		endpoint := os.Getenv("S3_ENDPOINT")
+		bucket := os.Getenv("S3_BUCKET")
+		accessKey := os.Getenv("S3_ACCESS_KEY")
+		secretKey := os.Getenv("S3_SECRET_KEY")
+
+		if endpoint != "" && bucket != "" && accessKey != "" && secretKey != "" {
+			region := os.Getenv("S3_REGION")
+			if region == "" {
+				region = "us-east-1"
+			}
+			log.Printf("✅ Meter photos stored in S3 bucket %s", bucket)
+			return NewS3PhotoStore(endpoint, region, bucket, accessKey, secretKey, os.Getenv("S3_PUBLIC_URL"))
+		}
+		log.Println("⚠️ S3 settings incomplete. Storing meter photos on local disk.")
+	}
+
+	dir := os.Getenv("PHOTO_UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads/meter-photos"
+	}
+	return NewLocalPhotoStore(dir, "/uploads/meter-photos")
+}
+
+// LocalPhotoStore writes photos to a directory that the API serves at URLPath
+type LocalPhotoStore struct {
+	Dir     string
+	URLPath string
+}
+
+func NewLocalPhotoStore(dir, urlPath string) *LocalPhotoStore {
+	return &LocalPhotoStore{
+		Dir:     dir,
+		URLPath: urlPath,
+	}
+}
+
+// Save writes the photo to disk
+func (s *LocalPhotoStore) Save(ctx context.Context, name, contentType string, data []byte) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create photo directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.Dir, name), data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to save photo: %v", err)
+	}
+
+	return s.URLPath + "/" + name, nil
+}
+
+// S3PhotoStore uploads photos to an S3-compatible bucket using path-style requests
+type S3PhotoStore struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *http.Client
+}
+
+func NewS3PhotoStore(endpoint, region, bucket, accessKey, secretKey, publicURL string) *S3PhotoStore {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if publicURL == "" {
+		publicURL = endpoint + "/" + bucket
+	}
+
+	return &S3PhotoStore{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Save uploads the photo with a signed PUT Object request
+func (s *S3PhotoStore) Save(ctx context.Context, name, contentType string, data []byte) (string, error) {
+	key := "meter-photos/" + name
+	objectURL, err := url.Parse(s.endpoint + "/" + s.bucket + "/" + key)
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, data, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload photo: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		log.Printf("❌ S3 upload error (%d): %s", resp.StatusCode, string(respBody))
+		return "", fmt.Errorf("photo storage returned status: %d", resp.StatusCode)
+	}
+
+	return s.publicURL + "/" + key, nil
+}
+
+// sign adds AWS Signature Version 4 headers to an S3 request
+func (s *S3PhotoStore) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
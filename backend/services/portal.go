@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxOTPAttempts is how many wrong codes are accepted before the OTP is discarded
+const maxOTPAttempts = 5
+
+// otpResendInterval stops a meter from being sent codes back to back
+const otpResendInterval = time.Minute
+
+// portalOTP is a pending one-time code, one per key: a meter number for portal logins. A TTL
+// index on expires_at removes it.
+type portalOTP struct {
+	MeterNumber string    `bson:"_id"`
+	CodeHash    string    `bson:"code_hash"`
+	Attempts    int       `bson:"attempts"`
+	CreatedAt   time.Time `bson:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+type PortalService struct {
+	otpsCollection      Collection
+	customersCollection Collection
+	smsService          *SMSService
+	jwtService          *JWTService
+}
+
+func NewPortalService(otps, customers *mongo.Collection, smsService *SMSService, jwtService *JWTService) *PortalService {
+	return &PortalService{
+		otpsCollection:      wrapCollection(otps),
+		customersCollection: wrapCollection(customers),
+		smsService:          smsService,
+		jwtService:          jwtService,
+	}
+}
+
+// RequestOTP texts a 6-digit login code to the customer if the phone number matches the meter.
+// A mismatch is not reported, so the endpoint cannot be used to discover which numbers are registered.
+// Codes expire after PORTAL_OTP_TTL_MINUTES (default 5).
+func (ps *PortalService) RequestOTP(ctx context.Context, meterNumber, phone string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var customer models.Customer
+	err := ps.customersCollection.FindOne(ctx, bson.M{"meter_number": meterNumber}).Decode(&customer)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return fmt.Errorf("error fetching customer: %v", err)
+	}
+
+	// Closed accounts get no code, and are not told why
+	if !portalLoginAllowed(&customer) {
+		utils.Logf(ctx, "⚠️ Portal OTP requested for %s meter %s", customer.Status, meterNumber)
+		return nil
+	}
+
+	stored, _ := utils.FormatPhoneNumber(customer.PhoneNumber)
+	given, err := utils.FormatPhoneNumber(phone)
+	if err != nil || given != stored {
+		utils.Logf(ctx, "⚠️ Portal OTP requested for meter %s with a non-matching phone number", meterNumber)
+		return nil
+	}
+
+	code, err := issueOTP(ctx, ps.otpsCollection, meterNumber)
+	if err != nil || code == "" {
+		return err
+	}
+
+	if ps.smsService == nil {
+		return errors.New("SMS service is not available")
+	}
+	return ps.smsService.SendLoginCode(&customer, code, otpTTL())
+}
+
+// VerifyOTP checks a login code and returns a customer token scoped to the meter.
+// The code is single use and is discarded after too many wrong attempts.
+func (ps *PortalService) VerifyOTP(ctx context.Context, meterNumber, code string) (string, *models.Customer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := verifyOTP(ctx, ps.otpsCollection, meterNumber, code); err != nil {
+		return "", nil, err
+	}
+
+	var customer models.Customer
+	if err := ps.customersCollection.FindOne(ctx, bson.M{"meter_number": meterNumber}).Decode(&customer); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", nil, errors.New("invalid or expired code")
+		}
+		return "", nil, fmt.Errorf("error fetching customer: %v", err)
+	}
+	if !portalLoginAllowed(&customer) {
+		return "", nil, errors.New("account is not active")
+	}
+
+	token, err := ps.jwtService.GenerateCustomerToken(&customer)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	return token, &customer, nil
+}
+
+// issueOTP stores a new code under key, replacing any earlier one, and returns it for sending.
+// It returns "" without error when a code was issued for key within otpResendInterval.
+func issueOTP(ctx context.Context, otps Collection, key string) (string, error) {
+	var existing portalOTP
+	err := otps.FindOne(ctx, bson.M{"_id": key}).Decode(&existing)
+	if err == nil && time.Since(existing.CreatedAt) < otpResendInterval {
+		return "", nil
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %v", err)
+	}
+
+	now := time.Now()
+	otp := portalOTP{
+		MeterNumber: key,
+		CodeHash:    hashOTP(key, code),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(otpTTL()),
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := otps.ReplaceOne(ctx, bson.M{"_id": key}, otp, opts); err != nil {
+		return "", fmt.Errorf("failed to save code: %v", err)
+	}
+
+	return code, nil
+}
+
+// verifyOTP checks code against the one issued under key. A correct code is used up; the code
+// is also discarded once it expires or after maxOTPAttempts guesses. Each guess is counted in the
+// same update that checks the limit, so parallel guesses cannot get past it, and only one
+// caller can use up a correct code.
+func verifyOTP(ctx context.Context, otps Collection, key, code string) error {
+	now := time.Now()
+
+	// The TTL monitor runs about once a minute, so expiry is checked here too
+	var otp portalOTP
+	err := otps.FindOneAndUpdate(ctx,
+		bson.M{"_id": key, "attempts": bson.M{"$lt": maxOTPAttempts}, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&otp)
+	if err == mongo.ErrNoDocuments {
+		otps.DeleteOne(ctx, bson.M{"_id": key, "$or": bson.A{
+			bson.M{"attempts": bson.M{"$gte": maxOTPAttempts}},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		}})
+		return errors.New("invalid or expired code")
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching code: %v", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(hashOTP(key, code))) != 1 {
+		if otp.Attempts >= maxOTPAttempts {
+			otps.DeleteOne(ctx, bson.M{"_id": key, "code_hash": otp.CodeHash})
+		}
+		return errors.New("invalid or expired code")
+	}
+
+	// Matching the hash keeps a newly issued code from being deleted in its place
+	result, err := otps.DeleteOne(ctx, bson.M{"_id": key, "code_hash": otp.CodeHash})
+	if err != nil {
+		return fmt.Errorf("failed to clear code: %v", err)
+	}
+	if result.DeletedCount != 1 {
+		return errors.New("invalid or expired code")
+	}
+
+	return nil
+}
+
+// portalLoginAllowed reports whether a customer may sign in to the portal. Archived and inactive
+// accounts may not; disconnected customers still can, to see what they owe.
+func portalLoginAllowed(customer *models.Customer) bool {
+	return customer.DeletedAt == nil && customer.Status != "archived" && customer.Status != "inactive"
+}
+
+// otpTTL returns how long a login code stays valid, from PORTAL_OTP_TTL_MINUTES (default 5)
+func otpTTL() time.Duration {
+	minutes := 5
+	if v, err := strconv.Atoi(os.Getenv("PORTAL_OTP_TTL_MINUTES")); err == nil && v > 0 {
+		minutes = v
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// generateOTP returns a random 6-digit code
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOTP hashes a code with its key so stored codes are not readable
+func hashOTP(key, code string) string {
+	sum := sha256.Sum256([]byte(key + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
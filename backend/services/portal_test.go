@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+)
+
+func TestPortalLoginAllowed(t *testing.T) {
+	archivedAt := time.Now()
+	tests := []struct {
+		customer models.Customer
+		want     bool
+	}{
+		{models.Customer{Status: "active"}, true},
+		{models.Customer{Status: "disconnected"}, true},
+		{models.Customer{Status: "inactive"}, false},
+		{models.Customer{Status: "archived"}, false},
+		{models.Customer{Status: "active", DeletedAt: &archivedAt}, false},
+	}
+
+	for _, tt := range tests {
+		if got := portalLoginAllowed(&tt.customer); got != tt.want {
+			t.Errorf("status %s, deleted %v: allowed = %v, want %v", tt.customer.Status, tt.customer.DeletedAt != nil, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyOTPLimitsParallelGuesses(t *testing.T) {
+	db := testDatabase(t)
+	otps := wrapCollection(db.Collection("portal_otps"))
+	ctx := context.Background()
+
+	code, err := issueOTP(ctx, otps, "MTR00000030")
+	if err != nil || code == "" {
+		t.Fatalf("issueOTP = %q, %v", code, err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// Many wrong guesses at once still only get maxOTPAttempts tries, after which the code is gone
+	var wg sync.WaitGroup
+	for i := 0; i < 4*maxOTPAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verifyOTP(ctx, otps, "MTR00000030", wrong)
+		}()
+	}
+	wg.Wait()
+
+	if err := verifyOTP(ctx, otps, "MTR00000030", code); err == nil {
+		t.Error("correct code accepted after the attempt limit")
+	}
+
+	// A correct code can be used once, even by parallel requests
+	code, err = issueOTP(ctx, otps, "MTR00000031")
+	if err != nil || code == "" {
+		t.Fatalf("issueOTP = %q, %v", code, err)
+	}
+
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if verifyOTP(ctx, otps, "MTR00000031", code) == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("code accepted %d times, want once", accepted)
+	}
+}
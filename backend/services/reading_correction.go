@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CorrectReading fixes a misread meter value in one transaction: the reading's bill is voided and
+// taken off the customer balance, the reading is recalculated against the one before it, and a new
+// bill is raised. The first recorded value is kept on the reading with the reason. Only a meter's
+// latest reading can be corrected, as later readings were billed from it, and not while its bill
+// has payments.
+func (bs *BillingService) CorrectReading(ctx context.Context, readingID primitive.ObjectID, newReading float64, reason, actingUser string) (*models.Bill, error) {
+	if reason == "" {
+		return nil, errors.New("correction reason is required")
+	}
+	if newReading < 0 {
+		return nil, errors.New("reading cannot be negative")
+	}
+
+	session, err := bs.readingsCollection.StartSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start session: %v", err)
+	}
+	defer session.EndSession(context.Background())
+
+	var resultBill *models.Bill
+	var customer *models.Customer
+
+	err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+		if err := session.StartTransaction(); err != nil {
+			return fmt.Errorf("failed to start transaction: %v", err)
+		}
+
+		// 1. The reading, which must be the meter's latest
+		var reading models.MeterReading
+		err := bs.readingsCollection.FindOne(sc, bson.M{"_id": readingID}).Decode(&reading)
+		if err != nil {
+			session.AbortTransaction(sc)
+			if err == mongo.ErrNoDocuments {
+				return errors.New("reading not found")
+			}
+			return fmt.Errorf("error fetching reading: %v", err)
+		}
+		if reading.Status == "cancelled" {
+			session.AbortTransaction(sc)
+			return errors.New("reading is cancelled")
+		}
+
+		later, err := bs.readingsCollection.CountDocuments(sc, bson.M{
+			"meter_number": reading.MeterNumber,
+			"status":       bson.M{"$ne": "cancelled"},
+			"reading_date": bson.M{"$gt": reading.ReadingDate},
+		})
+		if err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("error checking for later readings: %v", err)
+		}
+		if later > 0 {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("only the latest reading for meter %s can be corrected", reading.MeterNumber)
+		}
+
+		// 2. Void its bill and roll the customer back to the reading before
+		if err = bs.voidReadingBill(sc, &reading, "correcting", "Reading corrected: "+reason, actingUser); err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		customer, err = bs.GetCustomerByMeterNumber(sc, reading.MeterNumber)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		previous, err := bs.readingBefore(sc, &reading)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		tariff, err := bs.customerTariff(sc, customer)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		// 3. Recalculate the reading with the corrected value
+		request := reading
+		request.CurrentReading = newReading
+		corrected, arrears, err := prepareReading(&request, customer, previous, fixedChargeFor(customer, tariff))
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+		corrected.ID = reading.ID
+
+		if _, err = bs.readingsCollection.UpdateByID(sc, reading.ID, readingCorrectionUpdate(&reading, corrected, reason, actingUser, time.Now())); err != nil {
+			session.AbortTransaction(sc)
+			return fmt.Errorf("failed to update reading: %v", err)
+		}
+
+		// 4. Bill it again
+		resultBill, err = bs.generateBill(sc, customer, corrected, arrears, tariff)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		err = bs.updateCustomerAfterBilling(sc, customer.ID, corrected, resultBill.TotalAmount)
+		if err != nil {
+			session.AbortTransaction(sc)
+			return err
+		}
+
+		if err = session.CommitTransaction(sc); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	utils.Logf(ctx, "✏️ Reading %s corrected to %.2f; bill %s reissued for KSh %.2f",
+		readingID.Hex(), newReading, resultBill.BillNumber, resultBill.TotalAmount)
+
+	if !resultBill.Flagged && customer.PhoneNumber != "" {
+		go bs.sendBillSMSNotification(resultBill, customer)
+	}
+
+	return resultBill, nil
+}
+
+// readingBefore returns the meter's last valid reading before reading, or nil if it was the first
+func (bs *BillingService) readingBefore(sc mongo.SessionContext, reading *models.MeterReading) (*models.MeterReading, error) {
+	var previous models.MeterReading
+	err := bs.readingsCollection.FindOne(sc, bson.M{
+		"meter_number": reading.MeterNumber,
+		"status":       bson.M{"$ne": "cancelled"},
+		"reading_date": bson.M{"$lt": reading.ReadingDate},
+		"_id":          bson.M{"$ne": reading.ID},
+	}, options.FindOne().SetSort(bson.M{"reading_date": -1})).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching previous reading: %v", err)
+	}
+	return &previous, nil
+}
+
+// readingCorrectionUpdate sets the recalculated values from corrected on the stored reading,
+// keeping what was captured in the field, and records the correction. A corrected disputed
+// reading counts as resolved.
+func readingCorrectionUpdate(original, corrected *models.MeterReading, reason, actingUser string, now time.Time) bson.M {
+	firstValue := original.CurrentReading
+	if original.OriginalReading != nil {
+		firstValue = *original.OriginalReading
+	}
+
+	set := bson.M{
+		"previous_reading":   corrected.PreviousReading,
+		"current_reading":    corrected.CurrentReading,
+		"consumption":        corrected.Consumption,
+		"rate_per_unit":      corrected.RatePerUnit,
+		"water_charge":       corrected.WaterCharge,
+		"fixed_charge":       corrected.FixedCharge,
+		"proration_factor":   corrected.Proration,
+		"estimate_deviation": corrected.EstimateDeviation,
+		"needs_review":       corrected.NeedsReview,
+		"review_reason":      corrected.ReviewReason,
+		"rollover":           corrected.Rollover,
+		"status":             corrected.Status,
+		"original_reading":   firstValue,
+		"correction_reason":  reason,
+		"corrected_by":       actingUser,
+		"corrected_at":       now,
+		"updated_at":         now,
+	}
+	if original.Status == "disputed" {
+		set["resolution"] = "Reading corrected: " + reason
+		set["resolved_by"] = actingUser
+		set["resolved_at"] = now
+	}
+
+	return bson.M{"$set": set}
+}
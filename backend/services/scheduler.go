@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Job is a recurring task. Run returns a short description of what it did for the log.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Scheduler runs jobs on a fixed interval in the background. Each run first takes a lease on the
+// job's document in job_locks, so when several API instances are running only one of them runs a
+// job per interval.
+type Scheduler struct {
+	locks    Collection
+	instance string
+	jobs     []Job
+}
+
+func NewScheduler(locks *mongo.Collection) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		locks:    wrapCollection(locks),
+		instance: fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Add registers job if it is enabled. JOB_<NAME>_ENABLED turns a job on or off, overriding
+// enabledByDefault, and JOB_<NAME>_INTERVAL_MINUTES overrides its interval.
+func (s *Scheduler) Add(job Job, enabledByDefault bool) {
+	prefix := "JOB_" + strings.ToUpper(job.Name)
+
+	enabled := enabledByDefault
+	if v, err := strconv.ParseBool(os.Getenv(prefix + "_ENABLED")); err == nil {
+		enabled = v
+	}
+	if !enabled {
+		log.Printf("⏸️ Job %s disabled", job.Name)
+		return
+	}
+
+	if v, err := strconv.Atoi(os.Getenv(prefix + "_INTERVAL_MINUTES")); err == nil && v > 0 {
+		job.Interval = time.Duration(v) * time.Minute
+	}
+	if job.Timeout == 0 {
+		job.Timeout = 5 * time.Minute
+	}
+
+	s.jobs = append(s.jobs, job)
+	log.Printf("🗓️ Job %s scheduled every %s", job.Name, job.Interval)
+}
+
+// Start runs every registered job once and then on its interval until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		go func(job Job) {
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+
+			for {
+				s.runOnce(ctx, job)
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
+
+// runOnce runs job if no instance has run it within the last interval
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	acquired, err := s.acquire(ctx, job)
+	if err != nil {
+		log.Printf("❌ Job %s: failed to take lock: %v", job.Name, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	log.Printf("▶️ Job %s started", job.Name)
+	started := time.Now()
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	outcome, err := job.Run(runCtx)
+	cancel()
+
+	status := "ok"
+	if err != nil {
+		status = "failed"
+		outcome = err.Error()
+		log.Printf("❌ Job %s failed after %s: %v", job.Name, time.Since(started).Round(time.Millisecond), err)
+	} else {
+		log.Printf("✅ Job %s finished in %s: %s", job.Name, time.Since(started).Round(time.Millisecond), outcome)
+	}
+
+	s.recordOutcome(ctx, job, status, outcome)
+}
+
+// leaseDuration is how long a run holds the job's lock: until just short of its next run, but
+// never less than the run's timeout, so a slow run cannot be started again while it is going.
+func leaseDuration(job Job) time.Duration {
+	slack := job.Interval / 10
+	if slack > time.Minute {
+		slack = time.Minute
+	}
+
+	lease := job.Interval - slack
+	if lease < job.Timeout {
+		lease = job.Timeout
+	}
+	return lease
+}
+
+// acquire leases the job's lock for leaseDuration. The lock is not released when the run
+// finishes, which is what stops another instance's ticker from running it again early.
+// A document that is still leased makes the upsert collide on _id, meaning someone else holds it.
+func (s *Scheduler) acquire(ctx context.Context, job Job) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err := s.locks.UpdateOne(ctx,
+		bson.M{"_id": job.Name, "locked_until": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{
+			"locked_until": now.Add(leaseDuration(job)),
+			"owner":        s.instance,
+			"started_at":   now,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordOutcome keeps the last run's result on the lock document for operators to inspect
+func (s *Scheduler) recordOutcome(ctx context.Context, job Job, status, outcome string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	_, err := s.locks.UpdateOne(ctx, bson.M{"_id": job.Name, "owner": s.instance}, bson.M{"$set": bson.M{
+		"finished_at": time.Now(),
+		"last_status": status,
+		"last_result": outcome,
+	}})
+	if err != nil {
+		log.Printf("⚠️ Job %s: failed to record outcome: %v", job.Name, err)
+	}
+}
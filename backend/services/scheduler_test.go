@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseDuration(t *testing.T) {
+	tests := []struct {
+		interval, timeout, want time.Duration
+	}{
+		{time.Hour, 5 * time.Minute, 59 * time.Minute},         // Slack capped at a minute
+		{10 * time.Minute, time.Minute, 9 * time.Minute},       // A tenth of the interval
+		{5 * time.Minute, 30 * time.Minute, 30 * time.Minute},  // Run can outlast the interval
+		{15 * time.Minute, 15 * time.Minute, 15 * time.Minute}, // Timeout equal to the interval
+	}
+
+	for _, tt := range tests {
+		job := Job{Name: "test", Interval: tt.interval, Timeout: tt.timeout}
+		if got := leaseDuration(job); got != tt.want {
+			t.Errorf("interval %s, timeout %s: lease %s, want %s", tt.interval, tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -2,12 +2,12 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,15 +20,24 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrSMSOptedOut is returned, and logged as skipped_opt_out, when a notification is not sent
+// because the customer has asked for no SMS
+var ErrSMSOptedOut = errors.New("customer has opted out of SMS")
+
+// unsentSMSStatuses are SMS log statuses for messages that never reached the provider
+var unsentSMSStatuses = bson.A{"failed", "skipped_opt_out"}
+
 type SMSService struct {
-	apiKey    string
-	username  string
-	senderID  string
 	db        *mongo.Database
+	sender    SMSSender
 	isEnabled bool
 	provider  string
+	quiet     *quietHours // Nil when notifications may go at any hour
 }
 
+// NewSMSService selects an SMS provider from the environment.
+// SMS_PROVIDER ("twilio" or "africastalking") picks one explicitly; otherwise
+// whichever provider has credentials is used, falling back to mock mode.
 func NewSMSService(db *mongo.Database) (*SMSService, error) {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -36,261 +45,633 @@ func NewSMSService(db *mongo.Database) (*SMSService, error) {
 	}
 
 	// Get Africa's Talking credentials
-	apiKey := os.Getenv("AFRICASTALKING_API_KEY")
-	username := os.Getenv("AFRICASTALKING_USERNAME")
-	senderID := os.Getenv("AFRICASTALKING_SENDER_ID")
+	atAPIKey := os.Getenv("AFRICASTALKING_API_KEY")
+	atUsername := os.Getenv("AFRICASTALKING_USERNAME")
+	atSenderID := os.Getenv("AFRICASTALKING_SENDER_ID")
+	hasAT := atAPIKey != "" && atUsername != ""
+
+	// Get Twilio credentials
+	twilioSID := os.Getenv("TWILIO_ACCOUNT_SID")
+	twilioToken := os.Getenv("TWILIO_AUTH_TOKEN")
+	twilioFrom := os.Getenv("TWILIO_PHONE_NUMBER")
+	hasTwilio := twilioSID != "" && twilioToken != "" && twilioFrom != ""
+
+	quiet := loadQuietHours()
+
+	provider := strings.ToLower(os.Getenv("SMS_PROVIDER"))
+	if provider == "" {
+		if hasAT {
+			provider = "africastalking"
+		} else if hasTwilio {
+			provider = "twilio"
+		}
+	}
 
-	// Check if credentials are available
-	if apiKey == "" || username == "" {
-		log.Println("⚠️ Africa's Talking credentials not found. Using mock SMS service.")
+	switch {
+	case provider == "africastalking" && hasAT:
+		log.Println("✅ SMS Service initialized with Africa's Talking (HTTP client)")
+		return &SMSService{
+			db:        db,
+			quiet:     quiet,
+			sender:    NewAfricasTalkingProvider(atAPIKey, atUsername, atSenderID),
+			isEnabled: true,
+			provider:  "africastalking",
+		}, nil
+	case provider == "twilio" && hasTwilio:
+		log.Println("✅ SMS Service initialized with Twilio (HTTP client)")
 		return &SMSService{
 			db:        db,
-			isEnabled: false,
-			provider:  "mock",
+			quiet:     quiet,
+			sender:    NewTwilioProvider(twilioSID, twilioToken, twilioFrom),
+			isEnabled: true,
+			provider:  "twilio",
 		}, nil
 	}
 
-	log.Println("✅ SMS Service initialized with Africa's Talking (HTTP client)")
+	if provider != "" {
+		log.Printf("⚠️ Credentials for SMS provider %s not found. Using mock SMS service.", provider)
+	} else {
+		log.Println("⚠️ SMS provider credentials not found. Using mock SMS service.")
+	}
 	return &SMSService{
-		apiKey:    apiKey,
-		username:  username,
-		senderID:  senderID,
 		db:        db,
-		isEnabled: true,
-		provider:  "africastalking",
+		quiet:     quiet,
+		isEnabled: false,
+		provider:  "mock",
 	}, nil
 }
 
-// SendSMS sends an SMS message
-func (s *SMSService) SendSMS(to, message string) error {
-	if !s.isEnabled {
-		log.Printf("[MOCK SMS] To: %s, Message: %s", to, message)
-		return nil
+// NewSMSServiceWithSender builds an SMSService that sends through the given sender,
+// bypassing environment configuration. Tests pass a *MockSender.
+func NewSMSServiceWithSender(db *mongo.Database, sender SMSSender) *SMSService {
+	provider := "custom"
+	if _, ok := sender.(*MockSender); ok {
+		provider = "mock"
 	}
-	return s.sendAfricasTalkingSMS(to, message)
-}
+	quiet := loadQuietHours()
 
-// sendAfricasTalkingSMS sends SMS via Africa's Talking HTTP API
-func (s *SMSService) sendAfricasTalkingSMS(to, message string) error {
-	// Format phone number
-	phone := s.formatPhoneNumberForAT(to)
-
-	// Determine API environment
-	apiURL := "https://api.africastalking.com/version1/messaging"
-	if os.Getenv("APP_ENV") == "development" {
-		apiURL = "https://api.sandbox.africastalking.com/version1/messaging"
+	return &SMSService{
+		db:        db,
+		quiet:     quiet,
+		sender:    sender,
+		isEnabled: true,
+		provider:  provider,
 	}
+}
 
-	// Prepare form data (x-www-form-urlencoded)
-	formData := url.Values{}
-	formData.Set("username", s.username)
-	formData.Set("to", phone)
-	formData.Set("message", message)
+// SMSResult holds what the provider reported for a sent message. QueuedUntil is set instead when
+// the message was held back for quiet hours.
+type SMSResult struct {
+	MessageID   string
+	Provider    string
+	Cost        float64
+	QueuedUntil *time.Time
+}
 
-	// Add sender ID if available
-	if s.senderID != "" {
-		formData.Set("from", s.senderID)
+// SendSMS sends an SMS message through the configured provider and returns the provider's message ID and cost
+func (s *SMSService) SendSMS(to, message string) (*SMSResult, error) {
+	if !s.isEnabled {
+		log.Printf("[MOCK SMS] To: %s, Message: %s", to, message)
+		return &SMSResult{Provider: s.provider}, nil
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(formData.Encode()))
+	messageID, cost, err := s.sender.Send(to, message)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return nil, err
 	}
 
-	// Set correct headers for Africa's Talking
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("apiKey", s.apiKey)
+	return &SMSResult{MessageID: messageID, Provider: s.provider, Cost: cost}, nil
+}
 
-	// Send request
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("❌ Africa's Talking SMS failed: %v", err)
-		return fmt.Errorf("failed to send SMS: %v", err)
+// sendToCustomer sends message to the customer's phone unless they are over the daily limit
+func (s *SMSService) sendToCustomer(customer *models.Customer, message string) (*SMSResult, error) {
+	if err := s.checkDailyLimit(customer); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return s.SendSMS(customer.PhoneNumber, message)
+}
 
-	// Read response body for debugging
-	body, _ := io.ReadAll(resp.Body)
+// checkDailyLimit fails once the customer has been sent SMS_DAILY_LIMIT_PER_CUSTOMER messages
+// today (default 5, 0 for no limit). Failed sends, including ones refused by the limit, don't
+// count towards it; messages queued for quiet hours do.
+func (s *SMSService) checkDailyLimit(customer *models.Customer) error {
+	limit := int64(5)
+	if v, err := strconv.Atoi(os.Getenv("SMS_DAILY_LIMIT_PER_CUSTOMER")); err == nil && v >= 0 {
+		limit = int64(v)
+	}
 
-	// Check response
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		log.Printf("❌ Africa's Talking error (%d): %s", resp.StatusCode, string(body))
-		return fmt.Errorf("SMS API returned status: %d", resp.StatusCode)
+	if limit > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		sent, err := s.db.Collection("sms_logs").CountDocuments(ctx, bson.M{
+			"customer_id": customer.ID,
+			"sent_at":     bson.M{"$gte": startOfDay},
+			"status":      bson.M{"$nin": unsentSMSStatuses},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check daily SMS limit: %v", err)
+		}
+		if sent >= limit {
+			return fmt.Errorf("daily SMS limit of %d reached for meter %s", limit, customer.MeterNumber)
+		}
 	}
 
-	log.Printf("✅ Africa's Talking SMS sent to %s", phone)
-	log.Printf("📥 Response: %s", string(body))
 	return nil
 }
 
-// formatPhoneNumberForAT formats phone number for Africa's Talking (Kenya)
-func (s *SMSService) formatPhoneNumberForAT(phone string) string {
-	// Remove any non-digit characters
-	phone = strings.Map(func(r rune) rune {
-		if r >= '0' && r <= '9' {
-			return r
-		}
-		return -1
-	}, phone)
-
-	// Kenyan number formats: 0712345678 -> 254712345678
-	if strings.HasPrefix(phone, "0") && len(phone) == 10 {
-		phone = "254" + phone[1:]
+// sendNotice sends a notification to the customer unless they opted out of SMS. legalNotice
+// sends it regardless, for notices the customer must be given. During quiet hours the message is
+// queued instead, once it is logged; login codes and other urgent messages use sendToCustomer.
+func (s *SMSService) sendNotice(customer *models.Customer, message string, legalNotice bool) (*SMSResult, error) {
+	if customer.SMSOptOut && !legalNotice {
+		return nil, ErrSMSOptedOut
 	}
-
-	// If starts with +254, remove the +
-	if strings.HasPrefix(phone, "+254") {
-		phone = phone[1:]
+	if err := s.checkDailyLimit(customer); err != nil {
+		return nil, err
 	}
-
-	// Ensure we have the correct format (254XXXXXXXXX)
-	if !strings.HasPrefix(phone, "254") {
-		phone = "254" + phone
+	if until, quiet := s.quiet.holdUntil(time.Now()); quiet {
+		return &SMSResult{Provider: s.provider, QueuedUntil: &until}, nil
 	}
+	return s.SendSMS(customer.PhoneNumber, message)
+}
 
-	return phone
+// loadQuietHours reads the quiet hours setting, ignoring it with a warning when it is invalid
+func loadQuietHours() *quietHours {
+	quiet, err := quietHoursFromEnv()
+	if err != nil {
+		log.Printf("⚠️ Quiet hours disabled: %v", err)
+		return nil
+	}
+	if quiet != nil {
+		log.Printf("🌙 SMS notifications held from %s to %s (%s)",
+			os.Getenv("SMS_QUIET_START"), os.Getenv("SMS_QUIET_END"), quiet.location)
+	}
+	return quiet
 }
 
 // SendBillNotification sends a bill notification SMS to customer
 func (s *SMSService) SendBillNotification(bill *models.Bill, customer *models.Customer) error {
 	message := s.generateBillMessage(bill, customer)
-	err := s.SendSMS(customer.PhoneNumber, message)
-	s.logSMS(customer.ID, bill.ID, customer.PhoneNumber, message, err == nil, "bill_notification")
+	result, err := s.sendNotice(customer, message, false)
+	s.logSMS(customer.ID, bill.ID, customer.PhoneNumber, message, result, err, "bill_notification")
 	return err
 }
 
-// SendPaymentConfirmation sends payment confirmation SMS
-func (s *SMSService) SendPaymentConfirmation(payment *models.Payment, customer *models.Customer) error {
+// BulkSendBillNotifications sends bill notifications for many bills.
+// customers is keyed by customer ID; the result maps each bill ID to its send error (nil on success).
+func (s *SMSService) BulkSendBillNotifications(bills []models.Bill, customers map[primitive.ObjectID]models.Customer) map[primitive.ObjectID]error {
+	results := make(map[primitive.ObjectID]error, len(bills))
+
+	for i := range bills {
+		bill := &bills[i]
+
+		customer, ok := customers[bill.CustomerID]
+		if !ok {
+			results[bill.ID] = fmt.Errorf("customer not found for bill %s", bill.BillNumber)
+			continue
+		}
+
+		results[bill.ID] = s.SendBillNotification(bill, &customer)
+	}
+
+	return results
+}
+
+// SendPaymentConfirmation sends payment confirmation SMS and returns the status it was logged with,
+// "queued" when quiet hours hold it back.
+// customer should be loaded after the payment so the balance shown is the new one.
+func (s *SMSService) SendPaymentConfirmation(payment *models.Payment, customer *models.Customer) (string, error) {
+	balance := fmt.Sprintf("Balance: KSh %.2f", customer.Balance)
+	if customer.Balance < 0 {
+		balance = fmt.Sprintf("Credit: KSh %.2f", -customer.Balance)
+	}
+
 	message := fmt.Sprintf(
 		"Dear %s,\n\n"+
 			"✅ Payment Received: KSh %.2f\n"+
 			"Receipt: %s\n"+
 			"Meter: %s\n"+
-			"Date: %s\n\n"+
+			"Date: %s\n"+
+			"%s\n\n"+
 			"Thank you for your payment!\n"+
-			"Rochi Pure Water",
+			"%s",
 		customer.FirstName,
 		payment.Amount,
 		payment.ReceiptNumber,
 		payment.MeterNumber,
 		payment.PaymentDate.Format("02 Jan 2006"),
+		balance,
+		company.Name,
 	)
 
-	err := s.SendSMS(customer.PhoneNumber, message)
-	s.logSMS(customer.ID, payment.BillID, customer.PhoneNumber, message, err == nil, "payment_confirmation")
-	return err
+	result, err := s.sendNotice(customer, message, false)
+	status := s.saveSMSLog(models.SMSLog{
+		CustomerID:    customer.ID,
+		BillID:        payment.BillID,
+		MeterNumber:   payment.MeterNumber,
+		PhoneNumber:   customer.PhoneNumber,
+		CustomerName:  customer.FullName(),
+		MessageType:   "payment_confirmation",
+		ReceiptNumber: payment.ReceiptNumber,
+		Message:       message,
+	}, result, err)
+	return status, err
 }
 
-// SendDisconnectionWarning sends disconnection warning SMS
-func (s *SMSService) SendDisconnectionWarning(bill *models.Bill, customer *models.Customer) error {
+// SendDisconnectionWarning sends disconnection warning SMS. overrideOptOut sends it to customers
+// who opted out of SMS, where the warning is a required legal notice.
+func (s *SMSService) SendDisconnectionWarning(bill *models.Bill, customer *models.Customer, overrideOptOut bool) error {
 	dueDate := bill.DueDate.Format("02 Jan 2006")
 
 	message := fmt.Sprintf(
 		"⚠️ URGENT: Dear %s,\n\n"+
 			"Your water account %s has overdue amount of KSh %.2f\n"+
 			"Original Due Date: %s\n"+
-			"Pay within 48 hours to avoid disconnection.\n\n"+
-			"Contact: 0700 000 000\n"+
-			"Rochi Pure Water",
+			"Pay within 48 hours to avoid disconnection.\n"+
+			"Pay via M-Pesa: Paybill %s, Account %s\n\n"+
+			"Contact: %s\n"+
+			"%s",
 		customer.FirstName,
 		bill.MeterNumber,
 		bill.Balance,
 		dueDate,
+		company.Paybill,
+		bill.MeterNumber,
+		company.SupportPhone,
+		company.Name,
 	)
 
-	err := s.SendSMS(customer.PhoneNumber, message)
-	s.logSMS(customer.ID, bill.ID, customer.PhoneNumber, message, err == nil, "disconnection_warning")
+	result, err := s.sendNotice(customer, message, overrideOptOut)
+	s.logSMS(customer.ID, bill.ID, customer.PhoneNumber, message, result, err, "disconnection_warning")
 	return err
 }
 
-// generateBillMessage creates the SMS message for a bill
+// Seeded template names
+const (
+	billNotificationTemplate   = "Bill Notification"
+	reconnectionNoticeTemplate = "Reconnection Notice"
+)
+
+// RenderTemplate loads the active SMS template with the given name and substitutes
+// its {variable} tokens; {company_name}, {paybill} and {support_phone} are always available.
+// It fails if any declared variable is left unsubstituted.
+func (s *SMSService) RenderTemplate(templateName string, vars map[string]string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var template models.NotificationTemplate
+	filter := bson.M{"name": templateName, "template_type": "sms", "language": "en", "is_active": true}
+	err := s.db.Collection("notification_templates").FindOne(ctx, filter).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", fmt.Errorf("active template %s not found", templateName)
+		}
+		return "", fmt.Errorf("error fetching template %s: %v", templateName, err)
+	}
+
+	body := template.Body
+	for name, value := range vars {
+		body = strings.ReplaceAll(body, "{"+name+"}", value)
+	}
+	for name, value := range companyTemplateVars() {
+		body = strings.ReplaceAll(body, "{"+name+"}", value)
+	}
+
+	var missing []string
+	for _, variable := range template.Variables {
+		token := "{" + strings.Trim(variable, "{}") + "}"
+		if strings.Contains(body, token) {
+			missing = append(missing, token)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s has unsubstituted variables: %s",
+			templateName, strings.Join(missing, ", "))
+	}
+
+	return body, nil
+}
+
+// companyTemplateVars are available to every template
+func companyTemplateVars() map[string]string {
+	return map[string]string{
+		"company_name":  company.Name,
+		"paybill":       company.Paybill,
+		"support_phone": company.SupportPhone,
+	}
+}
+
+// billTemplateVars builds the template variables available to bill messages
+func billTemplateVars(bill *models.Bill, customer *models.Customer) map[string]string {
+	period := bill.BillingPeriod
+	if period == "" {
+		period = time.Now().Format("January 2006")
+	}
+
+	return map[string]string{
+		"customer_name":    customer.FullName(),
+		"first_name":       customer.FirstName,
+		"bill_number":      bill.BillNumber,
+		"meter_number":     bill.MeterNumber,
+		"billing_period":   period,
+		"previous_reading": fmt.Sprintf("%.1f", bill.PreviousReading),
+		"current_reading":  fmt.Sprintf("%.1f", bill.CurrentReading),
+		"consumption":      fmt.Sprintf("%.1f", bill.Consumption),
+		"unit":             bill.ConsumptionUnit(),
+		"amount":           fmt.Sprintf("%.0f", bill.TotalAmount),
+		"balance":          fmt.Sprintf("%.2f", bill.Balance),
+		"arrears":          fmt.Sprintf("%.2f", bill.Arrears),
+		"due_date":         bill.DueDate.Format("02 Jan 2006"),
+		"paybill":          company.Paybill,
+		"company_name":     company.Name,
+	}
+}
+
+// SendReconnectionNotice tells a customer their supply has been restored
+func (s *SMSService) SendReconnectionNotice(customer *models.Customer) error {
+	message, err := s.RenderTemplate(reconnectionNoticeTemplate, map[string]string{
+		"customer_name": customer.FullName(),
+		"meter_number":  customer.MeterNumber,
+	})
+	if err != nil {
+		log.Printf("⚠️ Using default reconnection message: %v", err)
+		message = fmt.Sprintf(
+			"Dear %s,\nYour water supply for meter %s has been reconnected.\n"+
+				"Please ensure future payments are made on time to avoid disconnection.",
+			customer.FullName(), customer.MeterNumber)
+	}
+
+	result, err := s.sendNotice(customer, message, false)
+	s.logSMS(customer.ID, primitive.NilObjectID, customer.PhoneNumber, message, result, err, "reconnection_notice")
+	return err
+}
+
+// SendLoginCode texts a customer portal login code. The code is masked in the SMS log.
+func (s *SMSService) SendLoginCode(customer *models.Customer, code string, validFor time.Duration) error {
+	format := "Your %s portal code is %s. It expires in %d minutes. Do not share it with anyone."
+	minutes := int(validFor.Minutes())
+
+	result, err := s.sendToCustomer(customer, fmt.Sprintf(format, company.Name, code, minutes))
+	s.logSMS(customer.ID, primitive.NilObjectID, customer.PhoneNumber, fmt.Sprintf(format, company.Name, "******", minutes), result, err, "portal_otp")
+	return err
+}
+
+// SendPasswordResetCode texts a staff user the code for resetting a forgotten password
+func (s *SMSService) SendPasswordResetCode(user *models.User, code string, validFor time.Duration) error {
+	format := "Your %s password reset code is %s. It expires in %d minutes. If you did not ask to reset your password, contact your administrator."
+	minutes := int(validFor.Minutes())
+
+	result, err := s.SendSMS(user.PhoneNumber, fmt.Sprintf(format, company.Name, code, minutes))
+	s.logSMS(primitive.NilObjectID, primitive.NilObjectID, user.PhoneNumber, fmt.Sprintf(format, company.Name, "******", minutes), result, err, "password_reset")
+	return err
+}
+
+// generateBillMessage creates the SMS message for a bill from the bill notification
+// template, falling back to the built-in wording if the template cannot be rendered
 func (s *SMSService) generateBillMessage(bill *models.Bill, customer *models.Customer) string {
-	dueDate := bill.DueDate.Format("02 Jan 2006")
+	vars := billTemplateVars(bill, customer)
 
-	message := fmt.Sprintf(
+	message, err := s.RenderTemplate(billNotificationTemplate, vars)
+	if err == nil {
+		return message
+	}
+	log.Printf("⚠️ Using default bill message: %v", err)
+
+	return fmt.Sprintf(
 		"Dear %s,\n\n"+
 			"Your water bill for %s is now ready.\n\n"+
 			"Meter: %s\n"+
-			"Previous Reading: %.1f units\n"+
-			"Current Reading: %.1f units\n"+
-			"Consumption: %.1f units\n"+
-			"Amount Due: KSh %.0f\n"+
+			"Previous Reading: %s %s\n"+
+			"Current Reading: %s %s\n"+
+			"Consumption: %s %s\n"+
+			"Amount Due: KSh %s\n"+
 			"Due Date: %s\n\n"+
+			"Pay via M-Pesa: Paybill %s, Account %s\n"+
 			"Please make payment to avoid service interruption.\n\n"+
 			"Thank you,\n"+
-			"Rochi Pure Water",
-		customer.FirstName,
-		bill.BillingPeriod,
-		bill.MeterNumber,
-		bill.PreviousReading,
-		bill.CurrentReading,
-		bill.Consumption,
-		bill.TotalAmount,
-		dueDate,
+			"%s",
+		vars["customer_name"],
+		vars["billing_period"],
+		vars["meter_number"],
+		vars["previous_reading"], vars["unit"],
+		vars["current_reading"], vars["unit"],
+		vars["consumption"], vars["unit"],
+		vars["amount"],
+		vars["due_date"],
+		vars["paybill"],
+		vars["meter_number"],
+		vars["company_name"],
 	)
-
-	return message
 }
 
 // logSMS logs SMS sending to database
-func (s *SMSService) logSMS(customerID, billID primitive.ObjectID, phone, message string, success bool, messageType string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	collection := s.db.Collection("sms_logs")
-
-	smsLog := models.SMSLog{
-		ID:          primitive.NewObjectID(),
+func (s *SMSService) logSMS(customerID, billID primitive.ObjectID, phone, message string, result *SMSResult, sendErr error, messageType string) {
+	s.saveSMSLog(models.SMSLog{
 		CustomerID:  customerID,
 		BillID:      billID,
 		PhoneNumber: phone,
 		Message:     message,
 		MessageType: messageType,
-		Status:      "sent",
-		SentAt:      time.Now(),
-		Provider:    s.provider,
+	}, result, sendErr)
+}
+
+// saveSMSLog fills in the send outcome on smsLog, stores it and returns the status it was given
+func (s *SMSService) saveSMSLog(smsLog models.SMSLog, result *SMSResult, sendErr error) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := s.db.Collection("sms_logs")
+
+	smsLog.ID = primitive.NewObjectID()
+	smsLog.Status = "sent"
+	smsLog.SentAt = time.Now()
+	smsLog.Provider = s.provider
+	smsLog.Attempts = 1
+
+	if result != nil {
+		smsLog.MessageID = result.MessageID
+		smsLog.Provider = result.Provider
+		smsLog.Cost = result.Cost
+		if result.QueuedUntil != nil {
+			smsLog.Status = "queued"
+		}
 	}
 
-	if !success {
+	switch {
+	case errors.Is(sendErr, ErrSMSOptedOut):
+		smsLog.Status = "skipped_opt_out"
+	case sendErr != nil:
 		smsLog.Status = "failed"
+		smsLog.Error = sendErr.Error()
+		nextRetry := smsLog.SentAt.Add(smsRetryBackoff(1))
+		smsLog.NextRetryAt = &nextRetry
 	}
 
 	_, err := collection.InsertOne(ctx, smsLog)
 	if err != nil {
 		log.Printf("Failed to log SMS: %v", err)
+		return smsLog.Status
+	}
+
+	if smsLog.Status == "queued" {
+		if err := s.queueSMS(ctx, smsLog.ID, smsLog.PhoneNumber, smsLog.Message, *result.QueuedUntil); err != nil {
+			log.Printf("⚠️ %v; marking %s failed so it is retried", err, smsLog.ID.Hex())
+			collection.UpdateByID(ctx, smsLog.ID, bson.M{"$set": bson.M{"status": "failed", "error": err.Error()}})
+			return "failed"
+		}
 	}
+	return smsLog.Status
 }
 
-// GetSMSLogs retrieves SMS logs with optional filtering
-func (s *SMSService) GetSMSLogs(filter bson.M, limit int64) ([]models.SMSLog, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// UpdateDeliveryStatus records a provider delivery report against the matching SMS log
+func (s *SMSService) UpdateDeliveryStatus(ctx context.Context, messageID, status, errMsg string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	collection := s.db.Collection("sms_logs")
+
+	set := bson.M{"status": status}
+	if errMsg != "" {
+		set["error"] = errMsg
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"message_id": messageID}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to update SMS delivery status: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("sms log with message ID %s not found", messageID)
+	}
+
+	return nil
+}
+
+// GetSMSLogs retrieves a page of SMS logs matching filter, newest first, and how many match in
+// total. A limit of 0 returns every match.
+func (s *SMSService) GetSMSLogs(ctx context.Context, filter bson.M, page, limit int64) ([]models.SMSLog, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	collection := s.db.Collection("sms_logs")
 
 	opts := options.Find().SetSort(bson.M{"sent_at": -1})
 	if limit > 0 {
-		opts.SetLimit(limit)
+		if page < 1 {
+			page = 1
+		}
+		opts.SetSkip((page - 1) * limit).SetLimit(limit)
 	}
 
 	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch SMS logs: %v", err)
+		return nil, 0, fmt.Errorf("failed to fetch SMS logs: %v", err)
 	}
 	defer cursor.Close(ctx)
 
-	var logs []models.SMSLog
+	logs := []models.SMSLog{}
 	if err = cursor.All(ctx, &logs); err != nil {
-		return nil, fmt.Errorf("failed to decode SMS logs: %v", err)
+		return nil, 0, fmt.Errorf("failed to decode SMS logs: %v", err)
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count SMS logs: %v", err)
+	}
+
+	return logs, total, nil
+}
+
+// SMSSpendGroup is the spend on one message type through one provider
+type SMSSpendGroup struct {
+	MessageType string  `bson:"message_type" json:"message_type"`
+	Provider    string  `bson:"provider" json:"provider"`
+	Messages    int64   `bson:"messages" json:"messages"`
+	Cost        float64 `bson:"cost" json:"cost"`
+	Untracked   int64   `bson:"untracked" json:"untracked"` // Sent without a recorded cost
+}
+
+// SpendSummary totals SMS spend over [From, To). Untracked messages were sent before costs were
+// recorded, or through a provider that does not report them, and count as free in the totals.
+type SpendSummary struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Messages  int64           `json:"messages"`
+	Cost      float64         `json:"cost"`
+	Untracked int64           `json:"untracked"`
+	Groups    []SMSSpendGroup `json:"groups"`
+}
+
+// GetSpendSummary groups the SMS sent in [from, to) by message type and provider, most expensive
+// first. Failed, skipped and still queued messages are not charged and are left out.
+func (s *SMSService) GetSpendSummary(ctx context.Context, from, to time.Time) (*SpendSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	collection := s.db.Collection("sms_logs")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"sent_at": bson.M{"$gte": from, "$lt": to},
+			"status":  bson.M{"$nin": append(bson.A{"queued"}, unsentSMSStatuses...)},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"message_type": "$message_type", "provider": "$provider"},
+			"messages": bson.M{"$sum": 1},
+			"cost":     bson.M{"$sum": bson.M{"$ifNull": bson.A{"$cost", 0}}},
+			"untracked": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$gt": bson.A{"$cost", 0}}, 0, 1},
+			}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"message_type": "$_id.message_type",
+			"provider":     "$_id.provider",
+			"messages":     1,
+			"cost":         1,
+			"untracked":    1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "cost", Value: -1}, {Key: "messages", Value: -1}}}},
 	}
 
-	return logs, nil
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate SMS spend: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var groups []SMSSpendGroup
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("failed to decode SMS spend: %v", err)
+	}
+
+	return newSpendSummary(from, to, groups), nil
+}
+
+// newSpendSummary adds up the per-group spend
+func newSpendSummary(from, to time.Time, groups []SMSSpendGroup) *SpendSummary {
+	summary := &SpendSummary{From: from, To: to, Groups: groups}
+	if summary.Groups == nil {
+		summary.Groups = []SMSSpendGroup{}
+	}
+	for _, group := range groups {
+		summary.Messages += group.Messages
+		summary.Cost += group.Cost
+		summary.Untracked += group.Untracked
+	}
+	summary.Cost = math.Round(summary.Cost*100) / 100
+	return summary
 }
 
 // IsEnabled returns true if SMS service is enabled
 func (s *SMSService) IsEnabled() bool {
 	return s.isEnabled
 }
+
+// Provider names the provider messages are sent through, "mock" when none is configured
+func (s *SMSService) Provider() string {
+	return s.provider
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"waterbilling/backend/utils"
+)
+
+// SMSProvider sends a single SMS and returns the provider's message ID and cost
+type SMSProvider interface {
+	Send(to, body string) (sid string, cost float64, err error)
+}
+
+// SMSSender is what SMSService sends through; every SMSProvider is an SMSSender
+type SMSSender = SMSProvider
+
+// SentSMS is a message captured by MockSender
+type SentSMS struct {
+	To   string
+	Body string
+}
+
+// MockSender records messages instead of sending them, for use in tests.
+// Err, if set, is returned from every Send.
+type MockSender struct {
+	mu   sync.Mutex
+	sent []SentSMS
+	Err  error
+}
+
+// Send records the message and returns Err
+func (m *MockSender) Send(to, body string) (string, float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, SentSMS{To: to, Body: body})
+	if m.Err != nil {
+		return "", 0, m.Err
+	}
+	return fmt.Sprintf("mock-%d", len(m.sent)), 0, nil
+}
+
+// Sent returns the messages recorded so far
+func (m *MockSender) Sent() []SentSMS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]SentSMS(nil), m.sent...)
+}
+
+// AfricasTalkingProvider sends SMS through the Africa's Talking messaging API
+type AfricasTalkingProvider struct {
+	apiKey   string
+	username string
+	senderID string
+	client   *http.Client
+}
+
+func NewAfricasTalkingProvider(apiKey, username, senderID string) *AfricasTalkingProvider {
+	return &AfricasTalkingProvider{
+		apiKey:   apiKey,
+		username: username,
+		senderID: senderID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send sends SMS via Africa's Talking HTTP API
+func (p *AfricasTalkingProvider) Send(to, body string) (string, float64, error) {
+	// Format phone number
+	phone, err := utils.FormatPhoneNumber(to)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Determine API environment
+	apiURL := "https://api.africastalking.com/version1/messaging"
+	if os.Getenv("APP_ENV") == "development" {
+		apiURL = "https://api.sandbox.africastalking.com/version1/messaging"
+	}
+
+	// Prepare form data (x-www-form-urlencoded)
+	formData := url.Values{}
+	formData.Set("username", p.username)
+	formData.Set("to", phone)
+	formData.Set("message", body)
+
+	// Add sender ID if available
+	if p.senderID != "" {
+		formData.Set("from", p.senderID)
+	}
+
+	// Create HTTP request
+	req, err := http.NewRequest("POST", apiURL, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// Set correct headers for Africa's Talking
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("apiKey", p.apiKey)
+
+	// Send request
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Printf("❌ Africa's Talking SMS failed: %v", err)
+		return "", 0, fmt.Errorf("failed to send SMS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response body for debugging
+	respBody, _ := io.ReadAll(resp.Body)
+
+	// Check response
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Africa's Talking error (%d): %s", resp.StatusCode, string(respBody))
+		return "", 0, fmt.Errorf("SMS API returned status: %d", resp.StatusCode)
+	}
+
+	log.Printf("📥 Response: %s", string(respBody))
+
+	messageID, cost, err := parseATRecipient(respBody)
+	if err != nil {
+		log.Printf("❌ Africa's Talking SMS to %s not accepted: %v", phone, err)
+		return "", 0, err
+	}
+
+	log.Printf("✅ Africa's Talking SMS sent to %s", phone)
+	return messageID, cost, nil
+}
+
+// parseATRecipient reads the message ID and cost from an Africa's Talking response, so delivery
+// reports and spend can be traced. A successful HTTP status can still carry a rejected recipient
+// (invalid number, insufficient balance, blacklisted), which is returned as an error.
+func parseATRecipient(respBody []byte) (string, float64, error) {
+	var atResp africasTalkingResponse
+	if err := json.Unmarshal(respBody, &atResp); err != nil {
+		return "", 0, fmt.Errorf("could not parse SMS API response: %v", err)
+	}
+
+	if len(atResp.SMSMessageData.Recipients) == 0 {
+		return "", 0, fmt.Errorf("SMS API accepted no recipients: %s", atResp.SMSMessageData.Message)
+	}
+
+	recipient := atResp.SMSMessageData.Recipients[0]
+	switch recipient.StatusCode {
+	case 100, 101, 102: // Processed, Sent, Queued
+	default:
+		return "", 0, fmt.Errorf("SMS API rejected recipient: %s (%d)", recipient.Status, recipient.StatusCode)
+	}
+
+	return recipient.MessageID, parseATCost(recipient.Cost), nil
+}
+
+// parseATCost converts an Africa's Talking cost string such as "KES 0.8000" to a number
+func parseATCost(cost string) float64 {
+	fields := strings.Fields(cost)
+	if len(fields) == 0 {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// africasTalkingResponse is the body returned by the Africa's Talking messaging API
+type africasTalkingResponse struct {
+	SMSMessageData struct {
+		Message    string `json:"Message"`
+		Recipients []struct {
+			StatusCode int    `json:"statusCode"`
+			Number     string `json:"number"`
+			Status     string `json:"status"`
+			Cost       string `json:"cost"`
+			MessageID  string `json:"messageId"`
+		} `json:"Recipients"`
+	} `json:"SMSMessageData"`
+}
+
+// TwilioProvider sends SMS through the Twilio Messages REST API
+type TwilioProvider struct {
+	accountSID string
+	authToken  string
+	fromNumber string
+	client     *http.Client
+}
+
+func NewTwilioProvider(accountSID, authToken, fromNumber string) *TwilioProvider {
+	return &TwilioProvider{
+		accountSID: accountSID,
+		authToken:  authToken,
+		fromNumber: fromNumber,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send sends SMS via the Twilio REST API
+func (p *TwilioProvider) Send(to, body string) (string, float64, error) {
+	apiURL := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", p.accountSID)
+
+	phone, err := utils.FormatPhoneNumber(to)
+	if err != nil {
+		return "", 0, err
+	}
+
+	formData := url.Values{}
+	formData.Set("To", phone)
+	formData.Set("From", p.fromNumber)
+	formData.Set("Body", body)
+
+	req, err := http.NewRequest("POST", apiURL, strings.NewReader(formData.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Printf("❌ Twilio SMS failed: %v", err)
+		return "", 0, fmt.Errorf("failed to send SMS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Twilio error (%d): %s", resp.StatusCode, string(respBody))
+		return "", 0, fmt.Errorf("SMS API returned status: %d", resp.StatusCode)
+	}
+
+	var twResp struct {
+		SID   string  `json:"sid"`
+		Price *string `json:"price"`
+	}
+	if err := json.Unmarshal(respBody, &twResp); err != nil {
+		log.Printf("⚠️ Could not parse Twilio response: %v", err)
+		return "", 0, nil
+	}
+
+	// Twilio reports price as a negative string and often only once the message is delivered
+	var cost float64
+	if twResp.Price != nil {
+		if price, err := strconv.ParseFloat(*twResp.Price, 64); err == nil {
+			cost = -price
+		}
+	}
+
+	log.Printf("✅ Twilio SMS sent to %s", to)
+	return twResp.SID, cost, nil
+}
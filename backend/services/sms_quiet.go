@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultSMSTimezone is where the utility's customers are. Quiet hours are in local time, and
+// the server usually runs in UTC.
+const defaultSMSTimezone = "Africa/Nairobi"
+
+// quietHours is a daily window, in minutes after local midnight, in which notifications are held
+// back. A window with start after end runs over midnight.
+type quietHours struct {
+	start, end int
+	location   *time.Location
+}
+
+// quietHoursFromEnv reads SMS_QUIET_START and SMS_QUIET_END (HH:MM) in SMS_TIMEZONE, which
+// defaults to Africa/Nairobi. It returns nil when quiet hours are not configured.
+func quietHoursFromEnv() (*quietHours, error) {
+	startValue, endValue := os.Getenv("SMS_QUIET_START"), os.Getenv("SMS_QUIET_END")
+	if startValue == "" && endValue == "" {
+		return nil, nil
+	}
+
+	start, err := parseClock(startValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMS_QUIET_START: %v", err)
+	}
+	end, err := parseClock(endValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMS_QUIET_END: %v", err)
+	}
+	if start == end {
+		return nil, nil
+	}
+
+	zone := os.Getenv("SMS_TIMEZONE")
+	if zone == "" {
+		zone = defaultSMSTimezone
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMS_TIMEZONE: %v", err)
+	}
+
+	return &quietHours{start: start, end: end, location: location}, nil
+}
+
+// parseClock turns HH:MM into minutes after midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// holdUntil returns when a message generated at now may be sent, and false if it may go now
+func (q *quietHours) holdUntil(now time.Time) (time.Time, bool) {
+	if q == nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+
+	quiet := minute >= q.start && minute < q.end
+	if q.start > q.end {
+		quiet = minute >= q.start || minute < q.end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	day := local.Day()
+	if minute >= q.end {
+		day++ // Quiet until tomorrow morning
+	}
+	return time.Date(local.Year(), local.Month(), day, q.end/60, q.end%60, 0, 0, q.location), true
+}
+
+// queuedSMS is a notification held in sms_queue until quiet hours end. Its sms_logs entry stays
+// "queued" until it is sent.
+type queuedSMS struct {
+	ID          primitive.ObjectID `bson:"_id"`
+	LogID       primitive.ObjectID `bson:"log_id"`
+	PhoneNumber string             `bson:"phone_number"`
+	Message     string             `bson:"message"`
+	SendAfter   time.Time          `bson:"send_after"`
+	CreatedAt   time.Time          `bson:"created_at"`
+}
+
+func (s *SMSService) queueSMS(ctx context.Context, logID primitive.ObjectID, phone, message string, sendAfter time.Time) error {
+	_, err := s.db.Collection("sms_queue").InsertOne(ctx, queuedSMS{
+		ID:          primitive.NewObjectID(),
+		LogID:       logID,
+		PhoneNumber: phone,
+		Message:     message,
+		SendAfter:   sendAfter,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue SMS: %v", err)
+	}
+	return nil
+}
+
+// FlushQueuedSMS sends the notifications held back by quiet hours that are now due, oldest
+// first. A send that fails is marked failed in sms_logs, where RetryFailedSMS picks it up.
+func (s *SMSService) FlushQueuedSMS(ctx context.Context) (sent, failed int, err error) {
+	if _, quiet := s.quiet.holdUntil(time.Now()); quiet {
+		return 0, 0, nil
+	}
+
+	queue := s.db.Collection("sms_queue")
+	logs := s.db.Collection("sms_logs")
+
+	for sent+failed < smsRetryBatch {
+		if ctx.Err() != nil {
+			return sent, failed, ctx.Err()
+		}
+
+		item, err := claimQueuedSMS(ctx, queue)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return sent, failed, err
+		}
+
+		result, sendErr := s.SendSMS(item.PhoneNumber, item.Message)
+		if s.recordResend(ctx, logs, item.LogID, 1, result, sendErr) {
+			sent++
+		} else {
+			failed++
+		}
+
+		deleteCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if _, err := queue.DeleteOne(deleteCtx, bson.M{"_id": item.ID}); err != nil {
+			log.Printf("Failed to remove %s from the SMS queue: %v", item.ID.Hex(), err)
+		}
+		cancel()
+	}
+
+	if sent+failed > 0 {
+		log.Printf("🌅 Sent %d SMS held for quiet hours, %d failed", sent, failed)
+	}
+	return sent, failed, nil
+}
+
+// claimQueuedSMS takes the oldest due message off the queue for a while, so an overlapping flush
+// does not send it too. The lease only runs out if this run dies before removing it.
+func claimQueuedSMS(ctx context.Context, queue *mongo.Collection) (*queuedSMS, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"send_after": 1})
+
+	var item queuedSMS
+	err := queue.FindOneAndUpdate(ctx,
+		bson.M{"send_after": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"send_after": now.Add(smsRetryLease)}},
+		opts,
+	).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queued SMS: %v", err)
+	}
+	return &item, nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSMSRetryMaxAge   = 24 * time.Hour
+	defaultSMSRetryAttempts = 3
+
+	// smsRetryBatch caps the messages one run re-sends, so a long outage is worked off over
+	// several runs instead of one burst
+	smsRetryBatch = 200
+
+	// smsRetryLease holds a claimed message back from other runs while it is re-sent
+	smsRetryLease = time.Hour
+)
+
+// smsNoRetryTypes are never re-sent: their logs hold a masked code, and a late code is useless
+var smsNoRetryTypes = bson.A{"portal_otp", "password_reset"}
+
+// smsRetryBackoff is how long to wait after attempt before trying again: 5 minutes after the
+// first send, doubling with each retry
+func smsRetryBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 8 {
+		attempt = 8
+	}
+	return 5 * time.Minute << (attempt - 1)
+}
+
+// RetryFailedSMS re-sends failed messages sent within maxAge that have had fewer than
+// maxAttempts tries and whose backoff has passed. Zero values use 24 hours and 3 attempts.
+// Messages refused by the daily per-customer limit, login codes and password resets are not
+// retried, and neither are messages to customers who have since opted out of SMS, apart from
+// disconnection warnings. Nothing is re-sent during quiet hours. Each message is claimed before
+// sending, so overlapping runs never send it twice.
+func (s *SMSService) RetryFailedSMS(ctx context.Context, maxAge time.Duration, maxAttempts int) (retried, succeeded int, err error) {
+	if maxAge <= 0 {
+		maxAge = defaultSMSRetryMaxAge
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultSMSRetryAttempts
+	}
+	if maxAttempts == 1 {
+		return 0, 0, nil
+	}
+	// Retried messages are all notices, so they wait for quiet hours to end like new ones
+	if _, quiet := s.quiet.holdUntil(time.Now()); quiet {
+		return 0, 0, nil
+	}
+
+	collection := s.db.Collection("sms_logs")
+
+	for retried < smsRetryBatch {
+		if ctx.Err() != nil {
+			return retried, succeeded, ctx.Err()
+		}
+
+		smsLog, err := s.claimFailedSMS(ctx, collection, maxAge, maxAttempts)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return retried, succeeded, err
+		}
+
+		optedOut, err := s.retryOptedOut(ctx, smsLog)
+		if err != nil {
+			return retried, succeeded, err
+		}
+		if optedOut {
+			s.skipOptedOut(ctx, collection, smsLog.ID)
+			continue
+		}
+		retried++
+
+		result, sendErr := s.SendSMS(smsLog.PhoneNumber, smsLog.Message)
+		if s.recordResend(ctx, collection, smsLog.ID, smsLog.Attempts, result, sendErr) {
+			succeeded++
+		}
+	}
+
+	if retried > 0 {
+		log.Printf("🔁 Retried %d failed SMS, %d sent", retried, succeeded)
+	}
+	return retried, succeeded, nil
+}
+
+// claimFailedSMS takes the oldest failed message due a retry, counting the attempt and leasing
+// it from other runs. Logs written before attempts were counted had one.
+func (s *SMSService) claimFailedSMS(ctx context.Context, collection *mongo.Collection, maxAge time.Duration, maxAttempts int) (*models.SMSLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"status":       "failed",
+		"sent_at":      bson.M{"$gte": now.Add(-maxAge)},
+		"phone_number": bson.M{"$ne": ""},
+		"message_type": bson.M{"$nin": smsNoRetryTypes},
+		"error":        bson.M{"$not": primitive.Regex{Pattern: "daily SMS limit"}},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"attempts": bson.M{"$exists": false}},
+				bson.M{"attempts": bson.M{"$lt": maxAttempts}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"next_retry_at": bson.M{"$exists": false}},
+				bson.M{"next_retry_at": bson.M{"$lte": now}},
+			}},
+		},
+	}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"attempts":      bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$attempts", 1}}, 1}},
+			"next_retry_at": now.Add(smsRetryLease),
+		}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.M{"sent_at": 1}).
+		SetReturnDocument(options.After)
+
+	var smsLog models.SMSLog
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&smsLog)
+	if err == mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim failed SMS: %v", err)
+	}
+	return &smsLog, nil
+}
+
+// retryOptedOut reports whether the customer a failed message was for has opted out of SMS since.
+// Disconnection warnings are legal notices and still go; messages not tied to a customer always do.
+func (s *SMSService) retryOptedOut(ctx context.Context, smsLog *models.SMSLog) (bool, error) {
+	if smsLog.CustomerID.IsZero() || smsLog.MessageType == "disconnection_warning" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var customer models.Customer
+	err := s.db.Collection("customers").FindOne(ctx, bson.M{"_id": smsLog.CustomerID},
+		options.FindOne().SetProjection(bson.M{"sms_opt_out": 1})).Decode(&customer)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check SMS opt-out: %v", err)
+	}
+	return customer.SMSOptOut, nil
+}
+
+// skipOptedOut marks a claimed message as not sent because the customer opted out
+func (s *SMSService) skipOptedOut(ctx context.Context, collection *mongo.Collection, logID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set":   bson.M{"status": "skipped_opt_out"},
+		"$unset": bson.M{"next_retry_at": ""},
+	}
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": logID}, update); err != nil {
+		log.Printf("Failed to record SMS opt-out for %s: %v", logID.Hex(), err)
+	}
+}
+
+// recordResend stores the outcome of a deferred send of the logged message, its attempts-th, and
+// reports whether it went through
+func (s *SMSService) recordResend(ctx context.Context, collection *mongo.Collection, logID primitive.ObjectID, attempts int, result *SMSResult, sendErr error) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var update bson.M
+	if sendErr != nil {
+		update = bson.M{"$set": bson.M{
+			"status":        "failed",
+			"error":         sendErr.Error(),
+			"next_retry_at": time.Now().Add(smsRetryBackoff(attempts)),
+		}}
+	} else {
+		set := bson.M{"status": "sent", "provider": s.provider}
+		if result != nil {
+			set["message_id"] = result.MessageID
+			set["provider"] = result.Provider
+			set["cost"] = result.Cost
+		}
+		update = bson.M{"$set": set, "$unset": bson.M{"error": "", "next_retry_at": ""}}
+	}
+
+	if _, err := collection.UpdateOne(ctx, bson.M{"_id": logID}, update); err != nil {
+		log.Printf("Failed to record SMS send for %s: %v", logID.Hex(), err)
+	}
+	return sendErr == nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewSpendSummary(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	summary := newSpendSummary(from, to, []SMSSpendGroup{
+		{MessageType: "bill_notification", Provider: "africastalking", Messages: 120, Cost: 96.1, Untracked: 0},
+		{MessageType: "bill_notification", Provider: "twilio", Messages: 30, Cost: 24.2, Untracked: 4},
+		{MessageType: "payment_confirmation", Provider: "mock", Messages: 5, Untracked: 5},
+	})
+
+	if summary.Messages != 155 || summary.Untracked != 9 {
+		t.Errorf("messages = %d, untracked = %d; want 155, 9", summary.Messages, summary.Untracked)
+	}
+	if summary.Cost != 120.3 {
+		t.Errorf("cost = %v, want 120.3", summary.Cost)
+	}
+
+	if empty := newSpendSummary(from, to, nil); empty.Groups == nil || empty.Cost != 0 {
+		t.Errorf("empty summary = %+v, want zero totals and no groups", empty)
+	}
+}
+
+func TestParseATRecipient(t *testing.T) {
+	sent := `{"SMSMessageData":{"Message":"Sent to 1/1 Total Cost: KES 0.8000","Recipients":[` +
+		`{"statusCode":101,"number":"+254700000001","status":"Success","cost":"KES 0.8000","messageId":"ATXid_1"}]}}`
+	messageID, cost, err := parseATRecipient([]byte(sent))
+	if err != nil || messageID != "ATXid_1" || cost != 0.8 {
+		t.Errorf("sent = %q, %v, %v; want ATXid_1, 0.8, nil", messageID, cost, err)
+	}
+
+	for name, body := range map[string]string{
+		"insufficient balance": `{"SMSMessageData":{"Message":"Sent to 0/1","Recipients":[` +
+			`{"statusCode":405,"number":"+254700000001","status":"InsufficientBalance","cost":"0","messageId":"None"}]}}`,
+		"invalid number": `{"SMSMessageData":{"Message":"Sent to 0/1","Recipients":[` +
+			`{"statusCode":403,"number":"+2547","status":"InvalidPhoneNumber","cost":"0","messageId":"None"}]}}`,
+		"no recipients": `{"SMSMessageData":{"Message":"InvalidSenderId","Recipients":[]}}`,
+		"unparseable":   `not json`,
+	} {
+		if _, _, err := parseATRecipient([]byte(body)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestSMSRetryBackoff(t *testing.T) {
+	want := []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute}
+	for i, backoff := range want {
+		if got := smsRetryBackoff(i + 1); got != backoff {
+			t.Errorf("smsRetryBackoff(%d) = %s, want %s", i+1, got, backoff)
+		}
+	}
+	if smsRetryBackoff(50) != smsRetryBackoff(8) {
+		t.Error("backoff is not capped")
+	}
+}
+
+func TestRetryFailedSMS(t *testing.T) {
+	db := testDatabase(t)
+	sender := &MockSender{}
+	sms := NewSMSServiceWithSender(db, sender)
+	ctx := context.Background()
+	logs := db.Collection("sms_logs")
+
+	due := time.Now().Add(-time.Minute)
+	insert := func(smsLog models.SMSLog) primitive.ObjectID {
+		smsLog.ID = primitive.NewObjectID()
+		smsLog.Status = "failed"
+		smsLog.PhoneNumber = "+254700000001"
+		smsLog.Message = "Your bill is ready"
+		if smsLog.SentAt.IsZero() {
+			smsLog.SentAt = time.Now().Add(-time.Hour)
+		}
+		if _, err := logs.InsertOne(ctx, smsLog); err != nil {
+			t.Fatal(err)
+		}
+		return smsLog.ID
+	}
+
+	legacy := insert(models.SMSLog{})                                                    // Logged before attempts were counted
+	exhausted := insert(models.SMSLog{Attempts: 3, NextRetryAt: &due})                   // Out of attempts
+	stale := insert(models.SMSLog{Attempts: 1, SentAt: time.Now().Add(-48 * time.Hour)}) // Too old
+	limited := insert(models.SMSLog{Attempts: 1, Error: "daily SMS limit of 5 reached for meter M1"})
+
+	retried, succeeded, err := sms.RetryFailedSMS(ctx, 24*time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 1 || succeeded != 1 {
+		t.Fatalf("retried %d, succeeded %d; want 1, 1", retried, succeeded)
+	}
+
+	var smsLog models.SMSLog
+	logs.FindOne(ctx, bson.M{"_id": legacy}).Decode(&smsLog)
+	if smsLog.Status != "sent" || smsLog.Attempts != 2 || smsLog.NextRetryAt != nil {
+		t.Errorf("retried log = status %s, attempts %d; want sent after 2", smsLog.Status, smsLog.Attempts)
+	}
+	for _, id := range []primitive.ObjectID{exhausted, stale, limited} {
+		var skipped models.SMSLog
+		logs.FindOne(ctx, bson.M{"_id": id}).Decode(&skipped)
+		if skipped.Status != "failed" {
+			t.Errorf("log %s was retried", id.Hex())
+		}
+	}
+
+	// A failed retry waits out its backoff before the next one
+	sender.Err = errors.New("provider unavailable")
+	failing := insert(models.SMSLog{Attempts: 1, NextRetryAt: &due})
+	if retried, succeeded, _ = sms.RetryFailedSMS(ctx, 24*time.Hour, 3); retried != 1 || succeeded != 0 {
+		t.Fatalf("retried %d, succeeded %d; want 1, 0", retried, succeeded)
+	}
+	if retried, _, _ = sms.RetryFailedSMS(ctx, 24*time.Hour, 3); retried != 0 {
+		t.Errorf("message retried again before its backoff")
+	}
+	logs.FindOne(ctx, bson.M{"_id": failing}).Decode(&smsLog)
+	if smsLog.Attempts != 2 || smsLog.Error != "provider unavailable" {
+		t.Errorf("failed retry = attempts %d, error %q", smsLog.Attempts, smsLog.Error)
+	}
+}
+
+func TestRetryFailedSMSSkipsCodesAndOptOuts(t *testing.T) {
+	db := testDatabase(t)
+	sender := &MockSender{}
+	sms := NewSMSServiceWithSender(db, sender)
+	ctx := context.Background()
+	logs := db.Collection("sms_logs")
+
+	optedOut := insertTestCustomer(t, db, "MTR00000020", 0, 0)
+	if _, err := db.Collection("customers").UpdateByID(ctx, optedOut.ID, bson.M{"$set": bson.M{"sms_opt_out": true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(customerID primitive.ObjectID, messageType string) primitive.ObjectID {
+		smsLog := models.SMSLog{
+			ID:          primitive.NewObjectID(),
+			CustomerID:  customerID,
+			PhoneNumber: "+254700000001",
+			MessageType: messageType,
+			Message:     "Your code is ******",
+			Status:      "failed",
+			Attempts:    1,
+			SentAt:      time.Now().Add(-time.Hour),
+		}
+		if _, err := logs.InsertOne(ctx, smsLog); err != nil {
+			t.Fatal(err)
+		}
+		return smsLog.ID
+	}
+
+	code := insert(primitive.NewObjectID(), "portal_otp")
+	reset := insert(primitive.NilObjectID, "password_reset")
+	bill := insert(optedOut.ID, "bill_notification")
+	warning := insert(optedOut.ID, "disconnection_warning")
+
+	retried, succeeded, err := sms.RetryFailedSMS(ctx, 24*time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried != 1 || succeeded != 1 {
+		t.Fatalf("retried %d, succeeded %d; want only the disconnection warning", retried, succeeded)
+	}
+
+	for id, want := range map[primitive.ObjectID]string{
+		code:    "failed",
+		reset:   "failed",
+		bill:    "skipped_opt_out",
+		warning: "sent",
+	} {
+		var smsLog models.SMSLog
+		logs.FindOne(ctx, bson.M{"_id": id}).Decode(&smsLog)
+		if smsLog.Status != want {
+			t.Errorf("%s log: status %s, want %s", smsLog.MessageType, smsLog.Status, want)
+		}
+	}
+}
+
+func TestSendNoticeRespectsOptOut(t *testing.T) {
+	t.Setenv("SMS_DAILY_LIMIT_PER_CUSTOMER", "0")
+	sender := &MockSender{}
+	sms := NewSMSServiceWithSender(nil, sender)
+	customer := &models.Customer{PhoneNumber: "+254700000001", SMSOptOut: true}
+
+	if _, err := sms.sendNotice(customer, "Your bill is ready", false); !errors.Is(err, ErrSMSOptedOut) {
+		t.Errorf("opted-out notice err = %v, want ErrSMSOptedOut", err)
+	}
+	if len(sender.Sent()) != 0 {
+		t.Fatal("SMS sent to an opted-out customer")
+	}
+
+	if _, err := sms.sendNotice(customer, "Disconnection notice", true); err != nil {
+		t.Fatalf("legal notice: %v", err)
+	}
+	if len(sender.Sent()) != 1 {
+		t.Errorf("legal notice was not sent")
+	}
+}
+
+func TestQuietHoursHoldUntil(t *testing.T) {
+	t.Setenv("SMS_QUIET_START", "21:00")
+	t.Setenv("SMS_QUIET_END", "07:00")
+	t.Setenv("SMS_TIMEZONE", "")
+	quiet, err := quietHoursFromEnv()
+	if err != nil || quiet == nil {
+		t.Fatalf("quietHoursFromEnv() = %v, %v", quiet, err)
+	}
+
+	// The server runs in UTC; Nairobi is three hours ahead
+	tests := []struct {
+		now       time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{time.Date(2026, 3, 10, 19, 30, 0, 0, time.UTC), true, time.Date(2026, 3, 11, 4, 0, 0, 0, time.UTC)}, // 22:30 local
+		{time.Date(2026, 3, 10, 2, 0, 0, 0, time.UTC), true, time.Date(2026, 3, 10, 4, 0, 0, 0, time.UTC)},   // 05:00 local
+		{time.Date(2026, 3, 10, 4, 0, 0, 0, time.UTC), false, time.Time{}},                                   // 07:00 local
+		{time.Date(2026, 3, 10, 17, 59, 0, 0, time.UTC), false, time.Time{}},                                 // 20:59 local
+	}
+	for _, tt := range tests {
+		until, isQuiet := quiet.holdUntil(tt.now)
+		if isQuiet != tt.wantQuiet || !until.Equal(tt.wantUntil) {
+			t.Errorf("holdUntil(%s) = %s, %v; want %s, %v", tt.now, until, isQuiet, tt.wantUntil, tt.wantQuiet)
+		}
+	}
+
+	t.Setenv("SMS_QUIET_END", "7am")
+	if _, err := quietHoursFromEnv(); err == nil {
+		t.Error("invalid SMS_QUIET_END was accepted")
+	}
+}
+
+func TestSendNoticeQueuesDuringQuietHours(t *testing.T) {
+	t.Setenv("SMS_DAILY_LIMIT_PER_CUSTOMER", "0")
+	sender := &MockSender{}
+	sms := NewSMSServiceWithSender(nil, sender)
+	sms.quiet = &quietHours{start: 0, end: 24*60 - 1, location: time.UTC} // Quiet all day but the last minute
+	if _, quiet := sms.quiet.holdUntil(time.Now()); !quiet {
+		t.Skip("running in the one unquiet minute")
+	}
+	customer := &models.Customer{PhoneNumber: "+254700000001"}
+
+	result, err := sms.sendNotice(customer, "Your bill is ready", false)
+	if err != nil || result.QueuedUntil == nil {
+		t.Fatalf("sendNotice = %+v, %v; want queued", result, err)
+	}
+	if len(sender.Sent()) != 0 {
+		t.Error("notice sent during quiet hours")
+	}
+
+	// Login codes are not held back
+	if result, err := sms.sendToCustomer(customer, "Your code is 123456"); err != nil || result.QueuedUntil != nil {
+		t.Errorf("sendToCustomer = %+v, %v; want sent", result, err)
+	}
+}
+
+func TestRetryFailedSMSWaitsForQuietHours(t *testing.T) {
+	sender := &MockSender{}
+	sms := NewSMSServiceWithSender(nil, sender)
+	sms.quiet = &quietHours{start: 0, end: 24*60 - 1, location: time.UTC} // Quiet all day but the last minute
+	if _, quiet := sms.quiet.holdUntil(time.Now()); !quiet {
+		t.Skip("running in the one unquiet minute")
+	}
+
+	// Returns before touching the database, which is nil here
+	retried, succeeded, err := sms.RetryFailedSMS(context.Background(), 24*time.Hour, 3)
+	if err != nil || retried != 0 || succeeded != 0 {
+		t.Errorf("RetryFailedSMS during quiet hours = %d, %d, %v; want nothing retried", retried, succeeded, err)
+	}
+	if len(sender.Sent()) != 0 {
+		t.Error("SMS re-sent during quiet hours")
+	}
+}
+
+func TestGetSMSLogsDateRange(t *testing.T) {
+	db := testDatabase(t)
+	sms := NewSMSServiceWithSender(db, &MockSender{})
+	ctx := context.Background()
+
+	for _, day := range []int{27, 28, 1, 2} {
+		month := time.March
+		if day > 20 {
+			month = time.February
+		}
+		db.Collection("sms_logs").InsertOne(ctx, models.SMSLog{
+			ID:     primitive.NewObjectID(),
+			Status: "sent",
+			SentAt: time.Date(2026, month, day, 10, 0, 0, 0, time.UTC),
+		})
+	}
+
+	filter := bson.M{"sent_at": bson.M{
+		"$gte": time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC),
+		"$lt":  time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC),
+	}}
+	logs, total, err := sms.GetSMSLogs(ctx, filter, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 || total != 2 {
+		t.Errorf("got %d of %d logs for 28 Feb to 1 Mar, want 2", len(logs), total)
+	}
+
+	// Newest first, one per page
+	logs, total, _ = sms.GetSMSLogs(ctx, filter, 2, 1)
+	if len(logs) != 1 || total != 2 || logs[0].SentAt.Day() != 28 {
+		t.Errorf("page 2 = %d logs of %d, want the 28 Feb log of 2", len(logs), total)
+	}
+}
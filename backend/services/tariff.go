@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TariffService struct {
+	tariffsCollection Collection
+}
+
+func NewTariffService(tariffs *mongo.Collection) *TariffService {
+	return &TariffService{
+		tariffsCollection: wrapCollection(tariffs),
+	}
+}
+
+// CreateTariff validates and inserts a new tariff
+func (ts *TariffService) CreateTariff(ctx context.Context, tariff *models.Tariff) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if tariff.Code == "" {
+		return errors.New("tariff code is required")
+	}
+
+	if err := validateTariff(tariff); err != nil {
+		return err
+	}
+
+	existing, err := ts.GetTariffByCode(ctx, tariff.Code)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("tariff with code %s already exists", tariff.Code)
+	}
+
+	tariff.ID = primitive.NewObjectID()
+	tariff.IsActive = true
+	tariff.CreatedAt = time.Now()
+	tariff.UpdatedAt = time.Now()
+
+	_, err = ts.tariffsCollection.InsertOne(ctx, tariff)
+	if err != nil {
+		return fmt.Errorf("failed to create tariff: %v", err)
+	}
+
+	return nil
+}
+
+// GetTariffByCode retrieves a tariff by its code, returning nil if it does not exist
+func (ts *TariffService) GetTariffByCode(ctx context.Context, code string) (*models.Tariff, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var tariff models.Tariff
+	err := ts.tariffsCollection.FindOne(ctx, bson.M{"code": code}).Decode(&tariff)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching tariff: %v", err)
+	}
+
+	return &tariff, nil
+}
+
+// ListTariffs retrieves tariffs, optionally filtered by customer type and active status
+func (ts *TariffService) ListTariffs(ctx context.Context, customerType string, activeOnly bool) ([]models.Tariff, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if customerType != "" {
+		filter["customer_type"] = customerType
+	}
+	if activeOnly {
+		filter["is_active"] = true
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "customer_type", Value: 1},
+		{Key: "effective_date", Value: -1},
+	})
+
+	cursor, err := ts.tariffsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tariffs: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tariffs []models.Tariff
+	if err = cursor.All(ctx, &tariffs); err != nil {
+		return nil, fmt.Errorf("error decoding tariffs: %v", err)
+	}
+
+	return tariffs, nil
+}
+
+// UpdateTariff replaces the editable fields of a tariff
+func (ts *TariffService) UpdateTariff(ctx context.Context, code string, tariff *models.Tariff) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := validateTariff(tariff); err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":           tariff.Name,
+			"customer_type":  tariff.CustomerType,
+			"description":    tariff.Description,
+			"base_rate":      tariff.BaseRate,
+			"fixed_charge":   tariff.FixedCharge,
+			"due_days":       tariff.DueDays,
+			"unit":           tariff.Unit,
+			"tiers":          tariff.Tiers,
+			"effective_date": tariff.EffectiveDate,
+			"expiry_date":    tariff.ExpiryDate,
+			"updated_at":     time.Now(),
+		},
+	}
+
+	result, err := ts.tariffsCollection.UpdateOne(ctx, bson.M{"code": code}, update)
+	if err != nil {
+		return fmt.Errorf("error updating tariff: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("tariff with code %s not found", code)
+	}
+
+	return nil
+}
+
+// DeactivateTariff marks a tariff inactive so it is no longer used for billing
+func (ts *TariffService) DeactivateTariff(ctx context.Context, code string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := ts.tariffsCollection.UpdateOne(ctx, bson.M{"code": code}, update)
+	if err != nil {
+		return fmt.Errorf("error deactivating tariff: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("tariff with code %s not found", code)
+	}
+
+	return nil
+}
+
+// GetActiveTariff returns the tariff in force for a customer type at the given time.
+// When several tariffs apply, the one with the latest effective date wins.
+func (ts *TariffService) GetActiveTariff(ctx context.Context, customerType string, at time.Time) (*models.Tariff, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"customer_type":  customerType,
+		"is_active":      true,
+		"effective_date": bson.M{"$lte": at},
+		"$or": []bson.M{
+			{"expiry_date": bson.M{"$exists": false}},
+			{"expiry_date": nil},
+			{"expiry_date": bson.M{"$gt": at}},
+		},
+	}
+
+	var tariff models.Tariff
+	opts := options.FindOne().SetSort(bson.M{"effective_date": -1})
+	err := ts.tariffsCollection.FindOne(ctx, filter, opts).Decode(&tariff)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching active tariff: %v", err)
+	}
+
+	return &tariff, nil
+}
+
+// validateTariff checks rates, dates and that tiers are contiguous and non-overlapping.
+// Tiers are sorted by minimum consumption; a zero maximum on the last tier means unbounded.
+func validateTariff(tariff *models.Tariff) error {
+	if tariff.EffectiveDate.IsZero() {
+		return errors.New("effective date is required")
+	}
+
+	if tariff.ExpiryDate != nil && !tariff.ExpiryDate.After(tariff.EffectiveDate) {
+		return errors.New("expiry date must be after effective date")
+	}
+
+	if tariff.BaseRate < 0 || tariff.FixedCharge < 0 {
+		return errors.New("rates and charges cannot be negative")
+	}
+
+	if tariff.DueDays < 0 {
+		return errors.New("due days cannot be negative")
+	}
+
+	if len(tariff.Tiers) == 0 {
+		return nil
+	}
+
+	sort.Slice(tariff.Tiers, func(i, j int) bool {
+		return tariff.Tiers[i].MinConsumption < tariff.Tiers[j].MinConsumption
+	})
+
+	if tariff.Tiers[0].MinConsumption != 0 {
+		return errors.New("first tier must start at 0")
+	}
+
+	last := len(tariff.Tiers) - 1
+	for i, tier := range tariff.Tiers {
+		if tier.Rate < 0 {
+			return fmt.Errorf("tier %d rate cannot be negative", i+1)
+		}
+
+		unbounded := i == last && tier.MaxConsumption == 0
+		if !unbounded && tier.MaxConsumption <= tier.MinConsumption {
+			return fmt.Errorf("tier %d maximum must be greater than its minimum", i+1)
+		}
+
+		if i > 0 && tier.MinConsumption != tariff.Tiers[i-1].MaxConsumption {
+			return fmt.Errorf("tier %d must start where tier %d ends (%.2f)",
+				i+1, i, tariff.Tiers[i-1].MaxConsumption)
+		}
+	}
+
+	return nil
+}
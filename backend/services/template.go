@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TemplateService struct {
+	templatesCollection Collection
+}
+
+func NewTemplateService(templates *mongo.Collection) *TemplateService {
+	return &TemplateService{
+		templatesCollection: wrapCollection(templates),
+	}
+}
+
+// CreateTemplate validates and inserts a notification template.
+// If the new template is active, any other active template with the same name and language is deactivated.
+func (ts *TemplateService) CreateTemplate(ctx context.Context, template *models.NotificationTemplate) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if template.Language == "" {
+		template.Language = "en"
+	}
+	if template.TemplateType == "" {
+		template.TemplateType = "sms"
+	}
+
+	if err := validateTemplate(template); err != nil {
+		return err
+	}
+
+	template.ID = primitive.NewObjectID()
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = time.Now()
+
+	if template.IsActive {
+		if err := ts.deactivateOthers(ctx, template); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ts.templatesCollection.InsertOne(ctx, template); err != nil {
+		return fmt.Errorf("failed to create template: %v", err)
+	}
+
+	return nil
+}
+
+// GetTemplateByID retrieves a template by ID, returning nil if it does not exist
+func (ts *TemplateService) GetTemplateByID(ctx context.Context, id primitive.ObjectID) (*models.NotificationTemplate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var template models.NotificationTemplate
+	err := ts.templatesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&template)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error fetching template: %v", err)
+	}
+
+	return &template, nil
+}
+
+// ListTemplates retrieves templates, optionally filtered by language and type
+func (ts *TemplateService) ListTemplates(ctx context.Context, language, templateType string) ([]models.NotificationTemplate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if language != "" {
+		filter["language"] = language
+	}
+	if templateType != "" {
+		filter["template_type"] = templateType
+	}
+
+	opts := options.Find().SetSort(bson.D{
+		{Key: "name", Value: 1},
+		{Key: "language", Value: 1},
+		{Key: "updated_at", Value: -1},
+	})
+
+	cursor, err := ts.templatesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching templates: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var templates []models.NotificationTemplate
+	if err = cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("error decoding templates: %v", err)
+	}
+
+	return templates, nil
+}
+
+// UpdateTemplate replaces the editable fields of a template.
+// If the template ends up active, the previously active template with the same name and language is deactivated.
+func (ts *TemplateService) UpdateTemplate(ctx context.Context, id primitive.ObjectID, template *models.NotificationTemplate) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if template.Language == "" {
+		template.Language = "en"
+	}
+	if template.TemplateType == "" {
+		template.TemplateType = "sms"
+	}
+
+	if err := validateTemplate(template); err != nil {
+		return err
+	}
+
+	template.ID = id
+	if template.IsActive {
+		if err := ts.deactivateOthers(ctx, template); err != nil {
+			return err
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"template_type": template.TemplateType,
+			"name":          template.Name,
+			"subject":       template.Subject,
+			"body":          template.Body,
+			"variables":     template.Variables,
+			"language":      template.Language,
+			"is_active":     template.IsActive,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	result, err := ts.templatesCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("error updating template: %v", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("template not found")
+	}
+
+	return nil
+}
+
+// SetTemplateStatus activates or deactivates a template
+func (ts *TemplateService) SetTemplateStatus(ctx context.Context, id primitive.ObjectID, isActive bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	template, err := ts.GetTemplateByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if template == nil {
+		return errors.New("template not found")
+	}
+
+	if isActive {
+		if err := ts.deactivateOthers(ctx, template); err != nil {
+			return err
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"is_active":  isActive,
+			"updated_at": time.Now(),
+		},
+	}
+
+	if _, err := ts.templatesCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+		return fmt.Errorf("error updating template status: %v", err)
+	}
+
+	return nil
+}
+
+// deactivateOthers deactivates every active template sharing the template's name and language
+func (ts *TemplateService) deactivateOthers(ctx context.Context, template *models.NotificationTemplate) error {
+	filter := bson.M{
+		"_id":       bson.M{"$ne": template.ID},
+		"name":      template.Name,
+		"language":  template.Language,
+		"is_active": true,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"is_active":  false,
+			"updated_at": time.Now(),
+		},
+	}
+
+	if _, err := ts.templatesCollection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("error deactivating previous template: %v", err)
+	}
+
+	return nil
+}
+
+// validateTemplate checks required fields and that every declared variable appears in the body
+func validateTemplate(template *models.NotificationTemplate) error {
+	if template.Name == "" || template.Body == "" {
+		return errors.New("template name and body are required")
+	}
+
+	if template.TemplateType != "sms" && template.TemplateType != "email" {
+		return fmt.Errorf("invalid template type: %s", template.TemplateType)
+	}
+
+	var missing []string
+	for _, variable := range template.Variables {
+		token := "{" + strings.Trim(variable, "{}") + "}"
+		if !strings.Contains(template.Body, token) {
+			missing = append(missing, token)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("variables not found in body: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
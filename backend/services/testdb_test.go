@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"waterbilling/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tests that need MongoDB connect to MONGODB_TEST_URI and are skipped when it is unset.
+// BillingService writes inside transactions, so the server must be a replica set:
+//
+//	docker run -d --name mongo-test -p 27017:27017 mongo:7 --replSet rs0
+//	docker exec mongo-test mongosh --quiet --eval 'rs.initiate()'
+//	MONGODB_TEST_URI='mongodb://localhost:27017/?directConnection=true' go test ./services/
+//
+// Each test gets a database of its own, dropped when the test finishes.
+
+// testDatabase connects to MONGODB_TEST_URI and returns a fresh, empty database
+func testDatabase(t testing.TB) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set; skipping test that needs MongoDB")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping %s: %v", uri, err)
+	}
+
+	db := client.Database("waterbilling_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	// Collections are created up front: MongoDB cannot create them inside a transaction on
+	// older servers
+	for _, name := range []string{"customers", "meter_readings", "bills", "payments", "tariffs", "sms_logs"} {
+		if err := db.CreateCollection(ctx, name); err != nil {
+			t.Fatalf("create collection %s: %v", name, err)
+		}
+	}
+
+	return db
+}
+
+// newTestBillingService returns a BillingService over a fresh test database, sending SMS
+// through the returned MockSender
+func newTestBillingService(t testing.TB) (*BillingService, *MockSender, *mongo.Database) {
+	t.Helper()
+
+	db := testDatabase(t)
+	sender := &MockSender{}
+	bs := NewBillingService(
+		db.Collection("customers"),
+		db.Collection("meter_readings"),
+		db.Collection("bills"),
+		db.Collection("payments"),
+		db.Collection("tariffs"),
+		NewSMSServiceWithSender(db, sender),
+		nil,
+	)
+	return bs, sender, db
+}
+
+// insertTestCustomer stores an active customer with the given meter number and starting values
+func insertTestCustomer(t testing.TB, db *mongo.Database, meterNumber string, initialReading, balance float64) *models.Customer {
+	t.Helper()
+
+	now := time.Now()
+	customer := &models.Customer{
+		ID:             primitive.NewObjectID(),
+		MeterNumber:    meterNumber,
+		AccountNumber:  "ACC-" + meterNumber,
+		FirstName:      "Test",
+		LastName:       "Customer",
+		PhoneNumber:    "+2547" + meterNumber[len(meterNumber)-8:],
+		Status:         "active",
+		InitialReading: initialReading,
+		LastReading:    initialReading,
+		Balance:        balance,
+		ConnectionDate: now.AddDate(-1, 0, 0),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	if _, err := db.Collection("customers").InsertOne(context.Background(), customer); err != nil {
+		t.Fatalf("insert customer %s: %v", meterNumber, err)
+	}
+	return customer
+}
+
+// waitForSMS waits up to a few seconds for the sender to have recorded n messages
+func waitForSMS(t *testing.T, sender *MockSender, n int) []SentSMS {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		sent := sender.Sent()
+		if len(sent) >= n || time.Now().After(deadline) {
+			return sent
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
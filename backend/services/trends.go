@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"waterbilling/backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MonthlyConsumption is one month of a meter's usage. Months without a reading are
+// returned with zero values and NoReading set so charts get a point for every month.
+type MonthlyConsumption struct {
+	Month       string  `json:"month"` // YYYY-MM
+	Consumption float64 `json:"consumption"`
+	Charge      float64 `json:"charge"` // Water and fixed charges for the month, without arrears
+	Readings    int     `json:"readings"`
+	Estimated   bool    `json:"estimated"` // At least one of the month's readings was estimated
+	NoReading   bool    `json:"no_reading"`
+}
+
+// GetConsumptionTrend returns a meter's consumption and charges per month for the last
+// months months, oldest first, including the current month
+func (bs *BillingService) GetConsumptionTrend(ctx context.Context, meterNumber string, months int) ([]MonthlyConsumption, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	start := trendStart(time.Now(), months)
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "meter_number", Value: meterNumber},
+			{Key: "reading_date", Value: bson.D{{Key: "$gte", Value: start}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+				{Key: "format", Value: "%Y-%m"},
+				{Key: "date", Value: "$reading_date"},
+			}}}},
+			{Key: "consumption", Value: bson.D{{Key: "$sum", Value: "$consumption"}}},
+			{Key: "charge", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$add", Value: bson.A{"$water_charge", "$fixed_charge"}}}}}},
+			{Key: "readings", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "estimated_readings", Value: bson.D{{Key: "$sum", Value: bson.D{
+				{Key: "$cond", Value: bson.A{bson.D{{Key: "$eq", Value: bson.A{"$reading_type", "estimated"}}}, 1, 0}},
+			}}}},
+		}}},
+	}
+
+	cursor, err := bs.readingsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating consumption trend: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Month             string  `bson:"_id"`
+		Consumption       float64 `bson:"consumption"`
+		Charge            float64 `bson:"charge"`
+		Readings          int     `bson:"readings"`
+		EstimatedReadings int     `bson:"estimated_readings"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding consumption trend: %v", err)
+	}
+
+	byMonth := make(map[string]MonthlyConsumption, len(rows))
+	for _, row := range rows {
+		byMonth[row.Month] = MonthlyConsumption{
+			Month:       row.Month,
+			Consumption: utils.RoundToTwoDecimal(row.Consumption),
+			Charge:      utils.RoundToTwoDecimal(row.Charge),
+			Readings:    row.Readings,
+			Estimated:   row.EstimatedReadings > 0,
+		}
+	}
+
+	trend := make([]MonthlyConsumption, 0, months)
+	for _, month := range trendMonths(start, months) {
+		point, ok := byMonth[month]
+		if !ok {
+			point = MonthlyConsumption{Month: month, NoReading: true}
+		}
+		trend = append(trend, point)
+	}
+
+	return trend, nil
+}
+
+// trendStart is the first instant of the oldest month in a trend of months months ending with
+// the month of now. Months are calendar months in UTC, matching $dateToString.
+func trendStart(now time.Time, months int) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()-time.Month(months-1), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// trendMonths lists the YYYY-MM keys of months months starting at start
+func trendMonths(start time.Time, months int) []string {
+	keys := make([]string, months)
+	for i := range keys {
+		keys[i] = start.AddDate(0, i, 0).Format("2006-01")
+	}
+	return keys
+}
+
+// MonthlyRevenue is the amount billed and collected in one month. Months without bills or
+// payments are returned as zero points.
+type MonthlyRevenue struct {
+	Month          string  `json:"month"`           // YYYY-MM
+	Billed         float64 `json:"billed"`          // Charges on bills dated in the month; arrears are not part of a bill's total
+	Collected      float64 `json:"collected"`       // Payments received in the month, excluding refunded and failed ones
+	CollectionRate float64 `json:"collection_rate"` // Collected as a percentage of billed
+}
+
+// GetRevenueTrend returns billed and collected amounts per month for the last months months,
+// oldest first, including the current month
+func (bs *BillingService) GetRevenueTrend(ctx context.Context, months int) ([]MonthlyRevenue, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	start := trendStart(time.Now(), months)
+
+	billed, err := bs.sumByMonth(ctx, bs.billsCollection, bson.D{
+		{Key: "bill_date", Value: bson.D{{Key: "$gte", Value: start}}},
+	}, "$bill_date", "$total_amount")
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating billed revenue: %v", err)
+	}
+
+	collected, err := bs.sumByMonth(ctx, bs.paymentsCollection, bson.D{
+		{Key: "payment_date", Value: bson.D{{Key: "$gte", Value: start}}},
+		{Key: "status", Value: bson.D{{Key: "$nin", Value: bson.A{"refunded", "failed"}}}},
+	}, "$payment_date", "$amount")
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating collections: %v", err)
+	}
+
+	trend := make([]MonthlyRevenue, 0, months)
+	for _, month := range trendMonths(start, months) {
+		point := MonthlyRevenue{
+			Month:     month,
+			Billed:    utils.RoundToTwoDecimal(billed[month]),
+			Collected: utils.RoundToTwoDecimal(collected[month]),
+		}
+		if point.Billed > 0 {
+			point.CollectionRate = utils.RoundToTwoDecimal(point.Collected / point.Billed * 100)
+		}
+		trend = append(trend, point)
+	}
+
+	return trend, nil
+}
+
+// sumByMonth sums value over the documents matching filter, keyed by the YYYY-MM of dateField
+func (bs *BillingService) sumByMonth(ctx context.Context, collection Collection, filter bson.D,
+	dateField string, value interface{}) (map[string]float64, error) {
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$dateToString", Value: bson.D{
+				{Key: "format", Value: "%Y-%m"},
+				{Key: "date", Value: dateField},
+			}}}},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: value}}},
+		}}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Month string  `bson:"_id"`
+		Total float64 `bson:"total"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		totals[row.Month] = row.Total
+	}
+	return totals, nil
+}
+
+// agingBuckets are the receivables aging buckets, youngest first
+var agingBuckets = []string{"current", "1-30", "31-60", "61-90", "90+"}
+
+// AgingBucket is the outstanding balance on bills of one age range
+type AgingBucket struct {
+	Bucket string  `bson:"_id" json:"bucket"`
+	Amount float64 `bson:"amount" json:"amount"`
+	Bills  int64   `bson:"bills" json:"bills"`
+}
+
+// AgingReport buckets outstanding bill balances by days past their due date
+type AgingReport struct {
+	AsOf        time.Time     `json:"as_of"`
+	Buckets     []AgingBucket `json:"buckets"`
+	TotalAmount float64       `json:"total_amount"`
+	TotalBills  int64         `json:"total_bills"`
+}
+
+// GetReceivablesAging buckets the current balance of every unpaid bill by how many days past
+// due it is at asOf. Bills not yet due are "current".
+func (bs *BillingService) GetReceivablesAging(ctx context.Context, asOf time.Time) (*AgingReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	daysPastDue := bson.D{{Key: "$divide", Value: bson.A{
+		bson.D{{Key: "$subtract", Value: bson.A{asOf, "$due_date"}}},
+		int64(24 * time.Hour / time.Millisecond),
+	}}}
+	bucketUpTo := func(days int, bucket string) bson.D {
+		return bson.D{
+			{Key: "case", Value: bson.D{{Key: "$lte", Value: bson.A{"$days_past_due", days}}}},
+			{Key: "then", Value: bucket},
+		}
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{"pending", "partially_paid", "overdue"}}}},
+			{Key: "balance", Value: bson.D{{Key: "$gt", Value: 0}}},
+			{Key: "bill_date", Value: bson.D{{Key: "$lte", Value: asOf}}},
+		}}},
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "days_past_due", Value: daysPastDue}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$switch", Value: bson.D{
+				{Key: "branches", Value: bson.A{
+					bucketUpTo(0, "current"),
+					bucketUpTo(30, "1-30"),
+					bucketUpTo(60, "31-60"),
+					bucketUpTo(90, "61-90"),
+				}},
+				{Key: "default", Value: "90+"},
+			}}}},
+			{Key: "amount", Value: bson.D{{Key: "$sum", Value: "$balance"}}},
+			{Key: "bills", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	cursor, err := bs.billsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating receivables aging: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []AgingBucket
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding receivables aging: %v", err)
+	}
+
+	byBucket := make(map[string]AgingBucket, len(rows))
+	for _, row := range rows {
+		byBucket[row.Bucket] = row
+	}
+
+	report := &AgingReport{AsOf: asOf, Buckets: make([]AgingBucket, 0, len(agingBuckets))}
+	for _, name := range agingBuckets {
+		bucket := byBucket[name]
+		bucket.Bucket = name
+		bucket.Amount = utils.RoundToTwoDecimal(bucket.Amount)
+
+		report.Buckets = append(report.Buckets, bucket)
+		report.TotalAmount += bucket.Amount
+		report.TotalBills += bucket.Bills
+	}
+	report.TotalAmount = utils.RoundToTwoDecimal(report.TotalAmount)
+
+	return report, nil
+}
+
+// maxConsumptionBands caps how many bands a distribution has. Readings above the last band
+// boundary are counted in one open-ended top band.
+const maxConsumptionBands = 50
+
+// ConsumptionBand is the readings of one period whose consumption falls in [Min, Max)
+type ConsumptionBand struct {
+	Label       string  `json:"label"` // e.g. "5-10", or "250+" for an open-ended top band
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max,omitempty"` // Unset for an open-ended top band
+	Customers   int64   `json:"customers"`
+	Readings    int64   `json:"readings"`
+	Consumption float64 `json:"consumption"`  // Units billed
+	WaterCharge float64 `json:"water_charge"` // Consumption charges billed, without fixed charges
+}
+
+// GetConsumptionDistribution buckets the readings taken in period's month by consumption into
+// bands bandSize units wide, from zero up to the highest consumption. Every band is returned,
+// including empty ones, so the histogram has no gaps.
+func (bs *BillingService) GetConsumptionDistribution(ctx context.Context, period time.Time, bandSize float64) ([]ConsumptionBand, error) {
+	if bandSize <= 0 {
+		return nil, fmt.Errorf("band size must be greater than zero")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	match := bson.D{
+		{Key: "month", Value: period.Format("2006-01")},
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: "cancelled"}}},
+		{Key: "consumption", Value: bson.D{{Key: "$gte", Value: 0}}},
+	}
+
+	var highest struct {
+		Consumption float64 `bson:"consumption"`
+	}
+	err := bs.readingsCollection.FindOne(ctx, match, options.FindOne().
+		SetSort(bson.D{{Key: "consumption", Value: -1}}).
+		SetProjection(bson.D{{Key: "consumption", Value: 1}})).Decode(&highest)
+	if err == mongo.ErrNoDocuments {
+		return []ConsumptionBand{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching highest consumption: %v", err)
+	}
+
+	bands, boundaries, openEnded := consumptionBands(bandSize, highest.Consumption)
+
+	bucket := bson.D{
+		{Key: "groupBy", Value: "$consumption"},
+		{Key: "boundaries", Value: boundaries},
+		{Key: "output", Value: bson.D{
+			{Key: "customers", Value: bson.D{{Key: "$addToSet", Value: "$customer_id"}}},
+			{Key: "readings", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "consumption", Value: bson.D{{Key: "$sum", Value: "$consumption"}}},
+			{Key: "water_charge", Value: bson.D{{Key: "$sum", Value: "$water_charge"}}},
+		}},
+	}
+	if openEnded {
+		bucket = append(bucket, bson.E{Key: "default", Value: boundaries[len(boundaries)-1]})
+	}
+
+	cursor, err := bs.readingsCollection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$match", Value: match}},
+		bson.D{{Key: "$bucket", Value: bucket}},
+		bson.D{{Key: "$addFields", Value: bson.D{{Key: "customers", Value: bson.D{{Key: "$size", Value: "$customers"}}}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating consumption distribution: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Min         float64 `bson:"_id"`
+		Customers   int64   `bson:"customers"`
+		Readings    int64   `bson:"readings"`
+		Consumption float64 `bson:"consumption"`
+		WaterCharge float64 `bson:"water_charge"`
+	}
+	if err = cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("error decoding consumption distribution: %v", err)
+	}
+
+	for _, row := range rows {
+		i := int(row.Min/bandSize + 0.5)
+		if i >= len(bands) {
+			continue
+		}
+		bands[i].Customers = row.Customers
+		bands[i].Readings = row.Readings
+		bands[i].Consumption = utils.RoundToTwoDecimal(row.Consumption)
+		bands[i].WaterCharge = utils.RoundToTwoDecimal(row.WaterCharge)
+	}
+
+	return bands, nil
+}
+
+// consumptionBands lays out empty bands bandSize wide covering 0 to highest, with the $bucket
+// boundaries for them. Past maxConsumptionBands the last band is open-ended, and the final
+// boundary doubles as its $bucket default id.
+func consumptionBands(bandSize, highest float64) ([]ConsumptionBand, []float64, bool) {
+	count := int(highest/bandSize) + 1
+	openEnded := count > maxConsumptionBands
+	if openEnded {
+		count = maxConsumptionBands
+	}
+
+	closed := count
+	if openEnded {
+		closed = count - 1
+	}
+
+	bands := make([]ConsumptionBand, count)
+	boundaries := make([]float64, closed+1)
+	for i := range boundaries {
+		boundaries[i] = float64(i) * bandSize
+	}
+	for i := 0; i < closed; i++ {
+		bands[i] = ConsumptionBand{
+			Label: fmt.Sprintf("%g-%g", boundaries[i], boundaries[i+1]),
+			Min:   boundaries[i],
+			Max:   boundaries[i+1],
+		}
+	}
+	if openEnded {
+		bands[closed] = ConsumptionBand{
+			Label: fmt.Sprintf("%g+", boundaries[closed]),
+			Min:   boundaries[closed],
+		}
+	}
+
+	return bands, boundaries, openEnded
+}
@@ -2,10 +2,16 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"waterbilling/backend/models"
+	"waterbilling/backend/utils"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,20 +21,20 @@ import (
 )
 
 type UserService struct {
-	collection      *mongo.Collection // ✅ THIS MUST BE HERE
-	usersCollection *mongo.Collection
+	collection      Collection // ✅ THIS MUST BE HERE
+	usersCollection Collection
 }
 
 func NewUserService(collection *mongo.Collection) *UserService {
 	return &UserService{
-		collection:      collection, // ✅ Initialize the collection
-		usersCollection: collection,
+		collection:      wrapCollection(collection), // ✅ Initialize the collection
+		usersCollection: wrapCollection(collection),
 	}
 }
 
 // GetUserByUsername retrieves a user by username
-func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var user models.User
@@ -45,8 +51,8 @@ func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
 }
 
 // GetUserByEmail retrieves a user by email
-func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var user models.User
@@ -63,8 +69,8 @@ func (s *UserService) GetUserByEmail(email string) (*models.User, error) {
 }
 
 // GetUserByID retrieves a user by ID
-func (s *UserService) GetUserByID(id string) (*models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -87,18 +93,18 @@ func (s *UserService) GetUserByID(id string) (*models.User, error) {
 
 // CreateUser creates a new user
 // CreateUser creates a new user
-func (s *UserService) CreateUser(user *models.User, password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) CreateUser(ctx context.Context, user *models.User, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Check if username already exists
-	existingUser, _ := s.GetUserByUsername(user.Username)
+	existingUser, _ := s.GetUserByUsername(ctx, user.Username)
 	if existingUser != nil {
 		return fmt.Errorf("user with username %s already exists", user.Username)
 	}
 
 	// Check if email already exists
-	existingEmail, _ := s.GetUserByEmail(user.Email)
+	existingEmail, _ := s.GetUserByEmail(ctx, user.Email)
 	if existingEmail != nil {
 		return fmt.Errorf("user with email %s already exists", user.Email)
 	}
@@ -109,10 +115,12 @@ func (s *UserService) CreateUser(user *models.User, password string) error {
 		return fmt.Errorf("error hashing password: %v", err)
 	}
 
+	now := time.Now()
 	user.Password = string(hashedPassword)
+	user.PasswordChangedAt = &now
 	user.ID = primitive.NewObjectID()
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
 
 	// Set default values for new fields if needed
 	if user.MeterNumber == "" {
@@ -120,6 +128,15 @@ func (s *UserService) CreateUser(user *models.User, password string) error {
 	}
 
 	_, err = s.collection.InsertOne(ctx, user)
+	if field, ok := utils.IsDuplicateKeyError(err); ok {
+		switch field {
+		case "username":
+			return fmt.Errorf("user with username %s already exists", user.Username)
+		case "email":
+			return fmt.Errorf("user with email %s already exists", user.Email)
+		}
+		return fmt.Errorf("user with this %s already exists", field)
+	}
 	if err != nil {
 		return fmt.Errorf("error creating user: %v", err)
 	}
@@ -128,8 +145,8 @@ func (s *UserService) CreateUser(user *models.User, password string) error {
 }
 
 // UpdateUser updates a user
-func (s *UserService) UpdateUser(id string, updates map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) UpdateUser(ctx context.Context, id string, updates map[string]interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -154,8 +171,8 @@ func (s *UserService) UpdateUser(id string, updates map[string]interface{}) erro
 }
 
 // UpdateLastLogin updates user's last login timestamp
-func (s *UserService) UpdateLastLogin(userID string, lastLogin time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) UpdateLastLogin(ctx context.Context, userID string, lastLogin time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(userID)
@@ -174,9 +191,70 @@ func (s *UserService) UpdateLastLogin(userID string, lastLogin time.Time) error
 	return err
 }
 
+// PasswordMaxAge returns how long a password stays valid before the user is prompted to rotate it,
+// from PASSWORD_MAX_AGE_DAYS (default 90)
+func PasswordMaxAge() time.Duration {
+	days := 90
+	if v, err := strconv.Atoi(os.Getenv("PASSWORD_MAX_AGE_DAYS")); err == nil && v > 0 {
+		days = v
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// loginLockoutPolicy returns how many failed logins lock an account and for how long,
+// from LOGIN_MAX_ATTEMPTS (default 5) and LOGIN_LOCKOUT_MINUTES (default 15)
+func loginLockoutPolicy() (int, time.Duration) {
+	maxAttempts := 5
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS")); err == nil && v > 0 {
+		maxAttempts = v
+	}
+
+	lockout := 15 * time.Minute
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_MINUTES")); err == nil && v > 0 {
+		lockout = time.Duration(v) * time.Minute
+	}
+
+	return maxAttempts, lockout
+}
+
+// RecordFailedLogin counts a failed login and locks the account once the threshold is reached.
+// It returns the lock expiry if this attempt locked the account, or nil otherwise.
+func (s *UserService) RecordFailedLogin(ctx context.Context, userID primitive.ObjectID) (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	maxAttempts, lockout := loginLockoutPolicy()
+
+	var user models.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"failed_login_attempts": 1}}, opts).Decode(&user)
+	if err != nil {
+		return nil, fmt.Errorf("error recording failed login: %v", err)
+	}
+
+	if user.FailedLogins < maxAttempts {
+		return nil, nil
+	}
+
+	lockedUntil := time.Now().Add(lockout)
+	update := bson.M{
+		"$set": bson.M{
+			"failed_login_attempts": 0,
+			"locked_until":          lockedUntil,
+			"updated_at":            time.Now(),
+		},
+	}
+	if _, err := s.collection.UpdateByID(ctx, userID, update); err != nil {
+		return nil, fmt.Errorf("error locking account: %v", err)
+	}
+
+	return &lockedUntil, nil
+}
+
 // Authenticate authenticates a user
-func (s *UserService) Authenticate(username, password string) (*models.User, error) {
-	user, err := s.GetUserByUsername(username)
+func (s *UserService) Authenticate(ctx context.Context, username, password string) (*models.User, error) {
+	user, err := s.GetUserByUsername(ctx, username)
 	if err != nil {
 		return nil, fmt.Errorf("invalid credentials")
 	}
@@ -194,8 +272,8 @@ func (s *UserService) Authenticate(username, password string) (*models.User, err
 }
 
 // VerifyPassword verifies user's password
-func (s *UserService) VerifyPassword(userID string, password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) VerifyPassword(ctx context.Context, userID string, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(userID)
@@ -218,8 +296,18 @@ func (s *UserService) VerifyPassword(userID string, password string) error {
 }
 
 // ChangePassword changes user's password
-func (s *UserService) ChangePassword(userID string, newPassword string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) ChangePassword(ctx context.Context, userID string, newPassword string) error {
+	return s.setPassword(ctx, userID, newPassword, false)
+}
+
+// ResetPassword sets a password chosen by an admin and makes the user change it at their next
+// login. Any login lockout is cleared.
+func (s *UserService) ResetPassword(ctx context.Context, userID string, newPassword string) error {
+	return s.setPassword(ctx, userID, newPassword, true)
+}
+
+func (s *UserService) setPassword(ctx context.Context, userID, newPassword string, mustChange bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(userID)
@@ -234,9 +322,13 @@ func (s *UserService) ChangePassword(userID string, newPassword string) error {
 
 	update := bson.M{
 		"$set": bson.M{
-			"password":   string(hashedPassword),
-			"updated_at": time.Now(),
+			"password":              string(hashedPassword),
+			"password_changed_at":   time.Now(),
+			"must_change_password":  mustChange,
+			"failed_login_attempts": 0,
+			"updated_at":            time.Now(),
 		},
+		"$unset": bson.M{"locked_until": ""},
 	}
 
 	result, err := s.collection.UpdateByID(ctx, objectID, update)
@@ -251,16 +343,63 @@ func (s *UserService) ChangePassword(userID string, newPassword string) error {
 	return nil
 }
 
-// ListUsers retrieves all users with pagination
-func (s *UserService) ListUsers(filter bson.M, page, limit int64) ([]models.User, int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// temporaryPasswordClasses are the character sets a temporary password draws from, one of
+// each at least, so it meets the password policy. Look-alike characters are left out.
+var temporaryPasswordClasses = []string{
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"abcdefghijkmnopqrstuvwxyz",
+	"23456789",
+	"!@#$%*?",
+}
+
+// GenerateTemporaryPassword returns a random 12-character password that satisfies
+// utils.ValidatePassword, for an admin to hand to a user who must then change it
+func GenerateTemporaryPassword() (string, error) {
+	const length = 12
+
+	all := strings.Join(temporaryPasswordClasses, "")
+	password := make([]byte, length)
+	for i := range password {
+		set := all
+		if i < len(temporaryPasswordClasses) {
+			set = temporaryPasswordClasses[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = set[n.Int64()]
+	}
+
+	// Shuffle so the guaranteed characters are not always first
+	for i := length - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+// ListUsers retrieves users matching filter with pagination and sorting, newest first by
+// default. Password hashes are never loaded.
+func (s *UserService) ListUsers(ctx context.Context, filter bson.M, sort bson.D, page, limit int64) ([]models.User, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "created_at", Value: -1}}
+	}
+
 	skip := (page - 1) * limit
 	opts := options.Find().
 		SetSkip(skip).
 		SetLimit(limit).
-		SetSort(bson.M{"created_at": -1})
+		SetSort(sort).
+		SetProjection(bson.M{"password": 0})
 
 	cursor, err := s.collection.Find(ctx, filter, opts)
 	if err != nil {
@@ -282,8 +421,8 @@ func (s *UserService) ListUsers(filter bson.M, page, limit int64) ([]models.User
 }
 
 // DeleteUser deletes a user
-func (s *UserService) DeleteUser(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s *UserService) DeleteUser(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -303,19 +442,25 @@ func (s *UserService) DeleteUser(id string) error {
 	return nil
 }
 
-// ToggleUserStatus activates or deactivates a user
-func (us *UserService) ToggleUserStatus(id primitive.ObjectID, isActive bool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// SetActive activates or deactivates a user. Deactivated users cannot log in; revoking the
+// tokens they already hold is up to the caller.
+func (us *UserService) SetActive(ctx context.Context, id string, active bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid user ID format: %v", err)
+	}
+
 	update := bson.M{
 		"$set": bson.M{
-			"is_active":  isActive,
+			"is_active":  active,
 			"updated_at": time.Now(),
 		},
 	}
 
-	result, err := us.usersCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	result, err := us.usersCollection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
 	if err != nil {
 		return fmt.Errorf("failed to update user status: %v", err)
 	}
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"testing"
+
+	"waterbilling/backend/utils"
+)
+
+func TestGenerateTemporaryPasswordMeetsPolicy(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		password, err := GenerateTemporaryPassword()
+		if err != nil {
+			t.Fatalf("GenerateTemporaryPassword: %v", err)
+		}
+		if err := utils.ValidatePassword(password); err != nil {
+			t.Errorf("%q fails the password policy: %v", password, err)
+		}
+		seen[password] = true
+	}
+	if len(seen) < 50 {
+		t.Errorf("only %d distinct passwords out of 50", len(seen))
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKeyFields names the field behind each unique index, for messages shown to users
+var duplicateKeyFields = map[string]string{
+	"meter_number_unique":     "meter number",
+	"account_number_unique":   "account number",
+	"phone_number_unique":     "phone number",
+	"username_unique":         "username",
+	"email_unique":            "email",
+	"employee_id_unique":      "employee ID",
+	"transaction_id_unique":   "transaction ID",
+	"receipt_number_unique":   "receipt number",
+	"bill_number_unique":      "bill number",
+	"meter_month_year_unique": "monthly reading",
+	"tariff_code_unique":      "tariff code",
+}
+
+var duplicateIndexPattern = regexp.MustCompile(`index: (\S+)`)
+
+// IsDuplicateKeyError reports whether err is a unique index violation and, if so, which field
+// collided, such as "phone number". Unknown indexes fall back to the first key in the index.
+func IsDuplicateKeyError(err error) (string, bool) {
+	if !mongo.IsDuplicateKeyError(err) {
+		return "", false
+	}
+
+	var message string
+	var raw bson.Raw
+
+	var we mongo.WriteException
+	var bwe mongo.BulkWriteException
+	var ce mongo.CommandError
+	switch {
+	case errors.As(err, &we) && len(we.WriteErrors) > 0:
+		message, raw = we.WriteErrors[0].Message, we.WriteErrors[0].Raw
+	case errors.As(err, &bwe) && len(bwe.WriteErrors) > 0:
+		message, raw = bwe.WriteErrors[0].Message, bwe.WriteErrors[0].Raw
+	case errors.As(err, &ce):
+		message, raw = ce.Message, ce.Raw
+	default:
+		message = err.Error()
+	}
+
+	if match := duplicateIndexPattern.FindStringSubmatch(message); match != nil {
+		if field, ok := duplicateKeyFields[match[1]]; ok {
+			return field, true
+		}
+	}
+
+	if keyPattern, ok := raw.Lookup("keyPattern").DocumentOK(); ok {
+		if elements, err := keyPattern.Elements(); err == nil && len(elements) > 0 {
+			return strings.ReplaceAll(elements[0].Key(), "_", " "), true
+		}
+	}
+
+	return "value", true
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsDuplicateKeyError(t *testing.T) {
+	writeErr := func(code int, message string, raw bson.Raw) error {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: code, Message: message, Raw: raw}}}
+	}
+	keyPattern, _ := bson.Marshal(bson.M{"code": 11000, "keyPattern": bson.M{"national_id": 1}})
+
+	tests := []struct {
+		name      string
+		err       error
+		wantField string
+		wantOK    bool
+	}{
+		{"known index", writeErr(11000, `E11000 duplicate key error collection: water.customers index: phone_number_unique dup key: { phone_number: "+254712345678" }`, nil), "phone number", true},
+		{"compound index", writeErr(11000, `E11000 duplicate key error collection: water.meter_readings index: meter_month_year_unique dup key: { meter_number: "MTR001", month: "2026-03", year: 2026 }`, nil), "monthly reading", true},
+		{"unknown index uses key pattern", writeErr(11000, `E11000 duplicate key error collection: water.customers index: national_id_1`, keyPattern), "national id", true},
+		{"wrapped", fmt.Errorf("insert: %w", writeErr(11000, "E11000 duplicate key error index: email_unique", nil)), "email", true},
+		{"other write error", writeErr(121, "Document failed validation", nil), "", false},
+		{"not a mongo error", errors.New("boom"), "", false},
+		{"nil", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := IsDuplicateKeyError(tt.err)
+			if field != tt.wantField || ok != tt.wantOK {
+				t.Errorf("IsDuplicateKeyError = (%q, %v), want (%q, %v)", field, ok, tt.wantField, tt.wantOK)
+			}
+		})
+	}
+}
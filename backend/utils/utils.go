@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // GenerateBillNumber generates a unique bill number
@@ -32,27 +33,57 @@ func GenerateReceiptNumber() string {
 	return fmt.Sprintf("RCPT-%s-%s", timestamp, randomNum.String())
 }
 
-// FormatPhoneNumber formats phone number to E.164 format
-func FormatPhoneNumber(phone string) string {
+// FormatPhoneNumber normalises a Kenyan phone number to E.164 (+254XXXXXXXXX).
+// It accepts 0712345678, 712345678, 254712345678, +254712345678 and 2540712345678, ignoring
+// spaces and punctuation, and rejects anything that is not a 9-digit subscriber number.
+func FormatPhoneNumber(phone string) (string, error) {
 	// Remove any non-digit characters
-	phone = strings.Map(func(r rune) rune {
+	digits := strings.Map(func(r rune) rune {
 		if r >= '0' && r <= '9' {
 			return r
 		}
 		return -1
 	}, phone)
 
-	// If starts with 0, replace with country code
-	if strings.HasPrefix(phone, "0") {
-		phone = "254" + phone[1:]
+	var subscriber string
+	switch {
+	case len(digits) == 9 && digits[0] != '0':
+		subscriber = digits
+	case len(digits) == 10 && strings.HasPrefix(digits, "0"):
+		subscriber = digits[1:]
+	case len(digits) == 12 && strings.HasPrefix(digits, "254"):
+		subscriber = digits[3:]
+	case len(digits) == 13 && strings.HasPrefix(digits, "2540"):
+		subscriber = digits[4:]
+	default:
+		return "", fmt.Errorf("invalid phone number %q: expected a Kenyan number such as 0712345678", phone)
 	}
 
-	// If doesn't start with +, add it
-	if !strings.HasPrefix(phone, "+") {
-		phone = "+" + phone
+	if subscriber[0] == '0' {
+		return "", fmt.Errorf("invalid phone number %q: expected a Kenyan number such as 0712345678", phone)
 	}
 
-	return phone
+	return "+254" + subscriber, nil
+}
+
+// ValidatePhoneNumber checks that phone is a Kenyan mobile number in E.164 form:
+// +254 followed by nine digits starting with 7 or 1. Landlines and foreign numbers cannot
+// receive the SMS the system sends, so they are rejected.
+func ValidatePhoneNumber(phone string) error {
+	subscriber, ok := strings.CutPrefix(phone, "+254")
+	if !ok {
+		return fmt.Errorf("invalid phone number %q: must be a Kenyan number starting with +254", phone)
+	}
+
+	if len(subscriber) != 9 || strings.IndexFunc(subscriber, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return fmt.Errorf("invalid phone number %q: expected 9 digits after +254", phone)
+	}
+
+	if subscriber[0] != '7' && subscriber[0] != '1' {
+		return fmt.Errorf("invalid phone number %q: not a mobile number (must start with +2547 or +2541)", phone)
+	}
+
+	return nil
 }
 
 // ValidateMeterNumber validates meter number format
@@ -74,6 +105,17 @@ func ValidateMeterNumber(meterNumber string) bool {
 	return true
 }
 
+// ValidateCoordinates checks that a longitude and latitude are within range
+func ValidateCoordinates(lng, lat float64) error {
+	if lng < -180 || lng > 180 {
+		return fmt.Errorf("longitude %.6f must be between -180 and 180", lng)
+	}
+	if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude %.6f must be between -90 and 90", lat)
+	}
+	return nil
+}
+
 // CalculateConsumption calculates water consumption
 func CalculateConsumption(previous, current float64) (float64, error) {
 	if current < previous {
@@ -110,6 +152,51 @@ func RoundToTwoDecimal(value float64) float64 {
 	return rounded
 }
 
+// MinPasswordLength is the shortest password ValidatePassword accepts
+const MinPasswordLength = 8
+
+// ValidatePassword checks a password against the password policy: at least MinPasswordLength
+// characters with an upper-case letter, a lower-case letter, a digit and a symbol.
+// Any personal values given (username, email) must not appear in it, ignoring case.
+func ValidatePassword(password string, personal ...string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if !hasUpper || !hasLower || !hasDigit || !hasSymbol {
+		return fmt.Errorf("password must contain upper and lower case letters, a digit and a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		candidates := []string{value}
+		if at := strings.Index(value, "@"); at > 0 {
+			candidates = append(candidates, value[:at])
+		}
+		for _, candidate := range candidates {
+			if len(candidate) >= 3 && strings.Contains(lower, candidate) {
+				return fmt.Errorf("password must not contain your username or email")
+			}
+		}
+	}
+
+	return nil
+}
+
 // ParseDateString parses date string in various formats
 func ParseDateString(dateStr string) (time.Time, error) {
 	formats := []string{
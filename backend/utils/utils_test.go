@@ -0,0 +1,65 @@
+package utils
+
+import "testing"
+
+func TestFormatPhoneNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		phone   string
+		want    string
+		wantErr bool
+	}{
+		{"local with leading zero", "0712345678", "+254712345678", false},
+		{"local without leading zero", "712345678", "+254712345678", false},
+		{"country code", "254712345678", "+254712345678", false},
+		{"international", "+254712345678", "+254712345678", false},
+		{"country code with trunk zero", "2540712345678", "+254712345678", false},
+		{"newer 01 prefix", "0110123456", "+254110123456", false},
+		{"spaces and dashes", "0712 345-678", "+254712345678", false},
+		{"empty", "", "", true},
+		{"too short", "071234567", "", true},
+		{"too long", "07123456789", "", true},
+		{"other country code", "+447912345678", "", true},
+		{"double trunk zero", "00712345678", "", true},
+		{"zero subscriber prefix", "2540012345678", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatPhoneNumber(tt.phone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatPhoneNumber(%q) error = %v, wantErr %v", tt.phone, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FormatPhoneNumber(%q) = %q, want %q", tt.phone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePhoneNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		phone   string
+		wantErr bool
+	}{
+		{"safaricom mobile", "+254712345678", false},
+		{"newer 01 mobile", "+254110123456", false},
+		{"nairobi landline", "+254201234567", true},
+		{"mombasa landline", "+254412345678", true},
+		{"too short", "+25471234567", true},
+		{"too long", "+2547123456789", true},
+		{"non-Kenyan", "+447912345678", true},
+		{"not formatted", "0712345678", true},
+		{"letters", "+25471234567a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePhoneNumber(tt.phone)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePhoneNumber(%q) error = %v, wantErr %v", tt.phone, err, tt.wantErr)
+			}
+		})
+	}
+}
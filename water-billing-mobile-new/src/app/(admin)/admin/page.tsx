@@ -37,7 +37,7 @@ function AdminDashboard() {
       // Fetch unpaid bills
       const unpaidBills = await dashboardApi.getUnpaidBills();
       if (unpaidBills.success) {
-        const bills = unpaidBills.data || [];
+        const bills = unpaidBills.data?.bills || [];
         const pending = bills.filter((b: any) => b.status === 'pending');
         const overdue = bills.filter((b: any) => b.status === 'overdue');
         
@@ -36,6 +36,7 @@ interface Bill {
   due_date: string;
   issue_date?: string;
   consumption: number;
+  unit?: string;
   previous_reading?: number;
   current_reading?: number;
   rate_per_unit?: number;
@@ -260,7 +261,7 @@ function BillDetailsContent() {
           <div className="space-y-3">
             <div>
               <p className="text-sm text-gray-500">Consumption</p>
-              <p className="font-medium">{bill.consumption} m³</p>
+              <p className="font-medium">{bill.consumption} {bill.unit || 'm³'}</p>
             </div>
             {bill.previous_reading && (
               <div>
@@ -276,7 +277,7 @@ function BillDetailsContent() {
             )}
             {bill.rate_per_unit && (
               <div>
-                <p className="text-sm text-gray-500">Rate per m³</p>
+                <p className="text-sm text-gray-500">Rate per {bill.unit || 'm³'}</p>
                 <p>KSh {bill.rate_per_unit.toLocaleString()}</p>
               </div>
             )}
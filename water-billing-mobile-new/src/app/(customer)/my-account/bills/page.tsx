@@ -25,6 +25,7 @@ interface Bill {
   status: string;
   due_date: string;
   consumption: number;
+  unit?: string;
 }
 
 function CustomerBills() {
@@ -142,7 +143,7 @@ function CustomerBills() {
                   <tr key={bill.id} className="hover:bg-gray-50">
                     <td className="px-6 py-4 text-sm font-mono">{bill.bill_number}</td>
                     <td className="px-6 py-4 text-sm">{bill.billing_period}</td>
-                    <td className="px-6 py-4 text-sm">{bill.consumption.toFixed(1)} m³</td>
+                    <td className="px-6 py-4 text-sm">{bill.consumption.toFixed(1)} {bill.unit || 'm³'}</td>
                     <td className="px-6 py-4 text-sm">KSh {bill.total_amount.toLocaleString()}</td>
                     <td className="px-6 py-4 text-sm">KSh {bill.amount_paid.toLocaleString()}</td>
                     <td className="px-6 py-4 text-sm font-medium">